@@ -0,0 +1,122 @@
+package alertingtest_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/avilikof/go-shared-libs/alerting"
+	"github.com/avilikof/go-shared-libs/alerting/alertingtest"
+	"github.com/avilikof/go-shared-libs/alerts"
+	"github.com/avilikof/go-shared-libs/event"
+)
+
+func TestStorage_TTL(t *testing.T) {
+	clock := alertingtest.NewFakeClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	storage := alertingtest.NewStorage(clock)
+
+	if err := storage.Set("short", []byte("1"), time.Minute); err != nil {
+		t.Fatalf("Set() error = %v", err)
+	}
+	if err := storage.Set("forever", []byte("2"), 0); err != nil {
+		t.Fatalf("Set() error = %v", err)
+	}
+
+	clock.Advance(59 * time.Second)
+	if _, err := storage.Get("short"); err != nil {
+		t.Errorf("Get() before expiry error = %v", err)
+	}
+
+	clock.Advance(time.Second)
+	if _, err := storage.Get("short"); !errors.Is(err, alerting.ErrNotFound) {
+		t.Errorf("Get() after expiry error = %v; want ErrNotFound", err)
+	}
+	if keys := storage.Keys(); len(keys) != 1 || keys[0] != "forever" {
+		t.Errorf("Keys() = %v; want [forever]", keys)
+	}
+}
+
+func TestSubjectMatches(t *testing.T) {
+	tests := []struct {
+		pattern, subject string
+		expected         bool
+	}{
+		{"alert.event", "alert.event", true},
+		{"alert.*", "alert.event", true},
+		{"alert.*", "alert.event.extra", false},
+		{"alert.>", "alert.event.extra", true},
+		{"alert.>", "alert", false},
+		{"*.event", "alert.store", false},
+	}
+	for _, tt := range tests {
+		if got := alertingtest.SubjectMatches(tt.pattern, tt.subject); got != tt.expected {
+			t.Errorf("SubjectMatches(%q, %q) = %v; want %v", tt.pattern, tt.subject, got, tt.expected)
+		}
+	}
+}
+
+func TestStream_SubscribeWildcard(t *testing.T) {
+	stream := alertingtest.NewStream()
+	defer stream.Close()
+
+	received := make(chan []byte)
+	if _, err := stream.Subscribe("alert.>", received); err != nil {
+		t.Fatalf("Subscribe() error = %v", err)
+	}
+	if _, err := stream.Subscribe("alert.>.x", received); !errors.Is(err, alertingtest.ErrInvalidSubject) {
+		t.Errorf("Subscribe() with misplaced '>' error = %v; want ErrInvalidSubject", err)
+	}
+
+	for _, subject := range []string{"alert.store", "other.topic", "alert.event"} {
+		if err := stream.Publish(subject, []byte(subject)); err != nil {
+			t.Fatalf("Publish() error = %v", err)
+		}
+	}
+	for _, want := range []string{"alert.store", "alert.event"} {
+		select {
+		case got := <-received:
+			if string(got) != want {
+				t.Errorf("received %q; want %q", got, want)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("timed out waiting for %s", want)
+		}
+	}
+
+	stream.Close()
+	if err := stream.Publish("alert.store", nil); !errors.Is(err, alerting.ErrClosed) {
+		t.Errorf("Publish() after Close error = %v; want ErrClosed", err)
+	}
+}
+
+func TestProcessorV2_FiresAndResolves(t *testing.T) {
+	storage := alertingtest.NewStorage(nil)
+	stream := alertingtest.NewStream()
+	defer stream.Close()
+	stream.Persist(storage, 0)
+
+	input := make(chan *alerts.AlertV2)
+	processor := alerting.NewProcessorV2(input, storage, stream)
+	done := make(chan struct{})
+	go func() {
+		processor.ProcessV2()
+		close(done)
+	}()
+
+	input <- alerts.NewAlertV2("a1", "test", "critical", "cpu_high", "cpu", "a1", time.Now(), alerts.AlertStateActive)
+	input <- alerts.NewAlertV2("a1", "test", "critical", "cpu_high", "cpu", "a1", time.Now(), alerts.AlertStateResolved)
+	close(input)
+	<-done
+
+	alertingtest.ExpectEvent(t, stream, event.ActionFiring, "a1")
+	alertingtest.ExpectEvent(t, stream, event.ActionResolved, "a1")
+	alertingtest.ExpectNoEvent(t, stream, event.ActionError, "a1")
+
+	stored, err := alerts.AlertV2FromBytes(alertingtest.ExpectStored(t, stream, "a1"))
+	if err != nil {
+		t.Fatalf("AlertV2FromBytes() error = %v", err)
+	}
+	if stored.IsFiring() {
+		t.Error("expected the stored alert to be resolved")
+	}
+}
@@ -0,0 +1,115 @@
+package alertingtest
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/avilikof/go-shared-libs/alerting"
+	"github.com/avilikof/go-shared-libs/event"
+)
+
+// Events decodes the events published on alerting.EvetTopic, oldest first.
+func Events(stream *Stream) []*event.Event {
+	var events []*event.Event
+	for _, msg := range stream.Messages(alerting.EvetTopic) {
+		ev, err := event.FromBytes(msg.Data)
+		if err != nil {
+			continue
+		}
+		events = append(events, ev)
+	}
+	return events
+}
+
+// FindEvent returns the first event with action published for alertID.
+func FindEvent(stream *Stream, action event.Action, alertID string) (*event.Event, bool) {
+	for _, ev := range Events(stream) {
+		if ev.Action == action && ev.Message["alert_id"] == alertID {
+			return ev, true
+		}
+	}
+	return nil, false
+}
+
+// ExpectEvent fails the test unless an event with action was published for
+// alertID.
+func ExpectEvent(t testing.TB, stream *Stream, action event.Action, alertID string) *event.Event {
+	t.Helper()
+	ev, ok := FindEvent(stream, action, alertID)
+	if !ok {
+		t.Fatalf("expected %s event for alert %s, got %s", action, alertID, describeEvents(stream))
+	}
+	return ev
+}
+
+// ExpectNoEvent fails the test if an event with action was published for
+// alertID.
+func ExpectNoEvent(t testing.TB, stream *Stream, action event.Action, alertID string) {
+	t.Helper()
+	if _, ok := FindEvent(stream, action, alertID); ok {
+		t.Fatalf("expected no %s event for alert %s, got %s", action, alertID, describeEvents(stream))
+	}
+}
+
+// WaitForEvent polls until an event with action is published for alertID and
+// fails the test after timeout. Use it with processors running in goroutines.
+func WaitForEvent(t testing.TB, stream *Stream, action event.Action, alertID string, timeout time.Duration) *event.Event {
+	t.Helper()
+	deadline := time.Now().Add(timeout)
+	for {
+		if ev, ok := FindEvent(stream, action, alertID); ok {
+			return ev
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out after %s waiting for %s event for alert %s, got %s", timeout, action, alertID, describeEvents(stream))
+			return nil
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// ExpectStored fails the test unless an alert with alertID was published on
+// alerting.StorageTopic and returns the latest payload.
+func ExpectStored(t testing.TB, stream *Stream, alertID string) []byte {
+	t.Helper()
+	var latest []byte
+	for _, msg := range stream.Messages(alerting.StorageTopic) {
+		if id, err := payloadAlertID(msg.Data); err == nil && id == alertID {
+			latest = msg.Data
+		}
+	}
+	if latest == nil {
+		t.Fatalf("expected alert %s to be stored", alertID)
+	}
+	return latest
+}
+
+func describeEvents(stream *Stream) string {
+	events := Events(stream)
+	if len(events) == 0 {
+		return "no events"
+	}
+	descriptions := make([]string, 0, len(events))
+	for _, ev := range events {
+		descriptions = append(descriptions, fmt.Sprintf("%s(%v)", ev.Action, ev.Message["alert_id"]))
+	}
+	return strings.Join(descriptions, ", ")
+}
+
+// payloadAlertID extracts the ID of a v1 or v2 alert payload.
+func payloadAlertID(data []byte) (string, error) {
+	var alert struct {
+		ID string `json:"id"`
+	}
+	if err := json.Unmarshal(data, &alert); err != nil {
+		return "", err
+	}
+	if alert.ID == "" {
+		return "", errors.New("alert without id")
+	}
+	return alert.ID, nil
+}
@@ -0,0 +1,415 @@
+package alertingtest
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/avilikof/go-shared-libs/alerting"
+)
+
+// StorageSuite describes an alerting.Storage implementation for
+// RunStorageSuite.
+type StorageSuite struct {
+	// New returns the Storage under test. Keys used by the suite are unique
+	// per run, so a shared backend does not need to be emptied.
+	New func(t *testing.T) alerting.Storage
+	// Wait lets d pass for the storage. Defaults to time.Sleep; storages on a
+	// FakeClock advance the clock instead.
+	Wait func(d time.Duration)
+	// TTL is the expiration used by the expiry check. Defaults to one second.
+	TTL time.Duration
+	// SkipTTL skips the expiry check for storages without per-key expiration.
+	SkipTTL bool
+}
+
+// RunStorageSuite checks that a Storage honours the alerting.Storage contract:
+// not-found semantics, overwrites, TTL expiry, concurrent access and closing.
+func RunStorageSuite(t *testing.T, suite StorageSuite) {
+	if suite.Wait == nil {
+		suite.Wait = time.Sleep
+	}
+	if suite.TTL <= 0 {
+		suite.TTL = time.Second
+	}
+	prefix := fmt.Sprintf("conformance-%d-", time.Now().UnixNano())
+
+	t.Run("NotFound", func(t *testing.T) {
+		storage := suite.New(t)
+		_, err := storage.Get(prefix + "missing")
+		if !errors.Is(err, alerting.ErrNotFound) {
+			t.Fatalf("Get() of a missing key error = %v; want alerting.ErrNotFound", err)
+		}
+	})
+
+	t.Run("SetGet", func(t *testing.T) {
+		storage := suite.New(t)
+		key := prefix + "set-get"
+		value := []byte(`{"id":"set-get"}`)
+		if err := storage.Set(key, value, 0); err != nil {
+			t.Fatalf("Set() error = %v", err)
+		}
+		value[0] = 'X'
+
+		got, err := storage.Get(key)
+		if err != nil {
+			t.Fatalf("Get() error = %v", err)
+		}
+		if string(got) != `{"id":"set-get"}` {
+			t.Errorf("Get() = %q; want the value as it was when Set was called", got)
+		}
+	})
+
+	t.Run("Overwrite", func(t *testing.T) {
+		storage := suite.New(t)
+		key := prefix + "overwrite"
+		for _, value := range []string{"first", "second"} {
+			if err := storage.Set(key, []byte(value), 0); err != nil {
+				t.Fatalf("Set(%q) error = %v", value, err)
+			}
+		}
+		got, err := storage.Get(key)
+		if err != nil {
+			t.Fatalf("Get() error = %v", err)
+		}
+		if string(got) != "second" {
+			t.Errorf("Get() = %q; want the last value set", got)
+		}
+	})
+
+	t.Run("TTL", func(t *testing.T) {
+		if suite.SkipTTL {
+			t.Skip("storage does not support per-key expiration")
+		}
+		storage := suite.New(t)
+		expiring, permanent := prefix+"expiring", prefix+"permanent"
+		if err := storage.Set(expiring, []byte("expiring"), suite.TTL); err != nil {
+			t.Fatalf("Set() error = %v", err)
+		}
+		if err := storage.Set(permanent, []byte("permanent"), 0); err != nil {
+			t.Fatalf("Set() error = %v", err)
+		}
+		if _, err := storage.Get(expiring); err != nil {
+			t.Fatalf("Get() before expiry error = %v", err)
+		}
+
+		suite.Wait(suite.TTL + suite.TTL/2)
+		if _, err := storage.Get(expiring); !errors.Is(err, alerting.ErrNotFound) {
+			t.Errorf("Get() after expiry error = %v; want alerting.ErrNotFound", err)
+		}
+		if _, err := storage.Get(permanent); err != nil {
+			t.Errorf("Get() of a key without expiration error = %v", err)
+		}
+	})
+
+	t.Run("Concurrent", func(t *testing.T) {
+		storage := suite.New(t)
+		shared := prefix + "shared"
+		const workers, rounds = 8, 25
+
+		var wg sync.WaitGroup
+		errs := make(chan error, workers*rounds*3)
+		for w := 0; w < workers; w++ {
+			wg.Add(1)
+			go func(w int) {
+				defer wg.Done()
+				own := fmt.Sprintf("%sworker-%d", prefix, w)
+				for i := 0; i < rounds; i++ {
+					value := []byte(fmt.Sprintf("%d-%d", w, i))
+					errs <- storage.Set(own, value, 0)
+					errs <- storage.Set(shared, value, 0)
+					if _, err := storage.Get(shared); err != nil {
+						errs <- err
+					}
+				}
+			}(w)
+		}
+		wg.Wait()
+		close(errs)
+		for err := range errs {
+			if err != nil {
+				t.Fatalf("concurrent access error = %v", err)
+			}
+		}
+
+		for w := 0; w < workers; w++ {
+			got, err := storage.Get(fmt.Sprintf("%sworker-%d", prefix, w))
+			if err != nil {
+				t.Fatalf("Get() error = %v", err)
+			}
+			if want := fmt.Sprintf("%d-%d", w, rounds-1); string(got) != want {
+				t.Errorf("worker %d value = %q; want %q", w, got, want)
+			}
+		}
+	})
+
+	t.Run("Close", func(t *testing.T) {
+		storage := suite.New(t)
+		if !closeImplementation(t, storage) {
+			t.Skip("storage has no Close method")
+		}
+		if _, err := storage.Get(prefix + "closed"); !errors.Is(err, alerting.ErrClosed) {
+			t.Errorf("Get() after Close error = %v; want alerting.ErrClosed", err)
+		}
+		if err := storage.Set(prefix+"closed", []byte("x"), 0); !errors.Is(err, alerting.ErrClosed) {
+			t.Errorf("Set() after Close error = %v; want alerting.ErrClosed", err)
+		}
+	})
+}
+
+// StreamSuite describes an alerting.Stream implementation for RunStreamSuite.
+type StreamSuite struct {
+	// New returns the Stream under test.
+	New func(t *testing.T) alerting.Stream
+	// Topic is the topic used for publishing and subscribing. Defaults to
+	// "conformance.test"; JetStream backed streams need a topic bound to one
+	// of their streams.
+	Topic string
+	// Settle is how long to wait after subscribing before publishing, for
+	// transports where subscriptions are established asynchronously.
+	Settle time.Duration
+	// Timeout bounds how long the suite waits for deliveries. Defaults to five
+	// seconds.
+	Timeout time.Duration
+}
+
+// RunStreamSuite checks that a Stream honours the alerting.Stream contract:
+// every published message is delivered to every subscriber, concurrent
+// publishers are safe, subscriptions end on Unsubscribe and Drain, and Publish fails
+// with alerting.ErrClosed after Close. Streams implementing
+// alerting.MessageStream must also deliver headers. Payloads
+// are unique per run, so messages left over on durable transports are
+// ignored.
+func RunStreamSuite(t *testing.T, suite StreamSuite) {
+	if suite.Topic == "" {
+		suite.Topic = "conformance.test"
+	}
+	if suite.Timeout <= 0 {
+		suite.Timeout = 5 * time.Second
+	}
+	prefix := fmt.Sprintf("conformance-%d-", time.Now().UnixNano())
+
+	t.Run("Delivery", func(t *testing.T) {
+		stream := suite.New(t)
+		_, received := subscribe(t, stream, suite)
+
+		var want [][]byte
+		for i := 0; i < 10; i++ {
+			payload := []byte(fmt.Sprintf("%sdelivery-%d", prefix, i))
+			want = append(want, payload)
+			if err := stream.Publish(suite.Topic, payload); err != nil {
+				t.Fatalf("Publish() error = %v", err)
+			}
+		}
+		expectDelivered(t, received, want, []byte(prefix+"delivery-"), suite.Timeout)
+	})
+
+	t.Run("ConcurrentPublish", func(t *testing.T) {
+		stream := suite.New(t)
+		_, received := subscribe(t, stream, suite)
+
+		const workers, rounds = 4, 10
+		var wg sync.WaitGroup
+		var mu sync.Mutex
+		var want [][]byte
+		errs := make(chan error, workers*rounds)
+		for w := 0; w < workers; w++ {
+			wg.Add(1)
+			go func(w int) {
+				defer wg.Done()
+				for i := 0; i < rounds; i++ {
+					payload := []byte(fmt.Sprintf("%sconcurrent-%d-%d", prefix, w, i))
+					mu.Lock()
+					want = append(want, payload)
+					mu.Unlock()
+					errs <- stream.Publish(suite.Topic, payload)
+				}
+			}(w)
+		}
+		wg.Wait()
+		close(errs)
+		for err := range errs {
+			if err != nil {
+				t.Fatalf("concurrent Publish() error = %v", err)
+			}
+		}
+		expectDelivered(t, received, want, []byte(prefix+"concurrent-"), suite.Timeout)
+	})
+
+	t.Run("FanOut", func(t *testing.T) {
+		stream := suite.New(t)
+		_, first := subscribe(t, stream, suite)
+		_, second := subscribe(t, stream, suite)
+
+		var want [][]byte
+		for i := 0; i < 10; i++ {
+			payload := []byte(fmt.Sprintf("%sfan-out-%d", prefix, i))
+			want = append(want, payload)
+			if err := stream.Publish(suite.Topic, payload); err != nil {
+				t.Fatalf("Publish() error = %v", err)
+			}
+		}
+		expectDelivered(t, first, want, []byte(prefix+"fan-out-"), suite.Timeout)
+		expectDelivered(t, second, want, []byte(prefix+"fan-out-"), suite.Timeout)
+	})
+
+	t.Run("Headers", func(t *testing.T) {
+		stream, ok := suite.New(t).(alerting.MessageStream)
+		if !ok {
+			t.Skip("stream does not implement alerting.MessageStream")
+		}
+		received := make(chan *alerting.Message, 1024)
+		sub, err := stream.SubscribeMsg(suite.Topic, func(_ context.Context, msg *alerting.Message) error {
+			received <- msg
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("SubscribeMsg() error = %v", err)
+		}
+		t.Cleanup(func() { _ = sub.Unsubscribe() })
+		time.Sleep(suite.Settle)
+
+		payload := []byte(prefix + "headers")
+		err = stream.PublishMsg(context.Background(), &alerting.Message{
+			Subject: suite.Topic,
+			Data:    payload,
+			Header:  alerting.Header{alerting.HeaderContentType: "application/json", "X-Conformance": "yes"},
+		})
+		if err != nil {
+			t.Fatalf("PublishMsg() error = %v", err)
+		}
+		deadline := time.After(suite.Timeout)
+		for {
+			select {
+			case msg := <-received:
+				if !bytes.Equal(msg.Data, payload) {
+					continue
+				}
+				if msg.Header[alerting.HeaderContentType] != "application/json" || msg.Header["X-Conformance"] != "yes" {
+					t.Errorf("received headers %v; want the published ones", msg.Header)
+				}
+				return
+			case <-deadline:
+				t.Fatalf("message was not delivered within %s", suite.Timeout)
+			}
+		}
+	})
+
+	t.Run("Unsubscribe", func(t *testing.T) {
+		stream := suite.New(t)
+		sub, received := subscribe(t, stream, suite)
+		if err := sub.Unsubscribe(); err != nil {
+			t.Fatalf("Unsubscribe() error = %v", err)
+		}
+		expectDone(t, sub, suite.Timeout)
+
+		if err := stream.Publish(suite.Topic, []byte(prefix+"unsubscribed")); err != nil {
+			t.Fatalf("Publish() error = %v", err)
+		}
+		select {
+		case payload := <-received:
+			if bytes.HasPrefix(payload, []byte(prefix+"unsubscribed")) {
+				t.Errorf("received %q after Unsubscribe", payload)
+			}
+		case <-time.After(suite.Settle + 100*time.Millisecond):
+		}
+	})
+
+	t.Run("Drain", func(t *testing.T) {
+		stream := suite.New(t)
+		sub, received := subscribe(t, stream, suite)
+
+		var want [][]byte
+		for i := 0; i < 10; i++ {
+			payload := []byte(fmt.Sprintf("%sdrain-%d", prefix, i))
+			want = append(want, payload)
+			if err := stream.Publish(suite.Topic, payload); err != nil {
+				t.Fatalf("Publish() error = %v", err)
+			}
+		}
+		expectDelivered(t, received, want, []byte(prefix+"drain-"), suite.Timeout)
+		if err := sub.Drain(suite.Timeout); err != nil {
+			t.Fatalf("Drain() error = %v", err)
+		}
+		expectDone(t, sub, suite.Timeout)
+		if stats := sub.Stats(); stats.Delivered < uint64(len(want)) || stats.Pending != 0 {
+			t.Errorf("Stats() = %+v; want at least %d delivered and none pending", stats, len(want))
+		}
+	})
+
+	t.Run("Close", func(t *testing.T) {
+		stream := suite.New(t)
+		if !closeImplementation(t, stream) {
+			t.Skip("stream has no Close method")
+		}
+		if err := stream.Publish(suite.Topic, []byte(prefix+"closed")); !errors.Is(err, alerting.ErrClosed) {
+			t.Errorf("Publish() after Close error = %v; want alerting.ErrClosed", err)
+		}
+	})
+}
+
+// subscribe subscribes to the suite's topic and unsubscribes when the test
+// ends.
+func subscribe(t *testing.T, stream alerting.Stream, suite StreamSuite) (alerting.Subscription, <-chan []byte) {
+	t.Helper()
+	received := make(chan []byte, 1024)
+	sub, err := stream.Subscribe(suite.Topic, received)
+	if err != nil {
+		t.Fatalf("Subscribe() error = %v", err)
+	}
+	t.Cleanup(func() { _ = sub.Unsubscribe() })
+	time.Sleep(suite.Settle)
+	return sub, received
+}
+
+func expectDone(t *testing.T, sub alerting.Subscription, timeout time.Duration) {
+	t.Helper()
+	select {
+	case <-sub.Done():
+	case <-time.After(timeout):
+		t.Fatalf("Done() was not closed within %s", timeout)
+	}
+}
+
+// expectDelivered waits until every payload in want has been received at
+// least once, ignoring payloads without prefix.
+func expectDelivered(t *testing.T, received <-chan []byte, want [][]byte, prefix []byte, timeout time.Duration) {
+	t.Helper()
+	missing := make(map[string]bool, len(want))
+	for _, payload := range want {
+		missing[string(payload)] = true
+	}
+
+	deadline := time.After(timeout)
+	for len(missing) > 0 {
+		select {
+		case payload := <-received:
+			if bytes.HasPrefix(payload, prefix) {
+				delete(missing, string(payload))
+			}
+		case <-deadline:
+			t.Fatalf("%d of %d messages were not delivered within %s", len(missing), len(want), timeout)
+		}
+	}
+}
+
+// closeImplementation closes v if it has a Close method and reports whether
+// it did.
+func closeImplementation(t *testing.T, v any) bool {
+	t.Helper()
+	switch closer := v.(type) {
+	case interface{ Close() error }:
+		if err := closer.Close(); err != nil {
+			t.Fatalf("Close() error = %v", err)
+		}
+	case interface{ Close() }:
+		closer.Close()
+	default:
+		return false
+	}
+	return true
+}
@@ -0,0 +1,29 @@
+package alertingtest_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/avilikof/go-shared-libs/alerting"
+	"github.com/avilikof/go-shared-libs/alerting/alertingtest"
+)
+
+func TestStorageConformance(t *testing.T) {
+	clock := alertingtest.NewFakeClock(time.Now())
+	alertingtest.RunStorageSuite(t, alertingtest.StorageSuite{
+		New: func(t *testing.T) alerting.Storage {
+			return alertingtest.NewStorage(clock)
+		},
+		Wait: clock.Advance,
+	})
+}
+
+func TestStreamConformance(t *testing.T) {
+	alertingtest.RunStreamSuite(t, alertingtest.StreamSuite{
+		New: func(t *testing.T) alerting.Stream {
+			stream := alertingtest.NewStream()
+			t.Cleanup(stream.Close)
+			return stream
+		},
+	})
+}
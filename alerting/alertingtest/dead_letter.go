@@ -0,0 +1,93 @@
+package alertingtest
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+
+	"github.com/avilikof/go-shared-libs/alerting"
+)
+
+var _ alerting.DeadLetterQueue = (*DeadLetterQueue)(nil)
+
+// DeadLetterQueue is an in-memory alerting.DeadLetterQueue that re-drives
+// dead letters on a Stream.
+type DeadLetterQueue struct {
+	mu      sync.Mutex
+	stream  alerting.Stream
+	letters []alerting.DeadLetter
+	nextID  int
+}
+
+// NewDeadLetterQueue creates an empty DeadLetterQueue re-driving on stream.
+func NewDeadLetterQueue(stream alerting.Stream) *DeadLetterQueue {
+	return &DeadLetterQueue{stream: stream}
+}
+
+func (q *DeadLetterQueue) Send(letter alerting.DeadLetter) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.nextID++
+	letter.ID = strconv.Itoa(q.nextID)
+	letter.Data = append([]byte(nil), letter.Data...)
+	q.letters = append(q.letters, letter)
+	return nil
+}
+
+func (q *DeadLetterQueue) List(limit int) ([]alerting.DeadLetter, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if limit <= 0 || limit > len(q.letters) {
+		limit = len(q.letters)
+	}
+	return append([]alerting.DeadLetter(nil), q.letters[:limit]...), nil
+}
+
+func (q *DeadLetterQueue) Get(id string) (*alerting.DeadLetter, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	i, err := q.index(id)
+	if err != nil {
+		return nil, err
+	}
+	letter := q.letters[i]
+	return &letter, nil
+}
+
+func (q *DeadLetterQueue) Redrive(id string) error {
+	letter, err := q.Get(id)
+	if err != nil {
+		return err
+	}
+	if err := q.stream.Publish(letter.Subject, letter.Data); err != nil {
+		return err
+	}
+	return q.Purge(id)
+}
+
+func (q *DeadLetterQueue) Purge(id string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	i, err := q.index(id)
+	if err != nil {
+		return err
+	}
+	q.letters = append(q.letters[:i], q.letters[i+1:]...)
+	return nil
+}
+
+func (q *DeadLetterQueue) PurgeAll() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.letters = nil
+	return nil
+}
+
+func (q *DeadLetterQueue) index(id string) (int, error) {
+	for i, letter := range q.letters {
+		if letter.ID == id {
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("%w: dead letter %q", alerting.ErrNotFound, id)
+}
@@ -0,0 +1,128 @@
+// Package alertingtest provides in-memory implementations of alerting.Storage
+// and alerting.Stream, plus assertions on the events they carry, so that code
+// built on alerting.Processor can be tested without a NATS server.
+package alertingtest
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/avilikof/go-shared-libs/alerting"
+)
+
+var (
+	_ alerting.Storage   = (*Storage)(nil)
+	_ alerting.KeyLister = (*Storage)(nil)
+)
+
+type entry struct {
+	value     []byte
+	expiresAt time.Time
+}
+
+// Storage is an in-memory alerting.Storage that honours per-key expiration
+// against its Clock.
+type Storage struct {
+	mu     sync.Mutex
+	clock  Clock
+	data   map[string]entry
+	closed bool
+}
+
+// NewStorage creates an empty Storage. A nil clock uses the wall clock.
+func NewStorage(clock Clock) *Storage {
+	if clock == nil {
+		clock = realClock{}
+	}
+	return &Storage{
+		clock: clock,
+		data:  make(map[string]entry),
+	}
+}
+
+// Get returns the value of key, or alerting.ErrNotFound if it is missing or
+// expired.
+func (s *Storage) Get(key string) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return nil, alerting.ErrClosed
+	}
+
+	e, ok := s.data[key]
+	if !ok || s.expired(e) {
+		delete(s.data, key)
+		return nil, fmt.Errorf("%w: %s", alerting.ErrNotFound, key)
+	}
+	return append([]byte(nil), e.value...), nil
+}
+
+// Set stores value under key. A positive expires makes the key disappear once
+// the clock has moved past it.
+func (s *Storage) Set(key string, value []byte, expires time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return alerting.ErrClosed
+	}
+
+	e := entry{value: append([]byte(nil), value...)}
+	if expires > 0 {
+		e.expiresAt = s.clock.Now().Add(expires)
+	}
+	s.data[key] = e
+	return nil
+}
+
+// Delete removes key. Deleting a missing key is not an error.
+func (s *Storage) Delete(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return alerting.ErrClosed
+	}
+	delete(s.data, key)
+	return nil
+}
+
+// Keys returns the sorted keys that have not expired.
+func (s *Storage) Keys() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	keys := make([]string, 0, len(s.data))
+	for key, e := range s.data {
+		if s.expired(e) {
+			delete(s.data, key)
+			continue
+		}
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// List implements alerting.KeyLister.
+func (s *Storage) List() ([]string, error) {
+	s.mu.Lock()
+	closed := s.closed
+	s.mu.Unlock()
+	if closed {
+		return nil, alerting.ErrClosed
+	}
+	return s.Keys(), nil
+}
+
+// Close makes every later operation fail with alerting.ErrClosed.
+func (s *Storage) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	return nil
+}
+
+func (s *Storage) expired(e entry) bool {
+	return !e.expiresAt.IsZero() && !s.clock.Now().Before(e.expiresAt)
+}
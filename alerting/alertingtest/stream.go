@@ -0,0 +1,344 @@
+package alertingtest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/avilikof/go-shared-libs/alerting"
+)
+
+var ErrInvalidSubject = errors.New("invalid subject")
+
+var _ alerting.MessageStream = (*Stream)(nil)
+
+// Message is a message published on a Stream.
+type Message struct {
+	Subject string
+	Data    []byte
+	Header  alerting.Header
+}
+
+// Stream is an in-memory alerting.Stream. Subscriptions accept NATS subject
+// wildcards: "*" matches one token and a trailing ">" matches one or more.
+// Every published message is also recorded for later assertions.
+type Stream struct {
+	mu       sync.Mutex
+	messages []Message
+	subs     []*subscription
+	hooks    []hook
+	closed   bool
+}
+
+type hook struct {
+	pattern string
+	fn      func(Message)
+}
+
+func NewStream() *Stream {
+	return &Stream{}
+}
+
+// Publish records the message and delivers it to every matching subscription
+// in publish order. Delivery never blocks the publisher.
+func (s *Stream) Publish(subject string, data []byte) error {
+	return s.PublishMsg(context.Background(), &alerting.Message{Subject: subject, Data: data})
+}
+
+// PublishMsg is Publish keeping the message's headers.
+func (s *Stream) PublishMsg(ctx context.Context, published *alerting.Message) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := validateSubject(published.Subject, false); err != nil {
+		return err
+	}
+	msg := Message{
+		Subject: published.Subject,
+		Data:    append([]byte(nil), published.Data...),
+		Header:  maps.Clone(published.Header),
+	}
+
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return alerting.ErrClosed
+	}
+	s.messages = append(s.messages, msg)
+	for _, sub := range s.subs {
+		if SubjectMatches(sub.pattern, msg.Subject) {
+			sub.enqueue(msg)
+		}
+	}
+	var hooks []hook
+	for _, h := range s.hooks {
+		if SubjectMatches(h.pattern, msg.Subject) {
+			hooks = append(hooks, h)
+		}
+	}
+	s.mu.Unlock()
+
+	for _, h := range hooks {
+		h.fn(msg)
+	}
+	return nil
+}
+
+// Subscribe forwards messages matching pattern to channel. It returns at once.
+// Subscriptions queue without bound and never drop, so options are ignored.
+func (s *Stream) Subscribe(pattern string, channel chan []byte, opts ...alerting.SubscribeOption) (alerting.Subscription, error) {
+	return s.SubscribeMsg(pattern, func(ctx context.Context, msg *alerting.Message) error {
+		select {
+		case channel <- msg.Data:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}, opts...)
+}
+
+// SubscribeMsg calls handler for messages matching pattern from the
+// subscription's goroutine. Handler errors are ignored.
+func (s *Stream) SubscribeMsg(pattern string, handler alerting.MessageHandler, _ ...alerting.SubscribeOption) (alerting.Subscription, error) {
+	if err := validateSubject(pattern, true); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return nil, alerting.ErrClosed
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	sub := &subscription{
+		stream:  s,
+		pattern: pattern,
+		handler: handler,
+		ctx:     ctx,
+		cancel:  cancel,
+		signal:  make(chan struct{}, 1),
+		idle:    make(chan struct{}, 1),
+		done:    make(chan struct{}),
+	}
+	s.subs = append(s.subs, sub)
+	go sub.run()
+	return sub, nil
+}
+
+// Messages returns the recorded messages whose subject matches pattern.
+func (s *Stream) Messages(pattern string) []Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var matched []Message
+	for _, msg := range s.messages {
+		if SubjectMatches(pattern, msg.Subject) {
+			matched = append(matched, msg)
+		}
+	}
+	return matched
+}
+
+// Persist writes every alert published on alerting.StorageTopic into storage,
+// keyed by the alert ID, the way a storage writer does in production. Writes
+// of deposed leaders are dropped by an alerting.Fence.
+func (s *Stream) Persist(storage alerting.Storage, expires time.Duration) {
+	fence := &alerting.Fence{}
+	s.OnPublish(alerting.StorageTopic, func(msg Message) {
+		if !fence.Admit(msg.Header) {
+			return
+		}
+		id, err := payloadAlertID(msg.Data)
+		if err != nil {
+			return
+		}
+		_ = storage.Set(id, msg.Data, expires)
+	})
+}
+
+// OnPublish calls fn synchronously for every message published on a subject
+// matching pattern.
+func (s *Stream) OnPublish(pattern string, fn func(Message)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.hooks = append(s.hooks, hook{pattern: pattern, fn: fn})
+}
+
+// Close stops all subscriptions. Later Publish and Subscribe calls fail with
+// alerting.ErrClosed.
+func (s *Stream) Close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return
+	}
+	s.closed = true
+	for _, sub := range s.subs {
+		sub.stop()
+	}
+}
+
+// remove stops matching sub against published messages.
+func (s *Stream) remove(sub *subscription) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, other := range s.subs {
+		if other == sub {
+			s.subs = append(s.subs[:i], s.subs[i+1:]...)
+			return
+		}
+	}
+}
+
+type subscription struct {
+	stream  *Stream
+	pattern string
+	handler alerting.MessageHandler
+	ctx     context.Context
+	cancel  context.CancelFunc
+
+	mu        sync.Mutex
+	queue     []Message
+	pending   int
+	delivered uint64
+	signal    chan struct{}
+	idle      chan struct{}
+	done      chan struct{}
+	once      sync.Once
+}
+
+func (sub *subscription) enqueue(msg Message) {
+	sub.mu.Lock()
+	sub.queue = append(sub.queue, msg)
+	sub.pending++
+	sub.mu.Unlock()
+
+	notify(sub.signal)
+}
+
+func (sub *subscription) Unsubscribe() error {
+	sub.stream.remove(sub)
+	sub.stop()
+	return nil
+}
+
+// Drain stops matching new messages and waits until the queued ones have
+// been handed to the channel.
+func (sub *subscription) Drain(timeout time.Duration) error {
+	sub.stream.remove(sub)
+	defer sub.stop()
+
+	deadline := time.After(timeout)
+	for sub.Stats().Pending > 0 {
+		select {
+		case <-sub.idle:
+		case <-sub.done:
+			return fmt.Errorf("%w: %s was closed", alerting.ErrDrainTimeout, sub.pattern)
+		case <-deadline:
+			return fmt.Errorf("%w: %s", alerting.ErrDrainTimeout, sub.pattern)
+		}
+	}
+	return nil
+}
+
+func (sub *subscription) Done() <-chan struct{} {
+	return sub.done
+}
+
+func (sub *subscription) Stats() alerting.SubscriptionStats {
+	sub.mu.Lock()
+	defer sub.mu.Unlock()
+	return alerting.SubscriptionStats{Delivered: sub.delivered, Pending: sub.pending}
+}
+
+func (sub *subscription) stop() {
+	sub.once.Do(func() {
+		sub.cancel()
+		close(sub.done)
+	})
+}
+
+func (sub *subscription) run() {
+	for {
+		sub.mu.Lock()
+		if len(sub.queue) == 0 {
+			sub.mu.Unlock()
+			select {
+			case <-sub.signal:
+				continue
+			case <-sub.done:
+				return
+			}
+		}
+		msg := sub.queue[0]
+		sub.queue = sub.queue[1:]
+		sub.mu.Unlock()
+
+		err := sub.handler(sub.ctx, &alerting.Message{
+			Subject: msg.Subject,
+			Data:    msg.Data,
+			Header:  maps.Clone(msg.Header),
+		})
+		if err != nil && sub.ctx.Err() != nil {
+			return
+		}
+
+		sub.mu.Lock()
+		sub.pending--
+		sub.delivered++
+		sub.mu.Unlock()
+		notify(sub.idle)
+	}
+}
+
+// notify signals ch without blocking.
+func notify(ch chan struct{}) {
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
+}
+
+// SubjectMatches reports whether subject matches a NATS style pattern.
+func SubjectMatches(pattern, subject string) bool {
+	patternTokens := strings.Split(pattern, ".")
+	subjectTokens := strings.Split(subject, ".")
+
+	for i, token := range patternTokens {
+		if token == ">" {
+			return len(subjectTokens) > i
+		}
+		if i >= len(subjectTokens) {
+			return false
+		}
+		if token != "*" && token != subjectTokens[i] {
+			return false
+		}
+	}
+	return len(patternTokens) == len(subjectTokens)
+}
+
+func validateSubject(subject string, wildcards bool) error {
+	if subject == "" {
+		return fmt.Errorf("%w: empty subject", ErrInvalidSubject)
+	}
+	tokens := strings.Split(subject, ".")
+	for i, token := range tokens {
+		switch {
+		case token == "":
+			return fmt.Errorf("%w: %q has an empty token", ErrInvalidSubject, subject)
+		case token == "*" || token == ">":
+			if !wildcards {
+				return fmt.Errorf("%w: wildcards are not allowed in %q", ErrInvalidSubject, subject)
+			}
+			if token == ">" && i != len(tokens)-1 {
+				return fmt.Errorf("%w: '>' must be the last token of %q", ErrInvalidSubject, subject)
+			}
+		}
+	}
+	return nil
+}
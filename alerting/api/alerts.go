@@ -0,0 +1,153 @@
+package api
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/avilikof/go-shared-libs/alerting"
+	"github.com/avilikof/go-shared-libs/alerts"
+)
+
+// Alert is an alert as returned by the API: the stored alert under Alert,
+// plus the fields shared by both alert versions and its operator state.
+type Alert struct {
+	ID              string            `json:"id"`
+	Version         string            `json:"version"`
+	Firing          bool              `json:"firing"`
+	Source          string            `json:"source,omitempty"`
+	Severity        string            `json:"severity,omitempty"`
+	Labels          map[string]string `json:"labels,omitempty"`
+	Acknowledgement *Acknowledgement  `json:"acknowledgement,omitempty"`
+	Silence         *Silence          `json:"silence,omitempty"`
+	Alert           json.RawMessage   `json:"alert"`
+}
+
+// AlertList is a page of alerts. Total counts all alerts matching the query,
+// not only the ones on the page.
+type AlertList struct {
+	Alerts []Alert `json:"alerts"`
+	Total  int     `json:"total"`
+	Offset int     `json:"offset"`
+	Limit  int     `json:"limit"`
+}
+
+// Accepted is the response to a posted alert.
+type Accepted struct {
+	ID string `json:"id"`
+}
+
+// ActionRequest is the optional body of ack, unack, resolve and silence
+// requests. Duration, e.g. "2h", is required for silences.
+type ActionRequest struct {
+	By       string `json:"by,omitempty"`
+	Comment  string `json:"comment,omitempty"`
+	Duration string `json:"duration,omitempty"`
+}
+
+func (req ActionRequest) eventData() map[string]any {
+	data := make(map[string]any)
+	if req.By != "" {
+		data["by"] = req.By
+	}
+	if req.Comment != "" {
+		data["comment"] = req.Comment
+	}
+	return data
+}
+
+// Acknowledgement records who acknowledged an alert and when.
+type Acknowledgement struct {
+	By      string    `json:"by,omitempty"`
+	Comment string    `json:"comment,omitempty"`
+	At      time.Time `json:"at"`
+}
+
+// Silence records who silenced an alert and until when.
+type Silence struct {
+	By      string    `json:"by,omitempty"`
+	Comment string    `json:"comment,omitempty"`
+	Until   time.Time `json:"until"`
+}
+
+// Query selects alerts to list. Empty fields match every alert; a zero Limit
+// lists all matching alerts.
+type Query struct {
+	// State is "firing" or "resolved".
+	State        string
+	Version      string
+	Source       string
+	Severity     string
+	Acknowledged *bool
+	Silenced     *bool
+	Labels       map[string]string
+	Limit        int
+	Offset       int
+}
+
+func (q Query) validate() error {
+	if q.State != "" && q.State != "firing" && q.State != "resolved" {
+		return invalid("invalid state %q: want firing or resolved", q.State)
+	}
+	if q.Limit < 0 || q.Offset < 0 {
+		return invalid("limit and offset must not be negative")
+	}
+	return nil
+}
+
+func (q Query) matches(alert *Alert) bool {
+	switch {
+	case q.State == "firing" && !alert.Firing,
+		q.State == "resolved" && alert.Firing,
+		q.Version != "" && q.Version != alert.Version,
+		q.Source != "" && q.Source != alert.Source,
+		q.Severity != "" && q.Severity != alert.Severity,
+		q.Acknowledged != nil && *q.Acknowledged != (alert.Acknowledgement != nil),
+		q.Silenced != nil && *q.Silenced != (alert.Silence != nil):
+		return false
+	}
+	for key, value := range q.Labels {
+		if got, ok := alert.Labels[key]; !ok || got != value {
+			return false
+		}
+	}
+	return true
+}
+
+// decodeAlert recognises the version of a stored alert by its fields: v2
+// alerts carry a state, v1 alerts a firing flag.
+func decodeAlert(data []byte) (*Alert, error) {
+	var probe struct {
+		ID     string  `json:"id"`
+		State  *string `json:"state"`
+		Firing *bool   `json:"firing"`
+	}
+	if err := json.Unmarshal(data, &probe); err != nil || probe.ID == "" {
+		return nil, errNotAlert
+	}
+
+	switch {
+	case probe.State != nil:
+		alertV2, err := alerts.AlertV2FromBytes(data)
+		if err != nil {
+			return nil, errNotAlert
+		}
+		return &Alert{
+			ID:       alertV2.ID(),
+			Version:  alerting.VersionV2.String(),
+			Firing:   alertV2.IsFiring(),
+			Source:   alertV2.Source(),
+			Severity: alertV2.Severity(),
+			Labels:   alertV2.Labels(),
+			Alert:    data,
+		}, nil
+	case probe.Firing != nil:
+		return &Alert{
+			ID:      probe.ID,
+			Version: alerting.VersionV1.String(),
+			Firing:  *probe.Firing,
+			Alert:   data,
+		}, nil
+	default:
+		return nil, errNotAlert
+	}
+}
@@ -0,0 +1,99 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/avilikof/go-shared-libs/alerting"
+)
+
+var ErrDeadLettersUnsupported = errors.New("no dead-letter queue configured")
+
+// DeadLetterList is the response of GET /dlq.
+type DeadLetterList struct {
+	DeadLetters []alerting.DeadLetter `json:"dead_letters"`
+}
+
+// deadLetters returns the configured queue, or writes 501 and returns nil.
+func (h *Handler) deadLetters(w http.ResponseWriter) alerting.DeadLetterQueue {
+	if h.config.DeadLetters == nil {
+		writeError(w, ErrDeadLettersUnsupported)
+	}
+	return h.config.DeadLetters
+}
+
+// listDeadLetters accepts the query parameter limit.
+func (h *Handler) listDeadLetters(w http.ResponseWriter, r *http.Request) {
+	dlq := h.deadLetters(w)
+	if dlq == nil {
+		return
+	}
+	limit := h.config.PageSize
+	if raw := r.URL.Query().Get("limit"); raw != "" {
+		var err error
+		if limit, err = strconv.Atoi(raw); err != nil || limit <= 0 {
+			writeError(w, invalid("invalid limit %q", raw))
+			return
+		}
+	}
+	letters, err := dlq.List(min(limit, h.config.MaxPageSize))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if letters == nil {
+		letters = []alerting.DeadLetter{}
+	}
+	writeJSON(w, http.StatusOK, DeadLetterList{DeadLetters: letters})
+}
+
+func (h *Handler) getDeadLetter(w http.ResponseWriter, r *http.Request) {
+	dlq := h.deadLetters(w)
+	if dlq == nil {
+		return
+	}
+	letter, err := dlq.Get(r.PathValue("id"))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, letter)
+}
+
+func (h *Handler) redriveDeadLetter(w http.ResponseWriter, r *http.Request) {
+	dlq := h.deadLetters(w)
+	if dlq == nil {
+		return
+	}
+	id := r.PathValue("id")
+	if err := dlq.Redrive(id); err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusAccepted, Accepted{ID: id})
+}
+
+func (h *Handler) purgeDeadLetter(w http.ResponseWriter, r *http.Request) {
+	dlq := h.deadLetters(w)
+	if dlq == nil {
+		return
+	}
+	if err := dlq.Purge(r.PathValue("id")); err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) purgeDeadLetters(w http.ResponseWriter, _ *http.Request) {
+	dlq := h.deadLetters(w)
+	if dlq == nil {
+		return
+	}
+	if err := dlq.PurgeAll(); err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
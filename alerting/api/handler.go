@@ -0,0 +1,269 @@
+// Package api exposes alert state over HTTP. Alerts posted to the API are
+// published on the Stream for the alerting.Processor; alerts are read from
+// Storage; and acknowledgements, silences and manual resolutions are recorded
+// in Storage with an event.Event published on alerting.EvetTopic for each.
+//
+//	POST /v1/alerts                 publish a v1 alert
+//	POST /v2/alerts                 publish a v2 alert
+//	GET  /alerts                    list alerts, filtered and paginated
+//	GET  /alerts/{id}               get one alert
+//	POST /alerts/{id}/ack           acknowledge an alert
+//	POST /alerts/{id}/unack         withdraw an acknowledgement
+//	POST /alerts/{id}/resolve       resolve an alert
+//	POST /alerts/{id}/silence       silence an alert for a duration
+//	GET  /dlq                       list dead letters
+//	GET  /dlq/{id}                  get one dead letter
+//	POST /dlq/{id}/redrive          publish a dead letter on its subject again
+//	DELETE /dlq/{id}                purge one dead letter
+//	DELETE /dlq                     purge all dead letters
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/avilikof/go-shared-libs/alerting"
+	"github.com/avilikof/go-shared-libs/alerts"
+)
+
+// maxBodyBytes bounds the size of request bodies.
+const maxBodyBytes = 1 << 20
+
+// Config configures a Handler. Zero values fall back to the defaults noted on
+// each field.
+type Config struct {
+	// InputSubject is the subject posted alerts are published on. Default
+	// "test.alert", the subject used by the alert generators.
+	InputSubject string
+	// PageSize is the number of alerts listed when no limit is given.
+	// Default 50.
+	PageSize int
+	// MaxPageSize caps the limit of a list request. Default 500.
+	MaxPageSize int
+	// DeadLetters is the dead-letter queue served under /dlq. Without one
+	// the /dlq endpoints answer 501.
+	DeadLetters alerting.DeadLetterQueue
+	// StaleTracker, if set, stops tracking alerts resolved through the API.
+	StaleTracker *alerting.StaleTracker
+	// Escalator, if set, stops the escalations of alerts resolved through
+	// the API.
+	Escalator *alerting.Escalator
+}
+
+// Handler is the http.Handler of the alerting API.
+type Handler struct {
+	service *Service
+	config  Config
+	mux     *http.ServeMux
+}
+
+// NewHandler creates a Handler. Listing alerts requires storage to implement
+// alerting.KeyLister; other storages answer list requests with 501.
+func NewHandler(storage alerting.Storage, stream alerting.Stream, config Config) *Handler {
+	if config.PageSize <= 0 {
+		config.PageSize = 50
+	}
+	if config.MaxPageSize <= 0 {
+		config.MaxPageSize = 500
+	}
+
+	var opts []ServiceOption
+	if config.StaleTracker != nil {
+		opts = append(opts, WithStaleTracker(config.StaleTracker))
+	}
+	if config.Escalator != nil {
+		opts = append(opts, WithEscalator(config.Escalator))
+	}
+	h := &Handler{
+		service: NewService(storage, stream, config.InputSubject, opts...),
+		config:  config,
+		mux:     http.NewServeMux(),
+	}
+	h.mux.HandleFunc("POST /v1/alerts", h.postAlertV1)
+	h.mux.HandleFunc("POST /v2/alerts", h.postAlertV2)
+	h.mux.HandleFunc("GET /alerts", h.listAlerts)
+	h.mux.HandleFunc("GET /alerts/{id}", h.getAlert)
+	h.mux.HandleFunc("POST /alerts/{id}/ack", h.action(h.service.Ack))
+	h.mux.HandleFunc("POST /alerts/{id}/unack", h.action(h.service.Unack))
+	h.mux.HandleFunc("POST /alerts/{id}/resolve", h.action(h.service.Resolve))
+	h.mux.HandleFunc("POST /alerts/{id}/silence", h.action(h.service.Silence))
+	h.mux.HandleFunc("GET /dlq", h.listDeadLetters)
+	h.mux.HandleFunc("GET /dlq/{id}", h.getDeadLetter)
+	h.mux.HandleFunc("POST /dlq/{id}/redrive", h.redriveDeadLetter)
+	h.mux.HandleFunc("DELETE /dlq/{id}", h.purgeDeadLetter)
+	h.mux.HandleFunc("DELETE /dlq", h.purgeDeadLetters)
+	return h
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mux.ServeHTTP(w, r)
+}
+
+func (h *Handler) postAlertV1(w http.ResponseWriter, r *http.Request) {
+	var alert alerts.Alert
+	if err := decodeBody(r, &alert, false); err != nil {
+		writeError(w, err)
+		return
+	}
+	if err := h.service.PublishAlertV1(&alert); err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusAccepted, Accepted{ID: alert.ID})
+}
+
+func (h *Handler) postAlertV2(w http.ResponseWriter, r *http.Request) {
+	var alert alerts.AlertV2
+	if err := decodeBody(r, &alert, false); err != nil {
+		writeError(w, err)
+		return
+	}
+	if err := h.service.PublishAlertV2(&alert); err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusAccepted, Accepted{ID: alert.ID()})
+}
+
+func (h *Handler) getAlert(w http.ResponseWriter, r *http.Request) {
+	alert, err := h.service.Get(r.PathValue("id"))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, alert)
+}
+
+// listAlerts accepts the query parameters state (firing or resolved),
+// version, source, severity, acknowledged and silenced (true or false), label
+// (key=value, repeatable), limit and offset.
+func (h *Handler) listAlerts(w http.ResponseWriter, r *http.Request) {
+	query, err := h.parseQuery(r.URL.Query())
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	list, err := h.service.List(query)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+func (h *Handler) action(fn func(alertID string, req ActionRequest) (*Alert, error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req ActionRequest
+		if err := decodeBody(r, &req, true); err != nil {
+			writeError(w, err)
+			return
+		}
+		alert, err := fn(r.PathValue("id"), req)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, alert)
+	}
+}
+
+func (h *Handler) parseQuery(values url.Values) (Query, error) {
+	query := Query{
+		State:    values.Get("state"),
+		Version:  values.Get("version"),
+		Source:   values.Get("source"),
+		Severity: values.Get("severity"),
+		Labels:   make(map[string]string),
+		Limit:    h.config.PageSize,
+	}
+
+	var err error
+	if query.Acknowledged, err = parseBool(values, "acknowledged"); err != nil {
+		return query, err
+	}
+	if query.Silenced, err = parseBool(values, "silenced"); err != nil {
+		return query, err
+	}
+	for _, label := range values["label"] {
+		key, value, ok := strings.Cut(label, "=")
+		if !ok || key == "" {
+			return query, invalid("invalid label %q: want key=value", label)
+		}
+		query.Labels[key] = value
+	}
+	if raw := values.Get("limit"); raw != "" {
+		if query.Limit, err = strconv.Atoi(raw); err != nil || query.Limit <= 0 {
+			return query, invalid("invalid limit %q", raw)
+		}
+	}
+	query.Limit = min(query.Limit, h.config.MaxPageSize)
+	if raw := values.Get("offset"); raw != "" {
+		if query.Offset, err = strconv.Atoi(raw); err != nil || query.Offset < 0 {
+			return query, invalid("invalid offset %q", raw)
+		}
+	}
+	return query, nil
+}
+
+func parseBool(values url.Values, name string) (*bool, error) {
+	raw := values.Get(name)
+	if raw == "" {
+		return nil, nil
+	}
+	value, err := strconv.ParseBool(raw)
+	if err != nil {
+		return nil, invalid("invalid %s %q: want true or false", name, raw)
+	}
+	return &value, nil
+}
+
+// decodeBody decodes a JSON request body into v. An empty body is accepted
+// only if optional is set, and leaves v untouched.
+func decodeBody(r *http.Request, v any, optional bool) error {
+	decoder := json.NewDecoder(http.MaxBytesReader(nil, r.Body, maxBodyBytes))
+	err := decoder.Decode(v)
+	if errors.Is(err, io.EOF) && optional {
+		return nil
+	}
+	if err != nil {
+		return invalid("invalid request body: %v", err)
+	}
+	return nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		fmt.Printf("API :: failed to write response: %v\n", err)
+	}
+}
+
+// writeError reports err as {"error": "..."} with the status matching it.
+func writeError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, ErrInvalidRequest):
+		status = http.StatusBadRequest
+	case errors.Is(err, alerting.ErrNotFound), errors.Is(err, errNotAlert):
+		status = http.StatusNotFound
+	case errors.Is(err, ErrNotFiring):
+		status = http.StatusConflict
+	case errors.Is(err, ErrListUnsupported), errors.Is(err, ErrDeadLettersUnsupported), errors.Is(err, errors.ErrUnsupported):
+		status = http.StatusNotImplemented
+	case errors.Is(err, alerting.ErrQuotaExceeded):
+		status = http.StatusTooManyRequests
+	case errors.Is(err, alerting.ErrClosed):
+		status = http.StatusServiceUnavailable
+	}
+	if status == http.StatusInternalServerError {
+		fmt.Printf("API :: %v\n", err)
+	}
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
@@ -0,0 +1,329 @@
+package api_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/avilikof/go-shared-libs/alerting"
+	"github.com/avilikof/go-shared-libs/alerting/alertingtest"
+	"github.com/avilikof/go-shared-libs/alerting/api"
+	"github.com/avilikof/go-shared-libs/alerts"
+	"github.com/avilikof/go-shared-libs/event"
+)
+
+type fixture struct {
+	storage *alertingtest.Storage
+	stream  *alertingtest.Stream
+	dlq     *alertingtest.DeadLetterQueue
+	server  *httptest.Server
+}
+
+func newFixture(t *testing.T) *fixture {
+	t.Helper()
+	storage := alertingtest.NewStorage(nil)
+	stream := alertingtest.NewStream()
+	stream.Persist(storage, 0)
+	dlq := alertingtest.NewDeadLetterQueue(stream)
+	server := httptest.NewServer(api.NewHandler(storage, stream, api.Config{PageSize: 2, DeadLetters: dlq}))
+	t.Cleanup(func() {
+		server.Close()
+		stream.Close()
+	})
+	return &fixture{storage: storage, stream: stream, dlq: dlq, server: server}
+}
+
+func (f *fixture) storeV2(t *testing.T, id string, state alerts.AlertState, labels map[string]string) {
+	t.Helper()
+	alert := alerts.NewAlertV2(id, "node-exporter", "critical", "disk_full", "disk is full", id, time.Now(), state)
+	for key, value := range labels {
+		alert.AddLabel(key, value)
+	}
+	data, err := alert.MarshalJSON()
+	if err != nil {
+		t.Fatalf("MarshalJSON() error = %v", err)
+	}
+	if err := f.storage.Set(id, data, 0); err != nil {
+		t.Fatalf("Set() error = %v", err)
+	}
+}
+
+func (f *fixture) do(t *testing.T, method, path string, body any, want int, into any) {
+	t.Helper()
+	var reader *bytes.Reader
+	switch b := body.(type) {
+	case nil:
+		reader = bytes.NewReader(nil)
+	case []byte:
+		reader = bytes.NewReader(b)
+	default:
+		data, err := json.Marshal(b)
+		if err != nil {
+			t.Fatalf("Marshal() error = %v", err)
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequest(method, f.server.URL+path, reader)
+	if err != nil {
+		t.Fatalf("NewRequest() error = %v", err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("%s %s error = %v", method, path, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != want {
+		var apiErr map[string]string
+		_ = json.NewDecoder(resp.Body).Decode(&apiErr)
+		t.Fatalf("%s %s status = %d (%s); want %d", method, path, resp.StatusCode, apiErr["error"], want)
+	}
+	if into != nil {
+		if err := json.NewDecoder(resp.Body).Decode(into); err != nil {
+			t.Fatalf("decoding %s %s response: %v", method, path, err)
+		}
+	}
+}
+
+func TestHandler_PostAlerts(t *testing.T) {
+	f := newFixture(t)
+
+	v1 := alerts.NewAlert("legacy-1", "legacy", "hello", time.Now(), true)
+	var accepted api.Accepted
+	f.do(t, http.MethodPost, "/v1/alerts", v1.Bytes(), http.StatusAccepted, &accepted)
+	if accepted.ID != "legacy-1" {
+		t.Errorf("accepted ID = %q; want legacy-1", accepted.ID)
+	}
+
+	v2, _ := alerts.NewAlertV2("modern-1", "node-exporter", "warning", "cpu_high", "cpu", "modern-1", time.Now(), alerts.AlertStateActive).MarshalJSON()
+	f.do(t, http.MethodPost, "/v2/alerts", v2, http.StatusAccepted, nil)
+
+	if got := len(f.stream.Messages("test.alert")); got != 2 {
+		t.Errorf("published %d alerts on the input subject; want 2", got)
+	}
+	alertingtest.ExpectEvent(t, f.stream, event.ActionAlert, "legacy-1")
+	alertingtest.ExpectEvent(t, f.stream, event.ActionAlert, "modern-1")
+
+	f.do(t, http.MethodPost, "/v2/alerts", []byte(`{"source":"no-id"}`), http.StatusBadRequest, nil)
+	f.do(t, http.MethodPost, "/v1/alerts", []byte(`not json`), http.StatusBadRequest, nil)
+}
+
+func TestHandler_GetAndList(t *testing.T) {
+	f := newFixture(t)
+	f.storeV2(t, "a", alerts.AlertStateActive, map[string]string{"env": "prod"})
+	f.storeV2(t, "b", alerts.AlertStateActive, map[string]string{"env": "staging"})
+	f.storeV2(t, "c", alerts.AlertStateResolved, map[string]string{"env": "prod"})
+	f.storeV2(t, "d", alerts.AlertStateActive, map[string]string{"env": "prod"})
+	_ = f.storage.Set("e", alerts.NewAlert("e", "legacy", "hello", time.Now(), true).Bytes(), 0)
+	// State of other components sharing the storage is not listed.
+	_ = f.storage.Set("escalation.alert.a", []byte(`[]`), 0)
+	_ = f.storage.Set("stale.alert.a", []byte(`{"timeout":1}`), 0)
+
+	var alert api.Alert
+	f.do(t, http.MethodGet, "/alerts/e", nil, http.StatusOK, &alert)
+	if alert.Version != "v1" || !alert.Firing {
+		t.Errorf("GET /alerts/e = %+v; want a firing v1 alert", alert)
+	}
+	f.do(t, http.MethodGet, "/alerts/missing", nil, http.StatusNotFound, nil)
+	f.do(t, http.MethodGet, "/alerts/escalation.alert.a", nil, http.StatusNotFound, nil)
+
+	tests := []struct {
+		query string
+		want  []string
+		total int
+	}{
+		{query: "", want: []string{"a", "b"}, total: 5},
+		{query: "?offset=2", want: []string{"c", "d"}, total: 5},
+		{query: "?state=firing&limit=10", want: []string{"a", "b", "d", "e"}, total: 4},
+		{query: "?state=firing&label=env=prod", want: []string{"a", "d"}, total: 2},
+		{query: "?version=v1", want: []string{"e"}, total: 1},
+		{query: "?state=resolved", want: []string{"c"}, total: 1},
+	}
+	for _, tt := range tests {
+		var list api.AlertList
+		f.do(t, http.MethodGet, "/alerts"+tt.query, nil, http.StatusOK, &list)
+		var got []string
+		for _, alert := range list.Alerts {
+			got = append(got, alert.ID)
+		}
+		if !equal(got, tt.want) || list.Total != tt.total {
+			t.Errorf("GET /alerts%s = %v (total %d); want %v (total %d)", tt.query, got, list.Total, tt.want, tt.total)
+		}
+	}
+
+	f.do(t, http.MethodGet, "/alerts?state=pending", nil, http.StatusBadRequest, nil)
+	f.do(t, http.MethodGet, "/alerts?limit=0", nil, http.StatusBadRequest, nil)
+}
+
+func TestHandler_Actions(t *testing.T) {
+	f := newFixture(t)
+	f.storeV2(t, "disk", alerts.AlertStateActive, nil)
+
+	var alert api.Alert
+	f.do(t, http.MethodPost, "/alerts/disk/ack", api.ActionRequest{By: "alice", Comment: "looking"}, http.StatusOK, &alert)
+	if alert.Acknowledgement == nil || alert.Acknowledgement.By != "alice" {
+		t.Errorf("ack response acknowledgement = %+v; want one by alice", alert.Acknowledgement)
+	}
+	ack := alertingtest.ExpectEvent(t, f.stream, event.ActionAcknowledged, "disk")
+	if ack.Message["by"] != "alice" {
+		t.Errorf("acknowledged event message = %v; want by alice", ack.Message)
+	}
+
+	var list api.AlertList
+	f.do(t, http.MethodGet, "/alerts?acknowledged=true", nil, http.StatusOK, &list)
+	if list.Total != 1 {
+		t.Errorf("acknowledged alerts = %d; want 1", list.Total)
+	}
+
+	f.do(t, http.MethodPost, "/alerts/disk/unack", nil, http.StatusOK, &alert)
+	alertingtest.ExpectEvent(t, f.stream, event.ActionUnacknowledged, "disk")
+	alert = api.Alert{}
+	f.do(t, http.MethodGet, "/alerts/disk", nil, http.StatusOK, &alert)
+	if alert.Acknowledgement != nil {
+		t.Errorf("acknowledgement after unack = %+v; want none", alert.Acknowledgement)
+	}
+
+	f.do(t, http.MethodPost, "/alerts/disk/silence", api.ActionRequest{}, http.StatusBadRequest, nil)
+	f.do(t, http.MethodPost, "/alerts/disk/silence", api.ActionRequest{Duration: "1h"}, http.StatusOK, &alert)
+	if alert.Silence == nil {
+		t.Fatal("silence response has no silence")
+	}
+	alertingtest.ExpectEvent(t, f.stream, event.ActionSilenced, "disk")
+
+	f.do(t, http.MethodPost, "/alerts/disk/resolve", api.ActionRequest{By: "alice"}, http.StatusOK, &alert)
+	resolved := alertingtest.ExpectEvent(t, f.stream, event.ActionResolved, "disk")
+	if resolved.Message["reason"] != api.ResolveReasonManual {
+		t.Errorf("resolved event reason = %v; want %q", resolved.Message["reason"], api.ResolveReasonManual)
+	}
+	stored, err := alerts.AlertV2FromBytes(alertingtest.ExpectStored(t, f.stream, "disk"))
+	if err != nil || stored.IsFiring() {
+		t.Errorf("stored alert after resolve = %v, %v; want a resolved alert", stored, err)
+	}
+
+	f.do(t, http.MethodPost, "/alerts/disk/resolve", nil, http.StatusConflict, nil)
+	f.do(t, http.MethodPost, "/alerts/disk/ack", nil, http.StatusConflict, nil)
+	f.do(t, http.MethodPost, "/alerts/missing/ack", nil, http.StatusNotFound, nil)
+}
+
+func TestHandler_ResolveClearsAlertState(t *testing.T) {
+	storage := alertingtest.NewStorage(nil)
+	stream := alertingtest.NewStream()
+	stream.Persist(storage, 0)
+	stale := alerting.NewStaleTracker(storage, stream, time.Minute)
+	server := httptest.NewServer(api.NewHandler(storage, stream, api.Config{
+		StaleTracker: stale,
+		Escalator:    alerting.NewEscalator(storage, stream, time.Minute),
+	}))
+	t.Cleanup(func() {
+		server.Close()
+		stream.Close()
+	})
+	f := &fixture{storage: storage, stream: stream, server: server}
+
+	f.storeV2(t, "disk", alerts.AlertStateActive, nil)
+	data, _ := storage.Get("disk")
+	alert, _ := alerts.AlertV2FromBytes(data)
+	if err := stale.Seen(alert); err != nil {
+		t.Fatalf("Seen() error = %v", err)
+	}
+	_ = storage.Set("escalation.alert.disk", []byte(`[{"alert_id":"disk","policy":"pager","next_at":"2030-01-01T00:00:00Z"}]`), 0)
+	f.do(t, http.MethodPost, "/alerts/disk/ack", nil, http.StatusOK, nil)
+
+	f.do(t, http.MethodPost, "/alerts/disk/resolve", nil, http.StatusOK, nil)
+	for _, key := range []string{"ack.disk", "stale.alert.disk", "escalation.alert.disk"} {
+		if _, err := storage.Get(key); !errors.Is(err, alerting.ErrNotFound) {
+			t.Errorf("Get(%s) after resolve error = %v; want alerting.ErrNotFound", key, err)
+		}
+	}
+}
+
+func TestHandler_SilenceSuppressesFiring(t *testing.T) {
+	f := newFixture(t)
+	f.storeV2(t, "disk", alerts.AlertStateResolved, nil)
+	f.do(t, http.MethodPost, "/alerts/disk/silence", api.ActionRequest{Duration: "1h"}, http.StatusOK, nil)
+
+	input := make(chan *alerts.AlertV2, 1)
+	input <- alerts.NewAlertV2("disk", "node-exporter", "critical", "disk_full", "disk is full", "disk", time.Now(), alerts.AlertStateActive)
+	close(input)
+	alerting.NewProcessorV2(input, f.storage, f.stream).ProcessV2()
+
+	for _, msg := range f.stream.Messages(alerting.EvetTopic) {
+		if ev, err := event.FromBytes(msg.Data); err == nil && ev.Action == event.ActionFiring {
+			t.Fatalf("silenced alert fired: %s", msg.Data)
+		}
+	}
+	stored, err := f.storage.Get("disk")
+	if alert, _ := alerts.AlertV2FromBytes(stored); err != nil || alert.IsFiring() {
+		t.Errorf("stored silenced alert = %s, %v; want it left resolved", stored, err)
+	}
+}
+
+func TestHandler_DeadLetters(t *testing.T) {
+	f := newFixture(t)
+	for _, data := range []string{`{"id":`, `{"id":"disk"}`, `[]`} {
+		letter := alerting.DeadLetter{Subject: "test.alert", Error: "decoding alert", Attempts: 1, Timestamp: time.Now(), Data: []byte(data)}
+		if err := f.dlq.Send(letter); err != nil {
+			t.Fatalf("Send() error = %v", err)
+		}
+	}
+
+	var list api.DeadLetterList
+	f.do(t, http.MethodGet, "/dlq", nil, http.StatusOK, &list)
+	if len(list.DeadLetters) != 2 {
+		t.Fatalf("listed %d dead letters; want a page of 2", len(list.DeadLetters))
+	}
+	var letter alerting.DeadLetter
+	f.do(t, http.MethodGet, "/dlq/2", nil, http.StatusOK, &letter)
+	if string(letter.Data) != `{"id":"disk"}` || letter.Subject != "test.alert" {
+		t.Errorf("dead letter = %+v; want the second one", letter)
+	}
+
+	f.do(t, http.MethodPost, "/dlq/2/redrive", nil, http.StatusAccepted, nil)
+	if msgs := f.stream.Messages("test.alert"); len(msgs) != 1 || string(msgs[0].Data) != `{"id":"disk"}` {
+		t.Errorf("re-driven messages = %v; want the dead letter on test.alert", msgs)
+	}
+	f.do(t, http.MethodGet, "/dlq/2", nil, http.StatusNotFound, nil)
+
+	f.do(t, http.MethodDelete, "/dlq/1", nil, http.StatusNoContent, nil)
+	f.do(t, http.MethodDelete, "/dlq/1", nil, http.StatusNotFound, nil)
+	f.do(t, http.MethodDelete, "/dlq", nil, http.StatusNoContent, nil)
+	f.do(t, http.MethodGet, "/dlq", nil, http.StatusOK, &list)
+	if len(list.DeadLetters) != 0 {
+		t.Errorf("listed %d dead letters after purging; want 0", len(list.DeadLetters))
+	}
+	f.do(t, http.MethodGet, "/dlq?limit=0", nil, http.StatusBadRequest, nil)
+}
+
+func TestHandler_Unsupported(t *testing.T) {
+	storage := struct{ alerting.Storage }{alertingtest.NewStorage(nil)}
+	server := httptest.NewServer(api.NewHandler(storage, alertingtest.NewStream(), api.Config{}))
+	defer server.Close()
+
+	for _, path := range []string{"/alerts", "/dlq"} {
+		resp, err := http.Get(server.URL + path)
+		if err != nil {
+			t.Fatalf("GET %s error = %v", path, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusNotImplemented {
+			t.Errorf("GET %s status = %d; want %d", path, resp.StatusCode, http.StatusNotImplemented)
+		}
+	}
+}
+
+func equal(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
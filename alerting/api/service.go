@@ -0,0 +1,374 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/avilikof/go-shared-libs/alerting"
+	"github.com/avilikof/go-shared-libs/alerts"
+	"github.com/avilikof/go-shared-libs/event"
+)
+
+// ResolveReasonManual is the reason carried by resolved events for alerts
+// resolved through the API.
+const ResolveReasonManual = "manual"
+
+// Operator state is kept next to the alerts, so that a source resending an
+// alert does not wipe its acknowledgement or silence, and the Processor and
+// Escalator sharing the storage honour it.
+const (
+	ackKeyPrefix     = alerting.AckKeyPrefix
+	silenceKeyPrefix = alerting.SilenceKeyPrefix
+)
+
+var (
+	ErrInvalidRequest  = errors.New("invalid request")
+	ErrNotFiring       = errors.New("alert is not firing")
+	ErrListUnsupported = errors.New("storage cannot list alerts")
+
+	errNotAlert = errors.New("stored value is not an alert")
+)
+
+// Service implements the alerting API on a Storage and a Stream. Handler
+// serves it over HTTP; command-line tools use it directly.
+type Service struct {
+	storage      alerting.Storage
+	stream       alerting.Stream
+	inputSubject string
+	stale        *alerting.StaleTracker
+	escalator    *alerting.Escalator
+	now          func() time.Time
+}
+
+// ServiceOption configures optional Service behaviour.
+type ServiceOption func(*Service)
+
+// WithStaleTracker stops tracking the alerts resolved through the Service,
+// like the Processor does for alerts resolved by their source.
+func WithStaleTracker(tracker *alerting.StaleTracker) ServiceOption {
+	return func(s *Service) {
+		s.stale = tracker
+	}
+}
+
+// WithEscalator stops the escalations of the alerts resolved through the
+// Service.
+func WithEscalator(escalator *alerting.Escalator) ServiceOption {
+	return func(s *Service) {
+		s.escalator = escalator
+	}
+}
+
+// NewService creates a Service that publishes posted alerts on inputSubject,
+// or on "test.alert", the subject used by the alert generators, if empty.
+func NewService(storage alerting.Storage, stream alerting.Stream, inputSubject string, opts ...ServiceOption) *Service {
+	if inputSubject == "" {
+		inputSubject = "test.alert"
+	}
+	s := &Service{
+		storage:      storage,
+		stream:       stream,
+		inputSubject: inputSubject,
+		now:          time.Now,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// PublishAlertV1 publishes a v1 alert for the Processor.
+func (s *Service) PublishAlertV1(alert *alerts.Alert) error {
+	if alert.ID == "" {
+		return invalid("alert id is required")
+	}
+	return s.publishAlert(alert.ID, alerting.VersionV1, alert.Bytes())
+}
+
+// PublishAlertV2 publishes a v2 alert for the Processor.
+func (s *Service) PublishAlertV2(alert *alerts.AlertV2) error {
+	alertBytes, err := alert.MarshalJSON()
+	if err != nil {
+		return err
+	}
+	return s.publishAlert(alert.ID(), alerting.VersionV2, alertBytes)
+}
+
+func (s *Service) publishAlert(alertID string, version alerting.AlertVersion, alertBytes []byte) error {
+	if err := s.stream.Publish(s.inputSubject, alertBytes); err != nil {
+		return fmt.Errorf("failed to publish alert %s: %w", alertID, err)
+	}
+	return s.publishEvent(alertID, event.ActionAlert, map[string]any{"version": version.String()})
+}
+
+// Get returns an alert and its operator state.
+func (s *Service) Get(alertID string) (*Alert, error) {
+	if alertID == "" || isStateKey(alertID) {
+		return nil, fmt.Errorf("%w: %q", alerting.ErrNotFound, alertID)
+	}
+	data, err := s.storage.Get(alertID)
+	if err != nil {
+		return nil, err
+	}
+	alert, err := decodeAlert(data)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", err, alertID)
+	}
+	if alert.Acknowledgement, err = s.acknowledgement(alertID); err != nil {
+		return nil, err
+	}
+	if alert.Silence, err = s.silence(alertID); err != nil {
+		return nil, err
+	}
+	return alert, nil
+}
+
+// List returns the stored alerts matching query, sorted by ID. It requires
+// the storage to implement alerting.KeyLister.
+func (s *Service) List(query Query) (*AlertList, error) {
+	lister, ok := s.storage.(alerting.KeyLister)
+	if !ok {
+		return nil, ErrListUnsupported
+	}
+	if err := query.validate(); err != nil {
+		return nil, err
+	}
+	keys, err := lister.List()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list alerts: %w", err)
+	}
+
+	list := &AlertList{Alerts: []Alert{}, Offset: query.Offset, Limit: query.Limit}
+	for _, key := range keys {
+		if isStateKey(key) {
+			continue
+		}
+		alert, err := s.Get(key)
+		if errors.Is(err, alerting.ErrNotFound) || errors.Is(err, errNotAlert) {
+			// Expired since listing, or state kept by other components.
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if !query.matches(alert) {
+			continue
+		}
+		if list.Total >= query.Offset && (query.Limit <= 0 || len(list.Alerts) < query.Limit) {
+			list.Alerts = append(list.Alerts, *alert)
+		}
+		list.Total++
+	}
+	return list, nil
+}
+
+// Ack acknowledges a firing alert. The Escalator stops its escalations.
+func (s *Service) Ack(alertID string, req ActionRequest) (*Alert, error) {
+	alert, err := s.firing(alertID)
+	if err != nil {
+		return nil, err
+	}
+	ack := Acknowledgement{By: req.By, Comment: req.Comment, At: s.now()}
+	if err := s.setState(ackKeyPrefix+alertID, ack, 0); err != nil {
+		return nil, err
+	}
+	if err := s.publishEvent(alertID, event.ActionAcknowledged, req.eventData()); err != nil {
+		return nil, err
+	}
+	alert.Acknowledgement = &ack
+	return alert, nil
+}
+
+// Unack withdraws the acknowledgement of an alert.
+func (s *Service) Unack(alertID string, req ActionRequest) (*Alert, error) {
+	alert, err := s.Get(alertID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.clearState(ackKeyPrefix + alertID); err != nil {
+		return nil, err
+	}
+	if err := s.publishEvent(alertID, event.ActionUnacknowledged, req.eventData()); err != nil {
+		return nil, err
+	}
+	alert.Acknowledgement = nil
+	return alert, nil
+}
+
+// Resolve publishes the resolved alert on alerting.StorageTopic, the way the
+// Processor does, so the storage writer persists it, and withdraws its
+// acknowledgement, so that it does not carry over to the next time the
+// alert fires. Silences are kept until they run out, as they are meant to
+// outlast a resolution.
+func (s *Service) Resolve(alertID string, req ActionRequest) (*Alert, error) {
+	alert, err := s.firing(alertID)
+	if err != nil {
+		return nil, err
+	}
+	resolved, err := s.resolved(alert)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.stream.Publish(alerting.StorageTopic, resolved); err != nil {
+		return nil, fmt.Errorf("failed to store resolved alert %s: %w", alertID, err)
+	}
+	if err := s.clearState(ackKeyPrefix + alertID); err != nil {
+		return nil, err
+	}
+	data := req.eventData()
+	data["reason"] = ResolveReasonManual
+	if err := s.publishEvent(alertID, event.ActionResolved, data); err != nil {
+		return nil, err
+	}
+	if s.stale != nil {
+		if err := s.stale.Forget(alertID); err != nil {
+			return nil, fmt.Errorf("failed to stop tracking %s: %w", alertID, err)
+		}
+	}
+	if s.escalator != nil {
+		if err := s.escalator.Stop(alertID); err != nil {
+			return nil, fmt.Errorf("failed to stop escalations of %s: %w", alertID, err)
+		}
+	}
+	alert.Firing = false
+	alert.Acknowledgement = nil
+	alert.Alert = resolved
+	return alert, nil
+}
+
+// Silence silences an alert for req.Duration: the Processor does not fire it
+// again and the Escalator pauses its escalations until the silence runs out.
+// The silence is stored with that duration as expiration; storages without
+// per-key expiration keep the record, which is then ignored once it has run
+// out.
+func (s *Service) Silence(alertID string, req ActionRequest) (*Alert, error) {
+	duration, err := time.ParseDuration(req.Duration)
+	if err != nil || duration <= 0 {
+		return nil, invalid("invalid silence duration %q", req.Duration)
+	}
+	alert, err := s.Get(alertID)
+	if err != nil {
+		return nil, err
+	}
+
+	silence := Silence{By: req.By, Comment: req.Comment, Until: s.now().Add(duration)}
+	if err := s.setState(silenceKeyPrefix+alertID, silence, duration); err != nil {
+		return nil, err
+	}
+	data := req.eventData()
+	data["until"] = silence.Until.Format(time.RFC3339)
+	if err := s.publishEvent(alertID, event.ActionSilenced, data); err != nil {
+		return nil, err
+	}
+	alert.Silence = &silence
+	return alert, nil
+}
+
+func (s *Service) firing(alertID string) (*Alert, error) {
+	alert, err := s.Get(alertID)
+	if err != nil {
+		return nil, err
+	}
+	if !alert.Firing {
+		return nil, fmt.Errorf("%w: %s", ErrNotFiring, alertID)
+	}
+	return alert, nil
+}
+
+func (s *Service) resolved(alert *Alert) ([]byte, error) {
+	if alert.Version == alerting.VersionV1.String() {
+		alertV1, err := alerts.AlertFromBytes(alert.Alert)
+		if err != nil {
+			return nil, err
+		}
+		alertV1.Resolve(s.now())
+		return alertV1.Bytes(), nil
+	}
+	alertV2, err := alerts.AlertV2FromBytes(alert.Alert)
+	if err != nil {
+		return nil, err
+	}
+	alertV2.Resolve()
+	return alertV2.MarshalJSON()
+}
+
+func (s *Service) acknowledgement(alertID string) (*Acknowledgement, error) {
+	var ack *Acknowledgement
+	if err := s.getState(ackKeyPrefix+alertID, &ack); err != nil {
+		return nil, err
+	}
+	return ack, nil
+}
+
+func (s *Service) silence(alertID string) (*Silence, error) {
+	var silence *Silence
+	if err := s.getState(silenceKeyPrefix+alertID, &silence); err != nil {
+		return nil, err
+	}
+	if silence != nil && !s.now().Before(silence.Until) {
+		return nil, nil
+	}
+	return silence, nil
+}
+
+// getState decodes the state stored under key into v, leaving v untouched if
+// there is none.
+func (s *Service) getState(key string, v any) error {
+	data, err := s.storage.Get(key)
+	if errors.Is(err, alerting.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to load %s: %w", key, err)
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("failed to decode %s: %w", key, err)
+	}
+	return nil
+}
+
+func (s *Service) setState(key string, v any, expires time.Duration) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if err := s.storage.Set(key, data, expires); err != nil {
+		return fmt.Errorf("failed to store %s: %w", key, err)
+	}
+	return nil
+}
+
+// clearState deletes key, or overwrites it with null on storages that cannot
+// delete.
+func (s *Service) clearState(key string) error {
+	if deleter, ok := s.storage.(alerting.KeyDeleter); ok {
+		if err := deleter.Delete(key); err != nil {
+			return fmt.Errorf("failed to delete %s: %w", key, err)
+		}
+		return nil
+	}
+	return s.setState(key, nil, 0)
+}
+
+func (s *Service) publishEvent(alertID string, action event.Action, data map[string]any) error {
+	message := map[string]any{"alert_id": alertID}
+	for key, value := range data {
+		message[key] = value
+	}
+	apiEvent := event.NewEvent("alerting-api", event.TypeEvent, s.now(), action, message)
+	if err := s.stream.Publish(alerting.EvetTopic, apiEvent.Bytes()); err != nil {
+		return fmt.Errorf("failed to publish %s event for %s: %w", action, alertID, err)
+	}
+	return nil
+}
+
+func invalid(format string, args ...any) error {
+	return fmt.Errorf("%w: %s", ErrInvalidRequest, fmt.Sprintf(format, args...))
+}
+
+func isStateKey(key string) bool {
+	return strings.HasPrefix(key, ackKeyPrefix) || strings.HasPrefix(key, silenceKeyPrefix)
+}
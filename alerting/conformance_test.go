@@ -0,0 +1,64 @@
+package alerting_test
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/avilikof/go-shared-libs/alerting"
+	"github.com/avilikof/go-shared-libs/alerting/alertingtest"
+)
+
+// The NATS backed implementations are only checked when NATS_URL points at a
+// JetStream enabled server.
+func requireNATS(t *testing.T) {
+	t.Helper()
+	if os.Getenv(alerting.NATS_URL_JS) == "" {
+		t.Skipf("%s not set", alerting.NATS_URL_JS)
+	}
+}
+
+func newJetStreamHandler(t *testing.T) *alerting.JetStreamHandler {
+	t.Helper()
+	handler, err := alerting.NewJetStreamHandler()
+	if err != nil {
+		t.Fatalf("NewJetStreamHandler() error = %v", err)
+	}
+	t.Cleanup(handler.Close)
+	return handler
+}
+
+func TestJetStreamStorageConformance(t *testing.T) {
+	requireNATS(t)
+	alertingtest.RunStorageSuite(t, alertingtest.StorageSuite{
+		New: func(t *testing.T) alerting.Storage {
+			return newJetStreamHandler(t).Storage()
+		},
+		SkipTTL: true,
+	})
+}
+
+func TestJetStreamHandlerConformance(t *testing.T) {
+	requireNATS(t)
+	alertingtest.RunStreamSuite(t, alertingtest.StreamSuite{
+		New: func(t *testing.T) alerting.Stream {
+			return newJetStreamHandler(t)
+		},
+		Topic: "test.alert",
+	})
+}
+
+func TestStreamHandlerConformance(t *testing.T) {
+	requireNATS(t)
+	alertingtest.RunStreamSuite(t, alertingtest.StreamSuite{
+		New: func(t *testing.T) alerting.Stream {
+			handler, err := alerting.NewStreamHandler(alerting.NATS_URL_JS)
+			if err != nil {
+				t.Fatalf("NewStreamHandler() error = %v", err)
+			}
+			t.Cleanup(handler.Close)
+			return handler
+		},
+		Settle: 100 * time.Millisecond,
+	})
+}
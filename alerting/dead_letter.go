@@ -0,0 +1,173 @@
+package alerting
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/avilikof/go-shared-libs/alerts"
+)
+
+// DeadLetterTopic is the subject dead letters are published on.
+const DeadLetterTopic = "alert.dlq"
+
+// Headers recording why a message was dead-lettered.
+const (
+	HeaderDLQError     = "Dlq-Error"
+	HeaderDLQSubject   = "Dlq-Original-Subject"
+	HeaderDLQAttempts  = "Dlq-Attempts"
+	HeaderDLQTimestamp = "Dlq-Timestamp"
+)
+
+// DeadLetter is a message that could not be processed, kept with the
+// subject it was received on so that it can be re-driven once the cause is
+// fixed.
+type DeadLetter struct {
+	ID        string    `json:"id"`
+	Subject   string    `json:"subject"`
+	Error     string    `json:"error"`
+	Attempts  int       `json:"attempts"`
+	Timestamp time.Time `json:"timestamp"`
+	Data      []byte    `json:"data"`
+}
+
+// DeadLetterQueue keeps poison messages. Get, Redrive and Purge return an
+// error matching ErrNotFound for unknown IDs.
+type DeadLetterQueue interface {
+	// Send adds a dead letter; its ID is assigned by the queue.
+	Send(letter DeadLetter) error
+	// List returns up to limit dead letters, oldest first. A limit of 0
+	// returns all of them.
+	List(limit int) ([]DeadLetter, error)
+	Get(id string) (*DeadLetter, error)
+	// Redrive publishes the dead letter on its original subject again and
+	// removes it from the queue.
+	Redrive(id string) error
+	Purge(id string) error
+	PurgeAll() error
+}
+
+// DeadLetterConfig configures dead-lettering by a Processor.
+type DeadLetterConfig struct {
+	// Subject is the subject re-driven alerts are published on. Default
+	// "test.alert", the subject used by the alert generators.
+	Subject string
+	// MaxAttempts is how often processing an alert is tried before it is
+	// dead-lettered. With ConsumeV2 every delivery is an attempt, so the
+	// consumer's MaxDeliver must not be lower. Default 3.
+	MaxAttempts int
+	// RetryDelay is the wait before the second attempt, doubled before each
+	// later one. ConsumeV2 leaves the wait to the consumer's BackOff.
+	// Default 100 milliseconds.
+	RetryDelay time.Duration
+}
+
+// WithDeadLetterQueue retries alerts whose processing fails, e.g. because
+// storage is unavailable, and sends them to dlq as they were received once
+// config.MaxAttempts attempts have failed. Stored alerts that cannot be
+// decoded are sent to dlq on StorageTopic and replaced by the alert
+// received.
+func WithDeadLetterQueue(dlq DeadLetterQueue, config DeadLetterConfig) ProcessorOption {
+	if config.Subject == "" {
+		config.Subject = "test.alert"
+	}
+	if config.MaxAttempts < 1 {
+		config.MaxAttempts = 3
+	}
+	if config.RetryDelay <= 0 {
+		config.RetryDelay = 100 * time.Millisecond
+	}
+	return func(p *Processor) {
+		p.dlq = dlq
+		p.dlqConfig = config
+	}
+}
+
+func (p *Processor) maxAttempts() int {
+	if p.dlq == nil {
+		return 1
+	}
+	return p.dlqConfig.MaxAttempts
+}
+
+// errDeadLettered marks processing errors of alerts that were sent to the
+// dead-letter queue.
+var errDeadLettered = errors.New("dead-lettered")
+
+// deadLetter sends an alert received as data on subject that failed attempts
+// times to the dead-letter queue, if there is one, and reports whether it was
+// sent.
+func (p *Processor) deadLetter(alertID, subject string, data []byte, cause error, attempts int) bool {
+	if p.dlq == nil {
+		return false
+	}
+	err := p.dlq.Send(DeadLetter{
+		Subject:   subject,
+		Error:     cause.Error(),
+		Attempts:  attempts,
+		Timestamp: time.Now(),
+		Data:      data,
+	})
+	if err != nil {
+		fmt.Printf("Alert :: %s :: failed to dead-letter: %v\n", alertID, err)
+		return false
+	}
+	fmt.Printf("Alert :: %s dead-lettered after %d attempt(s)\n", alertID, attempts)
+	return true
+}
+
+// deadLetterStored reports a stored alert that cannot be decoded and sends
+// it to the dead-letter queue, if there is one, on StorageTopic, so that a
+// redrive stores it again once it has been fixed. The caller replaces the
+// stored alert with the one it received.
+func (p *Processor) deadLetterStored(alertID string, data []byte, cause error) {
+	cause = fmt.Errorf("decoding stored alert: %w", cause)
+	p.publishLog(cause, alertID)
+	p.deadLetter(alertID, StorageTopic, data, cause, 1)
+}
+
+// ForwardAlerts decodes the v1 alerts received from subject on messages and
+// sends them to output, normally the input of a Processor. Payloads that
+// cannot be decoded are sent to dlq, or dropped if dlq is nil. It returns
+// when messages is closed. Durable streams acknowledge messages once they
+// are on the channel, so one that was not processed before a crash is lost;
+// subscribe with Processor.HandleMsg to process them at least once.
+func ForwardAlerts(messages <-chan []byte, subject string, output chan<- *alerts.Alert, dlq DeadLetterQueue) {
+	for data := range messages {
+		alert, err := alerts.AlertFromBytes(data)
+		if err == nil {
+			output <- alert
+			continue
+		}
+		forwardFailed(subject, data, err, dlq)
+	}
+}
+
+// ForwardAlertsV2 is ForwardAlerts for v2 alerts.
+func ForwardAlertsV2(messages <-chan []byte, subject string, output chan<- *alerts.AlertV2, dlq DeadLetterQueue) {
+	for data := range messages {
+		alert, err := alerts.AlertV2FromBytes(data)
+		if err == nil {
+			output <- alert
+			continue
+		}
+		forwardFailed(subject, data, err, dlq)
+	}
+}
+
+func forwardFailed(subject string, data []byte, cause error, dlq DeadLetterQueue) {
+	fmt.Printf("Alert :: undecodable message on %s: %v\n", subject, cause)
+	if dlq == nil {
+		return
+	}
+	err := dlq.Send(DeadLetter{
+		Subject:   subject,
+		Error:     fmt.Sprintf("decoding alert: %v", cause),
+		Attempts:  1,
+		Timestamp: time.Now(),
+		Data:      data,
+	})
+	if err != nil {
+		fmt.Printf("Alert :: failed to dead-letter message from %s: %v\n", subject, err)
+	}
+}
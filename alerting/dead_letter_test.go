@@ -0,0 +1,178 @@
+package alerting_test
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/avilikof/go-shared-libs/alerting"
+	"github.com/avilikof/go-shared-libs/alerting/alertingtest"
+	"github.com/avilikof/go-shared-libs/alerts"
+	"github.com/avilikof/go-shared-libs/event"
+)
+
+// unavailableStorage fails every Get of key.
+type unavailableStorage struct {
+	alerting.Storage
+	key string
+}
+
+func (s unavailableStorage) Get(key string) ([]byte, error) {
+	if key == s.key {
+		return nil, errors.New("storage unavailable")
+	}
+	return s.Storage.Get(key)
+}
+
+func TestProcessor_DeadLettersAfterMaxAttempts(t *testing.T) {
+	storage := unavailableStorage{Storage: alertingtest.NewStorage(nil), key: "disk"}
+	stream := alertingtest.NewStream()
+	defer stream.Close()
+	dlq := alertingtest.NewDeadLetterQueue(stream)
+
+	input := make(chan *alerts.AlertV2)
+	processor := alerting.NewProcessorV2(input, storage, stream,
+		alerting.WithDeadLetterQueue(dlq, alerting.DeadLetterConfig{MaxAttempts: 2, RetryDelay: 20 * time.Millisecond}),
+		alerting.WithPipeline(alerting.NewPipeline(alerting.StaticLabels(map[string]string{"team": "infra"}))))
+	done := make(chan struct{})
+	go func() {
+		processor.ProcessV2()
+		close(done)
+	}()
+	start := time.Now()
+	input <- alerts.NewAlertV2("disk", "node-exporter", "critical", "disk_full", "disk", "disk", time.Now(), alerts.AlertStateActive)
+	input <- alerts.NewAlertV2("cpu", "node-exporter", "critical", "cpu_high", "cpu", "cpu", time.Now(), alerts.AlertStateActive)
+	close(input)
+	<-done
+
+	if elapsed := time.Since(start); elapsed < 20*time.Millisecond {
+		t.Errorf("processing took %s; want a retry delay of 20ms", elapsed)
+	}
+	letters, _ := dlq.List(0)
+	if len(letters) != 1 {
+		t.Fatalf("got %d dead letters; want 1", len(letters))
+	}
+	letter := letters[0]
+	if letter.Subject != "test.alert" || letter.Attempts != 2 {
+		t.Errorf("dead letter = %s after %d attempts; want test.alert after 2", letter.Subject, letter.Attempts)
+	}
+	if alert, err := alerts.AlertV2FromBytes(letter.Data); err != nil || alert.ID() != "disk" || len(alert.Labels()) != 0 {
+		t.Errorf("dead letter payload = %q; want the disk alert as received", letter.Data)
+	}
+	alertingtest.ExpectEvent(t, stream, event.ActionError, "disk")
+	alertingtest.ExpectEvent(t, stream, event.ActionFiring, "cpu")
+}
+
+func TestProcessor_ReplacesUndecodableStoredAlerts(t *testing.T) {
+	storage := alertingtest.NewStorage(nil)
+	stream := alertingtest.NewStream()
+	defer stream.Close()
+	stream.Persist(storage, 0)
+	dlq := alertingtest.NewDeadLetterQueue(stream)
+	for _, id := range []string{"v1", "v2"} {
+		if err := storage.Set(id, []byte("corrupt"), 0); err != nil {
+			t.Fatalf("Set() error = %v", err)
+		}
+	}
+
+	input := make(chan *alerts.Alert, 1)
+	input <- alerts.NewAlert("v1", "disk", "disk full", time.Now(), true)
+	close(input)
+	alerting.NewProcessor(input, storage, stream, alerting.WithDeadLetterQueue(dlq, alerting.DeadLetterConfig{})).Process()
+
+	inputV2 := make(chan *alerts.AlertV2, 1)
+	inputV2 <- alerts.NewAlertV2("v2", "node-exporter", "critical", "disk_full", "disk", "v2", time.Now(), alerts.AlertStateActive)
+	close(inputV2)
+	alerting.NewProcessorV2(inputV2, storage, stream, alerting.WithDeadLetterQueue(dlq, alerting.DeadLetterConfig{})).ProcessV2()
+
+	letters, _ := dlq.List(0)
+	if len(letters) != 2 {
+		t.Fatalf("got %d dead letters; want the 2 stored alerts", len(letters))
+	}
+	for _, letter := range letters {
+		if letter.Subject != alerting.StorageTopic || string(letter.Data) != "corrupt" {
+			t.Errorf("dead letter = %q on %s; want the stored alert on %s", letter.Data, letter.Subject, alerting.StorageTopic)
+		}
+	}
+	if data, _ := storage.Get("v1"); !json.Valid(data) {
+		t.Errorf("stored v1 alert = %q; want it replaced", data)
+	}
+	alertingtest.ExpectEvent(t, stream, event.ActionFiring, "v2")
+}
+
+func TestForwardAlertsV2_DeadLettersUndecodable(t *testing.T) {
+	stream := alertingtest.NewStream()
+	defer stream.Close()
+	dlq := alertingtest.NewDeadLetterQueue(stream)
+
+	alert := alerts.NewAlertV2("disk", "node-exporter", "critical", "disk_full", "disk", "disk", time.Now(), alerts.AlertStateActive)
+	data, _ := alert.MarshalJSON()
+	messages := make(chan []byte, 2)
+	messages <- []byte("not json")
+	messages <- data
+	close(messages)
+
+	output := make(chan *alerts.AlertV2, 2)
+	alerting.ForwardAlertsV2(messages, "test.alert", output, dlq)
+	if len(output) != 1 || (<-output).ID() != "disk" {
+		t.Error("expected the valid alert to be forwarded")
+	}
+	letters, _ := dlq.List(0)
+	if len(letters) != 1 || string(letters[0].Data) != "not json" {
+		t.Fatalf("dead letters = %+v; want the undecodable payload", letters)
+	}
+
+	if err := dlq.Redrive(letters[0].ID); err != nil {
+		t.Fatalf("Redrive() error = %v", err)
+	}
+	if got := stream.Messages("test.alert"); len(got) != 1 {
+		t.Errorf("got %d re-driven messages; want 1", len(got))
+	}
+}
+
+func TestJetStreamDeadLetterQueue(t *testing.T) {
+	requireNATS(t)
+	handler := newJetStreamHandler(t)
+	dlq, err := alerting.NewJetStreamDeadLetterQueue(handler.JetStream(), time.Hour)
+	if err != nil {
+		t.Fatalf("NewJetStreamDeadLetterQueue() error = %v", err)
+	}
+	if err := dlq.PurgeAll(); err != nil {
+		t.Fatalf("PurgeAll() error = %v", err)
+	}
+
+	subject := alerting.TenantPrefix + "dlq-" + strconv.FormatInt(time.Now().UnixNano(), 10) + ".test.alert"
+	for _, data := range []string{"first", "second"} {
+		letter := alerting.DeadLetter{Subject: subject, Error: "boom", Attempts: 3, Timestamp: time.Now(), Data: []byte(data)}
+		if err := dlq.Send(letter); err != nil {
+			t.Fatalf("Send() error = %v", err)
+		}
+	}
+	letters, err := dlq.List(0)
+	if err != nil || len(letters) != 2 {
+		t.Fatalf("List() = %d dead letters, %v; want 2", len(letters), err)
+	}
+	if letters[0].Error != "boom" || letters[0].Attempts != 3 || letters[0].Subject != subject {
+		t.Errorf("List()[0] = %+v; want the headers restored", letters[0])
+	}
+
+	if err := dlq.Redrive(letters[0].ID); err != nil {
+		t.Fatalf("Redrive() error = %v", err)
+	}
+	msg, err := handler.JetStream().GetLastMsg(alerting.ALERT_STREAM, subject)
+	if err != nil || string(msg.Data) != "first" {
+		t.Errorf("re-driven message = %v, %v; want first", msg, err)
+	}
+	if _, err := dlq.Get(letters[0].ID); !errors.Is(err, alerting.ErrNotFound) {
+		t.Errorf("Get() after Redrive() error = %v; want ErrNotFound", err)
+	}
+
+	if err := dlq.Purge(letters[1].ID); err != nil {
+		t.Fatalf("Purge() error = %v", err)
+	}
+	if letters, _ := dlq.List(0); len(letters) != 0 {
+		t.Errorf("List() after Purge() = %d dead letters; want 0", len(letters))
+	}
+}
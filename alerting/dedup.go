@@ -0,0 +1,145 @@
+package alerting
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MessageID returns a deterministic ID for a message published on topic, so
+// that a retried publish of the same alert carries the same ID and can be
+// dropped by the transport. JetStreamHandler derives it for producer-facing
+// input subjects only: the Processor's state writes and events recur with
+// identical content whenever an alert flaps, e.g. fires, resolves and fires
+// again within the duplicate window, and must never be dropped.
+func MessageID(topic string, data []byte) string {
+	hash := sha256.New()
+	hash.Write([]byte(topic))
+	hash.Write([]byte{0})
+	hash.Write(data)
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// internalSubject reports whether subject is StorageTopic or EvetTopic, on
+// its own or under a tenant prefix.
+func internalSubject(subject string) bool {
+	if tenantSubject, ok := strings.CutPrefix(subject, TenantPrefix); ok {
+		_, subject, _ = strings.Cut(tenantSubject, ".")
+	}
+	return subject == StorageTopic || subject == EvetTopic
+}
+
+// DedupCache remembers recently seen IDs for transports without server-side
+// duplicate detection. It holds at most size IDs, each for ttl.
+type DedupCache struct {
+	mu    sync.Mutex
+	size  int
+	ttl   time.Duration
+	order *list.List
+	seen  map[string]*list.Element
+	now   func() time.Time
+}
+
+type dedupEntry struct {
+	id     string
+	value  string
+	seenAt time.Time
+}
+
+// NewDedupCache creates a DedupCache. A size below 1 defaults to 10000 and a
+// non-positive ttl to two minutes, the default JetStream duplicate window.
+func NewDedupCache(size int, ttl time.Duration) *DedupCache {
+	if size < 1 {
+		size = 10000
+	}
+	if ttl <= 0 {
+		ttl = 2 * time.Minute
+	}
+	return &DedupCache{
+		size:  size,
+		ttl:   ttl,
+		order: list.New(),
+		seen:  make(map[string]*list.Element),
+		now:   time.Now,
+	}
+}
+
+// Seen records id and reports whether it was already seen within the ttl.
+func (c *DedupCache) Seen(id string) bool {
+	return c.SeenLatest(id, "")
+}
+
+// SeenLatest records value as the latest value of id and reports whether it
+// already was its latest value within the ttl. Unlike Seen it tells a value
+// that recurs after another one, such as the payload of an alert that fired,
+// resolved and fired again, from a retry.
+func (c *DedupCache) SeenLatest(id, value string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	for front := c.order.Front(); front != nil; front = c.order.Front() {
+		entry := front.Value.(dedupEntry)
+		if now.Sub(entry.seenAt) < c.ttl && c.order.Len() < c.size {
+			break
+		}
+		c.order.Remove(front)
+		delete(c.seen, entry.id)
+	}
+
+	if element, ok := c.seen[id]; ok {
+		if element.Value.(dedupEntry).value == value {
+			return true
+		}
+		c.order.Remove(element)
+	}
+	c.seen[id] = c.order.PushBack(dedupEntry{id: id, value: value, seenAt: now})
+	return false
+}
+
+// Forget removes id, so that it is not reported as seen again.
+func (c *DedupCache) Forget(id string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if element, ok := c.seen[id]; ok {
+		c.order.Remove(element)
+		delete(c.seen, id)
+	}
+}
+
+// WithDedupCache drops alerts that are identical to the previous alert of the
+// same ID received within the cache's ttl before processing them, e.g.
+// producer retries delivered by StreamHandler, Redis or Kafka. An alert that
+// flaps back to an earlier payload is processed again. Together with
+// WithStaleTracker, dropped alerts still count as resent.
+func WithDedupCache(cache *DedupCache) ProcessorOption {
+	return func(p *Processor) {
+		p.dedup = cache
+	}
+}
+
+// duplicate reports whether the previous alert alertID had hash, and then
+// records the alert as seen with the stale tracker.
+func (p *Processor) duplicate(alertID, hash string) bool {
+	if p.dedup == nil || !p.dedup.SeenLatest(alertID, hash) {
+		return false
+	}
+	fmt.Printf("Alert :: %s duplicate dropped\n", alertID)
+	if p.stale != nil {
+		if err := p.stale.Touch(alertID); err != nil {
+			p.publishLog(err, alertID)
+		}
+	}
+	return true
+}
+
+// forget lets an alert that failed to process be processed again.
+func (p *Processor) forget(alertID string) {
+	if p.dedup != nil {
+		p.dedup.Forget(alertID)
+	}
+}
@@ -0,0 +1,118 @@
+package alerting
+
+import (
+	"testing"
+	"time"
+
+	"github.com/avilikof/go-shared-libs/alerts"
+	"github.com/avilikof/go-shared-libs/event"
+)
+
+func TestMessageID(t *testing.T) {
+	data := []byte(`{"id":"disk"}`)
+	if MessageID(StorageTopic, data) != MessageID(StorageTopic, []byte(`{"id":"disk"}`)) {
+		t.Error("expected the same message to get the same ID")
+	}
+	if MessageID(StorageTopic, data) == MessageID(EvetTopic, data) {
+		t.Error("expected the topic to be part of the ID")
+	}
+}
+
+func TestDedupCache(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	cache := NewDedupCache(2, time.Minute)
+	cache.now = func() time.Time { return now }
+
+	if cache.Seen("a") {
+		t.Error("a is new")
+	}
+	if !cache.Seen("a") {
+		t.Error("expected a to be a duplicate")
+	}
+
+	now = now.Add(time.Minute)
+	if cache.Seen("a") {
+		t.Error("expected a to expire after the ttl")
+	}
+
+	cache.Seen("b")
+	cache.Seen("c")
+	if cache.Seen("a") {
+		t.Error("expected a to be evicted when the cache is full")
+	}
+
+	cache.Forget("a")
+	if cache.Seen("a") {
+		t.Error("expected a to be new again after Forget")
+	}
+}
+
+func TestDedupCache_SeenLatest(t *testing.T) {
+	cache := NewDedupCache(0, 0)
+	for i, step := range []struct {
+		value string
+		want  bool
+	}{
+		{"firing", false},
+		{"firing", true},
+		{"resolved", false},
+		{"firing", false},
+	} {
+		if got := cache.SeenLatest("disk", step.value); got != step.want {
+			t.Errorf("step %d: SeenLatest(disk, %s) = %v; want %v", i, step.value, got, step.want)
+		}
+	}
+}
+
+func TestProcessor_WithDedupCache(t *testing.T) {
+	storage := newMemStorage()
+	stream := newMemStream()
+	p := NewProcessorV2(nil, storage, stream, WithDedupCache(NewDedupCache(0, 0)))
+
+	receivedAt := time.Now()
+	p.processAlertV2(alerts.NewAlertV2("disk", "node-exporter", "critical", "disk_full", "disk", "disk", receivedAt, alerts.AlertStateActive))
+	p.processAlertV2(alerts.NewAlertV2("disk", "node-exporter", "critical", "disk_full", "disk", "disk", receivedAt, alerts.AlertStateActive))
+	if got := len(stream.published[StorageTopic]); got != 1 {
+		t.Fatalf("expected the retried alert to be dropped, got %d stores", got)
+	}
+	_ = storage.Set("disk", stream.published[StorageTopic][0], 0)
+
+	p.processAlertV2(alerts.NewAlertV2("disk", "node-exporter", "critical", "disk_full", "disk", "disk", receivedAt, alerts.AlertStateResolved))
+	if got := len(stream.events(event.ActionResolved)); got != 1 {
+		t.Errorf("expected the resolution to be processed, got %d resolved events", got)
+	}
+	_ = storage.Set("disk", stream.published[StorageTopic][1], 0)
+
+	// The alert flaps back to its first payload.
+	p.processAlertV2(alerts.NewAlertV2("disk", "node-exporter", "critical", "disk_full", "disk", "disk", receivedAt, alerts.AlertStateActive))
+	if got := len(stream.events(event.ActionFiring)); got != 2 {
+		t.Errorf("expected the alert to fire again, got %d firing events", got)
+	}
+}
+
+func TestProcessor_DedupCountsDropsAsResends(t *testing.T) {
+	storage := newMemStorage()
+	stream := newMemStream()
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	cache := NewDedupCache(0, time.Hour)
+	cache.now = func() time.Time { return now }
+	tracker := NewStaleTracker(storage, stream, 5*time.Minute)
+	tracker.now = func() time.Time { return now }
+	p := NewProcessorV2(nil, storage, stream, WithDedupCache(cache), WithStaleTracker(tracker))
+
+	receivedAt := now
+	p.processAlertV2(alerts.NewAlertV2("disk", "node-exporter", "critical", "disk_full", "disk", "disk", receivedAt, alerts.AlertStateActive))
+	now = now.Add(4 * time.Minute)
+	p.processAlertV2(alerts.NewAlertV2("disk", "node-exporter", "critical", "disk_full", "disk", "disk", receivedAt, alerts.AlertStateActive))
+	if got := len(stream.published[StorageTopic]); got != 1 {
+		t.Fatalf("expected the resent alert to be dropped, got %d stores", got)
+	}
+
+	now = now.Add(4 * time.Minute)
+	if err := tracker.Sweep(); err != nil {
+		t.Fatalf("Sweep() error = %v", err)
+	}
+	if got := len(stream.events(event.ActionResolved)); got != 0 {
+		t.Errorf("expected the resent alert to stay firing, got %d resolved events", got)
+	}
+}
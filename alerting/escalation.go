@@ -0,0 +1,367 @@
+package alerting
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/avilikof/go-shared-libs/alerts"
+	"github.com/avilikof/go-shared-libs/event"
+)
+
+// escalationKeyPrefix prefixes the key holding the running escalations of an
+// alert, so that they survive restarts and replicas escalating different
+// alerts never overwrite each other.
+const escalationKeyPrefix = "escalation.alert."
+
+var ErrUnknownEscalationPolicy = errors.New("unknown escalation policy")
+
+// EscalationStep is one stage of an escalation policy. Receivers are notified
+// Delay after the previous step (or after the alert fired, for the first
+// step), then again every Delay for Repeat more times before the escalation
+// moves on to the next step.
+type EscalationStep struct {
+	Delay     time.Duration `json:"delay" yaml:"delay"`
+	Receivers []string      `json:"receivers" yaml:"receivers"`
+	Repeat    int           `json:"repeat,omitempty" yaml:"repeat"`
+}
+
+// EscalationPolicy is a named, ordered list of escalation steps referenced by
+// alerts.Action.EscalationPolicy.
+type EscalationPolicy struct {
+	Name  string           `json:"name" yaml:"name"`
+	Steps []EscalationStep `json:"steps" yaml:"steps"`
+}
+
+type escalation struct {
+	AlertID    string            `json:"alert_id"`
+	Policy     string            `json:"policy"`
+	ActionType string            `json:"action_type,omitempty"`
+	Target     string            `json:"target,omitempty"`
+	Labels     map[string]string `json:"labels,omitempty"`
+	Step       int               `json:"step"`
+	Sent       int               `json:"sent"`
+	NextAt     time.Time         `json:"next_at"`
+}
+
+// Escalator runs escalation policies for firing alerts. Every notification is
+// published as an escalated event on the event topic; the escalation state is
+// kept in Storage, one key per alert, so that a restarted Escalator picks up
+// where it left off. Tick requires the storage to implement KeyLister.
+// Escalations of alerts muted by a maintenance window or silenced are paused
+// until the window closes or the silence runs out; escalations of
+// acknowledged alerts are stopped. Silences and acknowledgements are read
+// from the storage, so the Escalator must share it with the alerting API.
+type Escalator struct {
+	mu          sync.Mutex
+	storage     Storage
+	stream      Stream
+	policies    map[string]EscalationPolicy
+	interval    time.Duration
+	maintenance *MaintenanceSchedule
+	now         func() time.Time
+}
+
+// NewEscalator creates an Escalator that checks for due steps every interval.
+func NewEscalator(storage Storage, stream Stream, interval time.Duration, policies ...EscalationPolicy) *Escalator {
+	byName := make(map[string]EscalationPolicy, len(policies))
+	for _, policy := range policies {
+		byName[policy.Name] = policy
+	}
+	return &Escalator{
+		storage:  storage,
+		stream:   stream,
+		policies: byName,
+		interval: interval,
+		now:      time.Now,
+	}
+}
+
+// Start begins an escalation for every action of the alert that references a
+// policy. Actions with AutoCreate and no policy notify their target at once.
+// Escalations already running for the alert are left untouched.
+func (e *Escalator) Start(alert *alerts.AlertV2) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	active, err := e.load(alert.ID())
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	changed := false
+	for _, action := range alert.Actions() {
+		if action.EscalationPolicy == "" {
+			if action.AutoCreate {
+				errs = append(errs, e.publish(escalation{
+					AlertID:    alert.ID(),
+					ActionType: action.Type,
+					Target:     action.Target,
+				}, []string{action.Target}))
+			}
+			continue
+		}
+
+		policy, ok := e.policies[action.EscalationPolicy]
+		if !ok {
+			errs = append(errs, fmt.Errorf("%w: %s", ErrUnknownEscalationPolicy, action.EscalationPolicy))
+			continue
+		}
+		if len(policy.Steps) == 0 || running(active, alert.ID(), policy.Name) {
+			continue
+		}
+
+		active = append(active, escalation{
+			AlertID:    alert.ID(),
+			Policy:     policy.Name,
+			ActionType: action.Type,
+			Target:     action.Target,
+			Labels:     alert.Labels(),
+			NextAt:     e.now().Add(policy.Steps[0].Delay),
+		})
+		changed = true
+	}
+
+	if changed {
+		errs = append(errs, e.save(alert.ID(), active))
+	}
+	return errors.Join(errs...)
+}
+
+// Stop ends all escalations of an alert, e.g. because it was acknowledged or
+// resolved.
+func (e *Escalator) Stop(alertID string) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	active, err := e.load(alertID)
+	if err != nil || len(active) == 0 {
+		return err
+	}
+	return e.save(alertID, nil)
+}
+
+// Tick publishes every escalation step that is due and advances the
+// escalations accordingly.
+func (e *Escalator) Tick() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	lister, ok := e.storage.(KeyLister)
+	if !ok {
+		return fmt.Errorf("%w: storage cannot list keys", errors.ErrUnsupported)
+	}
+	keys, err := lister.List()
+	if err != nil {
+		return fmt.Errorf("failed to list escalations: %w", err)
+	}
+
+	var errs []error
+	for _, key := range keys {
+		alertID, ok := strings.CutPrefix(key, escalationKeyPrefix)
+		if !ok {
+			continue
+		}
+		active, err := e.load(alertID)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if err := e.tick(alertID, active); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// tick publishes the due steps of the escalations of an alert and saves them
+// if they advanced.
+func (e *Escalator) tick(alertID string, active []escalation) error {
+	now := e.now()
+	if due(active, now) {
+		acked, err := acknowledged(e.storage, alertID)
+		if err != nil {
+			return err
+		}
+		if acked {
+			fmt.Printf("Escalation :: %s stopped, alert acknowledged\n", alertID)
+			return e.save(alertID, nil)
+		}
+		silenced, err := silenced(e.storage, alertID, now)
+		if err != nil {
+			return err
+		}
+		if silenced {
+			fmt.Printf("Escalation :: %s paused, alert silenced\n", alertID)
+			return nil
+		}
+	}
+
+	var errs []error
+	changed := false
+	remaining := make([]escalation, 0, len(active))
+	for _, esc := range active {
+		policy, ok := e.policies[esc.Policy]
+		if !ok || esc.Step >= len(policy.Steps) {
+			changed = true
+			continue
+		}
+		if esc.NextAt.After(now) {
+			remaining = append(remaining, esc)
+			continue
+		}
+		if e.maintenance != nil {
+			// The due step is sent once the window closes.
+			if window, muted := e.maintenance.mutedLabels(esc.Labels); muted {
+				fmt.Printf("Escalation :: %s paused by maintenance window %s\n", esc.AlertID, window)
+				remaining = append(remaining, esc)
+				continue
+			}
+		}
+
+		step := policy.Steps[esc.Step]
+		if err := e.publish(esc, step.Receivers); err != nil {
+			errs = append(errs, err)
+			remaining = append(remaining, esc)
+			continue
+		}
+
+		changed = true
+		esc.Sent++
+		if esc.Sent > step.Repeat {
+			esc.Step++
+			esc.Sent = 0
+			if esc.Step >= len(policy.Steps) {
+				continue
+			}
+			step = policy.Steps[esc.Step]
+		}
+		esc.NextAt = now.Add(step.Delay)
+		remaining = append(remaining, esc)
+	}
+
+	if changed {
+		errs = append(errs, e.save(alertID, remaining))
+	}
+	return errors.Join(errs...)
+}
+
+// Run calls Tick every interval until ctx is cancelled.
+func (e *Escalator) Run(ctx context.Context) error {
+	ticker := time.NewTicker(e.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+			if err := e.Tick(); err != nil {
+				fmt.Printf("Escalation tick failed: %v\n", err)
+			}
+		}
+	}
+}
+
+// Watch stops escalations whenever an acknowledged or resolved event is seen
+// on the event topic. It blocks until ctx is cancelled or the stream is
+// closed.
+func (e *Escalator) Watch(ctx context.Context) error {
+	events := make(chan []byte)
+	sub, err := e.stream.Subscribe(EvetTopic, events)
+	if err != nil {
+		return err
+	}
+	defer sub.Unsubscribe()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-sub.Done():
+			return ErrClosed
+		case data := <-events:
+			ev, err := event.FromBytes(data)
+			if err != nil {
+				continue
+			}
+			if ev.Action != event.ActionAcknowledged && ev.Action != event.ActionResolved {
+				continue
+			}
+			alertID, _ := ev.Message["alert_id"].(string)
+			if alertID == "" {
+				continue
+			}
+			if err := e.Stop(alertID); err != nil {
+				fmt.Printf("Failed to stop escalation for %s: %v\n", alertID, err)
+			}
+		}
+	}
+}
+
+func (e *Escalator) publish(esc escalation, receivers []string) error {
+	escalatedEvent := escalatedEvent(esc.AlertID, map[string]any{
+		"policy":      esc.Policy,
+		"step":        esc.Step,
+		"attempt":     esc.Sent + 1,
+		"receivers":   receivers,
+		"action_type": esc.ActionType,
+		"target":      esc.Target,
+	})
+	return e.stream.Publish(EvetTopic, escalatedEvent.Bytes())
+}
+
+func (e *Escalator) load(alertID string) ([]escalation, error) {
+	data, err := e.storage.Get(escalationKeyPrefix + alertID)
+	if errors.Is(err, ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load escalations of %s: %w", alertID, err)
+	}
+	var active []escalation
+	if err := json.Unmarshal(data, &active); err != nil {
+		return nil, fmt.Errorf("failed to decode escalations of %s: %w", alertID, err)
+	}
+	return active, nil
+}
+
+// save stores the escalations of an alert, deleting its key once none are
+// left on storages that can delete keys.
+func (e *Escalator) save(alertID string, active []escalation) error {
+	key := escalationKeyPrefix + alertID
+	if len(active) == 0 {
+		if deleter, ok := e.storage.(KeyDeleter); ok {
+			return deleter.Delete(key)
+		}
+	}
+	data, err := json.Marshal(active)
+	if err != nil {
+		return err
+	}
+	return e.storage.Set(key, data, 0)
+}
+
+// due reports whether a step of one of the escalations is due at now.
+func due(active []escalation, now time.Time) bool {
+	for _, esc := range active {
+		if !esc.NextAt.After(now) {
+			return true
+		}
+	}
+	return false
+}
+
+func running(active []escalation, alertID, policy string) bool {
+	for _, esc := range active {
+		if esc.AlertID == alertID && esc.Policy == policy {
+			return true
+		}
+	}
+	return false
+}
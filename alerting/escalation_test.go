@@ -0,0 +1,193 @@
+package alerting
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/avilikof/go-shared-libs/alerts"
+	"github.com/avilikof/go-shared-libs/event"
+)
+
+func newEscalationTestAlert() *alerts.AlertV2 {
+	alert := alerts.NewAlertV2("a1", "test", "critical", "cpu_high", "cpu", "a1", time.Now(), alerts.AlertStateActive)
+	alert.AddAction(alerts.Action{Type: "callout", Target: "pagerduty", EscalationPolicy: "oncall"})
+	return alert
+}
+
+func TestEscalator_StepsAndRepeats(t *testing.T) {
+	storage := newMemStorage()
+	stream := newMemStream()
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	e := NewEscalator(storage, stream, time.Second, EscalationPolicy{
+		Name: "oncall",
+		Steps: []EscalationStep{
+			{Delay: time.Minute, Receivers: []string{"primary"}, Repeat: 1},
+			{Delay: 5 * time.Minute, Receivers: []string{"secondary"}},
+		},
+	})
+	e.now = func() time.Time { return now }
+
+	if err := e.Start(newEscalationTestAlert()); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+
+	// Nothing is due yet.
+	if err := e.Tick(); err != nil {
+		t.Fatalf("Tick() error = %v", err)
+	}
+	if got := len(stream.events(event.ActionEscalated)); got != 0 {
+		t.Fatalf("expected no escalations before the first delay, got %d", got)
+	}
+
+	wantReceivers := []string{"primary", "primary", "secondary"}
+	for i, want := range wantReceivers {
+		now = now.Add(5 * time.Minute)
+		if err := e.Tick(); err != nil {
+			t.Fatalf("Tick() error = %v", err)
+		}
+		escalated := stream.events(event.ActionEscalated)
+		if len(escalated) != i+1 {
+			t.Fatalf("expected %d escalations, got %d", i+1, len(escalated))
+		}
+		receivers := escalated[i].Message["receivers"].([]any)
+		if receivers[0] != want {
+			t.Errorf("escalation %d went to %v, want %s", i, receivers, want)
+		}
+	}
+
+	// The policy is exhausted.
+	now = now.Add(time.Hour)
+	if err := e.Tick(); err != nil {
+		t.Fatalf("Tick() error = %v", err)
+	}
+	if got := len(stream.events(event.ActionEscalated)); got != len(wantReceivers) {
+		t.Errorf("expected %d escalations after the last step, got %d", len(wantReceivers), got)
+	}
+}
+
+func TestEscalator_StopAndRestart(t *testing.T) {
+	storage := newMemStorage()
+	stream := newMemStream()
+	policy := EscalationPolicy{Name: "oncall", Steps: []EscalationStep{{Receivers: []string{"primary"}}}}
+
+	if err := NewEscalator(storage, stream, time.Second, policy).Start(newEscalationTestAlert()); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+
+	// A new Escalator over the same storage resumes the escalation.
+	restarted := NewEscalator(storage, stream, time.Second, policy)
+	if err := restarted.Stop("other"); err != nil {
+		t.Fatalf("Stop() error = %v", err)
+	}
+	if err := restarted.Tick(); err != nil {
+		t.Fatalf("Tick() error = %v", err)
+	}
+	if got := len(stream.events(event.ActionEscalated)); got != 1 {
+		t.Fatalf("expected 1 escalation after restart, got %d", got)
+	}
+
+	if err := restarted.Start(newEscalationTestAlert()); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	if err := restarted.Stop("a1"); err != nil {
+		t.Fatalf("Stop() error = %v", err)
+	}
+	if err := restarted.Tick(); err != nil {
+		t.Fatalf("Tick() error = %v", err)
+	}
+	if got := len(stream.events(event.ActionEscalated)); got != 1 {
+		t.Errorf("expected no escalation after Stop, got %d", got-1)
+	}
+}
+
+func TestEscalator_UnknownPolicy(t *testing.T) {
+	e := NewEscalator(newMemStorage(), newMemStream(), time.Second)
+	if err := e.Start(newEscalationTestAlert()); err == nil {
+		t.Error("expected an error for an unknown escalation policy")
+	}
+}
+
+// failingGetStorage fails every Get of key.
+type failingGetStorage struct {
+	*memStorage
+	key string
+}
+
+func (s failingGetStorage) Get(key string) ([]byte, error) {
+	if key == s.key {
+		return nil, errors.New("storage unavailable")
+	}
+	return s.memStorage.Get(key)
+}
+
+func TestEscalator_KeepsEscalationsOfOtherReplicas(t *testing.T) {
+	storage := newMemStorage()
+	stream := newMemStream()
+	policy := EscalationPolicy{Name: "oncall", Steps: []EscalationStep{{Receivers: []string{"primary"}}}}
+
+	second := alerts.NewAlertV2("a2", "test", "critical", "disk_full", "disk", "a2", time.Now(), alerts.AlertStateActive)
+	second.AddAction(alerts.Action{Type: "callout", Target: "pagerduty", EscalationPolicy: "oncall"})
+	if err := NewEscalator(storage, stream, time.Second, policy).Start(newEscalationTestAlert()); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	if err := NewEscalator(storage, stream, time.Second, policy).Start(second); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+
+	// A failed read must not be mistaken for no escalations and overwrite them.
+	failing := NewEscalator(failingGetStorage{storage, escalationKeyPrefix + "a1"}, stream, time.Second, policy)
+	if err := failing.Start(newEscalationTestAlert()); err == nil {
+		t.Error("Start() error = nil; want the storage error")
+	}
+
+	if err := NewEscalator(storage, stream, time.Second, policy).Tick(); err != nil {
+		t.Fatalf("Tick() error = %v", err)
+	}
+	if got := len(stream.events(event.ActionEscalated)); got != 2 {
+		t.Errorf("expected both replicas' escalations to run, got %d", got)
+	}
+}
+
+func TestEscalator_HonoursAcknowledgementsAndSilences(t *testing.T) {
+	storage := newMemStorage()
+	stream := newMemStream()
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	e := NewEscalator(storage, stream, time.Second, EscalationPolicy{
+		Name:  "oncall",
+		Steps: []EscalationStep{{Delay: time.Minute, Receivers: []string{"primary"}}},
+	})
+	e.now = func() time.Time { return now }
+
+	acked := alerts.NewAlertV2("acked", "test", "critical", "cpu_high", "cpu", "acked", now, alerts.AlertStateActive)
+	acked.AddAction(alerts.Action{Type: "callout", Target: "pagerduty", EscalationPolicy: "oncall"})
+	for _, alert := range []*alerts.AlertV2{newEscalationTestAlert(), acked} {
+		if err := e.Start(alert); err != nil {
+			t.Fatalf("Start() error = %v", err)
+		}
+	}
+	storage.Set(SilenceKeyPrefix+"a1", []byte(`{"until":"2024-01-01T01:00:00Z"}`), time.Hour)
+	storage.Set(AckKeyPrefix+"acked", []byte(`{"by":"alice"}`), 0)
+
+	now = now.Add(5 * time.Minute)
+	if err := e.Tick(); err != nil {
+		t.Fatalf("Tick() error = %v", err)
+	}
+	if got := len(stream.events(event.ActionEscalated)); got != 0 {
+		t.Fatalf("expected no escalations of silenced or acknowledged alerts, got %d", got)
+	}
+	if active, _ := e.load("acked"); len(active) != 0 {
+		t.Errorf("expected the escalation of the acknowledged alert to stop, got %+v", active)
+	}
+
+	// The silence ran out; memStorage does not expire keys.
+	now = now.Add(time.Hour)
+	if err := e.Tick(); err != nil {
+		t.Fatalf("Tick() error = %v", err)
+	}
+	escalated := stream.events(event.ActionEscalated)
+	if len(escalated) != 1 || escalated[0].Message["alert_id"] != "a1" {
+		t.Errorf("expected the silenced alert to escalate after its silence, got %d escalations", len(escalated))
+	}
+}
@@ -1,8 +1,10 @@
 package alerting
 
 import (
-	"github.com/avilikof/go-shared-libs/event"
+	"encoding/json"
 	"time"
+
+	"github.com/avilikof/go-shared-libs/event"
 )
 
 func eventBuilder(alertID string, action event.Action, eventType event.Type, additionalData map[string]any) event.Event {
@@ -32,6 +34,33 @@ func firingEvent(alertID string) event.Event {
 	return eventBuilder(alertID, event.ActionFiring, event.TypeEvent, nil)
 }
 
+// withAlert adds the alert to ev, so that the alert can be rebuilt from the
+// events, see Projection.
+func withAlert(ev event.Event, alert json.RawMessage) event.Event {
+	ev.Message["alert"] = alert
+	return ev
+}
+
 func resolvedEvent(alertID string) event.Event {
 	return eventBuilder(alertID, event.ActionResolved, event.TypeEvent, nil)
 }
+
+func resolvedEventWithReason(alertID, reason string) event.Event {
+	return eventBuilder(alertID, event.ActionResolved, event.TypeEvent, map[string]any{"reason": reason})
+}
+
+func escalatedEvent(alertID string, additionalData map[string]any) event.Event {
+	return eventBuilder(alertID, event.ActionEscalated, event.TypeEvent, additionalData)
+}
+
+func windowEvent(window string, action event.Action) event.Event {
+	return event.NewEvent("alerting", event.TypeEvent, time.Now(), action, map[string]any{"window": window})
+}
+
+func leadershipEvent(lease Lease, action event.Action) event.Event {
+	return event.NewEvent("alerting", event.TypeEvent, time.Now(), action, map[string]any{
+		"lease":  lease.Name,
+		"holder": lease.Holder,
+		"token":  lease.Token,
+	})
+}
@@ -0,0 +1,224 @@
+package alerting
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/avilikof/go-shared-libs/alerts"
+)
+
+const (
+	HeartbeatSource    = "heartbeat"
+	HeartbeatAlertType = "heartbeat_missed"
+)
+
+var ErrInvalidHeartbeat = errors.New("invalid heartbeat")
+
+// Heartbeat describes a subject on which a service promises to publish at
+// least once every Interval.
+type Heartbeat struct {
+	Name     string            `json:"name" yaml:"name"`
+	Subject  string            `json:"subject" yaml:"subject"`
+	Interval time.Duration     `json:"interval" yaml:"interval"`
+	Severity string            `json:"severity,omitempty" yaml:"severity"`
+	Labels   map[string]string `json:"labels,omitempty" yaml:"labels"`
+}
+
+type heartbeatState struct {
+	heartbeat Heartbeat
+	sub       Subscription
+	lastBeat  time.Time
+	missing   bool
+	// alertedAt is when the firing alert of a missing heartbeat was last
+	// sent.
+	alertedAt time.Time
+}
+
+// HeartbeatMonitor is a dead man's switch for registered heartbeats. When a
+// heartbeat is missed it sends a firing AlertV2 to output, normally the input
+// of a Processor created with NewProcessorV2, resends it every Interval while
+// the heartbeat stays missing, so that it never goes stale, and resolves it
+// once heartbeats resume.
+type HeartbeatMonitor struct {
+	mu     sync.Mutex
+	stream Stream
+	output chan<- *alerts.AlertV2
+	states map[string]*heartbeatState
+	now    func() time.Time
+}
+
+func NewHeartbeatMonitor(stream Stream, output chan<- *alerts.AlertV2) *HeartbeatMonitor {
+	return &HeartbeatMonitor{
+		stream: stream,
+		output: output,
+		states: make(map[string]*heartbeatState),
+		now:    time.Now,
+	}
+}
+
+// Register starts watching a heartbeat until it is unregistered. Every
+// message published on its subject counts as a beat, whether or not Run is
+// running; the first beat is expected within one Interval.
+func (m *HeartbeatMonitor) Register(heartbeat Heartbeat) error {
+	if heartbeat.Name == "" || heartbeat.Subject == "" || heartbeat.Interval <= 0 {
+		return fmt.Errorf("%w: name, subject and a positive interval are required", ErrInvalidHeartbeat)
+	}
+	if heartbeat.Severity == "" {
+		heartbeat.Severity = "critical"
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, exists := m.states[heartbeat.Name]; exists {
+		return fmt.Errorf("%w: %s is already registered", ErrInvalidHeartbeat, heartbeat.Name)
+	}
+	state := &heartbeatState{heartbeat: heartbeat, lastBeat: m.now()}
+	m.states[heartbeat.Name] = state
+
+	// A failed subscription is only logged: the heartbeat is then reported as
+	// missed, which is the safe outcome for a dead man's switch.
+	messages := make(chan []byte)
+	sub, err := m.stream.Subscribe(heartbeat.Subject, messages)
+	if err != nil {
+		fmt.Printf("Heartbeat :: %s :: failed to subscribe to %s: %v\n", heartbeat.Name, heartbeat.Subject, err)
+		return nil
+	}
+	state.sub = sub
+	go func() {
+		for {
+			select {
+			case <-messages:
+				m.Beat(heartbeat.Name)
+			case <-sub.Done():
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+// Unregister stops watching a heartbeat and resolves its alert if it was
+// missing.
+func (m *HeartbeatMonitor) Unregister(name string) error {
+	m.mu.Lock()
+	state, ok := m.states[name]
+	delete(m.states, name)
+	m.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("%w: %s is not registered", ErrInvalidHeartbeat, name)
+	}
+
+	var err error
+	if state.sub != nil {
+		err = state.sub.Unsubscribe()
+	}
+	if state.missing {
+		m.output <- m.heartbeatAlert(state.heartbeat, alerts.AlertStateResolved)
+	}
+	return err
+}
+
+// Close unregisters every heartbeat.
+func (m *HeartbeatMonitor) Close() error {
+	m.mu.Lock()
+	names := make([]string, 0, len(m.states))
+	for name := range m.states {
+		names = append(names, name)
+	}
+	m.mu.Unlock()
+
+	var errs []error
+	for _, name := range names {
+		if err := m.Unregister(name); err != nil && !errors.Is(err, ErrInvalidHeartbeat) {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Run checks for missed heartbeats every interval until ctx is cancelled.
+func (m *HeartbeatMonitor) Run(ctx context.Context, interval time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+			m.Check()
+		}
+	}
+}
+
+// Beat records a heartbeat and resolves its alert if it was missing.
+func (m *HeartbeatMonitor) Beat(name string) {
+	m.mu.Lock()
+	state, ok := m.states[name]
+	if !ok {
+		m.mu.Unlock()
+		return
+	}
+	state.lastBeat = m.now()
+	wasMissing := state.missing
+	state.missing = false
+	m.mu.Unlock()
+
+	if wasMissing {
+		fmt.Printf("Heartbeat :: %s resumed\n", name)
+		m.output <- m.heartbeatAlert(state.heartbeat, alerts.AlertStateResolved)
+	}
+}
+
+// Check raises an alert for every heartbeat that is overdue, and resends the
+// alerts of heartbeats still missing an Interval after they were last sent.
+func (m *HeartbeatMonitor) Check() {
+	now := m.now()
+
+	var missed, resent []Heartbeat
+	m.mu.Lock()
+	for _, state := range m.states {
+		switch {
+		case state.missing && now.Sub(state.alertedAt) >= state.heartbeat.Interval:
+			resent = append(resent, state.heartbeat)
+		case state.missing || now.Sub(state.lastBeat) <= state.heartbeat.Interval:
+			continue
+		default:
+			state.missing = true
+			missed = append(missed, state.heartbeat)
+		}
+		state.alertedAt = now
+	}
+	m.mu.Unlock()
+
+	for _, heartbeat := range missed {
+		fmt.Printf("Heartbeat :: %s missed\n", heartbeat.Name)
+		m.output <- m.heartbeatAlert(heartbeat, alerts.AlertStateActive)
+	}
+	for _, heartbeat := range resent {
+		m.output <- m.heartbeatAlert(heartbeat, alerts.AlertStateActive)
+	}
+}
+
+func (m *HeartbeatMonitor) heartbeatAlert(heartbeat Heartbeat, state alerts.AlertState) *alerts.AlertV2 {
+	id := "heartbeat-" + heartbeat.Name
+	alert := alerts.NewAlertV2(
+		id,
+		HeartbeatSource,
+		heartbeat.Severity,
+		HeartbeatAlertType,
+		fmt.Sprintf("no heartbeat on %s within %s", heartbeat.Subject, heartbeat.Interval),
+		id,
+		m.now(),
+		state,
+	)
+	for key, value := range heartbeat.Labels {
+		alert.AddLabel(key, value)
+	}
+	alert.AddLabel("heartbeat", heartbeat.Name)
+	alert.AddAnnotation("subject", heartbeat.Subject)
+	return alert
+}
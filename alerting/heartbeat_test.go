@@ -0,0 +1,134 @@
+package alerting
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/avilikof/go-shared-libs/alerts"
+)
+
+func TestHeartbeatMonitor_MissedAndResumed(t *testing.T) {
+	output := make(chan *alerts.AlertV2, 4)
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	m := NewHeartbeatMonitor(newMemStream(), output)
+	m.now = func() time.Time { return now }
+
+	if err := m.Register(Heartbeat{Name: "billing", Subject: "heartbeat.billing", Interval: time.Minute}); err != nil {
+		t.Fatalf("Register() error = %v", err)
+	}
+	if err := m.Register(Heartbeat{Name: "billing", Subject: "heartbeat.billing", Interval: time.Minute}); err == nil {
+		t.Error("expected an error when registering the same heartbeat twice")
+	}
+
+	now = now.Add(30 * time.Second)
+	m.Check()
+	if len(output) != 0 {
+		t.Fatalf("expected no alert within the interval, got %d", len(output))
+	}
+
+	now = now.Add(time.Minute)
+	m.Check()
+	m.Check()
+	if len(output) != 1 {
+		t.Fatalf("expected exactly 1 alert for a missed heartbeat, got %d", len(output))
+	}
+	firing := <-output
+	if !firing.IsFiring() || firing.ID() != "heartbeat-billing" || firing.Labels()["heartbeat"] != "billing" {
+		t.Errorf("unexpected missed heartbeat alert: %+v", firing)
+	}
+
+	m.Beat("billing")
+	if len(output) != 1 {
+		t.Fatalf("expected a resolving alert when heartbeats resume, got %d", len(output))
+	}
+	if resolved := <-output; resolved.IsFiring() {
+		t.Error("expected the heartbeat alert to be resolved")
+	}
+}
+
+// subscribedStream hands out the channels of its subscriptions.
+type subscribedStream struct {
+	*memStream
+	channels chan chan []byte
+}
+
+func (s *subscribedStream) Subscribe(_ string, channel chan []byte, _ ...SubscribeOption) (Subscription, error) {
+	s.channels <- channel
+	return &memSubscription{done: make(chan struct{})}, nil
+}
+
+func TestHeartbeatMonitor_Subscription(t *testing.T) {
+	output := make(chan *alerts.AlertV2, 4)
+	stream := &subscribedStream{memStream: newMemStream(), channels: make(chan chan []byte, 1)}
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	var mu sync.Mutex
+	clock := func() time.Time {
+		mu.Lock()
+		defer mu.Unlock()
+		return now
+	}
+	advance := func(d time.Duration) {
+		mu.Lock()
+		defer mu.Unlock()
+		now = now.Add(d)
+	}
+
+	m := NewHeartbeatMonitor(stream, output)
+	m.now = clock
+	if err := m.Register(Heartbeat{Name: "billing", Subject: "heartbeat.billing", Interval: time.Minute}); err != nil {
+		t.Fatalf("Register() error = %v", err)
+	}
+	beats := <-stream.channels
+
+	// Beats are recorded without Run.
+	advance(50 * time.Second)
+	select {
+	case beats <- []byte("beat"):
+	case <-time.After(time.Second):
+		t.Fatal("beat blocked before Run")
+	}
+	beatAt := clock()
+	for deadline := time.Now().Add(time.Second); ; time.Sleep(time.Millisecond) {
+		m.mu.Lock()
+		recorded := m.states["billing"].lastBeat.Equal(beatAt)
+		m.mu.Unlock()
+		if recorded {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("beat not recorded")
+		}
+	}
+	advance(50 * time.Second)
+	m.Check()
+	if len(output) != 0 {
+		t.Fatalf("expected the beat to count, got %d alerts", len(output))
+	}
+
+	// A missing heartbeat is resent every interval, so it never goes stale.
+	advance(time.Minute)
+	m.Check()
+	advance(time.Minute)
+	m.Check()
+	if len(output) != 2 {
+		t.Fatalf("expected the missed heartbeat alert to be resent, got %d alerts", len(output))
+	}
+	<-output
+	<-output
+
+	if err := m.Unregister("billing"); err != nil {
+		t.Fatalf("Unregister() error = %v", err)
+	}
+	if resolved := <-output; resolved.IsFiring() {
+		t.Error("expected Unregister to resolve the missing heartbeat")
+	}
+	if err := m.Unregister("billing"); !errors.Is(err, ErrInvalidHeartbeat) {
+		t.Errorf("Unregister() twice error = %v; want ErrInvalidHeartbeat", err)
+	}
+	if err := m.Close(); err != nil {
+		t.Errorf("Close() error = %v", err)
+	}
+}
@@ -0,0 +1,99 @@
+package alerting
+
+import (
+	"sync"
+	"time"
+
+	"github.com/avilikof/go-shared-libs/event"
+)
+
+type memStorage struct {
+	mu   sync.Mutex
+	data map[string][]byte
+}
+
+func newMemStorage() *memStorage {
+	return &memStorage{data: make(map[string][]byte)}
+}
+
+func (s *memStorage) Get(key string) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	value, ok := s.data[key]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return value, nil
+}
+
+func (s *memStorage) Set(key string, value []byte, _ time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data[key] = value
+	return nil
+}
+
+func (s *memStorage) Delete(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.data, key)
+	return nil
+}
+
+func (s *memStorage) List() ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	keys := make([]string, 0, len(s.data))
+	for key := range s.data {
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+type memStream struct {
+	mu        sync.Mutex
+	published map[string][][]byte
+}
+
+func newMemStream() *memStream {
+	return &memStream{published: make(map[string][][]byte)}
+}
+
+func (s *memStream) Publish(topic string, data []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.published[topic] = append(s.published[topic], data)
+	return nil
+}
+
+func (s *memStream) Subscribe(string, chan []byte, ...SubscribeOption) (Subscription, error) {
+	return &memSubscription{done: make(chan struct{})}, nil
+}
+
+// memSubscription is the never delivering Subscription of a memStream.
+type memSubscription struct {
+	done chan struct{}
+	once sync.Once
+}
+
+func (s *memSubscription) Unsubscribe() error {
+	s.once.Do(func() { close(s.done) })
+	return nil
+}
+
+func (s *memSubscription) Drain(time.Duration) error { return s.Unsubscribe() }
+func (s *memSubscription) Done() <-chan struct{}     { return s.done }
+func (s *memSubscription) Stats() SubscriptionStats  { return SubscriptionStats{} }
+
+func (s *memStream) events(action event.Action) []*event.Event {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var events []*event.Event
+	for _, data := range s.published[EvetTopic] {
+		ev, err := event.FromBytes(data)
+		if err == nil && ev.Action == action {
+			events = append(events, ev)
+		}
+	}
+	return events
+}
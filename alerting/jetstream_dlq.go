@@ -0,0 +1,152 @@
+package alerting
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+// DLQ_STREAM holds the dead letters published on DeadLetterTopic.
+const DLQ_STREAM = "DLQ"
+
+var _ DeadLetterQueue = (*JetStreamDeadLetterQueue)(nil)
+
+// JetStreamDeadLetterQueue is a DeadLetterQueue on the DLQ_STREAM stream.
+// Dead letters carry their metadata in Dlq-* headers and are identified by
+// their stream sequence number.
+type JetStreamDeadLetterQueue struct {
+	js nats.JetStreamContext
+}
+
+// NewJetStreamDeadLetterQueue creates or updates the dead-letter stream.
+// Dead letters are kept for maxAge, or 14 days if maxAge is zero.
+func NewJetStreamDeadLetterQueue(js nats.JetStreamContext, maxAge time.Duration) (*JetStreamDeadLetterQueue, error) {
+	if maxAge <= 0 {
+		maxAge = 14 * 24 * time.Hour
+	}
+	config, err := StreamDefinition{
+		Name:        DLQ_STREAM,
+		Description: "Dead-lettered alerts",
+		Subjects:    []string{DeadLetterTopic, TenantPrefix + "*." + DeadLetterTopic},
+		MaxAge:      maxAge,
+	}.config()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := reconcileStream(js, config, true); err != nil {
+		return nil, fmt.Errorf("failed to create dead-letter stream: %w", err)
+	}
+	return &JetStreamDeadLetterQueue{js: js}, nil
+}
+
+func (q *JetStreamDeadLetterQueue) Send(letter DeadLetter) error {
+	msg := nats.NewMsg(DeadLetterTopic)
+	msg.Data = letter.Data
+	msg.Header.Set(HeaderDLQError, letter.Error)
+	msg.Header.Set(HeaderDLQSubject, letter.Subject)
+	msg.Header.Set(HeaderDLQAttempts, strconv.Itoa(letter.Attempts))
+	msg.Header.Set(HeaderDLQTimestamp, letter.Timestamp.UTC().Format(time.RFC3339Nano))
+	if _, err := q.js.PublishMsg(msg); err != nil {
+		return fmt.Errorf("failed to publish dead letter: %w", natsError(err))
+	}
+	return nil
+}
+
+func (q *JetStreamDeadLetterQueue) List(limit int) ([]DeadLetter, error) {
+	info, err := q.js.StreamInfo(DLQ_STREAM)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get dead-letter stream: %w", natsError(err))
+	}
+
+	var letters []DeadLetter
+	for seq := info.State.FirstSeq; seq <= info.State.LastSeq && info.State.Msgs > 0; seq++ {
+		if limit > 0 && len(letters) >= limit {
+			break
+		}
+		letter, err := q.get(seq)
+		if errors.Is(err, ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		letters = append(letters, *letter)
+	}
+	return letters, nil
+}
+
+func (q *JetStreamDeadLetterQueue) Get(id string) (*DeadLetter, error) {
+	seq, err := parseSequence(id)
+	if err != nil {
+		return nil, err
+	}
+	return q.get(seq)
+}
+
+func (q *JetStreamDeadLetterQueue) Redrive(id string) error {
+	letter, err := q.Get(id)
+	if err != nil {
+		return err
+	}
+	if _, err := q.js.Publish(letter.Subject, letter.Data); err != nil {
+		return fmt.Errorf("failed to redrive dead letter %s to %s: %w", id, letter.Subject, natsError(err))
+	}
+	return q.Purge(id)
+}
+
+func (q *JetStreamDeadLetterQueue) Purge(id string) error {
+	seq, err := parseSequence(id)
+	if err != nil {
+		return err
+	}
+	err = q.js.DeleteMsg(DLQ_STREAM, seq)
+	if errors.Is(err, nats.ErrMsgNotFound) {
+		return fmt.Errorf("%w: dead letter %s", ErrNotFound, id)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to purge dead letter %s: %w", id, natsError(err))
+	}
+	return nil
+}
+
+func (q *JetStreamDeadLetterQueue) PurgeAll() error {
+	if err := q.js.PurgeStream(DLQ_STREAM); err != nil {
+		return fmt.Errorf("failed to purge dead letters: %w", natsError(err))
+	}
+	return nil
+}
+
+func (q *JetStreamDeadLetterQueue) get(seq uint64) (*DeadLetter, error) {
+	msg, err := q.js.GetMsg(DLQ_STREAM, seq)
+	if errors.Is(err, nats.ErrMsgNotFound) {
+		return nil, fmt.Errorf("%w: dead letter %d", ErrNotFound, seq)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get dead letter %d: %w", seq, natsError(err))
+	}
+
+	attempts, _ := strconv.Atoi(msg.Header.Get(HeaderDLQAttempts))
+	timestamp, err := time.Parse(time.RFC3339Nano, msg.Header.Get(HeaderDLQTimestamp))
+	if err != nil {
+		timestamp = msg.Time
+	}
+	return &DeadLetter{
+		ID:        strconv.FormatUint(seq, 10),
+		Subject:   msg.Header.Get(HeaderDLQSubject),
+		Error:     msg.Header.Get(HeaderDLQError),
+		Attempts:  attempts,
+		Timestamp: timestamp,
+		Data:      msg.Data,
+	}, nil
+}
+
+func parseSequence(id string) (uint64, error) {
+	seq, err := strconv.ParseUint(id, 10, 64)
+	if err != nil || seq == 0 {
+		return 0, fmt.Errorf("%w: dead letter %q", ErrNotFound, id)
+	}
+	return seq, nil
+}
@@ -1,8 +1,12 @@
 package alerting
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"os"
+	"strings"
+	"time"
 
 	natsdriver "github.com/avilikof/go-shared-libs/nats"
 
@@ -13,15 +17,63 @@ const (
 	NATS_URL_JS  = "NATS_URL"
 	ALERT_STREAM = "ALERTS"
 	EVENT_STREAM = "EVENTS"
+	ALERT_BUCKET = "alerts"
+	LEASE_BUCKET = "leases"
 )
 
 type JetStreamHandler struct {
 	conn    *nats.Conn
 	js      nats.JetStreamContext
 	storage *natsdriver.JetStreamStorage
+	groups  groupSlots
 }
 
-func NewJetStreamHandler() (*JetStreamHandler, error) {
+// JetStreamOption configures a JetStreamHandler.
+type JetStreamOption func(*jetStreamOptions)
+
+type jetStreamOptions struct {
+	duplicates time.Duration
+	topology   *Topology
+}
+
+// WithDuplicateWindow sets how long the alert and event streams remember
+// message IDs to drop duplicate publishes. The server default is two
+// minutes; existing streams are updated to the window.
+func WithDuplicateWindow(window time.Duration) JetStreamOption {
+	return func(o *jetStreamOptions) {
+		o.duplicates = window
+	}
+}
+
+// WithTopology sets the streams and consumers reconciled on startup. Without
+// it the topology is loaded from the file named by $JETSTREAM_TOPOLOGY, or
+// DefaultTopology if that is not set.
+func WithTopology(topology Topology) JetStreamOption {
+	return func(o *jetStreamOptions) {
+		o.topology = &topology
+	}
+}
+
+// NewJetStreamHandler connects to $NATS_URL and reconciles the stream
+// topology. Missing streams and consumers are created and existing ones are
+// updated to their definitions. Incompatible changes are only logged.
+func NewJetStreamHandler(opts ...JetStreamOption) (*JetStreamHandler, error) {
+	var options jetStreamOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+	if options.topology == nil {
+		topology := DefaultTopology()
+		if path := os.Getenv(JETSTREAM_TOPOLOGY); path != "" {
+			loaded, err := LoadTopology(path)
+			if err != nil {
+				return nil, err
+			}
+			topology = loaded
+		}
+		options.topology = &topology
+	}
+
 	natsUrl := os.Getenv(NATS_URL_JS)
 	if natsUrl == "" {
 		natsUrl = "nats://localhost:4222"
@@ -36,18 +88,21 @@ func NewJetStreamHandler() (*JetStreamHandler, error) {
 	// Create JetStream context
 	js, err := conn.JetStream()
 	if err != nil {
+		conn.Close()
 		return nil, fmt.Errorf("failed to create JetStream context: %w", err)
 	}
 
-	// Create streams for alerts and events
-	err = createStreams(js)
+	// Create the streams for alerts and events
+	err = createStreams(js, *options.topology, options.duplicates)
 	if err != nil {
+		conn.Close()
 		return nil, fmt.Errorf("failed to create streams: %w", err)
 	}
 
 	// Create storage using JetStream KV
-	storage, err := natsdriver.NewJetStreamStorage(conn, "alerts")
+	storage, err := natsdriver.NewJetStreamStorage(conn, ALERT_BUCKET)
 	if err != nil {
+		conn.Close()
 		return nil, fmt.Errorf("failed to create JetStream storage: %w", err)
 	}
 
@@ -58,73 +113,166 @@ func NewJetStreamHandler() (*JetStreamHandler, error) {
 	}, nil
 }
 
-func createStreams(js nats.JetStreamContext) error {
-	// Create alert stream
-	_, err := js.AddStream(&nats.StreamConfig{
-		Name:        ALERT_STREAM,
-		Description: "Alert processing stream",
-		Subjects:    []string{"test.alert", "alert.store"},
-		Storage:     nats.FileStorage,
-		MaxAge:      24 * 60 * 60 * 1000000000, // 24 hours in nanoseconds
-		MaxBytes:    100 * 1024 * 1024,         // 100MB
-		Replicas:    1,
-	})
-	if err != nil && err != nats.ErrStreamNameAlreadyInUse {
-		return fmt.Errorf("failed to create alert stream: %w", err)
-	}
-
-	// Create event stream
-	_, err = js.AddStream(&nats.StreamConfig{
-		Name:        EVENT_STREAM,
-		Description: "Event logging stream",
-		Subjects:    []string{"alert.event"},
-		Storage:     nats.FileStorage,
-		MaxAge:      7 * 24 * 60 * 60 * 1000000000, // 7 days in nanoseconds
-		MaxBytes:    50 * 1024 * 1024,              // 50MB
-		Replicas:    1,
-	})
-	if err != nil && err != nats.ErrStreamNameAlreadyInUse {
-		return fmt.Errorf("failed to create event stream: %w", err)
+// createStreams reconciles topology, applying a non-zero duplicate window to
+// every stream, and logs what changed. Incompatible changes are not an error.
+func createStreams(js nats.JetStreamContext, topology Topology, duplicates time.Duration) error {
+	if duplicates != 0 {
+		streams := make([]StreamDefinition, len(topology.Streams))
+		for i, def := range topology.Streams {
+			def.Duplicates = duplicates
+			streams[i] = def
+		}
+		topology.Streams = streams
 	}
 
-	return nil
+	results, err := Reconcile(js, topology, true)
+	for _, result := range results {
+		if result.Action != ReconcileUnchanged {
+			fmt.Printf("JetStream :: %s\n", result)
+		}
+	}
+	if errors.Is(err, ErrIncompatibleChange) {
+		fmt.Printf("JetStream :: %v\n", err)
+		return nil
+	}
+	return err
 }
 
-// Subscribe to JetStream subjects
-func (jsh *JetStreamHandler) Subscribe(subject string, alertChan chan []byte) error {
-	// Create durable consumer
-	consumerName := fmt.Sprintf("%s-consumer", subject)
+var durableSubject = strings.NewReplacer(".", "_", "*", "any", ">", "all")
 
-	sub, err := jsh.js.Subscribe(subject, func(msg *nats.Msg) {
-		alertChan <- msg.Data
-		msg.Ack() // Acknowledge message processing
-	}, nats.Durable(consumerName))
+// Subscribe to JetStream subjects through the durable push consumer
+// "<subject>-consumer", creating it if needed. Further concurrent
+// subscriptions of subject use "<subject>-consumer-2", "-3", ..., and
+// WithGroup(group) subscriptions share "<subject>-<group>" as a queue group.
+// Messages are buffered, see SubscribeOption, and acknowledged once they
+// have been handed to alertChan or dropped. The consumer outlives the
+// subscription, so a later Subscribe resumes where this one stopped.
+func (jsh *JetStreamHandler) Subscribe(subject string, alertChan chan []byte, opts ...SubscribeOption) (Subscription, error) {
+	return jsh.SubscribeMsg(subject, channelHandler(alertChan), opts...)
+}
 
+// SubscribeMsg is Subscribe calling handler with the messages and their
+// headers. Messages the handler fails are nacked for redelivery a second
+// later.
+func (jsh *JetStreamHandler) SubscribeMsg(subject string, handler MessageHandler, opts ...SubscribeOption) (Subscription, error) {
+	options := newSubscribeOptions(opts)
+	// Durable names must not contain subject tokens
+	prefix := durableSubject.Replace(subject)
+	consumerName, release := jsh.groups.group(subject, prefix+"-consumer", options)
+	if options.group != "" {
+		consumerName = fmt.Sprintf("%s-%s", prefix, options.group)
+	}
+	stream, err := jsh.ensurePushConsumer(subject, consumerName, options.group)
 	if err != nil {
-		return fmt.Errorf("failed to subscribe to %s: %w", subject, err)
+		release()
+		return nil, fmt.Errorf("failed to subscribe to %s: %w", subject, err)
 	}
 
-	// Keep subscription alive
-	go func() {
-		select {}
-	}()
+	buffer := newSubscriptionBuffer(subject, handler, options)
+	sub, err := jsh.js.QueueSubscribe(subject, options.group, func(msg *nats.Msg) {
+		buffer.offer(bufferedMessage{
+			msg:  fromNATS(msg),
+			done: func() { _ = msg.Ack() },
+			nak:  func() { _ = msg.NakWithDelay(time.Second) },
+		})
+	}, nats.Bind(stream, consumerName), nats.ManualAck())
+	if err != nil {
+		release()
+		buffer.close()
+		return nil, fmt.Errorf("failed to subscribe to %s: %w", subject, natsError(err))
+	}
+	return newNATSSubscription(sub, buffer, release), nil
+}
 
-	_ = sub // Keep reference to prevent GC
-	return nil
+// ensurePushConsumer creates the durable push consumer for subject, with
+// queue as its deliver group, unless it exists, and returns the name of its
+// stream. Consumers created by nats.go itself are deleted on Unsubscribe, so
+// it is created up front and bound to.
+func (jsh *JetStreamHandler) ensurePushConsumer(subject, durable, queue string) (string, error) {
+	stream, err := jsh.js.StreamNameBySubject(subject)
+	if err != nil {
+		return "", natsError(err)
+	}
+	_, err = jsh.js.ConsumerInfo(stream, durable)
+	if errors.Is(err, nats.ErrConsumerNotFound) {
+		_, err = jsh.js.AddConsumer(stream, &nats.ConsumerConfig{
+			Durable:        durable,
+			DeliverSubject: nats.NewInbox(),
+			DeliverGroup:   queue,
+			FilterSubject:  subject,
+			AckPolicy:      nats.AckExplicitPolicy,
+		})
+	}
+	if err != nil {
+		return "", natsError(err)
+	}
+	return stream, nil
 }
 
-// Publish to JetStream
+// Publish to JetStream. Messages on input subjects carry a Nats-Msg-Id
+// derived from their content, so a retried publish within the duplicate
+// window is dropped. State writes on StorageTopic and events on EvetTopic
+// carry none, see MessageID.
 func (jsh *JetStreamHandler) Publish(subject string, data []byte) error {
-	_, err := jsh.js.Publish(subject, data)
+	var opts []nats.PubOpt
+	if !internalSubject(subject) {
+		opts = append(opts, nats.MsgId(MessageID(subject, data)))
+	}
+	_, err := jsh.js.Publish(subject, data, opts...)
+	if err != nil {
+		return fmt.Errorf("failed to publish to %s: %w", subject, natsError(err))
+	}
+	return nil
+}
+
+// PublishMsg publishes msg with its headers and waits for the server's ack
+// or ctx. A HeaderMessageID header replaces the content-derived MessageID
+// for dropping duplicates, on every subject.
+func (jsh *JetStreamHandler) PublishMsg(ctx context.Context, msg *Message) error {
+	opts := []nats.PubOpt{nats.Context(ctx)}
+	id := msg.Header[HeaderMessageID]
+	if id == "" && !internalSubject(msg.Subject) {
+		id = MessageID(msg.Subject, msg.Data)
+	}
+	if id != "" {
+		opts = append(opts, nats.MsgId(id))
+	}
+	_, err := jsh.js.PublishMsg(toNATS(msg), opts...)
 	if err != nil {
-		return fmt.Errorf("failed to publish to %s: %w", subject, err)
+		return fmt.Errorf("failed to publish to %s: %w", msg.Subject, natsError(err))
 	}
 	return nil
 }
 
+// DuplicateWindow returns how long the stream of subject remembers message
+// IDs. Identical alerts published on an input subject within it are dropped,
+// see StaleTracker.AllowDuplicates.
+func (jsh *JetStreamHandler) DuplicateWindow(subject string) (time.Duration, error) {
+	stream, err := jsh.js.StreamNameBySubject(subject)
+	if err != nil {
+		return 0, fmt.Errorf("failed to find stream of %s: %w", subject, natsError(err))
+	}
+	info, err := jsh.js.StreamInfo(stream)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get stream %s: %w", stream, natsError(err))
+	}
+	return info.Config.Duplicates, nil
+}
+
 // Get storage interface
 func (jsh *JetStreamHandler) Storage() Storage {
-	return jsh.storage
+	return &jetStreamStorage{storage: jsh.storage, conn: jsh.conn}
+}
+
+// JetStream returns the JetStream context, e.g. for inspecting streams and
+// consumers.
+func (jsh *JetStreamHandler) JetStream() nats.JetStreamContext {
+	return jsh.js
+}
+
+// Conn returns the NATS connection, e.g. for request/reply.
+func (jsh *JetStreamHandler) Conn() *nats.Conn {
+	return jsh.conn
 }
 
 // Close connections
@@ -0,0 +1,205 @@
+package alerting_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+
+	"github.com/avilikof/go-shared-libs/alerting"
+)
+
+func TestJetStreamHandler_DropsDuplicates(t *testing.T) {
+	requireNATS(t)
+	handler, err := alerting.NewJetStreamHandler(alerting.WithDuplicateWindow(time.Minute))
+	if err != nil {
+		t.Fatalf("NewJetStreamHandler() error = %v", err)
+	}
+	t.Cleanup(handler.Close)
+
+	info, err := handler.JetStream().StreamInfo(alerting.EVENT_STREAM)
+	if err != nil {
+		t.Fatalf("StreamInfo() error = %v", err)
+	}
+	if info.Config.Duplicates != time.Minute {
+		t.Errorf("duplicate window = %s; want 1m", info.Config.Duplicates)
+	}
+	if window, err := handler.DuplicateWindow("test.alert"); err != nil || window != time.Minute {
+		t.Errorf("DuplicateWindow() = %s, %v; want 1m", window, err)
+	}
+
+	data := []byte(fmt.Sprintf(`{"id":"dedup-%d"}`, time.Now().UnixNano()))
+	if err := handler.Publish("test.alert", data); err != nil {
+		t.Fatalf("Publish() error = %v", err)
+	}
+	ack, err := handler.JetStream().Publish("test.alert", data, nats.MsgId(alerting.MessageID("test.alert", data)))
+	if err != nil {
+		t.Fatalf("retry error = %v", err)
+	}
+	if !ack.Duplicate {
+		t.Error("expected the retried publish to be dropped as a duplicate")
+	}
+}
+
+func TestJetStreamHandler_StoresFlappingAlerts(t *testing.T) {
+	requireNATS(t)
+	handler := newJetStreamHandler(t)
+
+	id := fmt.Sprintf("flapping-%d", time.Now().UnixNano())
+	firing := []byte(fmt.Sprintf(`{"id":%q,"state":"active"}`, id))
+	resolved := []byte(fmt.Sprintf(`{"id":%q,"state":"resolved"}`, id))
+	for _, data := range [][]byte{firing, resolved, firing} {
+		if err := handler.Publish(alerting.StorageTopic, data); err != nil {
+			t.Fatalf("Publish() error = %v", err)
+		}
+	}
+
+	last, err := handler.JetStream().GetLastMsg(alerting.ALERT_STREAM, alerting.StorageTopic)
+	if err != nil {
+		t.Fatalf("GetLastMsg() error = %v", err)
+	}
+	if string(last.Data) != string(firing) {
+		t.Errorf("last stored state = %s; want the alert firing again, %s", last.Data, firing)
+	}
+}
+
+func TestJetStreamHandler_NaksOnOverflow(t *testing.T) {
+	requireNATS(t)
+	handler := newJetStreamHandler(t)
+
+	subject := fmt.Sprintf("%soverflow-%d.test.alert", alerting.TenantPrefix, time.Now().UnixNano())
+	received := make(chan []byte)
+	counters := &alerting.SubscriptionCounters{}
+	_, err := handler.Subscribe(subject, received,
+		alerting.WithBufferSize(1),
+		alerting.WithOverflowPolicy(alerting.OverflowNak),
+		alerting.WithCounters(counters))
+	if err != nil {
+		t.Fatalf("Subscribe() error = %v", err)
+	}
+
+	want := map[string]bool{}
+	for i := 0; i < 5; i++ {
+		data := fmt.Sprintf("message-%d", i)
+		want[data] = true
+		if err := handler.Publish(subject, []byte(data)); err != nil {
+			t.Fatalf("Publish() error = %v", err)
+		}
+	}
+	deadline := time.After(10 * time.Second)
+	for len(want) > 0 {
+		select {
+		case data := <-received:
+			delete(want, string(data))
+			time.Sleep(10 * time.Millisecond)
+		case <-deadline:
+			t.Fatalf("timed out with %d messages undelivered, stats %+v", len(want), counters.Stats())
+		}
+	}
+	if stats := counters.Stats(); stats.Nacked == 0 {
+		t.Errorf("Stats() = %+v; want overflowing messages nacked", stats)
+	}
+}
+
+func TestJetStreamHandler_DrainKeepsConsumer(t *testing.T) {
+	requireNATS(t)
+	handler := newJetStreamHandler(t)
+
+	subject := fmt.Sprintf("%sdrain-%d.test.alert", alerting.TenantPrefix, time.Now().UnixNano())
+	received := make(chan []byte, 1)
+	sub, err := handler.Subscribe(subject, received)
+	if err != nil {
+		t.Fatalf("Subscribe() error = %v", err)
+	}
+	if err := handler.Publish(subject, []byte("before")); err != nil {
+		t.Fatalf("Publish() error = %v", err)
+	}
+	if err := sub.Drain(5 * time.Second); err != nil {
+		t.Fatalf("Drain() error = %v", err)
+	}
+	select {
+	case <-sub.Done():
+	default:
+		t.Error("Done() is open after Drain")
+	}
+
+	// Messages published meanwhile wait on the durable consumer for the
+	// next subscription.
+	if err := handler.Publish(subject, []byte("after")); err != nil {
+		t.Fatalf("Publish() error = %v", err)
+	}
+	resumed, err := handler.Subscribe(subject, received)
+	if err != nil {
+		t.Fatalf("Subscribe() error = %v", err)
+	}
+	t.Cleanup(func() { _ = resumed.Unsubscribe() })
+	for _, want := range []string{"before", "after"} {
+		select {
+		case data := <-received:
+			if string(data) != want {
+				t.Errorf("received %q; want %q", data, want)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for %q", want)
+		}
+	}
+}
+
+func TestJetStreamHandler_PullSubscribe(t *testing.T) {
+	requireNATS(t)
+	handler := newJetStreamHandler(t)
+
+	subject := fmt.Sprintf("%spull-%d.test.alert", alerting.TenantPrefix, time.Now().UnixNano())
+	consumer, err := handler.PullSubscribe(subject, alerting.PullConsumerConfig{
+		MaxDeliver: 3,
+		BackOff:    []time.Duration{50 * time.Millisecond},
+	})
+	if err != nil {
+		t.Fatalf("PullSubscribe() error = %v", err)
+	}
+	t.Cleanup(func() { _ = consumer.Unsubscribe() })
+
+	for _, data := range []string{"nak", "term"} {
+		if err := handler.Publish(subject, []byte(data)); err != nil {
+			t.Fatalf("Publish() error = %v", err)
+		}
+	}
+	ctx := context.Background()
+	deliveries, err := consumer.Fetch(ctx, 10, 2*time.Second)
+	if err != nil || len(deliveries) != 2 {
+		t.Fatalf("Fetch() = %d deliveries, %v; want 2", len(deliveries), err)
+	}
+	if err := deliveries[0].Nak(0); err != nil {
+		t.Fatalf("Nak() error = %v", err)
+	}
+	if err := deliveries[1].Term(); err != nil {
+		t.Fatalf("Term() error = %v", err)
+	}
+
+	redelivered, err := consumer.Fetch(ctx, 10, 2*time.Second)
+	if err != nil || len(redelivered) != 1 {
+		t.Fatalf("Fetch() after Nak() = %d deliveries, %v; want the nak'ed one", len(redelivered), err)
+	}
+	if string(redelivered[0].Data) != "nak" || redelivered[0].Delivered != 2 {
+		t.Errorf("redelivered %q on delivery %d; want nak on delivery 2", redelivered[0].Data, redelivered[0].Delivered)
+	}
+	if err := redelivered[0].Ack(); err != nil {
+		t.Fatalf("Ack() error = %v", err)
+	}
+
+	empty, err := consumer.Fetch(ctx, 10, 100*time.Millisecond)
+	if err != nil || len(empty) != 0 {
+		t.Errorf("Fetch() after Ack() = %d deliveries, %v; want none", len(empty), err)
+	}
+
+	_, err = handler.PullSubscribe(subject+".other", alerting.PullConsumerConfig{
+		MaxDeliver: 1,
+		BackOff:    []time.Duration{time.Second},
+	})
+	if !errors.Is(err, alerting.ErrInvalidSubscription) {
+		t.Errorf("PullSubscribe() with too many back-off delays error = %v; want ErrInvalidSubscription", err)
+	}
+}
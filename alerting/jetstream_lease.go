@@ -0,0 +1,110 @@
+package alerting
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+type leaseRecord struct {
+	Holder    string    `json:"holder"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// JetStreamLeaseStore is a LeaseStore backed by the LEASE_BUCKET KV bucket.
+// Every write is a compare-and-set on the key's revision, and the revision
+// that started a term is its fencing token. Expiry is judged by the clocks
+// of the competing instances.
+type JetStreamLeaseStore struct {
+	kv  nats.KeyValue
+	now func() time.Time
+}
+
+// NewJetStreamLeaseStore creates the lease bucket if it does not exist.
+// Leases record their expiry in the holder's clock and competitors compare it
+// with theirs, so the clocks of all instances must agree to well within the
+// RetryInterval of their LeaderElector; otherwise a standby may take over a
+// lease that is still valid and only the Fence on the storage writer keeps
+// the two leaders apart.
+func NewJetStreamLeaseStore(js nats.JetStreamContext) (*JetStreamLeaseStore, error) {
+	kv, err := js.CreateKeyValue(&nats.KeyValueConfig{
+		Bucket:      LEASE_BUCKET,
+		Description: "Leader election leases",
+		History:     1,
+		Storage:     nats.FileStorage,
+		Replicas:    1,
+	})
+	if err != nil {
+		kv, err = js.KeyValue(LEASE_BUCKET)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create/get lease bucket: %w", natsError(err))
+		}
+	}
+	return &JetStreamLeaseStore{kv: kv, now: time.Now}, nil
+}
+
+func (s *JetStreamLeaseStore) Acquire(name, holder string, ttl time.Duration) (Lease, error) {
+	record, err := s.record(holder, ttl)
+	if err != nil {
+		return Lease{}, err
+	}
+
+	var revision uint64
+	entry, err := s.kv.Get(name)
+	switch {
+	case errors.Is(err, nats.ErrKeyNotFound):
+		revision, err = s.kv.Create(name, record)
+	case err != nil:
+		return Lease{}, fmt.Errorf("failed to get lease %s: %w", name, natsError(err))
+	default:
+		var current leaseRecord
+		if err := json.Unmarshal(entry.Value(), &current); err != nil {
+			return Lease{}, fmt.Errorf("failed to decode lease %s: %w", name, err)
+		}
+		if current.Holder != holder && s.now().Before(current.ExpiresAt) {
+			return Lease{}, fmt.Errorf("%w: %s is held by %s", ErrLeaseHeld, name, current.Holder)
+		}
+		revision, err = s.kv.Update(name, record, entry.Revision())
+	}
+	if errors.Is(err, nats.ErrKeyExists) {
+		return Lease{}, fmt.Errorf("%w: %s was acquired concurrently", ErrLeaseHeld, name)
+	}
+	if err != nil {
+		return Lease{}, fmt.Errorf("failed to acquire lease %s: %w", name, natsError(err))
+	}
+	return Lease{Name: name, Holder: holder, Token: revision, revision: revision}, nil
+}
+
+func (s *JetStreamLeaseStore) Renew(lease Lease, ttl time.Duration) (Lease, error) {
+	record, err := s.record(lease.Holder, ttl)
+	if err != nil {
+		return lease, err
+	}
+	revision, err := s.kv.Update(lease.Name, record, lease.revision)
+	if errors.Is(err, nats.ErrKeyExists) || errors.Is(err, nats.ErrKeyNotFound) {
+		return lease, fmt.Errorf("%w: %s was taken over", ErrLeaseLost, lease.Name)
+	}
+	if err != nil {
+		return lease, fmt.Errorf("failed to renew lease %s: %w", lease.Name, natsError(err))
+	}
+	lease.revision = revision
+	return lease, nil
+}
+
+func (s *JetStreamLeaseStore) Release(lease Lease) error {
+	err := s.kv.Delete(lease.Name, nats.LastRevision(lease.revision))
+	if errors.Is(err, nats.ErrKeyExists) {
+		return fmt.Errorf("%w: %s was taken over", ErrLeaseLost, lease.Name)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to release lease %s: %w", lease.Name, natsError(err))
+	}
+	return nil
+}
+
+func (s *JetStreamLeaseStore) record(holder string, ttl time.Duration) ([]byte, error) {
+	return json.Marshal(leaseRecord{Holder: holder, ExpiresAt: s.now().Add(ttl)})
+}
@@ -0,0 +1,220 @@
+package alerting
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+// PullConsumerConfig configures a durable JetStream pull consumer. Zero
+// values fall back to the defaults noted on each field.
+type PullConsumerConfig struct {
+	// Durable names the consumer. Default the subject with "-pull" appended.
+	Durable string
+	// AckWait is how long a fetched message may stay unsettled before it is
+	// redelivered. Default 30 seconds.
+	AckWait time.Duration
+	// MaxDeliver caps deliveries per message; the server stops redelivering
+	// a message after it. Default 5.
+	MaxDeliver int
+	// BackOff are the redelivery delays after the first, second, ...
+	// delivery, used instead of AckWait and by Nak without a delay. The last
+	// delay repeats. It must be shorter than MaxDeliver.
+	BackOff []time.Duration
+	// MaxAckPending caps the unsettled messages of the consumer. Default 1000.
+	MaxAckPending int
+}
+
+// PullConsumer fetches messages from a durable pull consumer. Every fetched
+// Delivery must be settled with Ack, Nak or Term, or it is redelivered after
+// AckWait. It is a Subscription whose Stats count fetched messages.
+type PullConsumer struct {
+	sub      *nats.Subscription
+	backOff  []time.Duration
+	counters SubscriptionCounters
+	done     chan struct{}
+	once     sync.Once
+}
+
+// Fetcher fetches batches of deliveries, see PullConsumer.
+type Fetcher interface {
+	Fetch(ctx context.Context, batch int, maxWait time.Duration) ([]*Delivery, error)
+}
+
+var (
+	_ Fetcher      = (*PullConsumer)(nil)
+	_ Subscription = (*PullConsumer)(nil)
+)
+
+// PullSubscribe creates the durable pull consumer for subject, or updates it
+// to config if it exists, and binds to it. The consumer outlives the
+// PullConsumer, so unsettled messages are redelivered to the next one.
+func (jsh *JetStreamHandler) PullSubscribe(subject string, config PullConsumerConfig) (*PullConsumer, error) {
+	if config.Durable == "" {
+		config.Durable = durableSubject.Replace(subject) + "-pull"
+	}
+	if config.AckWait <= 0 {
+		config.AckWait = 30 * time.Second
+	}
+	if config.MaxDeliver == 0 {
+		config.MaxDeliver = 5
+	}
+	if config.MaxAckPending <= 0 {
+		config.MaxAckPending = 1000
+	}
+	if config.MaxDeliver > 0 && len(config.BackOff) >= config.MaxDeliver {
+		return nil, fmt.Errorf("%w: %d back-off delays need a max deliver above %d", ErrInvalidSubscription,
+			len(config.BackOff), config.MaxDeliver)
+	}
+
+	stream, err := jsh.js.StreamNameBySubject(subject)
+	if err != nil {
+		return nil, fmt.Errorf("failed to pull-subscribe to %s: %w", subject, natsError(err))
+	}
+	consumer, err := ConsumerDefinition{
+		Stream:        stream,
+		Name:          config.Durable,
+		FilterSubject: subject,
+		AckWait:       config.AckWait,
+		MaxDeliver:    config.MaxDeliver,
+		BackOff:       config.BackOff,
+		MaxAckPending: config.MaxAckPending,
+	}.config()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := reconcileConsumer(jsh.js, stream, consumer, true); err != nil {
+		return nil, fmt.Errorf("failed to pull-subscribe to %s: %w", subject, err)
+	}
+
+	sub, err := jsh.js.PullSubscribe(subject, config.Durable, nats.Bind(stream, config.Durable))
+	if err != nil {
+		return nil, fmt.Errorf("failed to pull-subscribe to %s: %w", subject, natsError(err))
+	}
+	c := &PullConsumer{sub: sub, backOff: config.BackOff, done: make(chan struct{})}
+	closed := sub.StatusChanged(nats.SubscriptionClosed)
+	go func() {
+		<-closed
+		c.finish()
+	}()
+	return c, nil
+}
+
+// Fetch returns up to batch messages, waiting at most maxWait for the first
+// one. It returns no deliveries and no error if none arrived in time, and
+// ctx's error if ctx is done.
+func (c *PullConsumer) Fetch(ctx context.Context, batch int, maxWait time.Duration) ([]*Delivery, error) {
+	fetchCtx, cancel := context.WithTimeout(ctx, maxWait)
+	defer cancel()
+
+	msgs, err := c.sub.Fetch(batch, nats.Context(fetchCtx))
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if errors.Is(err, nats.ErrTimeout) || errors.Is(err, context.DeadlineExceeded) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to fetch from %s: %w", c.sub.Subject, natsError(err))
+	}
+
+	c.counters.delivered.Add(uint64(len(msgs)))
+	deliveries := make([]*Delivery, 0, len(msgs))
+	for _, msg := range msgs {
+		received := fromNATS(msg)
+		delivery := &Delivery{
+			Subject:   received.Subject,
+			Data:      received.Data,
+			Header:    received.Header,
+			Delivered: 1,
+			acker:     msg,
+			backOff:   c.backOff,
+		}
+		if meta, err := msg.Metadata(); err == nil {
+			delivery.Delivered = meta.NumDelivered
+		}
+		deliveries = append(deliveries, delivery)
+	}
+	return deliveries, nil
+}
+
+// Unsubscribe stops fetching. The durable consumer is kept on the server.
+func (c *PullConsumer) Unsubscribe() error {
+	defer c.finish()
+	if err := c.sub.Unsubscribe(); err != nil && !errors.Is(err, nats.ErrBadSubscription) {
+		return natsError(err)
+	}
+	return nil
+}
+
+// Drain is Unsubscribe: a pull consumer holds no received messages, fetched
+// ones are settled by their Delivery.
+func (c *PullConsumer) Drain(time.Duration) error {
+	return c.Unsubscribe()
+}
+
+func (c *PullConsumer) Done() <-chan struct{} {
+	return c.done
+}
+
+func (c *PullConsumer) Stats() SubscriptionStats {
+	return c.counters.Stats()
+}
+
+func (c *PullConsumer) finish() {
+	c.once.Do(func() { close(c.done) })
+}
+
+// acker settles a delivery; *nats.Msg implements it.
+type acker interface {
+	Ack(opts ...nats.AckOpt) error
+	Nak(opts ...nats.AckOpt) error
+	NakWithDelay(delay time.Duration, opts ...nats.AckOpt) error
+	InProgress(opts ...nats.AckOpt) error
+	Term(opts ...nats.AckOpt) error
+}
+
+// Delivery is a fetched message that has to be settled.
+type Delivery struct {
+	Subject string
+	Data    []byte
+	Header  Header
+	// Delivered is how often the message has been delivered, 1 on the
+	// first delivery.
+	Delivered uint64
+
+	acker   acker
+	backOff []time.Duration
+}
+
+// Ack settles the message as processed.
+func (d *Delivery) Ack() error {
+	return natsError(d.acker.Ack())
+}
+
+// Nak asks for redelivery after delay. A zero delay uses the consumer's
+// back-off for this delivery, or redelivers at once without one.
+func (d *Delivery) Nak(delay time.Duration) error {
+	if delay <= 0 && len(d.backOff) > 0 {
+		i := min(int(d.Delivered), len(d.backOff)) - 1
+		delay = d.backOff[max(i, 0)]
+	}
+	if delay <= 0 {
+		return natsError(d.acker.Nak())
+	}
+	return natsError(d.acker.NakWithDelay(delay))
+}
+
+// InProgress resets the ack wait, for processing that takes longer than it.
+func (d *Delivery) InProgress() error {
+	return natsError(d.acker.InProgress())
+}
+
+// Term settles the message as never processable; it is not redelivered.
+func (d *Delivery) Term() error {
+	return natsError(d.acker.Term())
+}
@@ -0,0 +1,149 @@
+package alerting
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+
+	"github.com/avilikof/go-shared-libs/alerts"
+)
+
+type fakeAcker struct {
+	settled string
+	delay   time.Duration
+}
+
+func (a *fakeAcker) Ack(...nats.AckOpt) error        { a.settled = "ack"; return nil }
+func (a *fakeAcker) Nak(...nats.AckOpt) error        { a.settled = "nak"; return nil }
+func (a *fakeAcker) InProgress(...nats.AckOpt) error { return nil }
+func (a *fakeAcker) Term(...nats.AckOpt) error       { a.settled = "term"; return nil }
+func (a *fakeAcker) NakWithDelay(delay time.Duration, _ ...nats.AckOpt) error {
+	a.settled, a.delay = "nak", delay
+	return nil
+}
+
+// fakeFetcher returns its deliveries on the first Fetch and then cancels the
+// consuming context.
+type fakeFetcher struct {
+	deliveries []*Delivery
+	cancel     context.CancelFunc
+}
+
+func (f *fakeFetcher) Fetch(context.Context, int, time.Duration) ([]*Delivery, error) {
+	deliveries := f.deliveries
+	f.deliveries = nil
+	if deliveries == nil {
+		f.cancel()
+	}
+	return deliveries, nil
+}
+
+func newDelivery(data []byte) (*Delivery, *fakeAcker) {
+	acker := &fakeAcker{}
+	return &Delivery{Subject: "test.alert", Data: data, Delivered: 1, acker: acker}, acker
+}
+
+func TestDelivery_NakBackOff(t *testing.T) {
+	delivery, acker := newDelivery(nil)
+	delivery.backOff = []time.Duration{time.Second, time.Minute}
+
+	for delivered, want := range map[uint64]time.Duration{1: time.Second, 2: time.Minute, 5: time.Minute} {
+		delivery.Delivered = delivered
+		if err := delivery.Nak(0); err != nil {
+			t.Fatalf("Nak() error = %v", err)
+		}
+		if acker.delay != want {
+			t.Errorf("Nak() after delivery %d delayed %s; want %s", delivered, acker.delay, want)
+		}
+	}
+	_ = delivery.Nak(time.Hour)
+	if acker.delay != time.Hour {
+		t.Errorf("Nak(1h) delayed %s; want the explicit delay", acker.delay)
+	}
+}
+
+func TestProcessor_ConsumeV2(t *testing.T) {
+	storage := failingGetStorage{memStorage: newMemStorage(), key: "corrupt"}
+
+	firing, _ := alerts.NewAlertV2("disk", "node-exporter", "critical", "disk_full", "disk", "disk", time.Now(), alerts.AlertStateActive).MarshalJSON()
+	failing, _ := alerts.NewAlertV2("corrupt", "node-exporter", "critical", "disk_full", "disk", "disk", time.Now(), alerts.AlertStateActive).MarshalJSON()
+	processed, processedAcker := newDelivery(firing)
+	failed, failedAcker := newDelivery(failing)
+	undecodable, undecodableAcker := newDelivery([]byte("{"))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	fetcher := &fakeFetcher{deliveries: []*Delivery{processed, failed, undecodable}, cancel: cancel}
+	stream := newMemStream()
+	p := NewProcessorV2(nil, storage, stream)
+	if err := p.ConsumeV2(ctx, fetcher, 0); err != context.Canceled {
+		t.Fatalf("ConsumeV2() error = %v; want context.Canceled", err)
+	}
+
+	if processedAcker.settled != "ack" || len(stream.published[StorageTopic]) != 1 {
+		t.Errorf("processed alert settled with %q after %d stores; want ack after 1", processedAcker.settled,
+			len(stream.published[StorageTopic]))
+	}
+	if failedAcker.settled != "nak" {
+		t.Errorf("failed alert settled with %q; want nak", failedAcker.settled)
+	}
+	if undecodableAcker.settled != "term" {
+		t.Errorf("undecodable message settled with %q; want term", undecodableAcker.settled)
+	}
+}
+
+func TestProcessor_ConsumeV2TermsDeadLetters(t *testing.T) {
+	storage := failingGetStorage{memStorage: newMemStorage(), key: "corrupt"}
+	failing, _ := alerts.NewAlertV2("corrupt", "node-exporter", "critical", "disk_full", "disk", "disk", time.Now(), alerts.AlertStateActive).MarshalJSON()
+	dlq := &memDeadLetterQueue{}
+	// A long delay would stall the test if attempts were retried in process.
+	p := NewProcessorV2(nil, storage, newMemStream(), WithDeadLetterQueue(dlq, DeadLetterConfig{MaxAttempts: 2, RetryDelay: time.Hour}))
+
+	for delivered, want := range map[uint64]string{1: "nak", 2: "term"} {
+		failed, acker := newDelivery(failing)
+		failed.Delivered = delivered
+		ctx, cancel := context.WithCancel(context.Background())
+		_ = p.ConsumeV2(ctx, &fakeFetcher{deliveries: []*Delivery{failed}, cancel: cancel}, 1)
+		if acker.settled != want {
+			t.Errorf("delivery %d settled with %q; want %q", delivered, acker.settled, want)
+		}
+	}
+	if len(dlq.letters) != 1 || dlq.letters[0].Attempts != 2 {
+		t.Errorf("dead letters = %+v; want one after 2 attempts", dlq.letters)
+	}
+}
+
+// unavailableStream fails every publish.
+type unavailableStream struct {
+	*memStream
+}
+
+func (unavailableStream) Publish(string, []byte) error {
+	return errors.New("stream unavailable")
+}
+
+func TestProcessor_ConsumeV2NaksWhenStreamIsDown(t *testing.T) {
+	firing, _ := alerts.NewAlertV2("disk", "node-exporter", "critical", "disk_full", "disk", "disk", time.Now(), alerts.AlertStateActive).MarshalJSON()
+	delivery, acker := newDelivery(firing)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	p := NewProcessorV2(nil, newMemStorage(), unavailableStream{newMemStream()})
+	_ = p.ConsumeV2(ctx, &fakeFetcher{deliveries: []*Delivery{delivery}, cancel: cancel}, 1)
+
+	if acker.settled != "nak" {
+		t.Errorf("alert settled with %q while the stream is down; want nak", acker.settled)
+	}
+}
+
+// memDeadLetterQueue records sent dead letters.
+type memDeadLetterQueue struct {
+	DeadLetterQueue
+	letters []DeadLetter
+}
+
+func (q *memDeadLetterQueue) Send(letter DeadLetter) error {
+	q.letters = append(q.letters, letter)
+	return nil
+}
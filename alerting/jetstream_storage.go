@@ -0,0 +1,86 @@
+package alerting
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	natsdriver "github.com/avilikof/go-shared-libs/nats"
+
+	"github.com/nats-io/nats.go"
+)
+
+// jetStreamStorage maps natsdriver.JetStreamStorage errors onto the Storage
+// contract.
+type jetStreamStorage struct {
+	storage *natsdriver.JetStreamStorage
+	conn    *nats.Conn
+	closed  atomic.Bool
+}
+
+func (s *jetStreamStorage) Get(key string) ([]byte, error) {
+	if err := s.checkClosed(); err != nil {
+		return nil, err
+	}
+	value, err := s.storage.Get(key)
+	if errors.Is(err, natsdriver.ErrKeyNotFound) {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, key)
+	}
+	if err != nil {
+		return nil, natsError(err)
+	}
+	return value, nil
+}
+
+// Set stores value under key. JetStream KV only supports a bucket wide TTL,
+// so expires is ignored.
+func (s *jetStreamStorage) Set(key string, value []byte, expires time.Duration) error {
+	if err := s.checkClosed(); err != nil {
+		return err
+	}
+	return natsError(s.storage.Set(key, value, expires))
+}
+
+func (s *jetStreamStorage) Delete(key string) error {
+	if err := s.checkClosed(); err != nil {
+		return err
+	}
+	return natsError(s.storage.Delete(key))
+}
+
+// List returns the sorted keys of the bucket.
+func (s *jetStreamStorage) List() ([]string, error) {
+	if err := s.checkClosed(); err != nil {
+		return nil, err
+	}
+	keys, err := s.storage.GetAll()
+	if err != nil {
+		return nil, natsError(err)
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// Close detaches the storage; the underlying connection is owned by the
+// JetStreamHandler.
+func (s *jetStreamStorage) Close() error {
+	s.closed.Store(true)
+	return nil
+}
+
+func (s *jetStreamStorage) checkClosed() error {
+	if s.closed.Load() || s.conn.IsClosed() {
+		return ErrClosed
+	}
+	return nil
+}
+
+// natsError marks errors caused by a closed NATS connection with ErrClosed.
+func natsError(err error) error {
+	if err != nil && errors.Is(err, nats.ErrConnectionClosed) {
+		return fmt.Errorf("%w: %w", ErrClosed, err)
+	}
+	return err
+}
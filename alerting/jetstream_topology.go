@@ -0,0 +1,448 @@
+package alerting
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"gopkg.in/yaml.v3"
+)
+
+// JETSTREAM_TOPOLOGY names the environment variable holding the path of a
+// topology file loaded by NewJetStreamHandler, see LoadTopology.
+const JETSTREAM_TOPOLOGY = "JETSTREAM_TOPOLOGY"
+
+var (
+	// ErrInvalidTopology is returned for topologies that cannot be loaded or
+	// are missing required fields.
+	ErrInvalidTopology = errors.New("invalid topology")
+	// ErrIncompatibleChange is returned by Reconcile when an existing stream
+	// or consumer differs from its definition in a way the server cannot
+	// apply in place.
+	ErrIncompatibleChange = errors.New("incompatible change")
+)
+
+// StreamDefinition declares a JetStream stream. Zero values fall back to the
+// defaults noted on each field.
+type StreamDefinition struct {
+	Name        string   `yaml:"name"`
+	Description string   `yaml:"description"`
+	Subjects    []string `yaml:"subjects"`
+	// Storage is "file" or "memory". Default "file".
+	Storage string `yaml:"storage"`
+	// Retention is "limits", "interest" or "workqueue". Default "limits".
+	Retention string `yaml:"retention"`
+	// MaxAge, MaxBytes and MaxMsgs limit the stream. Zero means unlimited.
+	MaxAge   time.Duration `yaml:"max_age"`
+	MaxBytes int64         `yaml:"max_bytes"`
+	MaxMsgs  int64         `yaml:"max_msgs"`
+	// Replicas is the number of stream replicas. Default 1.
+	Replicas int `yaml:"replicas"`
+	// Duplicates is the duplicate detection window. Default two minutes,
+	// the server default.
+	Duplicates time.Duration `yaml:"duplicates"`
+}
+
+// ConsumerDefinition declares a durable pull consumer on a stream.
+type ConsumerDefinition struct {
+	Stream      string `yaml:"stream"`
+	Name        string `yaml:"name"`
+	Description string `yaml:"description"`
+	// FilterSubject restricts the consumer to matching subjects.
+	FilterSubject string `yaml:"filter_subject"`
+	// DeliverPolicy is "all", "last", "new" or "last_per_subject". Default
+	// "all".
+	DeliverPolicy string `yaml:"deliver_policy"`
+	// AckWait is how long a delivered message may stay unacknowledged
+	// before it is redelivered. Default 30 seconds.
+	AckWait time.Duration `yaml:"ack_wait"`
+	// MaxDeliver caps deliveries per message. Zero means unlimited.
+	MaxDeliver int `yaml:"max_deliver"`
+	// BackOff are the redelivery delays after the first, second, ...
+	// delivery, replacing AckWait. It must be shorter than MaxDeliver.
+	BackOff []time.Duration `yaml:"backoff"`
+	// MaxAckPending caps unacknowledged messages. Default 1000.
+	MaxAckPending int `yaml:"max_ack_pending"`
+}
+
+// Topology is the set of streams and consumers reconciled by
+// NewJetStreamHandler.
+type Topology struct {
+	Streams   []StreamDefinition   `yaml:"streams"`
+	Consumers []ConsumerDefinition `yaml:"consumers"`
+}
+
+// DefaultTopology returns the ALERTS and EVENTS streams used by the alerting
+// services.
+func DefaultTopology() Topology {
+	return Topology{
+		Streams: []StreamDefinition{
+			{
+				Name:        ALERT_STREAM,
+				Description: "Alert processing stream",
+				Subjects:    []string{"test.alert", StorageTopic, TenantPrefix + "*.test.alert", TenantPrefix + "*." + StorageTopic},
+				MaxAge:      24 * time.Hour,
+				MaxBytes:    100 * 1024 * 1024,
+			},
+			{
+				Name:        EVENT_STREAM,
+				Description: "Event logging stream",
+				Subjects:    []string{EvetTopic, TenantPrefix + "*." + EvetTopic},
+				MaxAge:      7 * 24 * time.Hour,
+				MaxBytes:    50 * 1024 * 1024,
+			},
+		},
+	}
+}
+
+// LoadTopology reads a topology from a YAML file with top-level "streams"
+// and "consumers" keys.
+func LoadTopology(path string) (Topology, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Topology{}, fmt.Errorf("failed to read topology %s: %w", path, err)
+	}
+	var topology Topology
+	if err := yaml.Unmarshal(data, &topology); err != nil {
+		return Topology{}, fmt.Errorf("%w: %s: %v", ErrInvalidTopology, path, err)
+	}
+	if err := topology.Validate(); err != nil {
+		return Topology{}, fmt.Errorf("%s: %w", path, err)
+	}
+	return topology, nil
+}
+
+// Validate checks that every definition can be turned into a server config.
+func (t Topology) Validate() error {
+	streams := map[string]bool{}
+	for _, def := range t.Streams {
+		if _, err := def.config(); err != nil {
+			return err
+		}
+		if streams[def.Name] {
+			return fmt.Errorf("%w: stream %s defined twice", ErrInvalidTopology, def.Name)
+		}
+		streams[def.Name] = true
+	}
+	for _, def := range t.Consumers {
+		if _, err := def.config(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (def StreamDefinition) config() (*nats.StreamConfig, error) {
+	if def.Name == "" || len(def.Subjects) == 0 {
+		return nil, fmt.Errorf("%w: stream %q needs a name and subjects", ErrInvalidTopology, def.Name)
+	}
+	config := &nats.StreamConfig{
+		Name:        def.Name,
+		Description: def.Description,
+		Subjects:    def.Subjects,
+		MaxAge:      def.MaxAge,
+		MaxBytes:    def.MaxBytes,
+		MaxMsgs:     def.MaxMsgs,
+		Replicas:    def.Replicas,
+		Duplicates:  def.Duplicates,
+	}
+	if config.MaxBytes == 0 {
+		config.MaxBytes = -1
+	}
+	if config.MaxMsgs == 0 {
+		config.MaxMsgs = -1
+	}
+	if config.Replicas < 1 {
+		config.Replicas = 1
+	}
+	if config.Duplicates <= 0 {
+		config.Duplicates = 2 * time.Minute
+	}
+	if err := parseEnum("storage", def.Storage, "file", &config.Storage); err != nil {
+		return nil, fmt.Errorf("stream %s: %w", def.Name, err)
+	}
+	if err := parseEnum("retention", def.Retention, "limits", &config.Retention); err != nil {
+		return nil, fmt.Errorf("stream %s: %w", def.Name, err)
+	}
+	return config, nil
+}
+
+func (def ConsumerDefinition) config() (*nats.ConsumerConfig, error) {
+	if def.Stream == "" || def.Name == "" {
+		return nil, fmt.Errorf("%w: consumer %q needs a stream and a name", ErrInvalidTopology, def.Name)
+	}
+	config := &nats.ConsumerConfig{
+		Durable:       def.Name,
+		Description:   def.Description,
+		FilterSubject: def.FilterSubject,
+		AckPolicy:     nats.AckExplicitPolicy,
+		AckWait:       def.AckWait,
+		MaxDeliver:    def.MaxDeliver,
+		BackOff:       def.BackOff,
+		MaxAckPending: def.MaxAckPending,
+	}
+	if config.AckWait <= 0 {
+		config.AckWait = 30 * time.Second
+	}
+	if config.MaxDeliver <= 0 {
+		config.MaxDeliver = -1
+	}
+	if len(config.BackOff) > 0 {
+		if config.MaxDeliver > 0 && len(config.BackOff) >= config.MaxDeliver {
+			return nil, fmt.Errorf("%w: consumer %s has %d back-off delays for a max deliver of %d", ErrInvalidTopology,
+				def.Name, len(config.BackOff), config.MaxDeliver)
+		}
+		// The server takes the ack wait from the first delay.
+		config.AckWait = config.BackOff[0]
+	}
+	if config.MaxAckPending <= 0 {
+		config.MaxAckPending = 1000
+	}
+	if err := parseEnum("deliver_policy", def.DeliverPolicy, "all", &config.DeliverPolicy); err != nil {
+		return nil, fmt.Errorf("consumer %s: %w", def.Name, err)
+	}
+	return config, nil
+}
+
+// parseEnum decodes value, or fallback if it is empty, with the JSON decoding
+// of the nats.go enum type v. Some of those ignore unknown values, so the
+// result is encoded again to check that it round-trips.
+func parseEnum(field, value, fallback string, v any) error {
+	if value == "" {
+		value = fallback
+	}
+	quoted := strconv.Quote(value)
+	err := json.Unmarshal([]byte(quoted), v)
+	if err == nil {
+		var encoded []byte
+		encoded, err = json.Marshal(v)
+		if err == nil && string(encoded) != quoted {
+			err = errors.New("unknown value")
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("%w: %s %q", ErrInvalidTopology, field, value)
+	}
+	return nil
+}
+
+// ReconcileAction is what Reconcile did with a definition.
+type ReconcileAction string
+
+const (
+	ReconcileCreated      ReconcileAction = "created"
+	ReconcileUpdated      ReconcileAction = "updated"
+	ReconcileOutdated     ReconcileAction = "outdated"
+	ReconcileUnchanged    ReconcileAction = "unchanged"
+	ReconcileIncompatible ReconcileAction = "incompatible"
+)
+
+// ReconcileResult reports the outcome for one stream or consumer.
+type ReconcileResult struct {
+	// Kind is "stream" or "consumer".
+	Kind   string
+	Name   string
+	Action ReconcileAction
+	// Changes describes the fields that were updated, or that were not.
+	Changes []string
+}
+
+func (r ReconcileResult) String() string {
+	s := fmt.Sprintf("%s %s %s", r.Kind, r.Name, r.Action)
+	if len(r.Changes) > 0 {
+		s += fmt.Sprintf(": %v", r.Changes)
+	}
+	return s
+}
+
+// Reconcile creates the streams and consumers of topology that do not exist.
+// Existing ones that differ from their definition are updated if update is
+// set and reported as outdated otherwise. Those that need incompatible
+// changes, e.g. a different storage type, are left alone and reported;
+// Reconcile then returns an error matching ErrIncompatibleChange after
+// reconciling everything else. Streams and consumers that are not in the
+// topology are never touched.
+func Reconcile(js nats.JetStreamContext, topology Topology, update bool) ([]ReconcileResult, error) {
+	if err := topology.Validate(); err != nil {
+		return nil, err
+	}
+
+	var results []ReconcileResult
+	var incompatible []string
+	for _, def := range topology.Streams {
+		config, _ := def.config()
+		result, err := reconcileStream(js, config, update)
+		if err != nil {
+			return results, err
+		}
+		results = append(results, result)
+		if result.Action == ReconcileIncompatible {
+			incompatible = append(incompatible, result.String())
+		}
+	}
+	for _, def := range topology.Consumers {
+		config, _ := def.config()
+		result, err := reconcileConsumer(js, def.Stream, config, update)
+		if err != nil {
+			return results, err
+		}
+		results = append(results, result)
+		if result.Action == ReconcileIncompatible {
+			incompatible = append(incompatible, result.String())
+		}
+	}
+	if len(incompatible) > 0 {
+		return results, fmt.Errorf("%w: %v", ErrIncompatibleChange, incompatible)
+	}
+	return results, nil
+}
+
+func reconcileStream(js nats.JetStreamContext, config *nats.StreamConfig, update bool) (ReconcileResult, error) {
+	result := ReconcileResult{Kind: "stream", Name: config.Name}
+	info, err := js.StreamInfo(config.Name)
+	if errors.Is(err, nats.ErrStreamNotFound) {
+		if _, err := js.AddStream(config); err != nil {
+			return result, fmt.Errorf("failed to create stream %s: %w", config.Name, natsError(err))
+		}
+		result.Action = ReconcileCreated
+		return result, nil
+	}
+	if err != nil {
+		return result, fmt.Errorf("failed to get stream %s: %w", config.Name, natsError(err))
+	}
+
+	current := info.Config
+	if current.Storage != config.Storage {
+		result.Changes = append(result.Changes, change("storage", current.Storage, config.Storage))
+	}
+	if current.Retention != config.Retention {
+		result.Changes = append(result.Changes, change("retention", current.Retention, config.Retention))
+	}
+	if len(result.Changes) > 0 {
+		result.Action = ReconcileIncompatible
+		return result, nil
+	}
+
+	if current.Description != config.Description {
+		result.Changes = append(result.Changes, change("description", current.Description, config.Description))
+	}
+	if !slices.Equal(current.Subjects, config.Subjects) {
+		result.Changes = append(result.Changes, change("subjects", current.Subjects, config.Subjects))
+	}
+	if current.MaxAge != config.MaxAge {
+		result.Changes = append(result.Changes, change("max_age", current.MaxAge, config.MaxAge))
+	}
+	if current.MaxBytes != config.MaxBytes {
+		result.Changes = append(result.Changes, change("max_bytes", current.MaxBytes, config.MaxBytes))
+	}
+	if current.MaxMsgs != config.MaxMsgs {
+		result.Changes = append(result.Changes, change("max_msgs", current.MaxMsgs, config.MaxMsgs))
+	}
+	if current.Replicas != config.Replicas {
+		result.Changes = append(result.Changes, change("replicas", current.Replicas, config.Replicas))
+	}
+	if current.Duplicates != config.Duplicates {
+		result.Changes = append(result.Changes, change("duplicates", current.Duplicates, config.Duplicates))
+	}
+	if len(result.Changes) == 0 {
+		result.Action = ReconcileUnchanged
+		return result, nil
+	}
+	if !update {
+		result.Action = ReconcileOutdated
+		return result, nil
+	}
+
+	updated := current
+	updated.Description = config.Description
+	updated.Subjects = config.Subjects
+	updated.MaxAge = config.MaxAge
+	updated.MaxBytes = config.MaxBytes
+	updated.MaxMsgs = config.MaxMsgs
+	updated.Replicas = config.Replicas
+	updated.Duplicates = config.Duplicates
+	if _, err := js.UpdateStream(&updated); err != nil {
+		return result, fmt.Errorf("failed to update stream %s %v: %w", config.Name, result.Changes, natsError(err))
+	}
+	result.Action = ReconcileUpdated
+	return result, nil
+}
+
+func reconcileConsumer(js nats.JetStreamContext, stream string, config *nats.ConsumerConfig, update bool) (ReconcileResult, error) {
+	result := ReconcileResult{Kind: "consumer", Name: stream + "/" + config.Durable}
+	info, err := js.ConsumerInfo(stream, config.Durable)
+	if errors.Is(err, nats.ErrConsumerNotFound) {
+		if _, err := js.AddConsumer(stream, config); err != nil {
+			return result, fmt.Errorf("failed to create consumer %s: %w", result.Name, natsError(err))
+		}
+		result.Action = ReconcileCreated
+		return result, nil
+	}
+	if err != nil {
+		return result, fmt.Errorf("failed to get consumer %s: %w", result.Name, natsError(err))
+	}
+
+	current := info.Config
+	if current.DeliverPolicy != config.DeliverPolicy {
+		result.Changes = append(result.Changes, change("deliver_policy", current.DeliverPolicy, config.DeliverPolicy))
+	}
+	if current.AckPolicy != config.AckPolicy {
+		result.Changes = append(result.Changes, change("ack_policy", current.AckPolicy, config.AckPolicy))
+	}
+	if current.DeliverSubject != "" {
+		result.Changes = append(result.Changes, change("deliver_subject", current.DeliverSubject, ""))
+	}
+	if len(result.Changes) > 0 {
+		result.Action = ReconcileIncompatible
+		return result, nil
+	}
+
+	if current.Description != config.Description {
+		result.Changes = append(result.Changes, change("description", current.Description, config.Description))
+	}
+	if current.FilterSubject != config.FilterSubject {
+		result.Changes = append(result.Changes, change("filter_subject", current.FilterSubject, config.FilterSubject))
+	}
+	if current.AckWait != config.AckWait {
+		result.Changes = append(result.Changes, change("ack_wait", current.AckWait, config.AckWait))
+	}
+	if current.MaxDeliver != config.MaxDeliver {
+		result.Changes = append(result.Changes, change("max_deliver", current.MaxDeliver, config.MaxDeliver))
+	}
+	if !slices.Equal(current.BackOff, config.BackOff) {
+		result.Changes = append(result.Changes, change("backoff", current.BackOff, config.BackOff))
+	}
+	if current.MaxAckPending != config.MaxAckPending {
+		result.Changes = append(result.Changes, change("max_ack_pending", current.MaxAckPending, config.MaxAckPending))
+	}
+	if len(result.Changes) == 0 {
+		result.Action = ReconcileUnchanged
+		return result, nil
+	}
+	if !update {
+		result.Action = ReconcileOutdated
+		return result, nil
+	}
+
+	updated := current
+	updated.Description = config.Description
+	updated.FilterSubject = config.FilterSubject
+	updated.AckWait = config.AckWait
+	updated.MaxDeliver = config.MaxDeliver
+	updated.BackOff = config.BackOff
+	updated.MaxAckPending = config.MaxAckPending
+	if _, err := js.UpdateConsumer(stream, &updated); err != nil {
+		return result, fmt.Errorf("failed to update consumer %s %v: %w", result.Name, result.Changes, natsError(err))
+	}
+	result.Action = ReconcileUpdated
+	return result, nil
+}
+
+func change(field string, from, to any) string {
+	return fmt.Sprintf("%s %v -> %v", field, from, to)
+}
@@ -0,0 +1,135 @@
+package alerting_test
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/avilikof/go-shared-libs/alerting"
+)
+
+const testTopology = `
+streams:
+  - name: ALERTS
+    subjects: [test.alert, alert.store]
+    max_age: 48h
+    max_bytes: 1048576
+    replicas: 1
+  - name: EVENTS
+    subjects: [alert.event]
+    storage: memory
+    retention: interest
+consumers:
+  - stream: ALERTS
+    name: processor
+    filter_subject: test.alert
+    ack_wait: 1m
+    max_deliver: 5
+`
+
+func TestLoadTopology(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "topology.yaml")
+	if err := os.WriteFile(path, []byte(testTopology), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	topology, err := alerting.LoadTopology(path)
+	if err != nil {
+		t.Fatalf("LoadTopology() error = %v", err)
+	}
+	if len(topology.Streams) != 2 || topology.Streams[0].MaxAge != 48*time.Hour {
+		t.Errorf("Streams = %+v; want ALERTS with a 48h max age", topology.Streams)
+	}
+	if len(topology.Consumers) != 1 || topology.Consumers[0].MaxDeliver != 5 {
+		t.Errorf("Consumers = %+v; want processor with max_deliver 5", topology.Consumers)
+	}
+}
+
+func TestTopology_Validate(t *testing.T) {
+	for name, topology := range map[string]alerting.Topology{
+		"no subjects":     {Streams: []alerting.StreamDefinition{{Name: "S"}}},
+		"bad storage":     {Streams: []alerting.StreamDefinition{{Name: "S", Subjects: []string{"s"}, Storage: "disk"}}},
+		"duplicate":       {Streams: []alerting.StreamDefinition{{Name: "S", Subjects: []string{"a"}}, {Name: "S", Subjects: []string{"b"}}}},
+		"consumer stream": {Consumers: []alerting.ConsumerDefinition{{Name: "c"}}},
+		"deliver policy":  {Consumers: []alerting.ConsumerDefinition{{Stream: "S", Name: "c", DeliverPolicy: "sometimes"}}},
+	} {
+		if err := topology.Validate(); !errors.Is(err, alerting.ErrInvalidTopology) {
+			t.Errorf("%s: Validate() error = %v; want ErrInvalidTopology", name, err)
+		}
+	}
+	if err := alerting.DefaultTopology().Validate(); err != nil {
+		t.Errorf("DefaultTopology().Validate() error = %v", err)
+	}
+}
+
+func TestReconcile(t *testing.T) {
+	requireNATS(t)
+	js := newJetStreamHandler(t).JetStream()
+
+	name := fmt.Sprintf("RECONCILE_%d", time.Now().UnixNano())
+	t.Cleanup(func() { _ = js.DeleteStream(name) })
+	topology := alerting.Topology{
+		Streams: []alerting.StreamDefinition{{
+			Name:     name,
+			Subjects: []string{"reconcile." + name + ".>"},
+			MaxAge:   time.Hour,
+		}},
+		Consumers: []alerting.ConsumerDefinition{{Stream: name, Name: "worker", MaxDeliver: 3}},
+	}
+
+	expectActions := func(update bool, want ...alerting.ReconcileAction) {
+		t.Helper()
+		results, err := alerting.Reconcile(js, topology, update)
+		if err != nil {
+			t.Fatalf("Reconcile() error = %v", err)
+		}
+		for i, result := range results {
+			if result.Action != want[i] {
+				t.Errorf("Reconcile() %s; want %s", result, want[i])
+			}
+		}
+	}
+	expectActions(false, alerting.ReconcileCreated, alerting.ReconcileCreated)
+	expectActions(true, alerting.ReconcileUnchanged, alerting.ReconcileUnchanged)
+
+	topology.Streams[0].MaxAge = 2 * time.Hour
+	topology.Consumers[0].MaxDeliver = 5
+	expectActions(false, alerting.ReconcileOutdated, alerting.ReconcileOutdated)
+	info, err := js.StreamInfo(name)
+	if err != nil || info.Config.MaxAge != time.Hour {
+		t.Errorf("StreamInfo() = %v, %v; want the max age kept without updates", info, err)
+	}
+	expectActions(true, alerting.ReconcileUpdated, alerting.ReconcileUpdated)
+	info, err = js.StreamInfo(name)
+	if err != nil || info.Config.MaxAge != 2*time.Hour {
+		t.Errorf("StreamInfo() = %v, %v; want the max age updated", info, err)
+	}
+
+	topology.Streams[0].MaxAge = 3 * time.Hour
+	handler, err := alerting.NewJetStreamHandler(alerting.WithTopology(topology))
+	if err != nil {
+		t.Fatalf("NewJetStreamHandler() error = %v", err)
+	}
+	handler.Close()
+	info, err = js.StreamInfo(name)
+	if err != nil || info.Config.MaxAge != 3*time.Hour {
+		t.Errorf("StreamInfo() = %v, %v; want the handler to apply compatible changes", info, err)
+	}
+
+	topology.Streams[0].Storage = "memory"
+	results, err := alerting.Reconcile(js, topology, true)
+	if !errors.Is(err, alerting.ErrIncompatibleChange) {
+		t.Fatalf("Reconcile() error = %v; want ErrIncompatibleChange", err)
+	}
+	if len(results) != 2 || results[0].Action != alerting.ReconcileIncompatible || results[1].Action != alerting.ReconcileUnchanged {
+		t.Errorf("Reconcile() = %v; want the stream incompatible and the consumer reconciled", results)
+	}
+
+	handler, err = alerting.NewJetStreamHandler(alerting.WithTopology(topology))
+	if err != nil {
+		t.Fatalf("NewJetStreamHandler() error = %v; want incompatible changes only reported", err)
+	}
+	handler.Close()
+}
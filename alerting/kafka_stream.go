@@ -0,0 +1,249 @@
+package alerting
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+// KafkaStreamConfig configures a KafkaStream. Zero values fall back to the
+// defaults noted on each field.
+type KafkaStreamConfig struct {
+	// Brokers are the seed brokers of the Kafka or Redpanda cluster.
+	Brokers []string
+	// Group names the consumer groups of subscriptions without WithGroup:
+	// the first subscription of a subject consumes through Group, further
+	// concurrent ones through Group-2, Group-3, ... Default "alerting".
+	Group string
+	// Topics maps subjects to topic names. Subjects without an entry use
+	// TopicPrefix followed by the subject.
+	Topics map[string]string
+	// TopicPrefix is prepended to subjects missing from Topics.
+	TopicPrefix string
+	// Key extracts the record key from a payload. Records with the same key
+	// land on the same partition and keep their order. Default AlertKey.
+	Key func(data []byte) []byte
+	// Options are passed to every client, e.g. kgo.DialTLSConfig or kgo.SASL.
+	Options []kgo.Opt
+}
+
+// KafkaStream is a Stream on Kafka or Redpanda. Records are keyed by alert ID,
+// so all messages about one alert are delivered in order. Subscribers consume
+// through a consumer group and commit the offset of a record once it has
+// been handled, so a restarted subscriber resumes where it left off. Each
+// subscription has a group of its own unless WithGroup shares one.
+// SubscribeMsg commits only records its handler succeeded for, so a
+// Processor subscribed with its HandleMsg or HandleMsgV2 handler processes
+// every record at least once. Subscribe commits records as soon as they are
+// handed to the channel, before the receiver processed them.
+type KafkaStream struct {
+	config   KafkaStreamConfig
+	producer *kgo.Client
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	groups groupSlots
+	wg     sync.WaitGroup
+	closed atomic.Bool
+}
+
+// NewKafkaStream creates a KafkaStream. Topics are not created; they must
+// exist or the cluster must allow automatic topic creation.
+func NewKafkaStream(config KafkaStreamConfig) (*KafkaStream, error) {
+	if len(config.Brokers) == 0 {
+		return nil, fmt.Errorf("kafka stream requires at least one broker")
+	}
+	if config.Group == "" {
+		config.Group = "alerting"
+	}
+	if config.Key == nil {
+		config.Key = AlertKey
+	}
+
+	opts := append([]kgo.Opt{kgo.SeedBrokers(config.Brokers...)}, config.Options...)
+	producer, err := kgo.NewClient(opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create kafka producer: %w", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	return &KafkaStream{
+		config:   config,
+		producer: producer,
+		ctx:      ctx,
+		cancel:   cancel,
+	}, nil
+}
+
+// Publish produces data to the topic mapped from subject and waits for the
+// broker to acknowledge it.
+func (ks *KafkaStream) Publish(subject string, data []byte) error {
+	return ks.PublishMsg(ks.ctx, &Message{Subject: subject, Data: data})
+}
+
+// PublishMsg is Publish with msg's headers as record headers, waiting at most
+// until ctx is done.
+func (ks *KafkaStream) PublishMsg(ctx context.Context, msg *Message) error {
+	if ks.closed.Load() {
+		return ErrClosed
+	}
+	record := &kgo.Record{
+		Topic: ks.topic(msg.Subject),
+		Key:   ks.config.Key(msg.Data),
+		Value: msg.Data,
+	}
+	for key, value := range msg.Header {
+		record.Headers = append(record.Headers, kgo.RecordHeader{Key: key, Value: []byte(value)})
+	}
+	if err := ks.producer.ProduceSync(ctx, record).FirstErr(); err != nil {
+		if ks.closed.Load() {
+			return ErrClosed
+		}
+		return fmt.Errorf("failed to publish to %s: %w", record.Topic, err)
+	}
+	return nil
+}
+
+// Subscribe joins the consumer group on the topic mapped from subject and
+// forwards records to channel from a background goroutine. A group without
+// committed offsets starts at the beginning of the topic. Records are polled
+// at the pace of channel, so SubscribeOptions but WithGroup do not apply.
+// Records are committed once handed to channel, before the receiver
+// processed them; subscribe a Processor with SubscribeMsg instead. Ending
+// the subscription leaves the group.
+func (ks *KafkaStream) Subscribe(subject string, channel chan []byte, opts ...SubscribeOption) (Subscription, error) {
+	return ks.SubscribeMsg(subject, channelHandler(channel), opts...)
+}
+
+// SubscribeMsg is Subscribe calling handler with the records and their
+// headers. Offsets are committed in order, so a record the handler fails
+// holds back its partition: it is not committed and is polled again, after a
+// second, together with the records behind it.
+func (ks *KafkaStream) SubscribeMsg(subject string, handler MessageHandler, opts ...SubscribeOption) (Subscription, error) {
+	if ks.closed.Load() {
+		return nil, ErrClosed
+	}
+	topic := ks.topic(subject)
+	group, release := ks.groups.group(subject, ks.config.Group, newSubscribeOptions(opts))
+	clientOpts := append([]kgo.Opt{
+		kgo.SeedBrokers(ks.config.Brokers...),
+		kgo.ConsumerGroup(group),
+		kgo.ConsumeTopics(topic),
+		kgo.ConsumeResetOffset(kgo.NewOffset().AtStart()),
+		kgo.DisableAutoCommit(),
+	}, ks.config.Options...)
+	consumer, err := kgo.NewClient(clientOpts...)
+	if err != nil {
+		release()
+		return nil, fmt.Errorf("failed to create kafka consumer for %s: %w", topic, err)
+	}
+
+	sub := newLoopSubscription(ks.ctx)
+	ks.wg.Add(1)
+	go func() {
+		defer ks.wg.Done()
+		defer close(sub.done)
+		defer release()
+		defer consumer.Close()
+		ks.consume(sub, consumer, subject, topic, handler)
+	}()
+	return sub, nil
+}
+
+// Close stops all subscriptions, leaving their consumer groups, and closes
+// the producer.
+func (ks *KafkaStream) Close() error {
+	if ks.closed.Swap(true) {
+		return nil
+	}
+	ks.cancel()
+	ks.wg.Wait()
+	ks.producer.Close()
+	return nil
+}
+
+func (ks *KafkaStream) topic(subject string) string {
+	if topic, ok := ks.config.Topics[subject]; ok {
+		return topic
+	}
+	return ks.config.TopicPrefix + subject
+}
+
+func (ks *KafkaStream) consume(sub *loopSubscription, consumer *kgo.Client, subject, topic string, handler MessageHandler) {
+	for sub.running() {
+		fetches := consumer.PollFetches(sub.ctx)
+		if sub.ctx.Err() != nil {
+			return
+		}
+		fetches.EachError(func(t string, partition int32, err error) {
+			fmt.Printf("Kafka stream :: %s[%d] :: %v\n", t, partition, err)
+		})
+
+		var delivered []*kgo.Record
+		failed := make(map[int32]kgo.EpochOffset)
+		fetches.EachRecord(func(record *kgo.Record) {
+			if sub.ctx.Err() != nil {
+				return
+			}
+			if _, ok := failed[record.Partition]; ok {
+				return
+			}
+			msg := &Message{Subject: subject, Data: record.Value}
+			if len(record.Headers) > 0 {
+				msg.Header = make(Header, len(record.Headers))
+				for _, header := range record.Headers {
+					msg.Header[header.Key] = string(header.Value)
+				}
+			}
+			if err := handler(sub.ctx, msg); err != nil {
+				if sub.ctx.Err() != nil {
+					return
+				}
+				fmt.Printf("Kafka stream :: %s :: %v\n", topic, err)
+				failed[record.Partition] = kgo.EpochOffset{Epoch: record.LeaderEpoch, Offset: record.Offset}
+				return
+			}
+			delivered = append(delivered, record)
+			sub.counters.delivered.Add(1)
+		})
+		if len(delivered) > 0 {
+			// Commit with a fresh context so offsets of delivered records are
+			// not lost when Close interrupts the loop.
+			if err := consumer.CommitRecords(context.Background(), delivered...); err != nil {
+				fmt.Printf("Kafka stream :: %s :: failed to commit offsets: %v\n", topic, err)
+			}
+		}
+		if len(failed) > 0 && sub.ctx.Err() == nil {
+			// Rewind the partitions to their failed records, so they are
+			// polled again.
+			consumer.SetOffsets(map[string]map[int32]kgo.EpochOffset{topic: failed})
+			sleep(sub.ctx, time.Second)
+		}
+	}
+}
+
+// AlertKey returns the alert ID carried by an alert or an alert event, or nil
+// when data carries none. It is the default KafkaStreamConfig.Key.
+func AlertKey(data []byte) []byte {
+	var payload struct {
+		ID      string `json:"id"`
+		Message any    `json:"Message"`
+	}
+	if err := json.Unmarshal(data, &payload); err != nil {
+		return nil
+	}
+	if payload.ID != "" {
+		return []byte(payload.ID)
+	}
+	if message, ok := payload.Message.(map[string]any); ok {
+		if alertID, ok := message["alert_id"].(string); ok && alertID != "" {
+			return []byte(alertID)
+		}
+	}
+	return nil
+}
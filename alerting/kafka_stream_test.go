@@ -0,0 +1,211 @@
+package alerting_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/twmb/franz-go/pkg/kfake"
+	"github.com/twmb/franz-go/pkg/kgo"
+
+	"github.com/avilikof/go-shared-libs/alerting"
+	"github.com/avilikof/go-shared-libs/alerting/alertingtest"
+	"github.com/avilikof/go-shared-libs/alerts"
+	"github.com/avilikof/go-shared-libs/event"
+)
+
+func newKafkaStream(t *testing.T, config alerting.KafkaStreamConfig) *alerting.KafkaStream {
+	t.Helper()
+	stream, err := alerting.NewKafkaStream(config)
+	if err != nil {
+		t.Fatalf("NewKafkaStream() error = %v", err)
+	}
+	t.Cleanup(func() { stream.Close() })
+	return stream
+}
+
+func TestKafkaStreamConformance(t *testing.T) {
+	cluster := kfake.MustCluster(kfake.NumBrokers(1), kfake.SeedTopics(3, "conformance.test"))
+	t.Cleanup(cluster.Close)
+
+	alertingtest.RunStreamSuite(t, alertingtest.StreamSuite{
+		New: func(t *testing.T) alerting.Stream {
+			return newKafkaStream(t, alerting.KafkaStreamConfig{
+				Brokers: cluster.ListenAddrs(),
+				Group:   t.Name(),
+			})
+		},
+		Timeout: 10 * time.Second,
+	})
+}
+
+func TestKafkaStream_MapsTopicsAndKeysByAlertID(t *testing.T) {
+	cluster := kfake.MustCluster(kfake.NumBrokers(1), kfake.SeedTopics(3, "alerts-store", "prod.alert.event"))
+	t.Cleanup(cluster.Close)
+
+	stream := newKafkaStream(t, alerting.KafkaStreamConfig{
+		Brokers:     cluster.ListenAddrs(),
+		Topics:      map[string]string{alerting.StorageTopic: "alerts-store"},
+		TopicPrefix: "prod.",
+	})
+
+	alert := alerts.NewAlertV2("disk-full", "node-exporter", "critical", "disk", "disk is full", "disk-full", time.Now(), alerts.AlertStateActive)
+	alertBytes, err := alert.MarshalJSON()
+	if err != nil {
+		t.Fatalf("MarshalJSON() error = %v", err)
+	}
+	if err := stream.Publish(alerting.StorageTopic, alertBytes); err != nil {
+		t.Fatalf("Publish() error = %v", err)
+	}
+	event := []byte(`{"Action":"acknowledged","Message":{"alert_id":"disk-full"}}`)
+	if err := stream.Publish(alerting.EvetTopic, event); err != nil {
+		t.Fatalf("Publish() error = %v", err)
+	}
+
+	consumer, err := kgo.NewClient(
+		kgo.SeedBrokers(cluster.ListenAddrs()...),
+		kgo.ConsumeTopics("alerts-store", "prod.alert.event"),
+		kgo.ConsumeResetOffset(kgo.NewOffset().AtStart()),
+	)
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	defer consumer.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	seen := map[string]*kgo.Record{}
+	for len(seen) < 2 && ctx.Err() == nil {
+		consumer.PollFetches(ctx).EachRecord(func(record *kgo.Record) {
+			seen[record.Topic] = record
+		})
+	}
+
+	var partition int32 = -1
+	for _, topic := range []string{"alerts-store", "prod.alert.event"} {
+		record, ok := seen[topic]
+		if !ok {
+			t.Fatalf("no record on topic %s", topic)
+		}
+		if string(record.Key) != "disk-full" {
+			t.Errorf("%s record key = %q; want the alert ID", topic, record.Key)
+		}
+		if partition >= 0 && record.Partition != partition {
+			t.Errorf("%s record partition = %d; want %d, the partition of the same key", topic, record.Partition, partition)
+		}
+		partition = record.Partition
+	}
+}
+
+func TestKafkaStream_ResumesFromCommittedOffsets(t *testing.T) {
+	cluster := kfake.MustCluster(kfake.NumBrokers(1), kfake.SeedTopics(1, "alert.store"))
+	t.Cleanup(cluster.Close)
+	config := alerting.KafkaStreamConfig{Brokers: cluster.ListenAddrs()}
+
+	first, err := alerting.NewKafkaStream(config)
+	if err != nil {
+		t.Fatalf("NewKafkaStream() error = %v", err)
+	}
+	received := make(chan []byte, 1)
+	if _, err := first.Subscribe(alerting.StorageTopic, received); err != nil {
+		t.Fatalf("Subscribe() error = %v", err)
+	}
+	if err := first.Publish(alerting.StorageTopic, []byte("first")); err != nil {
+		t.Fatalf("Publish() error = %v", err)
+	}
+	expectKafkaMessage(t, received, "first")
+	first.Close()
+
+	second := newKafkaStream(t, config)
+	if err := second.Publish(alerting.StorageTopic, []byte("second")); err != nil {
+		t.Fatalf("Publish() error = %v", err)
+	}
+	received = make(chan []byte, 1)
+	if _, err := second.Subscribe(alerting.StorageTopic, received); err != nil {
+		t.Fatalf("Subscribe() error = %v", err)
+	}
+	expectKafkaMessage(t, received, "second")
+}
+
+func TestKafkaStream_RedeliversFailedRecords(t *testing.T) {
+	cluster := kfake.MustCluster(kfake.NumBrokers(1), kfake.SeedTopics(1, "alert.store"))
+	t.Cleanup(cluster.Close)
+	stream := newKafkaStream(t, alerting.KafkaStreamConfig{Brokers: cluster.ListenAddrs()})
+
+	received := make(chan []byte, 4)
+	failures := 1
+	handler := func(_ context.Context, msg *alerting.Message) error {
+		if string(msg.Data) == "first" && failures > 0 {
+			failures--
+			return errors.New("handler failed")
+		}
+		received <- msg.Data
+		return nil
+	}
+	if _, err := stream.SubscribeMsg(alerting.StorageTopic, handler); err != nil {
+		t.Fatalf("SubscribeMsg() error = %v", err)
+	}
+	for _, data := range []string{"first", "second"} {
+		if err := stream.Publish(alerting.StorageTopic, []byte(data)); err != nil {
+			t.Fatalf("Publish() error = %v", err)
+		}
+	}
+
+	// The failed record is polled again and holds back the one behind it.
+	expectKafkaMessage(t, received, "first")
+	expectKafkaMessage(t, received, "second")
+}
+
+func TestKafkaStream_RedeliversAlertsTheProcessorFailed(t *testing.T) {
+	cluster := kfake.MustCluster(kfake.NumBrokers(1), kfake.SeedTopics(1, "test.alert"))
+	t.Cleanup(cluster.Close)
+	stream := newKafkaStream(t, alerting.KafkaStreamConfig{Brokers: cluster.ListenAddrs()})
+
+	storage := alertingtest.NewStorage(nil)
+	output := alertingtest.NewStream()
+	output.Persist(storage, 0)
+	t.Cleanup(output.Close)
+	// The first attempt fails to store the alert.
+	p := alerting.NewProcessorV2(nil, storage, &flakyStream{Stream: output, failures: 1})
+	if _, err := stream.SubscribeMsg("test.alert", p.HandleMsgV2); err != nil {
+		t.Fatalf("SubscribeMsg() error = %v", err)
+	}
+	firing, _ := alerts.NewAlertV2("disk", "node-exporter", "critical", "disk_full", "disk", "disk", time.Now(), alerts.AlertStateActive).MarshalJSON()
+	if err := stream.Publish("test.alert", firing); err != nil {
+		t.Fatalf("Publish() error = %v", err)
+	}
+
+	alertingtest.WaitForEvent(t, output, event.ActionFiring, "disk", 10*time.Second)
+}
+
+func TestAlertKey(t *testing.T) {
+	tests := map[string]struct {
+		data string
+		want string
+	}{
+		"alert":            {data: `{"id":"a-1","message":"disk full"}`, want: "a-1"},
+		"event":            {data: `{"Action":"resolved","Message":{"alert_id":"a-2"}}`, want: "a-2"},
+		"event without id": {data: `{"Action":"log","Message":{"message":"hello"}}`},
+		"not json":         {data: `plain`},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := alerting.AlertKey([]byte(tt.data)); string(got) != tt.want {
+				t.Errorf("AlertKey() = %q; want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func expectKafkaMessage(t *testing.T, received <-chan []byte, want string) {
+	t.Helper()
+	select {
+	case data := <-received:
+		if string(data) != want {
+			t.Errorf("received %q; want %q", data, want)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatalf("timed out waiting for %q", want)
+	}
+}
@@ -0,0 +1,12 @@
+package alerting
+
+// matchLabels reports whether labels contains every key/value pair of want.
+// An empty want matches everything.
+func matchLabels(labels, want map[string]string) bool {
+	for key, value := range want {
+		if labels[key] != value {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,331 @@
+package alerting
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/avilikof/go-shared-libs/event"
+)
+
+var (
+	// ErrLeaseHeld is returned by LeaseStore.Acquire while another holder
+	// owns an unexpired lease.
+	ErrLeaseHeld = errors.New("lease held by another holder")
+	// ErrLeaseLost is returned by LeaseStore.Renew and Release once the lease
+	// has expired or been taken over.
+	ErrLeaseLost = errors.New("lease lost")
+	// ErrNotLeader is returned for the writes of a Processor whose
+	// LeaderElector is not the leader.
+	ErrNotLeader = errors.New("not the leader")
+)
+
+// Lease is one term of a holder owning a named lease. Token is a fencing
+// token: every term gets a higher token than the previous one, so that
+// writes tagged with a stale token can be rejected.
+type Lease struct {
+	Name   string
+	Holder string
+	Token  uint64
+
+	// revision is the backend revision the next renewal must replace.
+	revision uint64
+}
+
+// LeaseStore is a backend for leases with expiry, such as NATS KV or Redis.
+type LeaseStore interface {
+	// Acquire starts a new term for holder if the lease is free, expired or
+	// already held by holder. It returns an error matching ErrLeaseHeld if
+	// another holder owns it.
+	Acquire(name, holder string, ttl time.Duration) (Lease, error)
+	// Renew extends the lease by ttl. It returns an error matching
+	// ErrLeaseLost if the term is over.
+	Renew(lease Lease, ttl time.Duration) (Lease, error)
+	// Release ends the term so that a standby can take over at once.
+	Release(lease Lease) error
+}
+
+// LeaderElectorConfig configures a LeaderElector. Zero fields get defaults.
+type LeaderElectorConfig struct {
+	// Name of the lease; instances using the same name compete for it.
+	// Defaults to "alerting-processor".
+	Name string
+	// ID identifies this instance. Defaults to <hostname>-<pid>.
+	ID string
+	// TTL is how long a lease lasts without renewal. Defaults to 15s.
+	TTL time.Duration
+	// RetryInterval is how often the leader renews and standbys try to
+	// acquire the lease. Defaults to TTL/3.
+	RetryInterval time.Duration
+}
+
+func (c LeaderElectorConfig) withDefaults() LeaderElectorConfig {
+	if c.Name == "" {
+		c.Name = "alerting-processor"
+	}
+	if c.ID == "" {
+		hostname, _ := os.Hostname()
+		c.ID = fmt.Sprintf("%s-%d", hostname, os.Getpid())
+	}
+	if c.TTL <= 0 {
+		c.TTL = 15 * time.Second
+	}
+	if c.RetryInterval <= 0 || c.RetryInterval >= c.TTL {
+		c.RetryInterval = c.TTL / 3
+	}
+	return c
+}
+
+// LeaderElector keeps one of several instances the leader. The leader renews
+// its lease every RetryInterval; a standby takes over at most TTL plus
+// RetryInterval after the leader stopped renewing. The leader steps down as
+// soon as it can no longer be sure its lease is valid, so two leaders never
+// overlap as long as the instances' clocks agree within RetryInterval.
+//
+// Leadership changes are published as leader_elected and leader_lost events
+// on EvetTopic.
+type LeaderElector struct {
+	store  LeaseStore
+	stream Stream
+	config LeaderElectorConfig
+
+	mu        sync.Mutex
+	lease     *Lease
+	renewedAt time.Time
+	elected   chan struct{}
+	now       func() time.Time
+}
+
+// NewLeaderElector creates a LeaderElector. A nil stream disables
+// leadership events.
+func NewLeaderElector(store LeaseStore, stream Stream, config LeaderElectorConfig) *LeaderElector {
+	return &LeaderElector{
+		store:   store,
+		stream:  stream,
+		config:  config.withDefaults(),
+		elected: make(chan struct{}),
+		now:     time.Now,
+	}
+}
+
+// ID returns the ID this instance competes with.
+func (e *LeaderElector) ID() string { return e.config.ID }
+
+// IsLeader reports whether this instance currently holds the lease.
+func (e *LeaderElector) IsLeader() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.lease != nil
+}
+
+// Token returns the fencing token of the current term, or 0 if this
+// instance is not the leader.
+func (e *LeaderElector) Token() uint64 {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.lease == nil {
+		return 0
+	}
+	return e.lease.Token
+}
+
+// Elected returns a channel that is closed while this instance is the
+// leader.
+func (e *LeaderElector) Elected() <-chan struct{} {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.elected
+}
+
+// Run campaigns for and renews the lease every RetryInterval until ctx is
+// cancelled, then releases the lease if it holds it.
+func (e *LeaderElector) Run(ctx context.Context) error {
+	ticker := time.NewTicker(e.config.RetryInterval)
+	defer ticker.Stop()
+
+	for {
+		e.Campaign()
+		select {
+		case <-ctx.Done():
+			e.Resign()
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Campaign renews the lease if this instance is the leader and tries to
+// acquire it otherwise.
+func (e *LeaderElector) Campaign() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.lease != nil {
+		e.renew()
+		return
+	}
+
+	attempt := e.now()
+	lease, err := e.store.Acquire(e.config.Name, e.config.ID, e.config.TTL)
+	if errors.Is(err, ErrLeaseHeld) {
+		return
+	}
+	if err != nil {
+		fmt.Printf("Leader :: %s :: failed to acquire lease: %v\n", e.config.Name, err)
+		return
+	}
+	e.lease = &lease
+	e.renewedAt = attempt
+	close(e.elected)
+	fmt.Printf("Leader :: %s :: %s elected with token %d\n", e.config.Name, e.config.ID, lease.Token)
+	e.publish(lease, event.ActionLeaderElected)
+}
+
+func (e *LeaderElector) renew() {
+	attempt := e.now()
+	lease, err := e.store.Renew(*e.lease, e.config.TTL)
+	if err == nil {
+		e.lease = &lease
+		e.renewedAt = attempt
+		return
+	}
+
+	// A lease that may expire before the next attempt is given up, so that a
+	// standby taking over never overlaps with this instance.
+	if errors.Is(err, ErrLeaseLost) || attempt.Add(e.config.RetryInterval).After(e.renewedAt.Add(e.config.TTL)) {
+		fmt.Printf("Leader :: %s :: %s lost leadership: %v\n", e.config.Name, e.config.ID, err)
+		e.stepDown()
+		return
+	}
+	fmt.Printf("Leader :: %s :: failed to renew lease: %v\n", e.config.Name, err)
+}
+
+// Resign releases the lease if this instance holds it.
+func (e *LeaderElector) Resign() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.lease == nil {
+		return
+	}
+	if err := e.store.Release(*e.lease); err != nil && !errors.Is(err, ErrLeaseLost) {
+		fmt.Printf("Leader :: %s :: failed to release lease: %v\n", e.config.Name, err)
+	}
+	e.stepDown()
+}
+
+func (e *LeaderElector) stepDown() {
+	lease := *e.lease
+	e.lease = nil
+	e.elected = make(chan struct{})
+	e.publish(lease, event.ActionLeaderLost)
+}
+
+func (e *LeaderElector) publish(lease Lease, action event.Action) {
+	if e.stream == nil {
+		return
+	}
+	leaderEvent := leadershipEvent(lease, action)
+	if err := e.stream.Publish(EvetTopic, leaderEvent.Bytes()); err != nil {
+		fmt.Printf("Leader :: %s :: failed to publish %s event: %v\n", lease.Name, action, err)
+	}
+}
+
+// WithLeaderElector makes the Processor process alerts only while elector
+// is the leader. A standby blocks on the first alert it receives and
+// processes it once it takes over. Leadership is checked again before every
+// publish, which fails with ErrNotLeader once the lease is lost, and every
+// message carries the fencing token of the term in HeaderLeaderToken, so
+// that a storage writer using a Fence drops the writes a deposed leader had
+// in flight.
+func WithLeaderElector(elector *LeaderElector) ProcessorOption {
+	return func(p *Processor) {
+		p.elector = elector
+	}
+}
+
+// fencedStream publishes only while elector is the leader and stamps every
+// message with the fencing token of its term.
+type fencedStream struct {
+	Stream
+	elector *LeaderElector
+}
+
+func (s fencedStream) Publish(topic string, data []byte) error {
+	return s.PublishMsg(context.Background(), &Message{Subject: topic, Data: data})
+}
+
+func (s fencedStream) PublishMsg(ctx context.Context, msg *Message) error {
+	token := s.elector.Token()
+	if token == 0 {
+		return fmt.Errorf("%w: %s cannot publish on %s", ErrNotLeader, s.elector.ID(), msg.Subject)
+	}
+	header := msg.Header.Clone()
+	header[HeaderLeaderToken] = strconv.FormatUint(token, 10)
+	return PublishMsg(ctx, s.Stream, &Message{Subject: msg.Subject, Data: msg.Data, Header: header})
+}
+
+func (s fencedStream) SubscribeMsg(topic string, handler MessageHandler, opts ...SubscribeOption) (Subscription, error) {
+	return SubscribeMsg(s.Stream, topic, handler, opts...)
+}
+
+// Fence drops messages published by a deposed leader. A storage writer
+// consuming StorageTopic wraps its handler with Handler, so that a write of
+// a leader that lost its lease while the write was in flight cannot
+// overwrite the state written by its successor. Messages without
+// HeaderLeaderToken pass. The highest token is kept in memory, so a
+// restarted writer admits the first token it sees. The zero Fence is ready
+// to use.
+type Fence struct {
+	mu    sync.Mutex
+	token uint64
+}
+
+// Admit reports whether a message with header may be applied, and records
+// its token.
+func (f *Fence) Admit(header Header) bool {
+	value, ok := header[HeaderLeaderToken]
+	if !ok {
+		return true
+	}
+	token, err := strconv.ParseUint(value, 10, 64)
+	if err != nil {
+		return true
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if token < f.token {
+		return false
+	}
+	f.token = token
+	return true
+}
+
+// Handler returns a MessageHandler calling handler with the admitted
+// messages. Stale messages are logged and settled without calling handler.
+func (f *Fence) Handler(handler MessageHandler) MessageHandler {
+	return func(ctx context.Context, msg *Message) error {
+		if !f.Admit(msg.Header) {
+			fmt.Printf("Leader :: dropping %s message of deposed leader with token %s\n", msg.Subject, msg.Header[HeaderLeaderToken])
+			return nil
+		}
+		return handler(ctx, msg)
+	}
+}
+
+// awaitLeadership blocks until this instance is the leader or ctx is done,
+// and returns ctx's error in that case.
+func (p *Processor) awaitLeadership(ctx context.Context) error {
+	if p.elector == nil {
+		return nil
+	}
+	select {
+	case <-p.elector.Elected():
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,279 @@
+package alerting_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+
+	"github.com/avilikof/go-shared-libs/alerting"
+	"github.com/avilikof/go-shared-libs/alerting/alertingtest"
+	"github.com/avilikof/go-shared-libs/alerts"
+	"github.com/avilikof/go-shared-libs/event"
+	redisdriver "github.com/avilikof/go-shared-libs/redis"
+)
+
+func newRedisLeaseStore(t *testing.T, server *miniredis.Miniredis) *alerting.RedisLeaseStore {
+	t.Helper()
+	driver, err := redisdriver.NewDriver(server.Addr(), 0)
+	if err != nil {
+		t.Fatalf("NewDriver() error = %v", err)
+	}
+	t.Cleanup(func() { driver.Close() })
+	return alerting.NewRedisLeaseStore(driver, "leases:")
+}
+
+// testLeaseStore checks the lease lifecycle of store. expire lets every
+// lease taken with ttl run out.
+func testLeaseStore(t *testing.T, store alerting.LeaseStore, name string, ttl time.Duration, expire func()) {
+	t.Helper()
+
+	first, err := store.Acquire(name, "a", ttl)
+	if err != nil {
+		t.Fatalf("Acquire(a) error = %v", err)
+	}
+	if _, err := store.Acquire(name, "b", ttl); !errors.Is(err, alerting.ErrLeaseHeld) {
+		t.Fatalf("Acquire(b) error = %v; want ErrLeaseHeld", err)
+	}
+	if first, err = store.Renew(first, ttl); err != nil {
+		t.Fatalf("Renew(a) error = %v", err)
+	}
+
+	expire()
+	second, err := store.Acquire(name, "b", ttl)
+	if err != nil {
+		t.Fatalf("Acquire(b) after expiry error = %v", err)
+	}
+	if second.Token <= first.Token {
+		t.Errorf("token of the second term = %d; want more than %d", second.Token, first.Token)
+	}
+	if _, err := store.Renew(first, ttl); !errors.Is(err, alerting.ErrLeaseLost) {
+		t.Errorf("Renew(a) after takeover error = %v; want ErrLeaseLost", err)
+	}
+	if err := store.Release(first); !errors.Is(err, alerting.ErrLeaseLost) {
+		t.Errorf("Release(a) after takeover error = %v; want ErrLeaseLost", err)
+	}
+
+	if err := store.Release(second); err != nil {
+		t.Fatalf("Release(b) error = %v", err)
+	}
+	third, err := store.Acquire(name, "a", ttl)
+	if err != nil {
+		t.Fatalf("Acquire(a) after release error = %v", err)
+	}
+	if third.Token <= second.Token {
+		t.Errorf("token of the third term = %d; want more than %d", third.Token, second.Token)
+	}
+}
+
+func TestRedisLeaseStore(t *testing.T) {
+	server := miniredis.RunT(t)
+	testLeaseStore(t, newRedisLeaseStore(t, server), "processor", time.Minute, func() {
+		server.FastForward(time.Minute)
+	})
+}
+
+func TestJetStreamLeaseStore(t *testing.T) {
+	requireNATS(t)
+	store, err := alerting.NewJetStreamLeaseStore(newJetStreamHandler(t).JetStream())
+	if err != nil {
+		t.Fatalf("NewJetStreamLeaseStore() error = %v", err)
+	}
+	ttl := 200 * time.Millisecond
+	testLeaseStore(t, store, fmt.Sprintf("test-%d", time.Now().UnixNano()), ttl, func() {
+		time.Sleep(ttl)
+	})
+}
+
+func TestLeaderElector_Failover(t *testing.T) {
+	server := miniredis.RunT(t)
+	store := newRedisLeaseStore(t, server)
+	stream := alertingtest.NewStream()
+	t.Cleanup(stream.Close)
+
+	config := alerting.LeaderElectorConfig{TTL: time.Minute}
+	config.ID = "a"
+	a := alerting.NewLeaderElector(store, stream, config)
+	config.ID = "b"
+	b := alerting.NewLeaderElector(store, stream, config)
+
+	a.Campaign()
+	b.Campaign()
+	if !a.IsLeader() || b.IsLeader() {
+		t.Fatalf("leaders = a:%v b:%v; want only a", a.IsLeader(), b.IsLeader())
+	}
+	firstToken := a.Token()
+
+	// a stops renewing; b takes over once the lease expires and a steps down
+	// on its next renewal.
+	server.FastForward(time.Minute)
+	b.Campaign()
+	a.Campaign()
+	if a.IsLeader() || !b.IsLeader() {
+		t.Fatalf("leaders = a:%v b:%v; want only b", a.IsLeader(), b.IsLeader())
+	}
+	if b.Token() <= firstToken {
+		t.Errorf("token of b = %d; want more than %d", b.Token(), firstToken)
+	}
+
+	var elected, lost []string
+	for _, ev := range alertingtest.Events(stream) {
+		switch ev.Action {
+		case event.ActionLeaderElected:
+			elected = append(elected, ev.Message["holder"].(string))
+		case event.ActionLeaderLost:
+			lost = append(lost, ev.Message["holder"].(string))
+		}
+	}
+	if fmt.Sprint(elected) != "[a b]" || fmt.Sprint(lost) != "[a]" {
+		t.Errorf("elected = %v, lost = %v; want [a b] and [a]", elected, lost)
+	}
+
+	b.Resign()
+	a.Campaign()
+	if !a.IsLeader() {
+		t.Error("expected a to take over at once after b resigned")
+	}
+}
+
+func TestProcessor_WithLeaderElector(t *testing.T) {
+	server := miniredis.RunT(t)
+	storage := alertingtest.NewStorage(nil)
+	stream := alertingtest.NewStream()
+	stream.Persist(storage, 0)
+	t.Cleanup(stream.Close)
+
+	elector := alerting.NewLeaderElector(newRedisLeaseStore(t, server), nil, alerting.LeaderElectorConfig{ID: "standby"})
+	input := make(chan *alerts.AlertV2)
+	defer close(input)
+	go alerting.NewProcessorV2(input, storage, stream, alerting.WithLeaderElector(elector)).ProcessV2()
+
+	input <- alerts.NewAlertV2("disk", "node-exporter", "critical", "disk_full", "disk", "disk", time.Now(), alerts.AlertStateActive)
+	time.Sleep(50 * time.Millisecond)
+	alertingtest.ExpectNoEvent(t, stream, event.ActionFiring, "disk")
+
+	elector.Campaign()
+	alertingtest.WaitForEvent(t, stream, event.ActionFiring, "disk", time.Second)
+}
+
+// unusedFetcher fails the test when ConsumeV2 fetches.
+type unusedFetcher struct {
+	t *testing.T
+}
+
+func (f unusedFetcher) Fetch(context.Context, int, time.Duration) ([]*alerting.Delivery, error) {
+	f.t.Error("ConsumeV2 fetched without being the leader")
+	return nil, errors.New("not the leader")
+}
+
+func TestProcessor_ConsumeV2StopsWhileAwaitingLeadership(t *testing.T) {
+	server := miniredis.RunT(t)
+	elector := alerting.NewLeaderElector(newRedisLeaseStore(t, server), nil, alerting.LeaderElectorConfig{ID: "standby"})
+	p := alerting.NewProcessorV2(nil, alertingtest.NewStorage(nil), alertingtest.NewStream(), alerting.WithLeaderElector(elector))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- p.ConsumeV2(ctx, unusedFetcher{t}, 1) }()
+	time.Sleep(20 * time.Millisecond)
+	cancel()
+
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("ConsumeV2() error = %v; want context.Canceled", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("ConsumeV2 did not return after its context was cancelled")
+	}
+}
+
+func TestProcessor_FencesWrites(t *testing.T) {
+	server := miniredis.RunT(t)
+	storage := alertingtest.NewStorage(nil)
+	stream := alertingtest.NewStream()
+	stream.Persist(storage, 0)
+	t.Cleanup(stream.Close)
+
+	elector := alerting.NewLeaderElector(newRedisLeaseStore(t, server), nil, alerting.LeaderElectorConfig{ID: "leader"})
+	elector.Campaign()
+	token := elector.Token()
+	input := make(chan *alerts.AlertV2, 1)
+	input <- alerts.NewAlertV2("disk", "node-exporter", "critical", "disk_full", "disk", "disk", time.Now(), alerts.AlertStateActive)
+	close(input)
+	alerting.NewProcessorV2(input, storage, stream, alerting.WithLeaderElector(elector)).ProcessV2()
+
+	stored := stream.Messages(alerting.StorageTopic)
+	if len(stored) != 1 || stored[0].Header[alerting.HeaderLeaderToken] != fmt.Sprint(token) {
+		t.Fatalf("stored messages = %+v; want one with token %d", stored, token)
+	}
+
+	// A write a deposed leader had in flight arrives after its successor's.
+	resolved, _ := alerts.NewAlertV2("disk", "node-exporter", "critical", "disk_full", "disk", "disk", time.Now(), alerts.AlertStateResolved).MarshalJSON()
+	stale := &alerting.Message{
+		Subject: alerting.StorageTopic,
+		Data:    resolved,
+		Header:  alerting.Header{alerting.HeaderLeaderToken: fmt.Sprint(token - 1)},
+	}
+	if err := stream.PublishMsg(context.Background(), stale); err != nil {
+		t.Fatalf("PublishMsg() error = %v", err)
+	}
+	data, err := storage.Get("disk")
+	if alert, _ := alerts.AlertV2FromBytes(data); err != nil || !alert.IsFiring() {
+		t.Errorf("stored alert = %s, %v; want the write of the stale leader dropped", data, err)
+	}
+}
+
+// flakyStream fails the first failures publishes.
+type flakyStream struct {
+	alerting.Stream
+	failures int
+}
+
+func (s *flakyStream) Publish(topic string, data []byte) error {
+	if s.failures > 0 {
+		s.failures--
+		return alerting.ErrNotLeader
+	}
+	return s.Stream.Publish(topic, data)
+}
+
+func TestProcessor_KeepsProcessingAfterFailedFire(t *testing.T) {
+	storage := alertingtest.NewStorage(nil)
+	stream := alertingtest.NewStream()
+	stream.Persist(storage, 0)
+	t.Cleanup(stream.Close)
+	_ = storage.Set("disk", alerts.NewAlert("disk", "disk", "disk full", time.Now(), false).Bytes(), 0)
+
+	input := make(chan *alerts.Alert, 2)
+	input <- alerts.NewAlert("disk", "disk", "disk full", time.Now(), true)
+	input <- alerts.NewAlert("cpu", "cpu", "cpu high", time.Now(), true)
+	close(input)
+	alerting.NewProcessor(input, storage, &flakyStream{Stream: stream, failures: 1}).Process()
+
+	if _, err := storage.Get("cpu"); err != nil {
+		t.Errorf("Get(cpu) error = %v; want the alert after the failed fire processed", err)
+	}
+}
+
+func TestFence(t *testing.T) {
+	var fence alerting.Fence
+	token := func(value string) alerting.Header { return alerting.Header{alerting.HeaderLeaderToken: value} }
+	for _, step := range []struct {
+		header alerting.Header
+		want   bool
+	}{
+		{token("5"), true},
+		{token("5"), true},
+		{token("4"), false},
+		{nil, true},
+		{token("6"), true},
+		{token("5"), false},
+	} {
+		if got := fence.Admit(step.header); got != step.want {
+			t.Errorf("Admit(%v) = %v; want %v", step.header, got, step.want)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package alerting
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/avilikof/go-shared-libs/alerts"
+)
+
+var ErrInvalidLookupTable = errors.New("invalid lookup table")
+
+// LookupTable annotates alerts from a table keyed by one of their fields,
+// e.g. the owner, team and runbook URL of each alert type. Annotations the
+// alert already carries are kept.
+type LookupTable struct {
+	// Key is the label or pseudo-label, such as FieldType, looked up in Rows.
+	Key string
+	// Rows maps key values to the annotations added to matching alerts.
+	Rows map[string]map[string]string
+}
+
+// LoadLookupTable reads a lookup table keyed by key from a CSV or YAML file,
+// chosen by the file extension.
+//
+// A CSV file has a header row; the first column holds the key values and the
+// other columns name the annotations:
+//
+//	type,owner,team,runbook_url
+//	disk_full,storage,infra,https://runbooks.example.com/disk-full
+//
+// A YAML file maps key values to annotations:
+//
+//	disk_full:
+//	  owner: storage
+//	  runbook_url: https://runbooks.example.com/disk-full
+func LoadLookupTable(path, key string) (*LookupTable, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open lookup table %s: %w", path, err)
+	}
+	defer file.Close()
+
+	table := &LookupTable{Key: key, Rows: make(map[string]map[string]string)}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".csv":
+		err = table.readCSV(file)
+	case ".yaml", ".yml":
+		err = yaml.NewDecoder(file).Decode(&table.Rows)
+	default:
+		err = fmt.Errorf("unsupported file extension %q", filepath.Ext(path))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s: %v", ErrInvalidLookupTable, path, err)
+	}
+	return table, nil
+}
+
+func (t *LookupTable) readCSV(file *os.File) error {
+	reader := csv.NewReader(file)
+	reader.TrimLeadingSpace = true
+	records, err := reader.ReadAll()
+	if err != nil {
+		return err
+	}
+	if len(records) == 0 {
+		return errors.New("missing header row")
+	}
+
+	header := records[0]
+	for _, record := range records[1:] {
+		annotations := make(map[string]string, len(header)-1)
+		for i := 1; i < len(header); i++ {
+			if record[i] != "" {
+				annotations[header[i]] = record[i]
+			}
+		}
+		t.Rows[record[0]] = annotations
+	}
+	return nil
+}
+
+func (t *LookupTable) Process(alert *alerts.AlertV2) (*alerts.AlertV2, error) {
+	row, ok := t.Rows[alertField(alert, t.Key)]
+	if !ok {
+		return alert, nil
+	}
+	for name, value := range row {
+		if _, ok := alert.Annotations()[name]; !ok {
+			alert.AddAnnotation(name, value)
+		}
+	}
+	return alert, nil
+}
@@ -0,0 +1,134 @@
+package alerting
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/avilikof/go-shared-libs/alerts"
+	"github.com/avilikof/go-shared-libs/event"
+)
+
+// MaintenanceWindow is a recurring silence: alerts carrying all of Matchers
+// are muted whenever the current time falls within one of Intervals.
+type MaintenanceWindow struct {
+	Name      string            `json:"name" yaml:"name"`
+	Matchers  map[string]string `json:"matchers,omitempty" yaml:"matchers"`
+	Intervals []TimeInterval    `json:"intervals" yaml:"intervals"`
+}
+
+type maintenanceWindow struct {
+	MaintenanceWindow
+	intervals []*compiledInterval
+	open      bool
+}
+
+func (w *maintenanceWindow) activeAt(t time.Time) bool {
+	for _, interval := range w.intervals {
+		if interval.contains(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// MaintenanceSchedule mutes alerts during maintenance windows and publishes
+// an event whenever a window opens or closes.
+type MaintenanceSchedule struct {
+	mu      sync.Mutex
+	stream  Stream
+	windows []*maintenanceWindow
+	now     func() time.Time
+}
+
+// NewMaintenanceSchedule validates the windows and creates a schedule for them.
+func NewMaintenanceSchedule(stream Stream, windows ...MaintenanceWindow) (*MaintenanceSchedule, error) {
+	schedule := &MaintenanceSchedule{
+		stream: stream,
+		now:    time.Now,
+	}
+	for _, window := range windows {
+		if window.Name == "" {
+			return nil, fmt.Errorf("%w: maintenance window without a name", ErrInvalidTimeInterval)
+		}
+		compiled := &maintenanceWindow{MaintenanceWindow: window}
+		for _, interval := range window.Intervals {
+			ci, err := interval.compile()
+			if err != nil {
+				return nil, fmt.Errorf("maintenance window %s: %w", window.Name, err)
+			}
+			compiled.intervals = append(compiled.intervals, ci)
+		}
+		schedule.windows = append(schedule.windows, compiled)
+	}
+	return schedule, nil
+}
+
+// Muted returns the name of the first active window matching the alert.
+func (s *MaintenanceSchedule) Muted(alert *alerts.AlertV2) (string, bool) {
+	return s.mutedLabels(alert.Labels())
+}
+
+// MutedV1 returns the name of the first active window matching a v1 alert.
+// v1 alerts carry no labels, so only windows without matchers mute them.
+func (s *MaintenanceSchedule) MutedV1(alert *alerts.Alert) (string, bool) {
+	return s.mutedLabels(nil)
+}
+
+func (s *MaintenanceSchedule) mutedLabels(labels map[string]string) (string, bool) {
+	now := s.now()
+	for _, window := range s.windows {
+		if matchLabels(labels, window.Matchers) && window.activeAt(now) {
+			return window.Name, true
+		}
+	}
+	return "", false
+}
+
+// Check publishes a window_opened or window_closed event for every window
+// whose state changed since the previous check.
+func (s *MaintenanceSchedule) Check() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	var errs []error
+	for _, window := range s.windows {
+		open := window.activeAt(now)
+		if open == window.open {
+			continue
+		}
+
+		action := event.ActionWindowClosed
+		if open {
+			action = event.ActionWindowOpened
+		}
+		windowEvent := windowEvent(window.Name, action)
+		if err := s.stream.Publish(EvetTopic, windowEvent.Bytes()); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		fmt.Printf("Maintenance window :: %s :: %s\n", window.Name, action)
+		window.open = open
+	}
+	return errors.Join(errs...)
+}
+
+// Run calls Check every interval until ctx is cancelled.
+func (s *MaintenanceSchedule) Run(ctx context.Context, interval time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+			if err := s.Check(); err != nil {
+				fmt.Printf("Maintenance window check failed: %v\n", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,168 @@
+package alerting
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/avilikof/go-shared-libs/alerts"
+	"github.com/avilikof/go-shared-libs/event"
+)
+
+func TestTimeInterval_Contains(t *testing.T) {
+	sundayNight := TimeInterval{
+		Times:    []TimeRange{{Start: "02:00", End: "04:00"}},
+		Weekdays: []string{"sunday"},
+	}
+	lastDays := TimeInterval{DaysOfMonth: []string{"-2:-1"}}
+	monthEnd := TimeInterval{DaysOfMonth: []string{"25:-1"}}
+	berlin := TimeInterval{
+		Times:    []TimeRange{{Start: "09:00", End: "17:00"}},
+		Weekdays: []string{"monday:friday"},
+		Location: "Europe/Berlin",
+	}
+
+	tests := []struct {
+		name     string
+		interval TimeInterval
+		at       time.Time
+		expected bool
+	}{
+		{"sunday inside", sundayNight, time.Date(2024, 6, 2, 3, 30, 0, 0, time.UTC), true},
+		{"sunday end is exclusive", sundayNight, time.Date(2024, 6, 2, 4, 0, 0, 0, time.UTC), false},
+		{"monday same time", sundayNight, time.Date(2024, 6, 3, 3, 30, 0, 0, time.UTC), false},
+		{"last day of february", lastDays, time.Date(2024, 2, 29, 12, 0, 0, 0, time.UTC), true},
+		{"second to last day", lastDays, time.Date(2024, 2, 28, 12, 0, 0, 0, time.UTC), true},
+		{"mid month", lastDays, time.Date(2024, 2, 15, 12, 0, 0, 0, time.UTC), false},
+		{"month end", monthEnd, time.Date(2024, 2, 26, 12, 0, 0, 0, time.UTC), true},
+		{"before month end", monthEnd, time.Date(2024, 2, 24, 12, 0, 0, 0, time.UTC), false},
+		{"berlin office hours", berlin, time.Date(2024, 6, 3, 7, 30, 0, 0, time.UTC), true},
+		{"before berlin office hours", berlin, time.Date(2024, 6, 3, 6, 30, 0, 0, time.UTC), false},
+	}
+
+	for _, tt := range tests {
+		got, err := tt.interval.Contains(tt.at)
+		if err != nil {
+			t.Fatalf("%s: Contains() error = %v", tt.name, err)
+		}
+		if got != tt.expected {
+			t.Errorf("%s: Contains(%v) = %v; want %v", tt.name, tt.at, got, tt.expected)
+		}
+	}
+}
+
+func TestTimeInterval_Invalid(t *testing.T) {
+	invalid := []TimeInterval{
+		{Times: []TimeRange{{Start: "04:00", End: "02:00"}}},
+		{Times: []TimeRange{{Start: "25:00", End: "26:00"}}},
+		{Weekdays: []string{"someday"}},
+		{Weekdays: []string{"friday:monday"}},
+		{DaysOfMonth: []string{"0"}},
+		{DaysOfMonth: []string{"10:5"}},
+		{DaysOfMonth: []string{"-1:25"}},
+		{Location: "Nowhere/Special"},
+	}
+	for _, interval := range invalid {
+		if _, err := interval.Contains(time.Now()); !errors.Is(err, ErrInvalidTimeInterval) {
+			t.Errorf("Contains() for %+v error = %v; want ErrInvalidTimeInterval", interval, err)
+		}
+	}
+}
+
+func TestMaintenanceSchedule_MutesAndAnnounces(t *testing.T) {
+	stream := newMemStream()
+	schedule, err := NewMaintenanceSchedule(stream, MaintenanceWindow{
+		Name:     "eu-prod-sunday",
+		Matchers: map[string]string{"env": "prod", "region": "eu-central"},
+		Intervals: []TimeInterval{{
+			Times:    []TimeRange{{Start: "02:00", End: "04:00"}},
+			Weekdays: []string{"sunday"},
+		}},
+	})
+	if err != nil {
+		t.Fatalf("NewMaintenanceSchedule() error = %v", err)
+	}
+	now := time.Date(2024, 6, 2, 2, 30, 0, 0, time.UTC)
+	schedule.now = func() time.Time { return now }
+
+	alert := alerts.NewAlertV2("a1", "test", "critical", "cpu_high", "cpu", "a1", now, alerts.AlertStateActive)
+	alert.AddLabel("env", "prod")
+	alert.AddLabel("region", "eu-central")
+	other := alerts.NewAlertV2("a2", "test", "critical", "cpu_high", "cpu", "a2", now, alerts.AlertStateActive)
+	other.AddLabel("env", "prod")
+
+	if window, muted := schedule.Muted(alert); !muted || window != "eu-prod-sunday" {
+		t.Errorf("expected alert to be muted by eu-prod-sunday, got %q, %v", window, muted)
+	}
+	if _, muted := schedule.Muted(other); muted {
+		t.Error("expected alert from another region not to be muted")
+	}
+
+	for _, check := range []time.Time{now, now.Add(time.Minute), now.Add(2 * time.Hour)} {
+		now = check
+		if err := schedule.Check(); err != nil {
+			t.Fatalf("Check() error = %v", err)
+		}
+	}
+	if got := len(stream.events(event.ActionWindowOpened)); got != 1 {
+		t.Errorf("expected 1 window_opened event, got %d", got)
+	}
+	if got := len(stream.events(event.ActionWindowClosed)); got != 1 {
+		t.Errorf("expected 1 window_closed event, got %d", got)
+	}
+	if _, muted := schedule.Muted(alert); muted {
+		t.Error("expected alert not to be muted after the window closed")
+	}
+}
+
+func TestMaintenanceSchedule_MutesV1AndPausesEscalations(t *testing.T) {
+	storage := newMemStorage()
+	stream := newMemStream()
+	schedule, err := NewMaintenanceSchedule(stream, MaintenanceWindow{
+		Name:      "sunday",
+		Intervals: []TimeInterval{{Weekdays: []string{"sunday"}}},
+	})
+	if err != nil {
+		t.Fatalf("NewMaintenanceSchedule() error = %v", err)
+	}
+	now := time.Date(2024, 6, 1, 23, 0, 0, 0, time.UTC) // Saturday
+	schedule.now = func() time.Time { return now }
+	escalator := NewEscalator(storage, stream, time.Second, EscalationPolicy{
+		Name:  "oncall",
+		Steps: []EscalationStep{{Delay: 30 * time.Minute, Receivers: []string{"primary"}}},
+	})
+	escalator.now = func() time.Time { return now }
+
+	// The escalation started before the window opened.
+	input := make(chan *alerts.Alert)
+	done := make(chan struct{})
+	go func() {
+		NewProcessor(input, storage, stream, WithMaintenance(schedule), WithEscalator(escalator)).Process()
+		close(done)
+	}()
+	if err := escalator.Start(newEscalationTestAlert()); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+
+	now = now.Add(2 * time.Hour) // Sunday
+	input <- alerts.NewAlert("v1", "disk", "disk full", now, true)
+	close(input)
+	<-done
+	if got := len(stream.published[StorageTopic]); got != 0 {
+		t.Errorf("expected the muted v1 alert not to be stored, got %d stores", got)
+	}
+	if err := escalator.Tick(); err != nil {
+		t.Fatalf("Tick() error = %v", err)
+	}
+	if got := len(stream.events(event.ActionEscalated)); got != 0 {
+		t.Fatalf("expected no escalations during the window, got %d", got)
+	}
+
+	now = now.Add(24 * time.Hour) // Monday
+	if err := escalator.Tick(); err != nil {
+		t.Fatalf("Tick() error = %v", err)
+	}
+	if got := len(stream.events(event.ActionEscalated)); got != 1 {
+		t.Errorf("expected the paused escalation to resume after the window, got %d", got)
+	}
+}
@@ -0,0 +1,124 @@
+package alerting
+
+import (
+	"context"
+	"fmt"
+	"maps"
+)
+
+// Well-known message headers.
+const (
+	HeaderContentType   = "Content-Type"
+	HeaderSchemaVersion = "Schema-Version"
+	// HeaderTraceParent carries the W3C trace context of the publisher.
+	HeaderTraceParent = "traceparent"
+	// HeaderTenant is set by TenantStream to the publishing tenant's ID.
+	HeaderTenant = "Tenant"
+	// HeaderMessageID identifies a message. JetStreamHandler uses it instead
+	// of the content-derived MessageID to drop duplicates.
+	HeaderMessageID = "Message-Id"
+	// HeaderLeaderToken carries the fencing token of the leader whose
+	// Processor published a message, see Fence.
+	HeaderLeaderToken = "Leader-Token"
+)
+
+// Header holds message metadata. Keys are case-sensitive.
+type Header map[string]string
+
+// Message is a message with headers, see MessageStream.
+type Message struct {
+	Subject string
+	Data    []byte
+	Header  Header
+}
+
+// MessageHandler handles a message received by SubscribeMsg. ctx is
+// cancelled when the subscription ends. A returned error hands the message
+// back for redelivery where the transport supports it, see SubscribeMsg.
+type MessageHandler func(ctx context.Context, msg *Message) error
+
+// MessageStream is a Stream carrying headers along with the data. Every
+// Stream of this package implements it; PublishMsg and SubscribeMsg fall back
+// to Publish and Subscribe for Streams that do not.
+//
+// Headers are mapped to NATS headers, Kafka record headers and fields of
+// Redis stream entries. A failed MessageHandler is nacked on JetStream and
+// left pending on Redis, where it is reclaimed after ClaimIdle, and polled
+// again on Kafka; core NATS logs the error and moves on.
+type MessageStream interface {
+	Stream
+	PublishMsg(ctx context.Context, msg *Message) error
+	SubscribeMsg(topic string, handler MessageHandler, opts ...SubscribeOption) (Subscription, error)
+}
+
+var (
+	_ MessageStream = (*StreamHandler)(nil)
+	_ MessageStream = (*JetStreamHandler)(nil)
+	_ MessageStream = (*KafkaStream)(nil)
+	_ MessageStream = (*RedisStream)(nil)
+	_ MessageStream = (*TenantStream)(nil)
+)
+
+// PublishMsg publishes msg on stream. Without MessageStream support the
+// headers are dropped.
+func PublishMsg(ctx context.Context, stream Stream, msg *Message) error {
+	if ms, ok := stream.(MessageStream); ok {
+		return ms.PublishMsg(ctx, msg)
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return stream.Publish(msg.Subject, msg.Data)
+}
+
+// SubscribeMsg calls handler for every message on topic. Without
+// MessageStream support messages arrive without headers, and handler errors
+// are only logged.
+func SubscribeMsg(stream Stream, topic string, handler MessageHandler, opts ...SubscribeOption) (Subscription, error) {
+	if ms, ok := stream.(MessageStream); ok {
+		return ms.SubscribeMsg(topic, handler, opts...)
+	}
+
+	messages := make(chan []byte)
+	sub, err := stream.Subscribe(topic, messages, opts...)
+	if err != nil {
+		return nil, err
+	}
+	go func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		for {
+			select {
+			case data := <-messages:
+				if err := handler(ctx, &Message{Subject: topic, Data: data}); err != nil {
+					fmt.Printf("Subscription :: %s :: %v\n", topic, err)
+				}
+			case <-sub.Done():
+				return
+			}
+		}
+	}()
+	return sub, nil
+}
+
+// Clone returns a copy of h, so that it can be changed without affecting the
+// message it came from.
+func (h Header) Clone() Header {
+	if h == nil {
+		return Header{}
+	}
+	return maps.Clone(h)
+}
+
+// channelHandler is the MessageHandler behind Subscribe, handing the data to
+// channel.
+func channelHandler(channel chan []byte) MessageHandler {
+	return func(ctx context.Context, msg *Message) error {
+		select {
+		case channel <- msg.Data:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package alerting_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/avilikof/go-shared-libs/alerting"
+	"github.com/avilikof/go-shared-libs/alerting/alertingtest"
+)
+
+// plainStream hides the MessageStream methods of the stream it wraps.
+type plainStream struct {
+	alerting.Stream
+}
+
+func receiveMsg(t *testing.T, received <-chan *alerting.Message) *alerting.Message {
+	t.Helper()
+	select {
+	case msg := <-received:
+		return msg
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for a message")
+		return nil
+	}
+}
+
+func TestTenantStream_Headers(t *testing.T) {
+	stream := alertingtest.NewStream()
+	tenant, _ := alerting.NewTenant("billing", alerting.TenantQuota{})
+	tenantStream := tenant.Stream(stream)
+
+	received := make(chan *alerting.Message, 1)
+	_, err := tenantStream.SubscribeMsg("metrics", func(_ context.Context, msg *alerting.Message) error {
+		received <- msg
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("SubscribeMsg() error = %v", err)
+	}
+	header := alerting.Header{alerting.HeaderSchemaVersion: "2"}
+	err = tenantStream.PublishMsg(context.Background(), &alerting.Message{Subject: "metrics", Data: []byte("{}"), Header: header})
+	if err != nil {
+		t.Fatalf("PublishMsg() error = %v", err)
+	}
+
+	msg := receiveMsg(t, received)
+	if msg.Subject != "metrics" || msg.Header[alerting.HeaderTenant] != "billing" || msg.Header[alerting.HeaderSchemaVersion] != "2" {
+		t.Errorf("received %+v; want subject metrics with the schema version and tenant headers", msg)
+	}
+	if published := stream.Messages("tenant.billing.metrics"); len(published) != 1 {
+		t.Errorf("published %d messages on the tenant's subject; want 1", len(published))
+	}
+	if _, ok := header[alerting.HeaderTenant]; ok {
+		t.Error("PublishMsg() changed the caller's header")
+	}
+}
+
+func TestPublishMsg_FallsBackToPublish(t *testing.T) {
+	stream := alertingtest.NewStream()
+	plain := plainStream{stream}
+
+	received := make(chan *alerting.Message, 1)
+	sub, err := alerting.SubscribeMsg(plain, "metrics", func(_ context.Context, msg *alerting.Message) error {
+		received <- msg
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("SubscribeMsg() error = %v", err)
+	}
+	defer sub.Unsubscribe()
+
+	msg := &alerting.Message{Subject: "metrics", Data: []byte("{}"), Header: alerting.Header{"X-Dropped": "yes"}}
+	if err := alerting.PublishMsg(context.Background(), plain, msg); err != nil {
+		t.Fatalf("PublishMsg() error = %v", err)
+	}
+	if got := receiveMsg(t, received); got.Subject != "metrics" || string(got.Data) != "{}" || got.Header != nil {
+		t.Errorf("received %+v; want the data without headers", got)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := alerting.PublishMsg(ctx, plain, msg); err != context.Canceled {
+		t.Errorf("PublishMsg() with a cancelled context error = %v; want context.Canceled", err)
+	}
+}
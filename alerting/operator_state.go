@@ -0,0 +1,50 @@
+package alerting
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Operator state is kept next to the alerts, under these prefixes followed by
+// the alert ID, so that a source resending an alert does not wipe its
+// acknowledgement or silence. The alerting API writes it; the Processor and
+// the Escalator honour it when they share its storage.
+const (
+	AckKeyPrefix     = "ack."
+	SilenceKeyPrefix = "silence."
+)
+
+// acknowledged reports whether an acknowledgement is stored for the alert.
+// Withdrawn acknowledgements are deleted or overwritten with null.
+func acknowledged(storage Storage, alertID string) (bool, error) {
+	data, err := storage.Get(AckKeyPrefix + alertID)
+	if errors.Is(err, ErrNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to load acknowledgement of %s: %w", alertID, err)
+	}
+	return string(data) != "null", nil
+}
+
+// silenced reports whether a silence running past now is stored for the
+// alert. Silences are stored with their duration as expiration, but storages
+// without per-key expiration keep them after they ran out.
+func silenced(storage Storage, alertID string, now time.Time) (bool, error) {
+	data, err := storage.Get(SilenceKeyPrefix + alertID)
+	if errors.Is(err, ErrNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to load silence of %s: %w", alertID, err)
+	}
+	var silence *struct {
+		Until time.Time `json:"until"`
+	}
+	if err := json.Unmarshal(data, &silence); err != nil {
+		return false, fmt.Errorf("failed to decode silence of %s: %w", alertID, err)
+	}
+	return silence != nil && now.Before(silence.Until), nil
+}
@@ -0,0 +1,127 @@
+package alerting
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/avilikof/go-shared-libs/alerts"
+)
+
+// Pseudo-labels name the alert fields that stages can read next to its
+// labels, e.g. as relabel source labels or lookup keys.
+const (
+	FieldID       = "__id__"
+	FieldSource   = "__source__"
+	FieldSeverity = "__severity__"
+	FieldType     = "__type__"
+)
+
+// Stage enriches, transforms or drops an alert. Returning a nil alert drops
+// it; returning an error leaves the alert as the stage received it.
+type Stage interface {
+	Process(alert *alerts.AlertV2) (*alerts.AlertV2, error)
+}
+
+// StageFunc adapts a function to a Stage.
+type StageFunc func(alert *alerts.AlertV2) (*alerts.AlertV2, error)
+
+func (f StageFunc) Process(alert *alerts.AlertV2) (*alerts.AlertV2, error) {
+	return f(alert)
+}
+
+// Pipeline runs alerts through its stages in order before the Processor
+// handles them.
+type Pipeline struct {
+	stages []Stage
+}
+
+func NewPipeline(stages ...Stage) *Pipeline {
+	return &Pipeline{stages: stages}
+}
+
+// Process runs alert through every stage and returns the result, or nil if a
+// stage dropped it. A failing stage is skipped so that one broken stage does
+// not lose alerts; its error is returned along with the alert.
+func (p *Pipeline) Process(alert *alerts.AlertV2) (*alerts.AlertV2, error) {
+	var errs []error
+	for i, stage := range p.stages {
+		next, err := stage.Process(alert)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("pipeline stage %d: %w", i, err))
+			continue
+		}
+		if next == nil {
+			return nil, errors.Join(errs...)
+		}
+		alert = next
+	}
+	return alert, errors.Join(errs...)
+}
+
+// WithPipeline runs every AlertV2 through the pipeline before processing it.
+// Alerts dropped by the pipeline are ignored. v1 alerts carry none of the
+// fields stages work on, so it is only a ProcessorV2Option.
+func WithPipeline(pipeline *Pipeline) ProcessorV2Option {
+	return processorV2Option(func(p *Processor) {
+		p.pipeline = pipeline
+	})
+}
+
+// StaticLabels adds labels to every alert. Labels the alert already carries
+// are kept.
+func StaticLabels(labels map[string]string) Stage {
+	return StageFunc(func(alert *alerts.AlertV2) (*alerts.AlertV2, error) {
+		for key, value := range labels {
+			if _, ok := alert.Labels()[key]; !ok {
+				alert.AddLabel(key, value)
+			}
+		}
+		return alert, nil
+	})
+}
+
+// DropRule matches alerts by source, severity, type and labels. Empty fields
+// match any alert.
+type DropRule struct {
+	Source   string            `json:"source,omitempty" yaml:"source"`
+	Severity string            `json:"severity,omitempty" yaml:"severity"`
+	Type     string            `json:"type,omitempty" yaml:"type"`
+	Labels   map[string]string `json:"labels,omitempty" yaml:"labels"`
+}
+
+func (r DropRule) matches(alert *alerts.AlertV2) bool {
+	switch {
+	case r.Source != "" && r.Source != alert.Source(),
+		r.Severity != "" && r.Severity != alert.Severity(),
+		r.Type != "" && r.Type != alert.Type():
+		return false
+	}
+	return matchLabels(alert.Labels(), r.Labels)
+}
+
+// DropRules drops alerts matching any of rules.
+func DropRules(rules ...DropRule) Stage {
+	return StageFunc(func(alert *alerts.AlertV2) (*alerts.AlertV2, error) {
+		for _, rule := range rules {
+			if rule.matches(alert) {
+				return nil, nil
+			}
+		}
+		return alert, nil
+	})
+}
+
+// alertField returns the value of a pseudo-label or label of alert.
+func alertField(alert *alerts.AlertV2, name string) string {
+	switch name {
+	case FieldID:
+		return alert.ID()
+	case FieldSource:
+		return alert.Source()
+	case FieldSeverity:
+		return alert.Severity()
+	case FieldType:
+		return alert.Type()
+	}
+	return alert.Labels()[name]
+}
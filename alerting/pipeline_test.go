@@ -0,0 +1,202 @@
+package alerting
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/avilikof/go-shared-libs/alerts"
+)
+
+func newPipelineTestAlert(labels map[string]string) *alerts.AlertV2 {
+	alert := alerts.NewAlertV2("a1", "node-exporter", "warning", "disk_full", "disk", "a1", time.Now(), alerts.AlertStateActive)
+	for key, value := range labels {
+		alert.AddLabel(key, value)
+	}
+	return alert
+}
+
+func TestPipeline_StagesAndDrops(t *testing.T) {
+	failing := StageFunc(func(*alerts.AlertV2) (*alerts.AlertV2, error) {
+		return nil, errors.New("lookup service down")
+	})
+	pipeline := NewPipeline(
+		StaticLabels(map[string]string{"region": "eu-central", "env": "default"}),
+		failing,
+		DropRules(DropRule{Severity: "info"}, DropRule{Labels: map[string]string{"env": "dev"}}),
+	)
+
+	alert, err := pipeline.Process(newPipelineTestAlert(map[string]string{"env": "prod"}))
+	if err == nil {
+		t.Error("expected the failing stage to be reported")
+	}
+	if alert == nil {
+		t.Fatal("expected the alert to survive a failing stage")
+	}
+	if alert.Labels()["region"] != "eu-central" || alert.Labels()["env"] != "prod" {
+		t.Errorf("static labels = %v; want region added and env kept", alert.Labels())
+	}
+
+	dropped, _ := pipeline.Process(newPipelineTestAlert(map[string]string{"env": "dev"}))
+	if dropped != nil {
+		t.Error("expected the dev alert to be dropped")
+	}
+}
+
+func TestLoadLookupTable(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"owners.csv": "type,owner,runbook_url\n" +
+			"disk_full,storage,https://runbooks.example.com/disk\n" +
+			"cpu_high,compute,\n",
+		"owners.yaml": "disk_full:\n  owner: storage\n  runbook_url: https://runbooks.example.com/disk\n",
+	}
+
+	for name, content := range files {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(dir, name)
+			if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			table, err := LoadLookupTable(path, FieldType)
+			if err != nil {
+				t.Fatalf("LoadLookupTable() error = %v", err)
+			}
+
+			alert := newPipelineTestAlert(nil)
+			alert.AddAnnotation("owner", "set-by-producer")
+			if _, err := table.Process(alert); err != nil {
+				t.Fatalf("Process() error = %v", err)
+			}
+			annotations := alert.Annotations()
+			if annotations["runbook_url"] != "https://runbooks.example.com/disk" || annotations["owner"] != "set-by-producer" {
+				t.Errorf("annotations = %v; want runbook added and owner kept", annotations)
+			}
+		})
+	}
+
+	bad := filepath.Join(dir, "owners.txt")
+	_ = os.WriteFile(bad, []byte("x"), 0o600)
+	if _, err := LoadLookupTable(bad, FieldType); !errors.Is(err, ErrInvalidLookupTable) {
+		t.Errorf("LoadLookupTable(.txt) error = %v; want ErrInvalidLookupTable", err)
+	}
+}
+
+func TestRelabeler(t *testing.T) {
+	tests := []struct {
+		name    string
+		configs []RelabelConfig
+		labels  map[string]string
+		want    map[string]string
+		dropped bool
+	}{
+		{
+			name: "replace from pseudo-labels",
+			configs: []RelabelConfig{{
+				SourceLabels: []string{FieldSource, FieldType},
+				Regex:        "node-(.*);(.*)",
+				TargetLabel:  "check",
+				Replacement:  "$1/$2",
+			}},
+			want: map[string]string{"check": "exporter/disk_full"},
+		},
+		{
+			name:    "replace with empty result removes label",
+			configs: []RelabelConfig{{SourceLabels: []string{"missing"}, TargetLabel: "env"}},
+			labels:  map[string]string{"env": "prod"},
+			want:    map[string]string{},
+		},
+		{
+			name:    "keep",
+			configs: []RelabelConfig{{SourceLabels: []string{"env"}, Regex: "prod|staging", Action: RelabelKeep}},
+			labels:  map[string]string{"env": "dev"},
+			dropped: true,
+		},
+		{
+			name:    "drop",
+			configs: []RelabelConfig{{SourceLabels: []string{FieldSeverity}, Regex: "warn.*", Action: RelabelDrop}},
+			dropped: true,
+		},
+		{
+			name:    "labelmap and labeldrop",
+			configs: []RelabelConfig{{Regex: "k8s_(.+)", Action: RelabelLabelMap}, {Regex: "k8s_.+", Action: RelabelLabelDrop}},
+			labels:  map[string]string{"k8s_namespace": "payments", "env": "prod"},
+			want:    map[string]string{"namespace": "payments", "env": "prod"},
+		},
+		{
+			name:    "labelkeep",
+			configs: []RelabelConfig{{Regex: "env|team", Action: RelabelLabelKeep}},
+			labels:  map[string]string{"env": "prod", "pod": "api-7d9"},
+			want:    map[string]string{"env": "prod"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			relabeler, err := NewRelabeler(tt.configs...)
+			if err != nil {
+				t.Fatalf("NewRelabeler() error = %v", err)
+			}
+			alert, err := relabeler.Process(newPipelineTestAlert(tt.labels))
+			if err != nil {
+				t.Fatalf("Process() error = %v", err)
+			}
+			if tt.dropped {
+				if alert != nil {
+					t.Errorf("expected the alert to be dropped, got labels %v", alert.Labels())
+				}
+				return
+			}
+			if alert == nil {
+				t.Fatal("alert was dropped")
+			}
+			if len(alert.Labels()) != len(tt.want) {
+				t.Fatalf("labels = %v; want %v", alert.Labels(), tt.want)
+			}
+			for key, value := range tt.want {
+				if alert.Labels()[key] != value {
+					t.Errorf("labels = %v; want %v", alert.Labels(), tt.want)
+				}
+			}
+		})
+	}
+
+	if _, err := NewRelabeler(RelabelConfig{Action: RelabelReplace}); !errors.Is(err, ErrInvalidRelabelConfig) {
+		t.Errorf("replace without target error = %v; want ErrInvalidRelabelConfig", err)
+	}
+	if _, err := NewRelabeler(RelabelConfig{Regex: "(", Action: RelabelDrop}); !errors.Is(err, ErrInvalidRelabelConfig) {
+		t.Errorf("invalid regex error = %v; want ErrInvalidRelabelConfig", err)
+	}
+}
+
+func TestProcessor_WithPipeline(t *testing.T) {
+	storage := newMemStorage()
+	stream := newMemStream()
+	p := NewProcessorV2(nil, storage, stream, WithPipeline(NewPipeline(
+		StaticLabels(map[string]string{"team": "infra"}),
+		DropRules(DropRule{Type: "noise"}),
+	)))
+
+	p.processAlertV2(newPipelineTestAlert(nil))
+	noise := alerts.NewAlertV2("n1", "test", "info", "noise", "noise", "n1", time.Now(), alerts.AlertStateActive)
+	p.processAlertV2(noise)
+
+	stored := stream.published[StorageTopic]
+	if len(stored) != 1 {
+		t.Fatalf("expected only the enriched alert to be stored, got %d", len(stored))
+	}
+	alert, err := alerts.AlertV2FromBytes(stored[0])
+	if err != nil {
+		t.Fatalf("AlertV2FromBytes() error = %v", err)
+	}
+	if alert.Labels()["team"] != "infra" {
+		t.Errorf("stored labels = %v; want team=infra", alert.Labels())
+	}
+}
+
+func TestProcessor_RejectsPipelineForV1(t *testing.T) {
+	if _, ok := WithPipeline(NewPipeline()).(ProcessorOption); ok {
+		t.Error("WithPipeline is a ProcessorOption; want NewProcessor to reject it at compile time")
+	}
+}
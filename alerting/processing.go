@@ -3,6 +3,7 @@
 package alerting
 
 import (
+	"context"
 	"fmt"
 	"reflect"
 	"time"
@@ -14,72 +15,188 @@ const StorageTopic = "alert.store"
 const EvetTopic = "alert.event"
 
 type Processor struct {
-	input   <-chan *alerts.Alert
-	storage Storage
-	stream  Stream
+	input       <-chan *alerts.Alert
+	inputV2     <-chan *alerts.AlertV2
+	storage     Storage
+	stream      Stream
+	escalator   *Escalator
+	stale       *StaleTracker
+	maintenance *MaintenanceSchedule
+	pipeline    *Pipeline
+	elector     *LeaderElector
+	dedup       *DedupCache
+	dlq         DeadLetterQueue
+	dlqConfig   DeadLetterConfig
 }
 
-func NewProcessor(input <-chan *alerts.Alert, storage Storage, stream Stream) *Processor {
-	return &Processor{
+// ProcessorOption configures optional Processor behaviour. It is a
+// ProcessorV2Option as well.
+type ProcessorOption func(*Processor)
+
+// ProcessorV2Option configures a Processor created by NewProcessorV2.
+// Options working on AlertV2 fields, like WithPipeline, are only
+// ProcessorV2Options, so NewProcessor does not accept them.
+type ProcessorV2Option interface {
+	applyV2(p *Processor)
+}
+
+func (o ProcessorOption) applyV2(p *Processor) {
+	o(p)
+}
+
+// processorV2Option is a ProcessorV2Option that is no ProcessorOption.
+type processorV2Option func(*Processor)
+
+func (o processorV2Option) applyV2(p *Processor) {
+	o(p)
+}
+
+// WithEscalator starts escalations for alerts when they fire and stops them
+// when they resolve.
+func WithEscalator(escalator *Escalator) ProcessorOption {
+	return func(p *Processor) {
+		p.escalator = escalator
+	}
+}
+
+// WithStaleTracker records every firing alert with the tracker so that
+// alerts which are no longer resent get resolved as stale. Together with
+// WithEscalator, the escalations of stale alerts are stopped too. Resends
+// dropped by the transport never reach the Processor, see
+// StaleTracker.AllowDuplicates.
+func WithStaleTracker(tracker *StaleTracker) ProcessorOption {
+	return func(p *Processor) {
+		p.stale = tracker
+	}
+}
+
+// WithMaintenance keeps alerts from firing while a matching maintenance
+// window is active. Resolutions are never muted. Together with WithEscalator,
+// escalations of matching alerts are paused while the window is active.
+func WithMaintenance(schedule *MaintenanceSchedule) ProcessorOption {
+	return func(p *Processor) {
+		p.maintenance = schedule
+	}
+}
+
+// NewProcessor creates a Processor for v1 alerts.
+func NewProcessor(input <-chan *alerts.Alert, storage Storage, stream Stream, opts ...ProcessorOption) *Processor {
+	p := &Processor{
 		input:   input,
 		storage: storage,
 		stream:  stream,
 	}
+	for _, opt := range opts {
+		opt(p)
+	}
+	p.wire()
+	return p
+}
+
+// wire connects the components set by the options.
+func (p *Processor) wire() {
+	if p.stale != nil && p.escalator != nil {
+		p.stale.escalator = p.escalator
+	}
+	if p.maintenance != nil && p.escalator != nil {
+		p.escalator.maintenance = p.maintenance
+	}
+	if p.elector != nil {
+		p.stream = fencedStream{Stream: p.stream, elector: p.elector}
+	}
 }
 
 func (p *Processor) Process() {
 	for alert := range p.input {
-		storedAlertBytes, err := p.storage.Get(alert.ID)
-		if err != nil {
-			err := p.storeNewAlert(alert)
-			if err != nil {
-				println(err.Error())
-				logEvent := logEvent(err, alert.ID)
-				err := p.stream.Publish(EvetTopic, logEvent.Bytes())
-				if err != nil {
-					panic(err)
-				}
-			}
-			continue
+		_ = p.awaitLeadership(context.Background())
+		if err := p.processAlert(alert); err != nil {
+			p.publishLog(err, alert.ID)
 		}
-		storedAlert, err := alerts.AlertFromBytes(storedAlertBytes)
-		if err != nil {
-			fmt.Printf("Error decoding alert %s: %v\n", alert.ID, err)
-			logEvent := logEvent(err, alert.ID)
-			err := p.stream.Publish(EvetTopic, logEvent.Bytes())
-			if err != nil {
-				panic(err)
-			}
-			continue
+	}
+}
+
+// HandleMsg is a MessageHandler processing the v1 alerts of a subscription,
+// for running the Processor with SubscribeMsg instead of Process and its
+// input channel, which may then be nil. It returns once the alert has been
+// processed, so the transport acknowledges the message only then, and
+// returns the processing error so that the message is redelivered, giving
+// at-least-once processing. Messages that cannot be decoded are sent to the
+// dead-letter queue, if there is one, and acknowledged.
+func (p *Processor) HandleMsg(ctx context.Context, msg *Message) error {
+	alert, err := alerts.AlertFromBytes(msg.Data)
+	if err != nil {
+		forwardFailed(msg.Subject, msg.Data, err, p.dlq)
+		return nil
+	}
+	if err := p.awaitLeadership(ctx); err != nil {
+		return err
+	}
+	if err := p.processAlert(alert); err != nil {
+		p.publishLog(err, alert.ID)
+		return err
+	}
+	return nil
+}
+
+// processAlert compares alert with its stored copy and fires, resolves or
+// stores it.
+func (p *Processor) processAlert(alert *alerts.Alert) error {
+	if p.duplicate(alert.ID, alert.Hash()) {
+		return nil
+	}
+	err := p.applyAlert(alert)
+	if err != nil {
+		// Let a resend of the alert through the dedup cache.
+		p.forget(alert.ID)
+	}
+	return err
+}
+
+func (p *Processor) applyAlert(alert *alerts.Alert) error {
+	storedAlertBytes, err := p.storage.Get(alert.ID)
+	if err != nil {
+		return p.processNewAlert(alert)
+	}
+	storedAlert, err := alerts.AlertFromBytes(storedAlertBytes)
+	if err != nil {
+		fmt.Printf("Error decoding alert %s: %v\n", alert.ID, err)
+		p.deadLetterStored(alert.ID, storedAlertBytes, err)
+		if !alert.IsFiring() {
+			// Replace the corrupt record; there is nothing to resolve.
+			return p.storeAlert(alert)
 		}
+		return p.processNewAlert(alert)
+	}
 
-		if reflect.DeepEqual(storedAlert, alert) {
-			fmt.Println("Alerts are same")
-		} else {
-			if alert.IsFiring() != storedAlert.IsFiring() {
-				if !alert.IsFiring() {
-					err := p.resolveAlert(alert)
-					if err != nil {
-						println(err.Error())
-						logEvent := logEvent(err, alert.ID)
-						err := p.stream.Publish(EvetTopic, logEvent.Bytes())
-						if err != nil {
-							panic(err)
-						}
-					}
-					continue
-				} else {
-					err := p.fireAlert(alert)
-					if err != nil {
-						return
-					}
-					continue
-				}
-			} else {
-				fmt.Printf("%s is different", diffAlerts(alert, storedAlert))
-			}
+	if reflect.DeepEqual(storedAlert, alert) {
+		fmt.Println("Alerts are same")
+		p.seen(alert)
+		return nil
+	}
+	if alert.IsFiring() != storedAlert.IsFiring() {
+		if !alert.IsFiring() {
+			return p.resolveAlert(alert)
+		}
+		if p.muted(alert) {
+			return nil
 		}
+		return p.fireAlert(alert)
+	}
+	fmt.Printf("%s is different", diffAlerts(alert, storedAlert))
+	p.seen(alert)
+	return nil
+}
+
+// processNewAlert stores an alert that has no stored copy.
+func (p *Processor) processNewAlert(alert *alerts.Alert) error {
+	if p.muted(alert) {
+		return nil
 	}
+	if err := p.storeNewAlert(alert); err != nil {
+		return err
+	}
+	p.seen(alert)
+	return nil
 }
 
 func (p *Processor) resolveAlert(alert *alerts.Alert) error {
@@ -96,6 +213,14 @@ func (p *Processor) resolveAlert(alert *alerts.Alert) error {
 	if err != nil {
 		return err
 	}
+	if p.stale != nil {
+		if err := p.stale.Forget(alert.ID); err != nil {
+			return err
+		}
+	}
+	if p.escalator != nil {
+		return p.escalator.Stop(alert.ID)
+	}
 	return nil
 }
 
@@ -112,9 +237,49 @@ func (p *Processor) fireAlert(alert *alerts.Alert) error {
 		return err
 	}
 	fmt.Printf("Alert :: %s fired\n", alert.ID)
+	p.seen(alert)
 	return nil
 }
 
+// muted reports whether a firing v1 alert is muted by a maintenance window
+// or silenced.
+func (p *Processor) muted(alert *alerts.Alert) bool {
+	if !alert.IsFiring() {
+		return false
+	}
+	if p.maintenance != nil {
+		if window, muted := p.maintenance.MutedV1(alert); muted {
+			fmt.Printf("Alert :: %s muted by maintenance window %s\n", alert.ID, window)
+			return true
+		}
+	}
+	return p.silenced(alert.ID)
+}
+
+// silenced reports whether the alert is silenced. Failing to check counts
+// as not silenced, so that the alert still fires.
+func (p *Processor) silenced(alertID string) bool {
+	silenced, err := silenced(p.storage, alertID, time.Now())
+	if err != nil {
+		p.publishLog(err, alertID)
+		return false
+	}
+	if silenced {
+		fmt.Printf("Alert :: %s silenced\n", alertID)
+	}
+	return silenced
+}
+
+// seen records a firing v1 alert with the stale tracker.
+func (p *Processor) seen(alert *alerts.Alert) {
+	if p.stale == nil || !alert.IsFiring() {
+		return
+	}
+	if err := p.stale.SeenV1(alert); err != nil {
+		p.publishLog(err, alert.ID)
+	}
+}
+
 func (p *Processor) storeNewAlert(alert *alerts.Alert) error {
 	const alertNotStoredMsg = "alert not stored, new alert with Resolved status"
 	if !alert.IsFiring() {
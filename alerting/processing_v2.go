@@ -0,0 +1,315 @@
+package alerting
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/avilikof/go-shared-libs/alerts"
+)
+
+// NewProcessorV2 creates a Processor that consumes AlertV2 alerts.
+// Run it with ProcessV2.
+func NewProcessorV2(input <-chan *alerts.AlertV2, storage Storage, stream Stream, opts ...ProcessorV2Option) *Processor {
+	p := &Processor{
+		inputV2: input,
+		storage: storage,
+		stream:  stream,
+	}
+	for _, opt := range opts {
+		opt.applyV2(p)
+	}
+	p.wire()
+	return p
+}
+
+// ProcessV2 consumes AlertV2 alerts until the input channel is closed.
+// New firing alerts are stored and announced with a firing event; state
+// changes between active and resolved fire or resolve the stored alert.
+func (p *Processor) ProcessV2() {
+	for alert := range p.inputV2 {
+		_ = p.awaitLeadership(context.Background())
+		p.processAlertV2(alert)
+	}
+}
+
+// HandleMsgV2 is HandleMsg for AlertV2 alerts, for running the Processor
+// with SubscribeMsg instead of ProcessV2. Failed alerts are retried as with
+// ProcessV2 before the error is returned, unless ctx ends first; alerts that
+// have been dead-lettered are acknowledged.
+func (p *Processor) HandleMsgV2(ctx context.Context, msg *Message) error {
+	alert, err := alerts.AlertV2FromBytes(msg.Data)
+	if err != nil {
+		forwardFailed(msg.Subject, msg.Data, err, p.dlq)
+		return nil
+	}
+	if err := p.awaitLeadership(ctx); err != nil {
+		return err
+	}
+	err = p.processDeliveredV2(ctx, alert, msg.Subject, msg.Data, 0)
+	if errors.Is(err, errDeadLettered) {
+		return nil
+	}
+	return err
+}
+
+// ConsumeV2 fetches AlertV2 alerts from consumer in batches of up to batch
+// until ctx is done, and settles each one once it has been processed: it is
+// acknowledged after its state has been published to StorageTopic, nak'ed
+// for redelivery if processing failed, and terminated if it cannot be decoded
+// or was dead-lettered. Unlike ProcessV2, an alert is never acknowledged
+// before it has been processed, so a crash leads to redelivery instead of
+// loss. Failed alerts are not retried in process: every delivery is one
+// attempt, redelivered after the consumer's BackOff, and the delivery that
+// reaches the dead-letter queue's MaxAttempts is dead-lettered. While this
+// instance is not the leader, ConsumeV2 waits for leadership or ctx.
+func (p *Processor) ConsumeV2(ctx context.Context, consumer Fetcher, batch int) error {
+	if batch < 1 {
+		batch = 10
+	}
+	for {
+		if err := p.awaitLeadership(ctx); err != nil {
+			return err
+		}
+		deliveries, err := consumer.Fetch(ctx, batch, time.Second)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil {
+			fmt.Printf("Alert :: fetch failed: %v\n", err)
+			select {
+			case <-time.After(time.Second):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+			continue
+		}
+		for _, delivery := range deliveries {
+			p.settle(ctx, delivery)
+		}
+	}
+}
+
+func (p *Processor) settle(ctx context.Context, delivery *Delivery) {
+	alert, err := alerts.AlertV2FromBytes(delivery.Data)
+	if err != nil {
+		forwardFailed(delivery.Subject, delivery.Data, err, p.dlq)
+		err = delivery.Term()
+	} else {
+		err = p.processDeliveredV2(ctx, alert, delivery.Subject, delivery.Data, int(delivery.Delivered))
+		switch {
+		case err == nil:
+			err = delivery.Ack()
+		case errors.Is(err, errDeadLettered):
+			err = delivery.Term()
+		default:
+			err = delivery.Nak(0)
+		}
+	}
+	if err != nil {
+		fmt.Printf("Alert :: failed to settle message from %s: %v\n", delivery.Subject, err)
+	}
+}
+
+// processAlertV2 processes an alert received on the input channel, see
+// processDeliveredV2.
+func (p *Processor) processAlertV2(alert *alerts.AlertV2) error {
+	return p.processDeliveredV2(context.Background(), alert, p.dlqConfig.Subject, nil, 0)
+}
+
+// processDeliveredV2 processes alert, received as data on subject, and
+// returns why it failed, after data has been dead-lettered if there is a
+// dead-letter queue. Without data the alert is dead-lettered as received,
+// before the pipeline changed it. delivered is the number of the delivery
+// for transports that redeliver failed alerts themselves; each delivery is
+// then a single attempt. With zero, failed attempts are retried after
+// RetryDelay until MaxAttempts or ctx is done.
+func (p *Processor) processDeliveredV2(ctx context.Context, alert *alerts.AlertV2, subject string, data []byte, delivered int) error {
+	if p.duplicate(alert.ID(), alert.Hash()) {
+		return nil
+	}
+	if data == nil && p.dlq != nil {
+		var err error
+		if data, err = alert.MarshalJSON(); err != nil {
+			return err
+		}
+	}
+	if p.pipeline != nil {
+		enriched, err := p.pipeline.Process(alert)
+		if err != nil {
+			p.publishLog(fmt.Errorf("enriching alert: %w", err), alert.ID())
+		}
+		if enriched == nil {
+			fmt.Printf("Alert :: %s dropped by pipeline\n", alert.ID())
+			return nil
+		}
+		alert = enriched
+	}
+
+	var err error
+	attempts := max(delivered-1, 0)
+	for {
+		attempts++
+		if err = p.applyAlertV2(alert); err == nil {
+			return nil
+		}
+		if delivered > 0 || attempts >= p.maxAttempts() || !p.awaitRetry(ctx, attempts) {
+			break
+		}
+	}
+	// Let a redelivery of the alert through the dedup cache.
+	p.forget(alert.ID())
+	p.publishLog(err, alert.ID())
+	if attempts >= p.maxAttempts() && p.deadLetter(alert.ID(), subject, data, err, attempts) {
+		return fmt.Errorf("%w: %w", errDeadLettered, err)
+	}
+	return err
+}
+
+// awaitRetry waits RetryDelay before the second attempt, doubled before each
+// later one, and reports false if ctx is done first.
+func (p *Processor) awaitRetry(ctx context.Context, attempts int) bool {
+	timer := time.NewTimer(p.dlqConfig.RetryDelay << (attempts - 1))
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// applyAlertV2 compares alert with its stored copy and fires, resolves or
+// refreshes it.
+func (p *Processor) applyAlertV2(alert *alerts.AlertV2) error {
+	storedAlertBytes, err := p.storage.Get(alert.ID())
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return fmt.Errorf("loading stored alert: %w", err)
+	}
+	if err != nil {
+		if !alert.IsFiring() {
+			p.publishLog(fmt.Errorf("alert not stored, new alert with Resolved status"), alert.ID())
+			return nil
+		}
+		return p.fireAlertV2(alert)
+	}
+
+	storedAlert, err := alerts.AlertV2FromBytes(storedAlertBytes)
+	if err != nil {
+		p.deadLetterStored(alert.ID(), storedAlertBytes, err)
+		if !alert.IsFiring() {
+			// Replace the corrupt record; there is nothing to resolve.
+			return p.storeAlertV2(alert)
+		}
+		return p.fireAlertV2(alert)
+	}
+
+	switch {
+	case alert.IsFiring() && !storedAlert.IsFiring():
+		return p.fireAlertV2(alert)
+	case !alert.IsFiring() && storedAlert.IsFiring():
+		return p.resolveAlertV2(alert)
+	case alert.IsFiring():
+		// Still firing, refresh the stored copy without announcing it again.
+		return p.refreshAlertV2(alert)
+	}
+	return nil
+}
+
+func (p *Processor) refreshAlertV2(alert *alerts.AlertV2) error {
+	err := p.storeAlertV2(alert)
+	if err != nil {
+		return err
+	}
+	if p.stale != nil {
+		return p.stale.Seen(alert)
+	}
+	return nil
+}
+
+func (p *Processor) fireAlertV2(alert *alerts.AlertV2) error {
+	if p.maintenance != nil {
+		if window, muted := p.maintenance.Muted(alert); muted {
+			fmt.Printf("Alert :: %s muted by maintenance window %s\n", alert.ID(), window)
+			return nil
+		}
+	}
+	if p.silenced(alert.ID()) {
+		return nil
+	}
+	alertBytes, err := alert.MarshalJSON()
+	if err != nil {
+		return err
+	}
+	err = p.stream.Publish(StorageTopic, alertBytes)
+	if err != nil {
+		return err
+	}
+	firingEvent := withAlert(firingEvent(alert.ID()), alertBytes)
+	err = p.stream.Publish(EvetTopic, firingEvent.Bytes())
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Alert :: %s fired\n", alert.ID())
+
+	if p.stale != nil {
+		if err := p.stale.Seen(alert); err != nil {
+			return err
+		}
+	}
+	if p.escalator != nil {
+		if err := p.escalator.Start(alert); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *Processor) resolveAlertV2(alert *alerts.AlertV2) error {
+	alert.Resolve()
+	alertBytes, err := alert.MarshalJSON()
+	if err != nil {
+		return err
+	}
+	err = p.stream.Publish(StorageTopic, alertBytes)
+	if err != nil {
+		return err
+	}
+	resolveEvent := withAlert(resolvedEvent(alert.ID()), alertBytes)
+	err = p.stream.Publish(EvetTopic, resolveEvent.Bytes())
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Alert :: %s resolved\n", alert.ID())
+
+	if p.stale != nil {
+		if err := p.stale.Forget(alert.ID()); err != nil {
+			return err
+		}
+	}
+	if p.escalator != nil {
+		if err := p.escalator.Stop(alert.ID()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *Processor) storeAlertV2(alert *alerts.AlertV2) error {
+	alertBytes, err := alert.MarshalJSON()
+	if err != nil {
+		return err
+	}
+	return p.stream.Publish(StorageTopic, alertBytes)
+}
+
+// publishLog reports a processing error for an alert on the event topic. A
+// failed publish is only logged, so that the alert is still settled.
+func (p *Processor) publishLog(err error, alertID string) {
+	fmt.Printf("Alert :: %s :: %v\n", alertID, err)
+	logEvent := logEvent(err, alertID)
+	if err := p.stream.Publish(EvetTopic, logEvent.Bytes()); err != nil {
+		fmt.Printf("Alert :: %s :: failed to publish log event: %v\n", alertID, err)
+	}
+}
@@ -0,0 +1,332 @@
+package alerting
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/nats-io/nats.go"
+
+	"github.com/avilikof/go-shared-libs/alerts"
+	"github.com/avilikof/go-shared-libs/event"
+)
+
+// ProjectionConfig configures a Projection. Zero values fall back to the
+// defaults noted on each field.
+type ProjectionConfig struct {
+	// Name identifies the projection's checkpoint in its storage. Default
+	// "alerts".
+	Name string
+	// Subject selects the replayed events. Default EvetTopic.
+	Subject string
+	// StartSequence replays from this stream sequence instead of the
+	// checkpoint, e.g. 1 to rebuild from every retained event.
+	StartSequence uint64
+	// StartTime replays the events from this time on instead of the
+	// checkpoint. StartSequence takes precedence.
+	StartTime time.Time
+}
+
+// ErrUndecodable marks reducer errors for event data that can never be
+// applied, e.g. a malformed alert. Apply skips the event for that reducer
+// instead of stopping at it.
+var ErrUndecodable = errors.New("undecodable")
+
+// Reducer applies an event to the state kept in storage. Events are applied
+// at least once: after a crash the events since the last checkpoint are
+// applied again, so reducers must be idempotent. Errors not matching
+// ErrUndecodable, e.g. of storage, stop the projection at the event.
+type Reducer func(storage Storage, ev *event.Event) error
+
+// Projection rebuilds state from the events stream. It replays the events
+// in stream order, applies them with the reducers registered for their
+// action and checkpoints the last applied sequence in its storage, so that
+// a later Projection of the same name resumes after it.
+type Projection struct {
+	js       nats.JetStreamContext
+	storage  Storage
+	config   ProjectionConfig
+	reducers map[event.Action][]Reducer
+	applied  uint64
+}
+
+// NewProjection creates a Projection materializing into storage. Register
+// its reducers with Reduce before replaying.
+func NewProjection(js nats.JetStreamContext, storage Storage, config ProjectionConfig) *Projection {
+	if config.Name == "" {
+		config.Name = "alerts"
+	}
+	if config.Subject == "" {
+		config.Subject = EvetTopic
+	}
+	return &Projection{
+		js:       js,
+		storage:  storage,
+		config:   config,
+		reducers: make(map[event.Action][]Reducer),
+	}
+}
+
+// NewAlertStateProjection creates a Projection materializing the v2 alerts
+// into storage the way the Processor stores them, keyed by alert ID, e.g. to
+// rebuild a lost alerts bucket.
+func NewAlertStateProjection(js nats.JetStreamContext, storage Storage, config ProjectionConfig) *Projection {
+	p := NewProjection(js, storage, config)
+	p.Reduce(event.ActionFiring, ReduceFiring)
+	p.Reduce(event.ActionResolved, ReduceResolved)
+	return p
+}
+
+// Reduce registers reducer for the events of action. Reducers of the same
+// action are applied in registration order.
+func (p *Projection) Reduce(action event.Action, reducer Reducer) {
+	p.reducers[action] = append(p.reducers[action], reducer)
+}
+
+// Checkpoint returns the stream sequence of the last applied event, 0 if
+// none was applied yet.
+func (p *Projection) Checkpoint() (uint64, error) {
+	data, err := p.storage.Get(p.checkpointKey())
+	if errors.Is(err, ErrNotFound) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to load checkpoint of projection %s: %w", p.config.Name, err)
+	}
+	sequence, err := strconv.ParseUint(string(data), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("failed to decode checkpoint of projection %s: %w", p.config.Name, err)
+	}
+	return sequence, nil
+}
+
+// Apply applies the event data stored at sequence and checkpoints it.
+// Undecodable events, and reducer errors matching ErrUndecodable, are logged
+// and skipped. On any other reducer error the checkpoint is left before the
+// event, so it is applied again by the next replay.
+func (p *Projection) Apply(sequence uint64, data []byte) error {
+	ev, err := event.FromBytes(data)
+	if err != nil {
+		fmt.Printf("Projection :: %s :: skipping undecodable event %d: %v\n", p.config.Name, sequence, err)
+	} else {
+		for _, reducer := range p.reducers[ev.Action] {
+			err := reducer(p.storage, ev)
+			if errors.Is(err, ErrUndecodable) {
+				fmt.Printf("Projection :: %s :: skipping event %d: %v\n", p.config.Name, sequence, err)
+				continue
+			}
+			if err != nil {
+				return fmt.Errorf("failed to apply event %d to projection %s: %w", sequence, p.config.Name, err)
+			}
+		}
+	}
+	if err := p.storage.Set(p.checkpointKey(), []byte(strconv.FormatUint(sequence, 10)), 0); err != nil {
+		return fmt.Errorf("failed to checkpoint projection %s: %w", p.config.Name, err)
+	}
+	p.applied = sequence
+	return nil
+}
+
+// Replay applies the events up to the end of the stream and returns how
+// many it applied. Events published during the replay are applied too.
+func (p *Projection) Replay(ctx context.Context) (int, error) {
+	sub, err := p.subscribe()
+	if err != nil {
+		return 0, err
+	}
+	defer sub.Unsubscribe()
+
+	info, err := sub.ConsumerInfo()
+	if err != nil {
+		return 0, fmt.Errorf("failed to replay projection %s: %w", p.config.Name, natsError(err))
+	}
+	if info.NumPending == 0 && info.Delivered.Consumer == 0 {
+		return 0, nil
+	}
+
+	applied := 0
+	for {
+		msg, err := sub.NextMsgWithContext(ctx)
+		if err != nil {
+			return applied, err
+		}
+		pending, err := p.applyMsg(msg)
+		if err != nil {
+			return applied, err
+		}
+		applied++
+		if pending == 0 {
+			return applied, nil
+		}
+	}
+}
+
+// Run applies the events as they are published until ctx is done or a
+// reducer fails, see Apply.
+func (p *Projection) Run(ctx context.Context) error {
+	sub, err := p.subscribe()
+	if err != nil {
+		return err
+	}
+	defer sub.Unsubscribe()
+
+	for {
+		msg, err := sub.NextMsgWithContext(ctx)
+		if ctx.Err() != nil {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to run projection %s: %w", p.config.Name, natsError(err))
+		}
+		if _, err := p.applyMsg(msg); err != nil {
+			return err
+		}
+	}
+}
+
+// applyMsg applies msg and returns the number of events still pending after
+// it.
+func (p *Projection) applyMsg(msg *nats.Msg) (uint64, error) {
+	meta, err := msg.Metadata()
+	if err != nil {
+		return 0, fmt.Errorf("failed to read event metadata: %w", err)
+	}
+	return meta.NumPending, p.Apply(meta.Sequence.Stream, msg.Data)
+}
+
+// subscribe starts an ordered consumer at the configured start, or after
+// the checkpoint. Once this Projection applied events it always resumes
+// after them. Ordered consumers are ephemeral, so a projection never takes
+// events away from the durable consumers of the pipeline.
+func (p *Projection) subscribe() (*nats.Subscription, error) {
+	start := nats.DeliverAll()
+	switch {
+	case p.applied > 0:
+		start = nats.StartSequence(p.applied + 1)
+	case p.config.StartSequence > 0:
+		start = nats.StartSequence(p.config.StartSequence)
+	case !p.config.StartTime.IsZero():
+		start = nats.StartTime(p.config.StartTime)
+	default:
+		checkpoint, err := p.Checkpoint()
+		if err != nil {
+			return nil, err
+		}
+		if checkpoint > 0 {
+			start = nats.StartSequence(checkpoint + 1)
+		}
+	}
+	sub, err := p.js.SubscribeSync(p.config.Subject, nats.OrderedConsumer(), start)
+	if err != nil {
+		return nil, fmt.Errorf("failed to subscribe projection %s to %s: %w", p.config.Name, p.config.Subject, natsError(err))
+	}
+	return sub, nil
+}
+
+func (p *Projection) checkpointKey() string {
+	return "projection." + p.config.Name + ".checkpoint"
+}
+
+// ReduceFiring stores the alert carried by a firing event under its ID.
+// Firing events without an alert, published by v1 processors or before
+// events carried it, mark the stored alert firing, or store a bare alert if
+// there is none. A stored v1 alert is left as it is, but a v1 alert that is
+// not stored is rebuilt as a bare v2 alert: its events cannot be told apart.
+func ReduceFiring(storage Storage, ev *event.Event) error {
+	alertID, _ := ev.Message["alert_id"].(string)
+	if alertID == "" {
+		return nil
+	}
+	alert, err := carriedAlertV2(ev, alertID)
+	if err != nil {
+		return err
+	}
+	if alert == nil {
+		var stored bool
+		alert, stored, err = storedAlertV2(storage, alertID)
+		if err != nil {
+			return err
+		}
+		if stored && alert == nil {
+			return nil
+		}
+		if alert == nil {
+			alert = alerts.NewAlertV2(alertID, ev.Service, "", "", "", alertID, ev.Timestamp, alerts.AlertStateActive)
+		}
+		alert.Fire()
+	}
+	return storeProjectedAlert(storage, alert)
+}
+
+// ReduceResolved stores the alert carried by a resolved event under its ID.
+// Resolved events without an alert mark the stored v2 alert resolved;
+// alerts that are not stored and v1 alerts are left alone.
+func ReduceResolved(storage Storage, ev *event.Event) error {
+	alertID, _ := ev.Message["alert_id"].(string)
+	if alertID == "" {
+		return nil
+	}
+	alert, err := carriedAlertV2(ev, alertID)
+	if err != nil {
+		return err
+	}
+	if alert == nil {
+		alert, _, err = storedAlertV2(storage, alertID)
+		if err != nil || alert == nil {
+			return err
+		}
+		alert.Resolve()
+	}
+	return storeProjectedAlert(storage, alert)
+}
+
+// carriedAlertV2 decodes the alert carried by ev, nil if it carries none.
+func carriedAlertV2(ev *event.Event, alertID string) (*alerts.AlertV2, error) {
+	carried, ok := ev.Message["alert"]
+	if !ok {
+		return nil, nil
+	}
+	data, err := json.Marshal(carried)
+	if err == nil {
+		var alert *alerts.AlertV2
+		if alert, err = alerts.AlertV2FromBytes(data); err == nil {
+			return alert, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: alert %s of %s event: %v", ErrUndecodable, alertID, ev.Action, err)
+}
+
+func storeProjectedAlert(storage Storage, alert *alerts.AlertV2) error {
+	data, err := alert.MarshalJSON()
+	if err != nil {
+		return err
+	}
+	return storage.Set(alert.ID(), data, 0)
+}
+
+// storedAlertV2 loads the stored alert alertID and reports whether it is
+// stored. The alert is nil if it is not stored or is a v1 alert.
+func storedAlertV2(storage Storage, alertID string) (*alerts.AlertV2, bool, error) {
+	data, err := storage.Get(alertID)
+	if errors.Is(err, ErrNotFound) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("loading stored alert: %w", err)
+	}
+	var version struct {
+		Firing *bool   `json:"firing"`
+		State  *string `json:"state"`
+	}
+	if json.Unmarshal(data, &version) == nil && version.Firing != nil && version.State == nil {
+		return nil, true, nil
+	}
+	alert, err := alerts.AlertV2FromBytes(data)
+	if err != nil {
+		return nil, true, fmt.Errorf("%w: stored alert %s: %v", ErrUndecodable, alertID, err)
+	}
+	return alert, true, nil
+}
@@ -0,0 +1,163 @@
+package alerting_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/avilikof/go-shared-libs/alerting"
+	"github.com/avilikof/go-shared-libs/alerting/alertingtest"
+	"github.com/avilikof/go-shared-libs/alerts"
+	"github.com/avilikof/go-shared-libs/event"
+)
+
+func TestProjection_RebuildsAlerts(t *testing.T) {
+	storage := alertingtest.NewStorage(nil)
+	stream := alertingtest.NewStream()
+	defer stream.Close()
+	stream.Persist(storage, 0)
+
+	input := make(chan *alerts.AlertV2)
+	processor := alerting.NewProcessorV2(input, storage, stream)
+	done := make(chan struct{})
+	go func() {
+		processor.ProcessV2()
+		close(done)
+	}()
+	disk := alerts.NewAlertV2("disk", "node-exporter", "critical", "disk_full", "disk", "disk", time.Now(), alerts.AlertStateActive)
+	disk.AddLabel("team", "infra")
+	input <- disk
+	input <- alerts.NewAlertV2("cpu", "node-exporter", "warning", "cpu_high", "cpu", "cpu", time.Now(), alerts.AlertStateActive)
+	input <- alerts.NewAlertV2("cpu", "node-exporter", "warning", "cpu_high", "cpu", "cpu", time.Now(), alerts.AlertStateResolved)
+	close(input)
+	<-done
+
+	rebuilt := alertingtest.NewStorage(nil)
+	projection := alerting.NewAlertStateProjection(nil, rebuilt, alerting.ProjectionConfig{})
+	events := stream.Messages(alerting.EvetTopic)
+	for i, msg := range events {
+		if err := projection.Apply(uint64(i+1), msg.Data); err != nil {
+			t.Fatalf("Apply(%d) error = %v", i+1, err)
+		}
+	}
+
+	for _, id := range []string{"disk", "cpu"} {
+		want, _ := storage.Get(id)
+		got, err := rebuilt.Get(id)
+		if err != nil || string(got) != string(want) {
+			t.Errorf("rebuilt %s = %s, %v; want %s", id, got, err, want)
+		}
+	}
+	if checkpoint, err := projection.Checkpoint(); err != nil || checkpoint != uint64(len(events)) {
+		t.Errorf("Checkpoint() = %d, %v; want %d", checkpoint, err, len(events))
+	}
+}
+
+func TestProjection_Apply(t *testing.T) {
+	storage := alertingtest.NewStorage(nil)
+	projection := alerting.NewAlertStateProjection(nil, storage, alerting.ProjectionConfig{Name: "test"})
+
+	// Firing events without the alert store a bare alert.
+	legacy := event.NewEvent("alerting", event.TypeEvent, time.Now(), event.ActionFiring, map[string]any{"alert_id": "legacy"})
+	if err := projection.Apply(1, legacy.Bytes()); err != nil {
+		t.Fatalf("Apply() error = %v", err)
+	}
+	data, err := storage.Get("legacy")
+	if err != nil {
+		t.Fatalf("Get(legacy) error = %v", err)
+	}
+	if alert, err := alerts.AlertV2FromBytes(data); err != nil || !alert.IsFiring() || alert.Source() != "alerting" {
+		t.Errorf("legacy alert = %s, %v; want firing from alerting", data, err)
+	}
+
+	if err := projection.Apply(2, []byte("not an event")); err != nil {
+		t.Errorf("Apply(undecodable) error = %v; want it skipped", err)
+	}
+	malformed := event.NewEvent("alerting", event.TypeEvent, time.Now(), event.ActionFiring,
+		map[string]any{"alert_id": "malformed", "alert": map[string]any{"source": "alerting"}})
+	if err := projection.Apply(3, malformed.Bytes()); err != nil {
+		t.Errorf("Apply(malformed alert) error = %v; want it skipped", err)
+	}
+
+	// Stored v1 alerts are left alone.
+	v1, _ := json.Marshal(alerts.NewAlert("v1", "disk", "disk full", time.Now(), true))
+	_ = storage.Set("v1", v1, 0)
+	v1Firing := event.NewEvent("alerting", event.TypeEvent, time.Now(), event.ActionFiring, map[string]any{"alert_id": "v1"})
+	if err := projection.Apply(4, v1Firing.Bytes()); err != nil {
+		t.Errorf("Apply(v1) error = %v", err)
+	}
+	if data, _ := storage.Get("v1"); string(data) != string(v1) {
+		t.Errorf("stored v1 alert = %s; want it untouched", data)
+	}
+
+	failing := errors.New("reducer failed")
+	projection.Reduce(event.ActionResolved, func(alerting.Storage, *event.Event) error { return failing })
+	resolved := event.NewEvent("alerting", event.TypeEvent, time.Now(), event.ActionResolved, map[string]any{"alert_id": "legacy"})
+	if err := projection.Apply(5, resolved.Bytes()); !errors.Is(err, failing) {
+		t.Errorf("Apply() error = %v; want %v", err, failing)
+	}
+	if checkpoint, _ := projection.Checkpoint(); checkpoint != 4 {
+		t.Errorf("Checkpoint() = %d; want 4, before the failed event", checkpoint)
+	}
+	if _, err := storage.Get("projection.test.checkpoint"); err != nil {
+		t.Errorf("checkpoint not stored under its name: %v", err)
+	}
+}
+
+func TestProjection_ReplayResumesFromCheckpoint(t *testing.T) {
+	requireNATS(t)
+	handler := newJetStreamHandler(t)
+	info, err := handler.JetStream().StreamInfo(alerting.EVENT_STREAM)
+	if err != nil {
+		t.Fatalf("StreamInfo() error = %v", err)
+	}
+
+	prefix := fmt.Sprintf("projection-%d-", time.Now().UnixNano())
+	publish := func(action event.Action, id string) {
+		t.Helper()
+		ev := event.NewEvent("alerting", event.TypeEvent, time.Now(), action, map[string]any{"alert_id": prefix + id})
+		if err := handler.Publish(alerting.EvetTopic, ev.Bytes()); err != nil {
+			t.Fatalf("Publish() error = %v", err)
+		}
+	}
+	publish(event.ActionFiring, "disk")
+	publish(event.ActionFiring, "cpu")
+	publish(event.ActionResolved, "cpu")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	storage := alertingtest.NewStorage(nil)
+	config := alerting.ProjectionConfig{Name: prefix, StartSequence: info.State.LastSeq + 1}
+	applied, err := alerting.NewAlertStateProjection(handler.JetStream(), storage, config).Replay(ctx)
+	if err != nil || applied != 3 {
+		t.Fatalf("Replay() = %d, %v; want 3 events", applied, err)
+	}
+	expectFiring := func(id string, want bool) {
+		t.Helper()
+		data, err := storage.Get(prefix + id)
+		if err != nil {
+			t.Fatalf("Get(%s) error = %v", id, err)
+		}
+		if alert, err := alerts.AlertV2FromBytes(data); err != nil || alert.IsFiring() != want {
+			t.Errorf("%s = %s, %v; want firing %v", id, data, err, want)
+		}
+	}
+	expectFiring("disk", true)
+	expectFiring("cpu", false)
+
+	// Without a start the next projection resumes after the checkpoint.
+	publish(event.ActionResolved, "disk")
+	applied, err = alerting.NewAlertStateProjection(handler.JetStream(), storage, alerting.ProjectionConfig{Name: prefix}).Replay(ctx)
+	if err != nil || applied != 1 {
+		t.Fatalf("Replay() after checkpoint = %d, %v; want 1 event", applied, err)
+	}
+	expectFiring("disk", false)
+
+	applied, err = alerting.NewAlertStateProjection(handler.JetStream(), storage, alerting.ProjectionConfig{Name: prefix}).Replay(ctx)
+	if err != nil || applied != 0 {
+		t.Errorf("Replay() when caught up = %d, %v; want 0 events", applied, err)
+	}
+}
@@ -0,0 +1,269 @@
+package alerting
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/nats-io/nats.go"
+
+	"github.com/avilikof/go-shared-libs/alerts"
+	natsdriver "github.com/avilikof/go-shared-libs/nats"
+)
+
+// QuerySubject is the subject a QueryResponder answers on by default.
+const QuerySubject = "alert.query"
+
+// queryQueue is the queue group of QueryResponders, so that every query is
+// answered once.
+const queryQueue = "alerting-query"
+
+// Reply error codes of queries, next to natsdriver.CodeBadRequest and
+// natsdriver.CodeInternal.
+const (
+	QueryCodeNotFound    = "not_found"
+	QueryCodeUnsupported = "unsupported"
+)
+
+var ErrInvalidQuery = errors.New("invalid query")
+
+// QueryOp names a query.
+type QueryOp string
+
+const (
+	// QueryGetAlert returns the stored alert AlertID, firing or not.
+	QueryGetAlert QueryOp = "get-alert"
+	// QueryListFiring returns the firing alerts carrying Labels, sorted by
+	// ID.
+	QueryListFiring QueryOp = "list-firing"
+	// QueryCountByLabel counts the firing alerts carrying Labels by their
+	// value of Label. Alerts without Label are not counted.
+	QueryCountByLabel QueryOp = "count-by-label"
+)
+
+// QueryRequest is a query about the alerts in a Storage.
+type QueryRequest struct {
+	Op      QueryOp           `json:"op"`
+	AlertID string            `json:"alert_id,omitempty"`
+	Labels  map[string]string `json:"labels,omitempty"`
+	Label   string            `json:"label,omitempty"`
+}
+
+// QueryReply answers a QueryRequest. Alerts are returned as stored.
+type QueryReply struct {
+	Alert  json.RawMessage   `json:"alert,omitempty"`
+	Alerts []json.RawMessage `json:"alerts,omitempty"`
+	Counts map[string]int    `json:"counts,omitempty"`
+}
+
+// QueryResponder answers queries about the live v2 alerts in a Storage, for
+// services without access to the storage itself. Listing and counting
+// require the storage to implement KeyLister.
+type QueryResponder struct {
+	storage Storage
+}
+
+func NewQueryResponder(storage Storage) *QueryResponder {
+	return &QueryResponder{storage: storage}
+}
+
+// Serve answers queries received on conn under subject, QuerySubject if
+// empty, until the returned subscription is unsubscribed. Responders on the
+// same subject share the queries between them.
+func (r *QueryResponder) Serve(conn *nats.Conn, subject string) (*nats.Subscription, error) {
+	if subject == "" {
+		subject = QuerySubject
+	}
+	return natsdriver.Respond(conn, natsdriver.JSONCodec, subject, queryQueue,
+		func(ctx context.Context, request QueryRequest) (QueryReply, error) {
+			reply, err := r.Answer(ctx, request)
+			return reply, queryReplyError(err)
+		})
+}
+
+// Answer answers request. Missing alerts return an error matching
+// ErrNotFound, malformed requests one matching ErrInvalidQuery.
+func (r *QueryResponder) Answer(ctx context.Context, request QueryRequest) (QueryReply, error) {
+	switch request.Op {
+	case QueryGetAlert:
+		if request.AlertID == "" {
+			return QueryReply{}, fmt.Errorf("%w: %s needs an alert id", ErrInvalidQuery, request.Op)
+		}
+		data, err := r.storage.Get(request.AlertID)
+		if err != nil {
+			return QueryReply{}, err
+		}
+		if _, err := alerts.AlertV2FromBytes(data); err != nil {
+			return QueryReply{}, fmt.Errorf("%w: %s is not an alert", ErrNotFound, request.AlertID)
+		}
+		return QueryReply{Alert: data}, nil
+
+	case QueryListFiring:
+		firing, err := r.firing(ctx, request.Labels)
+		if err != nil {
+			return QueryReply{}, err
+		}
+		reply := QueryReply{Alerts: make([]json.RawMessage, 0, len(firing))}
+		for _, alert := range firing {
+			reply.Alerts = append(reply.Alerts, alert.data)
+		}
+		return reply, nil
+
+	case QueryCountByLabel:
+		if request.Label == "" {
+			return QueryReply{}, fmt.Errorf("%w: %s needs a label", ErrInvalidQuery, request.Op)
+		}
+		firing, err := r.firing(ctx, request.Labels)
+		if err != nil {
+			return QueryReply{}, err
+		}
+		reply := QueryReply{Counts: make(map[string]int)}
+		for _, alert := range firing {
+			if value, ok := alert.Labels()[request.Label]; ok {
+				reply.Counts[value]++
+			}
+		}
+		return reply, nil
+	}
+	return QueryReply{}, fmt.Errorf("%w: unknown op %q", ErrInvalidQuery, request.Op)
+}
+
+type firingAlert struct {
+	*alerts.AlertV2
+	data []byte
+}
+
+// firing returns the firing alerts carrying labels, sorted by ID.
+func (r *QueryResponder) firing(ctx context.Context, labels map[string]string) ([]firingAlert, error) {
+	lister, ok := r.storage.(KeyLister)
+	if !ok {
+		return nil, fmt.Errorf("%w: storage cannot list keys", errors.ErrUnsupported)
+	}
+	keys, err := lister.List()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list alerts: %w", err)
+	}
+
+	var firing []firingAlert
+	for _, key := range keys {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		data, err := r.storage.Get(key)
+		if errors.Is(err, ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		// Other values, e.g. operator state, are skipped.
+		alert, err := alerts.AlertV2FromBytes(data)
+		if err != nil || !alert.IsFiring() || !matchLabels(alert.Labels(), labels) {
+			continue
+		}
+		firing = append(firing, firingAlert{AlertV2: alert, data: data})
+	}
+	sort.Slice(firing, func(i, j int) bool { return firing[i].ID() < firing[j].ID() })
+	return firing, nil
+}
+
+// queryReplyError maps Answer's errors to reply error codes.
+func queryReplyError(err error) error {
+	code := natsdriver.CodeInternal
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, ErrNotFound):
+		code = QueryCodeNotFound
+	case errors.Is(err, ErrInvalidQuery):
+		code = natsdriver.CodeBadRequest
+	case errors.Is(err, errors.ErrUnsupported):
+		code = QueryCodeUnsupported
+	}
+	return &natsdriver.ReplyError{Code: code, Message: err.Error()}
+}
+
+// QueryClient queries a QueryResponder. Errors replied by the responder
+// match ErrNotFound, ErrInvalidQuery and errors.ErrUnsupported like those of
+// QueryResponder.Answer.
+type QueryClient struct {
+	conn    *nats.Conn
+	subject string
+}
+
+// NewQueryClient creates a QueryClient for the responder on subject,
+// QuerySubject if empty.
+func NewQueryClient(conn *nats.Conn, subject string) *QueryClient {
+	if subject == "" {
+		subject = QuerySubject
+	}
+	return &QueryClient{conn: conn, subject: subject}
+}
+
+// GetAlert returns the stored alert alertID.
+func (c *QueryClient) GetAlert(ctx context.Context, alertID string) (*alerts.AlertV2, error) {
+	reply, err := c.query(ctx, QueryRequest{Op: QueryGetAlert, AlertID: alertID})
+	if err != nil {
+		return nil, err
+	}
+	return alerts.AlertV2FromBytes(reply.Alert)
+}
+
+// ListFiring returns the firing alerts carrying labels, sorted by ID.
+func (c *QueryClient) ListFiring(ctx context.Context, labels map[string]string) ([]*alerts.AlertV2, error) {
+	reply, err := c.query(ctx, QueryRequest{Op: QueryListFiring, Labels: labels})
+	if err != nil {
+		return nil, err
+	}
+	firing := make([]*alerts.AlertV2, 0, len(reply.Alerts))
+	for _, data := range reply.Alerts {
+		alert, err := alerts.AlertV2FromBytes(data)
+		if err != nil {
+			return nil, err
+		}
+		firing = append(firing, alert)
+	}
+	return firing, nil
+}
+
+// CountByLabel counts the firing alerts carrying labels by their value of
+// label.
+func (c *QueryClient) CountByLabel(ctx context.Context, label string, labels map[string]string) (map[string]int, error) {
+	reply, err := c.query(ctx, QueryRequest{Op: QueryCountByLabel, Label: label, Labels: labels})
+	if err != nil {
+		return nil, err
+	}
+	if reply.Counts == nil {
+		reply.Counts = map[string]int{}
+	}
+	return reply.Counts, nil
+}
+
+func (c *QueryClient) query(ctx context.Context, request QueryRequest) (QueryReply, error) {
+	reply, err := natsdriver.Request[QueryRequest, QueryReply](ctx, c.conn, natsdriver.JSONCodec, c.subject, request)
+	var replyErr *natsdriver.ReplyError
+	if !errors.As(err, &replyErr) {
+		return reply, err
+	}
+	switch replyErr.Code {
+	case QueryCodeNotFound:
+		return reply, queryError{replyErr, ErrNotFound}
+	case natsdriver.CodeBadRequest:
+		return reply, queryError{replyErr, ErrInvalidQuery}
+	case QueryCodeUnsupported:
+		return reply, queryError{replyErr, errors.ErrUnsupported}
+	}
+	return reply, err
+}
+
+// queryError is an error reply matching the error it was replied for.
+type queryError struct {
+	*natsdriver.ReplyError
+	cause error
+}
+
+func (e queryError) Unwrap() []error {
+	return []error{e.cause, e.ReplyError}
+}
@@ -0,0 +1,140 @@
+package alerting_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+
+	"github.com/avilikof/go-shared-libs/alerting"
+	"github.com/avilikof/go-shared-libs/alerting/alertingtest"
+	"github.com/avilikof/go-shared-libs/alerts"
+	natsdriver "github.com/avilikof/go-shared-libs/nats"
+)
+
+func newQueryStorage(t *testing.T) *alertingtest.Storage {
+	t.Helper()
+	storage := alertingtest.NewStorage(nil)
+	for _, a := range []struct {
+		id, team string
+		state    alerts.AlertState
+	}{
+		{"disk", "infra", alerts.AlertStateActive},
+		{"cpu", "infra", alerts.AlertStateActive},
+		{"checkout", "payments", alerts.AlertStateActive},
+		{"memory", "infra", alerts.AlertStateResolved},
+	} {
+		alert := alerts.NewAlertV2(a.id, "node-exporter", "critical", a.id, a.id, a.id, time.Now(), a.state)
+		alert.AddLabel("team", a.team)
+		data, _ := alert.MarshalJSON()
+		if err := storage.Set(a.id, data, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	_ = storage.Set("ack.disk", []byte(`{"by":"oncall"}`), 0)
+	return storage
+}
+
+func TestQueryResponder_Answer(t *testing.T) {
+	responder := alerting.NewQueryResponder(newQueryStorage(t))
+	ctx := context.Background()
+
+	reply, err := responder.Answer(ctx, alerting.QueryRequest{Op: alerting.QueryListFiring, Labels: map[string]string{"team": "infra"}})
+	if err != nil {
+		t.Fatalf("Answer(list-firing) error = %v", err)
+	}
+	var ids []string
+	for _, data := range reply.Alerts {
+		alert, _ := alerts.AlertV2FromBytes(data)
+		ids = append(ids, alert.ID())
+	}
+	if fmt.Sprint(ids) != "[cpu disk]" {
+		t.Errorf("list-firing = %v; want [cpu disk]", ids)
+	}
+
+	reply, err = responder.Answer(ctx, alerting.QueryRequest{Op: alerting.QueryCountByLabel, Label: "team"})
+	if err != nil || reply.Counts["infra"] != 2 || reply.Counts["payments"] != 1 {
+		t.Errorf("Answer(count-by-label) = %v, %v; want infra 2 and payments 1", reply.Counts, err)
+	}
+
+	for _, tc := range []struct {
+		request alerting.QueryRequest
+		want    error
+	}{
+		{alerting.QueryRequest{Op: alerting.QueryGetAlert, AlertID: "missing"}, alerting.ErrNotFound},
+		{alerting.QueryRequest{Op: alerting.QueryGetAlert, AlertID: "ack.disk"}, alerting.ErrNotFound},
+		{alerting.QueryRequest{Op: alerting.QueryCountByLabel}, alerting.ErrInvalidQuery},
+		{alerting.QueryRequest{Op: "delete"}, alerting.ErrInvalidQuery},
+	} {
+		if _, err := responder.Answer(ctx, tc.request); !errors.Is(err, tc.want) {
+			t.Errorf("Answer(%+v) error = %v; want %v", tc.request, err, tc.want)
+		}
+	}
+
+	unlisted := alerting.NewQueryResponder(struct{ alerting.Storage }{newQueryStorage(t)})
+	if _, err := unlisted.Answer(ctx, alerting.QueryRequest{Op: alerting.QueryListFiring}); !errors.Is(err, errors.ErrUnsupported) {
+		t.Errorf("Answer(list-firing) without KeyLister error = %v; want errors.ErrUnsupported", err)
+	}
+}
+
+func TestQueryClient(t *testing.T) {
+	requireNATS(t)
+	conn := newJetStreamHandler(t).Conn()
+	subject := fmt.Sprintf("alert.query.test-%d", time.Now().UnixNano())
+
+	sub, err := alerting.NewQueryResponder(newQueryStorage(t)).Serve(conn, subject)
+	if err != nil {
+		t.Fatalf("Serve() error = %v", err)
+	}
+	t.Cleanup(func() { _ = sub.Unsubscribe() })
+	client := alerting.NewQueryClient(conn, subject)
+	ctx := context.Background()
+
+	alert, err := client.GetAlert(ctx, "disk")
+	if err != nil || alert.ID() != "disk" || !alert.IsFiring() {
+		t.Errorf("GetAlert(disk) = %v, %v; want the firing alert", alert, err)
+	}
+	firing, err := client.ListFiring(ctx, map[string]string{"team": "payments"})
+	if err != nil || len(firing) != 1 || firing[0].ID() != "checkout" {
+		t.Errorf("ListFiring(team=payments) = %v, %v; want checkout", firing, err)
+	}
+	counts, err := client.CountByLabel(ctx, "team", nil)
+	if err != nil || counts["infra"] != 2 {
+		t.Errorf("CountByLabel(team) = %v, %v; want 2 infra", counts, err)
+	}
+
+	_, err = client.GetAlert(ctx, "missing")
+	var replyErr *natsdriver.ReplyError
+	if !errors.Is(err, alerting.ErrNotFound) || !errors.As(err, &replyErr) || replyErr.Code != alerting.QueryCodeNotFound {
+		t.Errorf("GetAlert(missing) error = %v; want a not_found reply matching ErrNotFound", err)
+	}
+	if _, err := client.CountByLabel(ctx, "", nil); !errors.Is(err, alerting.ErrInvalidQuery) {
+		t.Errorf("CountByLabel(\"\") error = %v; want ErrInvalidQuery", err)
+	}
+}
+
+func TestRequest_Timeouts(t *testing.T) {
+	requireNATS(t)
+	conn := newJetStreamHandler(t).Conn()
+	subject := fmt.Sprintf("alert.query.silent-%d", time.Now().UnixNano())
+
+	_, err := natsdriver.Request[alerting.QueryRequest, alerting.QueryReply](context.Background(), conn, natsdriver.JSONCodec, subject, alerting.QueryRequest{})
+	if !errors.Is(err, natsdriver.ErrNoResponders) {
+		t.Errorf("Request() without responders error = %v; want ErrNoResponders", err)
+	}
+
+	sub, err := conn.Subscribe(subject, func(*nats.Msg) {})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = sub.Unsubscribe() })
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	_, err = natsdriver.Request[alerting.QueryRequest, alerting.QueryReply](ctx, conn, natsdriver.JSONCodec, subject, alerting.QueryRequest{})
+	if !errors.Is(err, natsdriver.ErrRequestTimeout) {
+		t.Errorf("Request() to a silent responder error = %v; want ErrRequestTimeout", err)
+	}
+}
@@ -0,0 +1,101 @@
+package alerting
+
+import (
+	"fmt"
+	"time"
+
+	redisdriver "github.com/avilikof/go-shared-libs/redis"
+)
+
+// acquireLeaseScript takes the lease in KEYS[1] for ARGV[1] with a TTL of
+// ARGV[2] milliseconds unless another holder has it, drawing the fencing
+// token from the counter in KEYS[2]. It returns the token, or 0 and the
+// current holder.
+const acquireLeaseScript = `
+local current = redis.call('GET', KEYS[1])
+if current then
+	local holder = string.match(current, '^(.*):%d+$')
+	if holder ~= ARGV[1] then
+		return {0, holder}
+	end
+end
+local token = redis.call('INCR', KEYS[2])
+redis.call('SET', KEYS[1], ARGV[1] .. ':' .. token, 'PX', ARGV[2])
+return {token, ARGV[1]}
+`
+
+// renewLeaseScript extends the lease in KEYS[1] to ARGV[2] milliseconds if
+// it still holds the term ARGV[1].
+const renewLeaseScript = `
+if redis.call('GET', KEYS[1]) ~= ARGV[1] then
+	return 0
+end
+redis.call('PEXPIRE', KEYS[1], ARGV[2])
+return 1
+`
+
+// releaseLeaseScript deletes the lease in KEYS[1] if it still holds the term
+// ARGV[1].
+const releaseLeaseScript = `
+if redis.call('GET', KEYS[1]) ~= ARGV[1] then
+	return 0
+end
+redis.call('DEL', KEYS[1])
+return 1
+`
+
+// RedisLeaseStore is a LeaseStore backed by Redis. Leases expire on the
+// server, so unlike JetStreamLeaseStore expiry does not depend on the
+// clocks of the competing instances. Fencing tokens come from a counter
+// stored next to each lease.
+type RedisLeaseStore struct {
+	driver *redisdriver.Driver
+	prefix string
+}
+
+// NewRedisLeaseStore creates a RedisLeaseStore storing every lease as
+// prefix+name. The driver is not closed by the store.
+func NewRedisLeaseStore(driver *redisdriver.Driver, prefix string) *RedisLeaseStore {
+	return &RedisLeaseStore{
+		driver: driver,
+		prefix: prefix,
+	}
+}
+
+func (s *RedisLeaseStore) Acquire(name, holder string, ttl time.Duration) (Lease, error) {
+	key := s.prefix + name
+	reply, err := s.driver.Eval(acquireLeaseScript, []string{key, key + ":token"}, holder, ttl.Milliseconds())
+	if err != nil {
+		return Lease{}, fmt.Errorf("failed to acquire lease %s: %w", name, err)
+	}
+	values, ok := reply.([]any)
+	if !ok || len(values) != 2 {
+		return Lease{}, fmt.Errorf("failed to acquire lease %s: unexpected reply %v", name, reply)
+	}
+	token, _ := values[0].(int64)
+	if token == 0 {
+		return Lease{}, fmt.Errorf("%w: %s is held by %v", ErrLeaseHeld, name, values[1])
+	}
+	return Lease{Name: name, Holder: holder, Token: uint64(token)}, nil
+}
+
+func (s *RedisLeaseStore) Renew(lease Lease, ttl time.Duration) (Lease, error) {
+	return lease, s.eval("renew", renewLeaseScript, lease, ttl.Milliseconds())
+}
+
+func (s *RedisLeaseStore) Release(lease Lease) error {
+	return s.eval("release", releaseLeaseScript, lease)
+}
+
+// eval runs a script guarded by the term of lease.
+func (s *RedisLeaseStore) eval(op, script string, lease Lease, args ...any) error {
+	term := fmt.Sprintf("%s:%d", lease.Holder, lease.Token)
+	reply, err := s.driver.Eval(script, []string{s.prefix + lease.Name}, append([]any{term}, args...)...)
+	if err != nil {
+		return fmt.Errorf("failed to %s lease %s: %w", op, lease.Name, err)
+	}
+	if reply != int64(1) {
+		return fmt.Errorf("%w: %s was taken over", ErrLeaseLost, lease.Name)
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+package alerting
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	redisdriver "github.com/avilikof/go-shared-libs/redis"
+)
+
+// RedisStorage is a Storage backed by Redis. Unlike JetStream KV it honours
+// the per-key expiration passed to Set. Keys are namespaced with a prefix so
+// that several processors can share one Redis database.
+type RedisStorage struct {
+	driver *redisdriver.Driver
+	prefix string
+	closed atomic.Bool
+}
+
+// NewRedisStorage creates a RedisStorage storing every key as prefix+key.
+// The storage takes ownership of driver and closes it on Close.
+func NewRedisStorage(driver *redisdriver.Driver, prefix string) *RedisStorage {
+	return &RedisStorage{
+		driver: driver,
+		prefix: prefix,
+	}
+}
+
+func (rs *RedisStorage) Get(key string) ([]byte, error) {
+	if rs.closed.Load() {
+		return nil, ErrClosed
+	}
+	value, err := rs.driver.Get(rs.prefix + key)
+	if errors.Is(err, redisdriver.ErrKeyNotFound) {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, key)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get key %s: %w", key, err)
+	}
+	return value, nil
+}
+
+// Set stores value under key. A zero expires keeps the key until deleted.
+func (rs *RedisStorage) Set(key string, value []byte, expires time.Duration) error {
+	if rs.closed.Load() {
+		return ErrClosed
+	}
+	if err := rs.driver.Set(rs.prefix+key, value, expires); err != nil {
+		return fmt.Errorf("failed to set key %s: %w", key, err)
+	}
+	return nil
+}
+
+// Delete removes key. Deleting a missing key is not an error.
+func (rs *RedisStorage) Delete(key string) error {
+	if rs.closed.Load() {
+		return ErrClosed
+	}
+	if err := rs.driver.Delete(rs.prefix + key); err != nil {
+		return fmt.Errorf("failed to delete key %s: %w", key, err)
+	}
+	return nil
+}
+
+// List returns the sorted keys in the storage's namespace, without prefix.
+func (rs *RedisStorage) List() ([]string, error) {
+	if rs.closed.Load() {
+		return nil, ErrClosed
+	}
+	keys, err := rs.driver.Keys(escapeGlob(rs.prefix) + "*")
+	if err != nil {
+		return nil, err
+	}
+	for i, key := range keys {
+		keys[i] = strings.TrimPrefix(key, rs.prefix)
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// Close closes the underlying driver.
+func (rs *RedisStorage) Close() error {
+	if rs.closed.Swap(true) {
+		return nil
+	}
+	return rs.driver.Close()
+}
+
+// escapeGlob escapes the characters Redis treats as glob patterns.
+func escapeGlob(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "*", `\*`, "?", `\?`, "[", `\[`, "]", `\]`).Replace(s)
+}
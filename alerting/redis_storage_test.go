@@ -0,0 +1,68 @@
+package alerting_test
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+
+	"github.com/avilikof/go-shared-libs/alerting"
+	"github.com/avilikof/go-shared-libs/alerting/alertingtest"
+	redisdriver "github.com/avilikof/go-shared-libs/redis"
+)
+
+func newRedisStorage(t *testing.T, server *miniredis.Miniredis, prefix string) *alerting.RedisStorage {
+	t.Helper()
+	driver, err := redisdriver.NewDriver(server.Addr(), 0)
+	if err != nil {
+		t.Fatalf("NewDriver() error = %v", err)
+	}
+	storage := alerting.NewRedisStorage(driver, prefix)
+	t.Cleanup(func() { storage.Close() })
+	return storage
+}
+
+func TestRedisStorageConformance(t *testing.T) {
+	server := miniredis.RunT(t)
+	alertingtest.RunStorageSuite(t, alertingtest.StorageSuite{
+		New: func(t *testing.T) alerting.Storage {
+			return newRedisStorage(t, server, "alerts:")
+		},
+		Wait: server.FastForward,
+	})
+}
+
+func TestRedisStorage_Namespaces(t *testing.T) {
+	server := miniredis.RunT(t)
+	teamA := newRedisStorage(t, server, "team-a:")
+	teamB := newRedisStorage(t, server, "team-b:")
+
+	if err := teamA.Set("cpu", []byte("a"), time.Hour); err != nil {
+		t.Fatalf("Set() error = %v", err)
+	}
+	if err := teamA.Set("disk", []byte("a"), 0); err != nil {
+		t.Fatalf("Set() error = %v", err)
+	}
+	if err := teamB.Set("cpu", []byte("b"), 0); err != nil {
+		t.Fatalf("Set() error = %v", err)
+	}
+
+	keys, err := teamA.List()
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	if !reflect.DeepEqual(keys, []string{"cpu", "disk"}) {
+		t.Errorf("List() = %v; want [cpu disk]", keys)
+	}
+	if ttl := server.TTL("team-a:cpu"); ttl != time.Hour {
+		t.Errorf("TTL of team-a:cpu = %s; want 1h", ttl)
+	}
+
+	if err := teamA.Delete("cpu"); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	if got, err := teamB.Get("cpu"); err != nil || string(got) != "b" {
+		t.Errorf("Get() from another namespace = %q, %v; want b", got, err)
+	}
+}
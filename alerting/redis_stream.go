@@ -0,0 +1,240 @@
+package alerting
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	redisdriver "github.com/avilikof/go-shared-libs/redis"
+)
+
+const (
+	// redisStreamDataField is the stream entry field carrying the message
+	// payload.
+	redisStreamDataField = "data"
+	// redisStreamHeaderPrefix starts the stream entry fields carrying message
+	// headers.
+	redisStreamHeaderPrefix = "header:"
+)
+
+// RedisStreamConfig configures a RedisStream. Zero values fall back to the
+// defaults noted on each field.
+type RedisStreamConfig struct {
+	// KeyPrefix is prepended to topics to form stream keys. Default "stream:".
+	KeyPrefix string
+	// Group names the consumer groups of subscriptions without WithGroup:
+	// the first subscription of a topic reads through Group, further
+	// concurrent ones through Group-2, Group-3, ... Default "alerting".
+	Group string
+	// Consumer names this subscriber within the group. Default hostname-pid.
+	Consumer string
+	// MaxLen trims every stream to about this many entries. Zero disables
+	// trimming.
+	MaxLen int64
+	// Batch is the number of entries read per call. Default 10.
+	Batch int64
+	// Block is how long a read waits for new entries. Default one second.
+	Block time.Duration
+	// ClaimIdle is how long an entry may stay unacknowledged before another
+	// consumer reclaims it. Default 30 seconds.
+	ClaimIdle time.Duration
+}
+
+// RedisStream is a Stream on Redis Streams. Subscribers read through a
+// consumer group, so every message is delivered to one subscriber of the
+// group, and entries left unacknowledged by a crashed consumer are reclaimed
+// after ClaimIdle. Each subscription has a group of its own unless
+// WithGroup shares one. SubscribeMsg acknowledges an entry only after its
+// handler succeeded, so a Processor subscribed with its HandleMsg or
+// HandleMsgV2 handler processes every entry at least once, e.g.
+//
+//	alerting.SubscribeMsg(stream, "test.alert", processor.HandleMsgV2)
+//
+// Subscribe acknowledges entries as soon as they are handed to the channel,
+// before the receiver processed them.
+type RedisStream struct {
+	driver *redisdriver.Driver
+	config RedisStreamConfig
+
+	groups groupSlots
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+	closed atomic.Bool
+}
+
+// NewRedisStream creates a RedisStream. The stream takes ownership of driver
+// and closes it on Close.
+func NewRedisStream(driver *redisdriver.Driver, config RedisStreamConfig) *RedisStream {
+	if config.KeyPrefix == "" {
+		config.KeyPrefix = "stream:"
+	}
+	if config.Group == "" {
+		config.Group = "alerting"
+	}
+	if config.Consumer == "" {
+		hostname, _ := os.Hostname()
+		config.Consumer = fmt.Sprintf("%s-%d", hostname, os.Getpid())
+	}
+	if config.Batch <= 0 {
+		config.Batch = 10
+	}
+	if config.Block <= 0 {
+		config.Block = time.Second
+	}
+	if config.ClaimIdle <= 0 {
+		config.ClaimIdle = 30 * time.Second
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	return &RedisStream{
+		driver: driver,
+		config: config,
+		ctx:    ctx,
+		cancel: cancel,
+	}
+}
+
+// Publish appends data to the topic's stream, trimming it to MaxLen.
+func (rs *RedisStream) Publish(topic string, data []byte) error {
+	return rs.PublishMsg(context.Background(), &Message{Subject: topic, Data: data})
+}
+
+// PublishMsg is Publish with msg's headers as "header:<key>" fields of the
+// entry. ctx is only checked before publishing.
+func (rs *RedisStream) PublishMsg(ctx context.Context, msg *Message) error {
+	if rs.closed.Load() {
+		return ErrClosed
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	values := map[string]any{redisStreamDataField: msg.Data}
+	for key, value := range msg.Header {
+		values[redisStreamHeaderPrefix+key] = value
+	}
+	_, err := rs.driver.StreamAdd(rs.config.KeyPrefix+msg.Subject, rs.config.MaxLen, values)
+	return err
+}
+
+// Subscribe joins the consumer group of the topic's stream and forwards
+// entries to channel from a background goroutine. Entries are acknowledged
+// once they have been handed to channel, before the receiver processed them;
+// subscribe a Processor with SubscribeMsg instead. The group starts at the
+// beginning of the stream when it is first created. Entries are read at the
+// pace of channel, so SubscribeOptions but WithGroup do not apply.
+func (rs *RedisStream) Subscribe(topic string, channel chan []byte, opts ...SubscribeOption) (Subscription, error) {
+	return rs.SubscribeMsg(topic, channelHandler(channel), opts...)
+}
+
+// SubscribeMsg is Subscribe calling handler with the entries and their
+// headers. Entries are acknowledged once handler returns nil; entries it
+// fails are left unacknowledged and reclaimed after ClaimIdle.
+func (rs *RedisStream) SubscribeMsg(topic string, handler MessageHandler, opts ...SubscribeOption) (Subscription, error) {
+	if rs.closed.Load() {
+		return nil, ErrClosed
+	}
+	stream := rs.config.KeyPrefix + topic
+	group, release := rs.groups.group(topic, rs.config.Group, newSubscribeOptions(opts))
+	if err := rs.driver.StreamCreateGroup(stream, group, "0"); err != nil {
+		release()
+		return nil, err
+	}
+
+	sub := newLoopSubscription(rs.ctx)
+	rs.wg.Add(1)
+	go func() {
+		defer rs.wg.Done()
+		defer close(sub.done)
+		defer release()
+		rs.consume(sub, topic, stream, group, handler)
+	}()
+	return sub, nil
+}
+
+// Close stops all subscriptions and closes the driver.
+func (rs *RedisStream) Close() error {
+	if rs.closed.Swap(true) {
+		return nil
+	}
+	rs.cancel()
+	rs.wg.Wait()
+	return rs.driver.Close()
+}
+
+func (rs *RedisStream) consume(sub *loopSubscription, topic, stream, group string, handler MessageHandler) {
+	claimCursor := "0-0"
+	nextClaim := time.Now()
+
+	for sub.running() {
+		var messages []redisdriver.StreamMessage
+		var err error
+
+		if time.Now().After(nextClaim) {
+			messages, claimCursor, err = rs.driver.StreamAutoClaim(sub.ctx, stream, group, rs.config.Consumer,
+				rs.config.ClaimIdle, claimCursor, rs.config.Batch)
+			if claimCursor == "0-0" || err != nil {
+				claimCursor = "0-0"
+				nextClaim = time.Now().Add(rs.config.ClaimIdle / 2)
+			}
+		}
+		if err == nil && len(messages) == 0 {
+			messages, err = rs.driver.StreamReadGroup(sub.ctx, stream, group, rs.config.Consumer,
+				rs.config.Batch, rs.config.Block)
+		}
+		if err != nil {
+			if sub.ctx.Err() != nil {
+				return
+			}
+			fmt.Printf("Redis stream :: %s :: %v\n", stream, err)
+			sleep(sub.ctx, time.Second)
+			continue
+		}
+
+		for _, entry := range messages {
+			if msg, ok := redisMessage(topic, entry); ok {
+				if err := handler(sub.ctx, msg); err != nil {
+					if sub.ctx.Err() != nil {
+						return
+					}
+					fmt.Printf("Redis stream :: %s :: %v\n", stream, err)
+					continue
+				}
+				sub.counters.delivered.Add(1)
+			}
+			if err := rs.driver.StreamAck(stream, group, entry.ID); err != nil {
+				fmt.Printf("Redis stream :: %s :: %v\n", stream, err)
+			}
+		}
+	}
+}
+
+// redisMessage converts a stream entry, reporting false for entries without
+// a payload.
+func redisMessage(topic string, entry redisdriver.StreamMessage) (*Message, bool) {
+	data, ok := entry.Values[redisStreamDataField]
+	if !ok {
+		return nil, false
+	}
+	msg := &Message{Subject: topic, Data: []byte(data)}
+	for field, value := range entry.Values {
+		if key, ok := strings.CutPrefix(field, redisStreamHeaderPrefix); ok {
+			if msg.Header == nil {
+				msg.Header = Header{}
+			}
+			msg.Header[key] = value
+		}
+	}
+	return msg, true
+}
+
+func sleep(ctx context.Context, d time.Duration) {
+	select {
+	case <-time.After(d):
+	case <-ctx.Done():
+	}
+}
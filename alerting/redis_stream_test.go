@@ -0,0 +1,147 @@
+package alerting_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+
+	"github.com/avilikof/go-shared-libs/alerting"
+	"github.com/avilikof/go-shared-libs/alerting/alertingtest"
+	"github.com/avilikof/go-shared-libs/alerts"
+	redisdriver "github.com/avilikof/go-shared-libs/redis"
+)
+
+func newRedisDriver(t *testing.T, server *miniredis.Miniredis) *redisdriver.Driver {
+	t.Helper()
+	driver, err := redisdriver.NewDriver(server.Addr(), 0)
+	if err != nil {
+		t.Fatalf("NewDriver() error = %v", err)
+	}
+	return driver
+}
+
+func TestRedisStreamConformance(t *testing.T) {
+	server := miniredis.RunT(t)
+	alertingtest.RunStreamSuite(t, alertingtest.StreamSuite{
+		New: func(t *testing.T) alerting.Stream {
+			stream := alerting.NewRedisStream(newRedisDriver(t, server), alerting.RedisStreamConfig{
+				Group: t.Name(),
+				Block: 50 * time.Millisecond,
+			})
+			t.Cleanup(func() { stream.Close() })
+			return stream
+		},
+	})
+}
+
+func TestRedisStream_TrimsAndReclaims(t *testing.T) {
+	server := miniredis.RunT(t)
+	config := alerting.RedisStreamConfig{
+		MaxLen:    5,
+		Block:     50 * time.Millisecond,
+		ClaimIdle: 20 * time.Millisecond,
+	}
+
+	publisher := alerting.NewRedisStream(newRedisDriver(t, server), config)
+	defer publisher.Close()
+	if _, err := publisher.Subscribe("alert.store", make(chan []byte)); err != nil {
+		t.Fatalf("Subscribe() error = %v", err)
+	}
+	publisher.Close()
+
+	// A consumer that reads an entry and crashes before acknowledging it.
+	crashed := newRedisDriver(t, server)
+	defer crashed.Close()
+	if _, err := crashed.StreamAdd("stream:alert.store", 0, map[string]any{"data": "orphaned"}); err != nil {
+		t.Fatalf("StreamAdd() error = %v", err)
+	}
+	pending, err := crashed.StreamReadGroup(t.Context(), "stream:alert.store", "alerting", "crashed", 10, 0)
+	if err != nil || len(pending) != 1 {
+		t.Fatalf("StreamReadGroup() = %v, %v; want the orphaned entry", pending, err)
+	}
+	time.Sleep(2 * config.ClaimIdle)
+
+	subscriber := alerting.NewRedisStream(newRedisDriver(t, server), config)
+	defer subscriber.Close()
+	received := make(chan []byte, 1)
+	if _, err := subscriber.Subscribe("alert.store", received); err != nil {
+		t.Fatalf("Subscribe() error = %v", err)
+	}
+	select {
+	case data := <-received:
+		if string(data) != "orphaned" {
+			t.Errorf("received %q; want the reclaimed entry", data)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for the pending entry to be reclaimed")
+	}
+
+	for i := 0; i < 20; i++ {
+		if err := subscriber.Publish("trimmed", []byte("x")); err != nil {
+			t.Fatalf("Publish() error = %v", err)
+		}
+	}
+	entries, err := server.Stream("stream:trimmed")
+	if err != nil {
+		t.Fatalf("Stream() error = %v", err)
+	}
+	if len(entries) > 5 {
+		t.Errorf("stream has %d entries; want at most MaxLen 5", len(entries))
+	}
+}
+
+func TestRedisStream_RedeliversAlertsTheProcessorFailed(t *testing.T) {
+	firing, _ := alerts.NewAlertV2("disk", "node-exporter", "critical", "disk_full", "disk", "disk", time.Now(), alerts.AlertStateActive).MarshalJSON()
+	tests := map[string]struct {
+		data    []byte
+		handler func(alerting.Storage, alerting.Stream) alerting.MessageHandler
+	}{
+		"v1": {
+			data: alerts.NewAlert("disk", "disk", "disk full", time.Now(), true).Bytes(),
+			handler: func(storage alerting.Storage, stream alerting.Stream) alerting.MessageHandler {
+				return alerting.NewProcessor(nil, storage, stream).HandleMsg
+			},
+		},
+		"v2": {
+			data: firing,
+			handler: func(storage alerting.Storage, stream alerting.Stream) alerting.MessageHandler {
+				return alerting.NewProcessorV2(nil, storage, stream).HandleMsgV2
+			},
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			server := miniredis.RunT(t)
+			stream := alerting.NewRedisStream(newRedisDriver(t, server), alerting.RedisStreamConfig{
+				Block:     50 * time.Millisecond,
+				ClaimIdle: 50 * time.Millisecond,
+			})
+			defer stream.Close()
+
+			storage := alertingtest.NewStorage(nil)
+			output := alertingtest.NewStream()
+			output.Persist(storage, 0)
+			t.Cleanup(output.Close)
+			// The first attempt fails to store the alert.
+			handler := tt.handler(storage, &flakyStream{Stream: output, failures: 1})
+			if _, err := stream.SubscribeMsg("test.alert", handler); err != nil {
+				t.Fatalf("SubscribeMsg() error = %v", err)
+			}
+			if err := stream.Publish("test.alert", tt.data); err != nil {
+				t.Fatalf("Publish() error = %v", err)
+			}
+
+			deadline := time.Now().Add(2 * time.Second)
+			for {
+				if _, err := storage.Get("disk"); err == nil {
+					return
+				}
+				if time.Now().After(deadline) {
+					t.Fatal("the alert was not stored after its entry was reclaimed")
+				}
+				time.Sleep(10 * time.Millisecond)
+			}
+		})
+	}
+}
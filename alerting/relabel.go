@@ -0,0 +1,146 @@
+package alerting
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/avilikof/go-shared-libs/alerts"
+)
+
+var ErrInvalidRelabelConfig = errors.New("invalid relabel config")
+
+// RelabelAction is the action of a RelabelConfig.
+type RelabelAction string
+
+const (
+	// RelabelReplace sets TargetLabel to Replacement, expanded with the
+	// groups of Regex, if Regex matches the source value. An empty result
+	// removes TargetLabel.
+	RelabelReplace RelabelAction = "replace"
+	// RelabelKeep drops alerts whose source value does not match Regex.
+	RelabelKeep RelabelAction = "keep"
+	// RelabelDrop drops alerts whose source value matches Regex.
+	RelabelDrop RelabelAction = "drop"
+	// RelabelLabelMap copies every label whose name matches Regex to the
+	// label named by Replacement.
+	RelabelLabelMap RelabelAction = "labelmap"
+	// RelabelLabelDrop removes every label whose name matches Regex.
+	RelabelLabelDrop RelabelAction = "labeldrop"
+	// RelabelLabelKeep removes every label whose name does not match Regex.
+	RelabelLabelKeep RelabelAction = "labelkeep"
+)
+
+// RelabelConfig rewrites the labels of alerts the way Prometheus
+// relabel_configs rewrite target labels. The source value is the values of
+// SourceLabels, which may name pseudo-labels such as FieldType, joined with
+// Separator. Regex is anchored at both ends.
+type RelabelConfig struct {
+	SourceLabels []string      `json:"source_labels,omitempty" yaml:"source_labels"`
+	Separator    string        `json:"separator,omitempty" yaml:"separator"`
+	Regex        string        `json:"regex,omitempty" yaml:"regex"`
+	TargetLabel  string        `json:"target_label,omitempty" yaml:"target_label"`
+	Replacement  string        `json:"replacement,omitempty" yaml:"replacement"`
+	Action       RelabelAction `json:"action,omitempty" yaml:"action"`
+}
+
+type relabelRule struct {
+	RelabelConfig
+	regex *regexp.Regexp
+}
+
+// Relabeler applies relabel configs in order.
+type Relabeler struct {
+	rules []relabelRule
+}
+
+// NewRelabeler validates configs and applies the Prometheus defaults: a
+// separator of ";", a regex of "(.*)", a replacement of "$1" and the replace
+// action.
+func NewRelabeler(configs ...RelabelConfig) (*Relabeler, error) {
+	relabeler := &Relabeler{}
+	for i, config := range configs {
+		if config.Separator == "" {
+			config.Separator = ";"
+		}
+		if config.Regex == "" {
+			config.Regex = "(.*)"
+		}
+		if config.Replacement == "" {
+			config.Replacement = "$1"
+		}
+		if config.Action == "" {
+			config.Action = RelabelReplace
+		}
+
+		regex, err := regexp.Compile("^(?:" + config.Regex + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("%w: config %d: %v", ErrInvalidRelabelConfig, i, err)
+		}
+		switch config.Action {
+		case RelabelReplace:
+			if config.TargetLabel == "" {
+				return nil, fmt.Errorf("%w: config %d: replace needs a target_label", ErrInvalidRelabelConfig, i)
+			}
+		case RelabelKeep, RelabelDrop, RelabelLabelMap, RelabelLabelDrop, RelabelLabelKeep:
+		default:
+			return nil, fmt.Errorf("%w: config %d: unknown action %q", ErrInvalidRelabelConfig, i, config.Action)
+		}
+		relabeler.rules = append(relabeler.rules, relabelRule{RelabelConfig: config, regex: regex})
+	}
+	return relabeler, nil
+}
+
+func (r *Relabeler) Process(alert *alerts.AlertV2) (*alerts.AlertV2, error) {
+	for _, rule := range r.rules {
+		if !rule.apply(alert) {
+			return nil, nil
+		}
+	}
+	return alert, nil
+}
+
+// apply rewrites alert and reports whether it is kept.
+func (r relabelRule) apply(alert *alerts.AlertV2) bool {
+	values := make([]string, len(r.SourceLabels))
+	for i, name := range r.SourceLabels {
+		values[i] = alertField(alert, name)
+	}
+	source := strings.Join(values, r.Separator)
+
+	switch r.Action {
+	case RelabelKeep:
+		return r.regex.MatchString(source)
+	case RelabelDrop:
+		return !r.regex.MatchString(source)
+	case RelabelReplace:
+		match := r.regex.FindStringSubmatchIndex(source)
+		if match == nil {
+			return true
+		}
+		value := string(r.regex.ExpandString(nil, r.Replacement, source, match))
+		if value == "" {
+			alert.RemoveLabel(r.TargetLabel)
+		} else {
+			alert.AddLabel(r.TargetLabel, value)
+		}
+	case RelabelLabelMap:
+		mapped := make(map[string]string)
+		for name, value := range alert.Labels() {
+			if match := r.regex.FindStringSubmatchIndex(name); match != nil {
+				mapped[string(r.regex.ExpandString(nil, r.Replacement, name, match))] = value
+			}
+		}
+		for name, value := range mapped {
+			alert.AddLabel(name, value)
+		}
+	case RelabelLabelDrop, RelabelLabelKeep:
+		for name := range alert.Labels() {
+			if r.regex.MatchString(name) == (r.Action == RelabelLabelDrop) {
+				alert.RemoveLabel(name)
+			}
+		}
+	}
+	return true
+}
@@ -0,0 +1,364 @@
+package alerting
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/avilikof/go-shared-libs/alerts"
+)
+
+// RuleSource is the source of alerts raised by a RuleEvaluator.
+const RuleSource = "rule_evaluator"
+
+const (
+	// defaultRuleInterval is the Run interval used when none is given.
+	defaultRuleInterval = 10 * time.Second
+	// minRuleAbsent is the shortest default Absent timeout of a rule.
+	minRuleAbsent = 5 * time.Minute
+)
+
+var ErrInvalidRule = errors.New("invalid rule")
+
+// MetricSample is one value of a metric series, published as JSON on the
+// subject a RuleEvaluator consumes:
+//
+//	{"name": "queue_depth", "labels": {"queue": "billing"}, "value": 1200}
+type MetricSample struct {
+	Name   string            `json:"name"`
+	Labels map[string]string `json:"labels,omitempty"`
+	Value  float64           `json:"value"`
+}
+
+// Comparison compares a sample value with a rule threshold.
+type Comparison string
+
+const (
+	GreaterThan    Comparison = ">"
+	GreaterOrEqual Comparison = ">="
+	LessThan       Comparison = "<"
+	LessOrEqual    Comparison = "<="
+	Equal          Comparison = "=="
+	NotEqual       Comparison = "!="
+)
+
+func (c Comparison) compare(value, threshold float64) bool {
+	switch c {
+	case GreaterThan:
+		return value > threshold
+	case GreaterOrEqual:
+		return value >= threshold
+	case LessThan:
+		return value < threshold
+	case LessOrEqual:
+		return value <= threshold
+	case Equal:
+		return value == threshold
+	case NotEqual:
+		return value != threshold
+	}
+	return false
+}
+
+// Rule raises an alert for every series of Metric carrying all of Matchers
+// whose value has satisfied the comparison with Threshold for at least For.
+// The alert is resolved by the first sample of the series that no longer
+// satisfies it, or once the series has sent no sample for Absent.
+type Rule struct {
+	Name       string            `json:"name" yaml:"name"`
+	Metric     string            `json:"metric" yaml:"metric"`
+	Matchers   map[string]string `json:"matchers,omitempty" yaml:"matchers"`
+	Comparison Comparison        `json:"comparison" yaml:"comparison"`
+	Threshold  float64           `json:"threshold" yaml:"threshold"`
+	For        time.Duration     `json:"for,omitempty" yaml:"for"`
+	// Absent is how long a series may send no samples before it is
+	// forgotten and its alert resolved. Default three times For, at least
+	// five minutes.
+	Absent      time.Duration     `json:"absent,omitempty" yaml:"absent"`
+	Severity    string            `json:"severity,omitempty" yaml:"severity"`
+	Labels      map[string]string `json:"labels,omitempty" yaml:"labels"`
+	Annotations map[string]string `json:"annotations,omitempty" yaml:"annotations"`
+}
+
+func (r Rule) matches(sample MetricSample) bool {
+	return r.Metric == sample.Name && matchLabels(sample.Labels, r.Matchers)
+}
+
+// LoadRules reads threshold rules from a YAML file:
+//
+//	rules:
+//	  - name: queue_backlog
+//	    metric: queue_depth
+//	    matchers: {queue: billing}
+//	    comparison: ">"
+//	    threshold: 1000
+//	    for: 5m
+//	    severity: warning
+//	    annotations:
+//	      runbook_url: https://runbooks.example.com/queue-backlog
+func LoadRules(path string) ([]Rule, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read rules %s: %w", path, err)
+	}
+	var file struct {
+		Rules []Rule `yaml:"rules"`
+	}
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("%w: %s: %v", ErrInvalidRule, path, err)
+	}
+	return file.Rules, nil
+}
+
+type ruleState int
+
+const (
+	rulePending ruleState = iota
+	ruleFiring
+)
+
+// seriesState tracks one series of one rule while its condition holds.
+type seriesState struct {
+	rule     *Rule
+	labels   map[string]string
+	state    ruleState
+	activeAt time.Time
+	seenAt   time.Time
+	value    float64
+}
+
+// RuleEvaluator turns metric samples into alerts. A series whose sample
+// satisfies a rule becomes pending; once the condition has held for the
+// rule's For duration a firing AlertV2 is sent to output, normally the input
+// of a Processor created with NewProcessorV2, and the alert is resolved when
+// the condition stops holding. Firing alerts are resent on every evaluation,
+// so that a Processor with a StaleTracker does not resolve them as stale.
+type RuleEvaluator struct {
+	mu      sync.Mutex
+	stream  Stream
+	subject string
+	output  chan<- *alerts.AlertV2
+	rules   []Rule
+	series  map[string]*seriesState
+	now     func() time.Time
+}
+
+// NewRuleEvaluator validates rules and creates a RuleEvaluator that consumes
+// samples published on subject.
+func NewRuleEvaluator(stream Stream, subject string, output chan<- *alerts.AlertV2, rules ...Rule) (*RuleEvaluator, error) {
+	rules = append([]Rule(nil), rules...)
+	names := make(map[string]bool, len(rules))
+	for i := range rules {
+		rule := &rules[i]
+		if rule.Name == "" || rule.Metric == "" {
+			return nil, fmt.Errorf("%w: rule %d: name and metric are required", ErrInvalidRule, i)
+		}
+		if names[rule.Name] {
+			return nil, fmt.Errorf("%w: duplicate rule %s", ErrInvalidRule, rule.Name)
+		}
+		names[rule.Name] = true
+		switch rule.Comparison {
+		case GreaterThan, GreaterOrEqual, LessThan, LessOrEqual, Equal, NotEqual:
+		default:
+			return nil, fmt.Errorf("%w: %s: unknown comparison %q", ErrInvalidRule, rule.Name, rule.Comparison)
+		}
+		if rule.For < 0 {
+			return nil, fmt.Errorf("%w: %s: for must not be negative", ErrInvalidRule, rule.Name)
+		}
+		if rule.Absent < 0 {
+			return nil, fmt.Errorf("%w: %s: absent must not be negative", ErrInvalidRule, rule.Name)
+		}
+		if rule.Absent == 0 {
+			rule.Absent = max(3*rule.For, minRuleAbsent)
+		}
+		if rule.Severity == "" {
+			rule.Severity = "warning"
+		}
+	}
+
+	return &RuleEvaluator{
+		stream:  stream,
+		subject: subject,
+		output:  output,
+		rules:   rules,
+		series:  make(map[string]*seriesState),
+		now:     time.Now,
+	}, nil
+}
+
+// Run consumes samples and evaluates the series every interval until ctx is
+// cancelled. A non-positive interval defaults to ten seconds; it must be
+// shorter than the stale timeout of the rule alerts.
+func (e *RuleEvaluator) Run(ctx context.Context, interval time.Duration) error {
+	if interval <= 0 {
+		interval = defaultRuleInterval
+	}
+	messages := make(chan []byte)
+	sub, err := e.stream.Subscribe(e.subject, messages)
+	if err != nil {
+		return fmt.Errorf("failed to subscribe to %s: %w", e.subject, err)
+	}
+	defer sub.Unsubscribe()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case data := <-messages:
+			var sample MetricSample
+			if err := json.Unmarshal(data, &sample); err != nil {
+				fmt.Printf("Rules :: invalid metric sample: %v\n", err)
+				continue
+			}
+			e.Observe(ctx, sample)
+		case <-ticker.C:
+			e.Evaluate(ctx)
+		}
+	}
+}
+
+// Observe evaluates sample against every matching rule. Sending the
+// resulting alerts stops when ctx is done.
+func (e *RuleEvaluator) Observe(ctx context.Context, sample MetricSample) {
+	now := e.now()
+
+	var changed []*alerts.AlertV2
+	e.mu.Lock()
+	for i := range e.rules {
+		rule := &e.rules[i]
+		if !rule.matches(sample) {
+			continue
+		}
+		key := rule.Name + "/" + seriesKey(sample.Labels)
+		state, active := e.series[key]
+
+		if !rule.Comparison.compare(sample.Value, rule.Threshold) {
+			if active {
+				delete(e.series, key)
+				state.value = sample.Value
+				if state.state == ruleFiring {
+					changed = append(changed, e.ruleAlert(state, alerts.AlertStateResolved))
+				}
+			}
+			continue
+		}
+
+		if !active {
+			state = &seriesState{rule: rule, labels: sample.Labels, state: rulePending, activeAt: now}
+			e.series[key] = state
+		}
+		state.value = sample.Value
+		state.seenAt = now
+		if state.state == rulePending && now.Sub(state.activeAt) >= rule.For {
+			state.state = ruleFiring
+			changed = append(changed, e.ruleAlert(state, alerts.AlertStateActive))
+		}
+	}
+	e.mu.Unlock()
+
+	e.send(ctx, changed)
+}
+
+// Evaluate fires every pending series whose condition has held for the For
+// duration of its rule, even if no new sample arrived, resends the alerts of
+// the firing series and forgets the series absent for longer than the Absent
+// timeout of their rule, resolving their alerts. Sending the alerts stops
+// when ctx is done.
+func (e *RuleEvaluator) Evaluate(ctx context.Context) {
+	now := e.now()
+
+	var changed []*alerts.AlertV2
+	e.mu.Lock()
+	for key, state := range e.series {
+		if now.Sub(state.seenAt) >= state.rule.Absent {
+			delete(e.series, key)
+			if state.state == ruleFiring {
+				fmt.Printf("Rules :: %s :: series absent since %s\n", state.rule.Name, state.seenAt.Format(time.RFC3339))
+				changed = append(changed, e.ruleAlert(state, alerts.AlertStateResolved))
+			}
+			continue
+		}
+		if state.state == rulePending && now.Sub(state.activeAt) < state.rule.For {
+			continue
+		}
+		state.state = ruleFiring
+		changed = append(changed, e.ruleAlert(state, alerts.AlertStateActive))
+	}
+	e.mu.Unlock()
+
+	e.send(ctx, changed)
+}
+
+func (e *RuleEvaluator) send(ctx context.Context, changed []*alerts.AlertV2) {
+	for _, alert := range changed {
+		fmt.Printf("Rules :: %s %s\n", alert.ID(), alert.State())
+		select {
+		case e.output <- alert:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (e *RuleEvaluator) ruleAlert(state *seriesState, alertState alerts.AlertState) *alerts.AlertV2 {
+	rule := state.rule
+	id := fmt.Sprintf("rule-%s-%016x", rule.Name, seriesHash(state.labels))
+	alert := alerts.NewAlertV2(
+		id,
+		RuleSource,
+		rule.Severity,
+		rule.Name,
+		fmt.Sprintf("%s %s %g (current value %g)", rule.Metric, rule.Comparison, rule.Threshold, state.value),
+		id,
+		e.now(),
+		alertState,
+	)
+	for key, value := range state.labels {
+		alert.AddLabel(key, value)
+	}
+	for key, value := range rule.Labels {
+		alert.AddLabel(key, value)
+	}
+	alert.AddLabel("rule", rule.Name)
+	for key, value := range rule.Annotations {
+		alert.AddAnnotation(key, value)
+	}
+	alert.AddAnnotation("value", strconv.FormatFloat(state.value, 'g', -1, 64))
+	return alert
+}
+
+// seriesKey identifies a series by its sorted labels.
+func seriesKey(labels map[string]string) string {
+	keys := make([]string, 0, len(labels))
+	for key := range labels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var key []byte
+	for _, name := range keys {
+		key = strconv.AppendQuote(key, name)
+		key = append(key, '=')
+		key = strconv.AppendQuote(key, labels[name])
+		key = append(key, ',')
+	}
+	return string(key)
+}
+
+func seriesHash(labels map[string]string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(seriesKey(labels)))
+	return h.Sum64()
+}
@@ -0,0 +1,249 @@
+package alerting
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/avilikof/go-shared-libs/alerts"
+)
+
+const testRules = `
+rules:
+  - name: queue_backlog
+    metric: queue_depth
+    matchers: {env: prod}
+    comparison: ">"
+    threshold: 1000
+    for: 5m
+    labels: {team: billing}
+    annotations:
+      runbook_url: https://runbooks.example.com/queue-backlog
+`
+
+func TestLoadRules(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rules.yaml")
+	if err := os.WriteFile(path, []byte(testRules), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	rules, err := LoadRules(path)
+	if err != nil {
+		t.Fatalf("LoadRules() error = %v", err)
+	}
+	if len(rules) != 1 || rules[0].Comparison != GreaterThan || rules[0].For != 5*time.Minute || rules[0].Matchers["env"] != "prod" {
+		t.Errorf("unexpected rules: %+v", rules)
+	}
+}
+
+func TestRuleEvaluator_PendingFiringResolved(t *testing.T) {
+	ctx := t.Context()
+	output := make(chan *alerts.AlertV2, 4)
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	e, err := NewRuleEvaluator(newMemStream(), "metrics", output, Rule{
+		Name:       "queue_backlog",
+		Metric:     "queue_depth",
+		Matchers:   map[string]string{"env": "prod"},
+		Comparison: GreaterThan,
+		Threshold:  1000,
+		For:        5 * time.Minute,
+	})
+	if err != nil {
+		t.Fatalf("NewRuleEvaluator() error = %v", err)
+	}
+	e.now = func() time.Time { return now }
+
+	high := MetricSample{Name: "queue_depth", Labels: map[string]string{"env": "prod", "queue": "billing"}, Value: 1500}
+	e.Observe(ctx, high)
+	e.Observe(ctx, MetricSample{Name: "queue_depth", Labels: map[string]string{"env": "dev"}, Value: 5000})
+	if len(output) != 0 {
+		t.Fatalf("expected the series to be pending, got %d alerts", len(output))
+	}
+
+	now = now.Add(4 * time.Minute)
+	e.Evaluate(ctx)
+	if len(output) != 0 {
+		t.Fatalf("expected no alert before the for duration, got %d", len(output))
+	}
+
+	now = now.Add(time.Minute)
+	e.Evaluate(ctx)
+	e.Observe(ctx, high)
+	if len(output) != 1 {
+		t.Fatalf("expected exactly 1 firing alert, got %d", len(output))
+	}
+	firing := <-output
+	if !firing.IsFiring() || firing.Source() != RuleSource || firing.Labels()["queue"] != "billing" || firing.Labels()["rule"] != "queue_backlog" {
+		t.Errorf("unexpected firing alert: %+v", firing)
+	}
+	if firing.Severity() != "warning" || firing.Annotations()["value"] != "1500" {
+		t.Errorf("severity = %q, value = %q; want warning and 1500", firing.Severity(), firing.Annotations()["value"])
+	}
+
+	e.Observe(ctx, MetricSample{Name: "queue_depth", Labels: map[string]string{"env": "prod", "queue": "billing"}, Value: 10})
+	if len(output) != 1 {
+		t.Fatalf("expected a resolving alert, got %d", len(output))
+	}
+	resolved := <-output
+	if resolved.IsFiring() || resolved.ID() != firing.ID() {
+		t.Errorf("expected %s to be resolved, got %+v", firing.ID(), resolved)
+	}
+}
+
+func TestRuleEvaluator_PendingResetsBelowThreshold(t *testing.T) {
+	ctx := t.Context()
+	output := make(chan *alerts.AlertV2, 4)
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	e, err := NewRuleEvaluator(newMemStream(), "metrics", output,
+		Rule{Name: "low_disk", Metric: "disk_free", Comparison: LessOrEqual, Threshold: 10, For: time.Minute},
+		Rule{Name: "no_disk", Metric: "disk_free", Comparison: Equal, Threshold: 0},
+	)
+	if err != nil {
+		t.Fatalf("NewRuleEvaluator() error = %v", err)
+	}
+	e.now = func() time.Time { return now }
+
+	e.Observe(ctx, MetricSample{Name: "disk_free", Value: 5})
+	now = now.Add(30 * time.Second)
+	e.Observe(ctx, MetricSample{Name: "disk_free", Value: 50})
+	now = now.Add(time.Minute)
+	e.Evaluate(ctx)
+	if len(output) != 0 {
+		t.Fatalf("expected the pending series to reset, got %d alerts", len(output))
+	}
+
+	e.Observe(ctx, MetricSample{Name: "disk_free", Value: 0})
+	if len(output) != 1 {
+		t.Fatalf("expected a rule without a for duration to fire at once, got %d alerts", len(output))
+	}
+	if alert := <-output; alert.Type() != "no_disk" {
+		t.Errorf("fired rule = %q; want no_disk", alert.Type())
+	}
+}
+
+func TestRuleEvaluator_ResolvesAbsentSeries(t *testing.T) {
+	ctx := t.Context()
+	output := make(chan *alerts.AlertV2, 4)
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	e, err := NewRuleEvaluator(newMemStream(), "metrics", output,
+		Rule{Name: "queue_backlog", Metric: "queue_depth", Comparison: GreaterThan, Threshold: 1000, For: time.Minute},
+		Rule{Name: "no_disk", Metric: "disk_free", Comparison: Equal, Threshold: 0, Absent: time.Hour},
+	)
+	if err != nil {
+		t.Fatalf("NewRuleEvaluator() error = %v", err)
+	}
+	e.now = func() time.Time { return now }
+
+	e.Observe(ctx, MetricSample{Name: "queue_depth", Value: 1500})
+	e.Observe(ctx, MetricSample{Name: "disk_free", Value: 0})
+	now = now.Add(time.Minute)
+	e.Evaluate(ctx)
+	// no_disk fired on its sample and is resent with queue_backlog firing.
+	if len(output) != 3 {
+		t.Fatalf("expected 3 firing alerts, got %d", len(output))
+	}
+	for range 3 {
+		<-output
+	}
+
+	// Without samples the queue series outlives its default Absent timeout
+	// of five minutes, the disk series stays within its hour.
+	now = now.Add(5 * time.Minute)
+	e.Evaluate(ctx)
+	if len(output) != 2 {
+		t.Fatalf("expected the absent series to resolve and the other to be resent, got %d alerts", len(output))
+	}
+	for range 2 {
+		alert := <-output
+		if alert.IsFiring() != (alert.Type() == "no_disk") {
+			t.Errorf("expected queue_backlog to resolve and no_disk to be resent, got %s firing %v", alert.Type(), alert.IsFiring())
+		}
+	}
+
+	e.Evaluate(ctx)
+	if len(output) != 1 {
+		t.Fatalf("expected only no_disk to be resent, got %d alerts", len(output))
+	}
+	if alert := <-output; alert.Type() != "no_disk" {
+		t.Errorf("expected the absent series to be forgotten, got %s", alert.Type())
+	}
+}
+
+func TestRuleEvaluator_ResendsFiringAlerts(t *testing.T) {
+	output := make(chan *alerts.AlertV2, 4)
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	e, err := NewRuleEvaluator(newMemStream(), "metrics", output,
+		Rule{Name: "no_disk", Metric: "disk_free", Comparison: Equal, Threshold: 0, Absent: time.Hour})
+	if err != nil {
+		t.Fatalf("NewRuleEvaluator() error = %v", err)
+	}
+	e.now = func() time.Time { return now }
+
+	e.Observe(t.Context(), MetricSample{Name: "disk_free", Value: 0})
+	for i := 0; i < 3; i++ {
+		now = now.Add(10 * time.Second)
+		e.Evaluate(t.Context())
+	}
+	if len(output) != 4 {
+		t.Fatalf("expected the firing alert and 3 resends, got %d alerts", len(output))
+	}
+	first := <-output
+	for range 3 {
+		if alert := <-output; !alert.IsFiring() || alert.ID() != first.ID() {
+			t.Errorf("expected %s to be resent as firing, got %s firing %v", first.ID(), alert.ID(), alert.IsFiring())
+		}
+	}
+}
+
+func TestRuleEvaluator_StopsSendingWhenContextIsDone(t *testing.T) {
+	e, err := NewRuleEvaluator(newMemStream(), "metrics", make(chan *alerts.AlertV2),
+		Rule{Name: "no_disk", Metric: "disk_free", Comparison: Equal, Threshold: 0})
+	if err != nil {
+		t.Fatalf("NewRuleEvaluator() error = %v", err)
+	}
+	ctx, cancel := context.WithCancel(t.Context())
+	cancel()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		e.Observe(ctx, MetricSample{Name: "disk_free", Value: 0})
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Observe blocked on the output after its context was cancelled")
+	}
+}
+
+func TestRuleEvaluator_RunDefaultsInterval(t *testing.T) {
+	e, err := NewRuleEvaluator(newMemStream(), "metrics", nil)
+	if err != nil {
+		t.Fatalf("NewRuleEvaluator() error = %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := e.Run(ctx, 0); !errors.Is(err, context.Canceled) {
+		t.Errorf("Run() error = %v; want context.Canceled", err)
+	}
+}
+
+func TestNewRuleEvaluator_Invalid(t *testing.T) {
+	tests := map[string][]Rule{
+		"missing metric":     {{Name: "a", Comparison: GreaterThan}},
+		"unknown comparison": {{Name: "a", Metric: "m", Comparison: "=>"}},
+		"negative for":       {{Name: "a", Metric: "m", Comparison: GreaterThan, For: -time.Second}},
+		"negative absent":    {{Name: "a", Metric: "m", Comparison: GreaterThan, Absent: -time.Second}},
+		"duplicate name":     {{Name: "a", Metric: "m", Comparison: GreaterThan}, {Name: "a", Metric: "n", Comparison: LessThan}},
+	}
+	for name, rules := range tests {
+		if _, err := NewRuleEvaluator(newMemStream(), "metrics", nil, rules...); !errors.Is(err, ErrInvalidRule) {
+			t.Errorf("%s: error = %v; want ErrInvalidRule", name, err)
+		}
+	}
+}
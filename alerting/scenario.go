@@ -0,0 +1,132 @@
+package alerting
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+var ErrInvalidScenario = errors.New("invalid scenario")
+
+// Scenario describes a reproducible alert load. The same Seed always yields
+// the same sequence of alert IDs, labels and fire/resolve transitions.
+//
+//	name: eu-prod-storm
+//	seed: 42
+//	rate: 50            # alerts per second
+//	duration: 10m
+//	report_interval: 5s
+//	bursts:
+//	  - every: 1m
+//	    length: 10s
+//	    multiplier: 5
+//	lifecycle:
+//	  ids: 200
+//	  min_firing: 30s
+//	  max_firing: 5m
+//	labels:
+//	  env:
+//	    - {value: prod, weight: 3}
+//	    - {value: staging, weight: 1}
+type Scenario struct {
+	Name           string                     `yaml:"name"`
+	Seed           int64                      `yaml:"seed"`
+	Subject        string                     `yaml:"subject"`
+	Version        string                     `yaml:"version"`
+	Source         string                     `yaml:"source"`
+	Rate           float64                    `yaml:"rate"`
+	Duration       time.Duration              `yaml:"duration"`
+	ReportInterval time.Duration              `yaml:"report_interval"`
+	Bursts         []Burst                    `yaml:"bursts"`
+	Lifecycle      Lifecycle                  `yaml:"lifecycle"`
+	Severities     []WeightedValue            `yaml:"severities"`
+	Types          []WeightedValue            `yaml:"types"`
+	Labels         map[string][]WeightedValue `yaml:"labels"`
+}
+
+// Burst multiplies the rate for Length at the start of every Every period.
+type Burst struct {
+	Every      time.Duration `yaml:"every"`
+	Length     time.Duration `yaml:"length"`
+	Multiplier float64       `yaml:"multiplier"`
+}
+
+// Lifecycle controls the pool of alert IDs. A fired alert is resent while it
+// fires and resolved after a random duration between MinFiring and MaxFiring.
+type Lifecycle struct {
+	IDs       int           `yaml:"ids"`
+	MinFiring time.Duration `yaml:"min_firing"`
+	MaxFiring time.Duration `yaml:"max_firing"`
+}
+
+// WeightedValue is one choice of a weighted random distribution.
+type WeightedValue struct {
+	Value  string  `yaml:"value"`
+	Weight float64 `yaml:"weight"`
+}
+
+// LoadScenario reads a YAML scenario file.
+func LoadScenario(path string) (*Scenario, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read scenario %s: %w", path, err)
+	}
+	var scenario Scenario
+	if err := yaml.Unmarshal(data, &scenario); err != nil {
+		return nil, fmt.Errorf("%w: %s: %v", ErrInvalidScenario, path, err)
+	}
+	return &scenario, nil
+}
+
+// withDefaults validates the scenario and fills in unset fields.
+func (s Scenario) withDefaults() (Scenario, error) {
+	if s.Rate <= 0 {
+		return s, fmt.Errorf("%w: rate must be positive", ErrInvalidScenario)
+	}
+	if s.Duration < 0 {
+		return s, fmt.Errorf("%w: duration must not be negative", ErrInvalidScenario)
+	}
+	if s.Subject == "" {
+		s.Subject = "test.alert"
+	}
+	if s.Source == "" {
+		s.Source = "load_generator"
+	}
+	switch s.Version {
+	case "", VersionV2.String(), VersionV1.String():
+	default:
+		return s, fmt.Errorf("%w: unknown alert version %q", ErrInvalidScenario, s.Version)
+	}
+	for _, burst := range s.Bursts {
+		if burst.Every <= 0 || burst.Length <= 0 || burst.Length > burst.Every || burst.Multiplier <= 0 {
+			return s, fmt.Errorf("%w: bursts need 0 < length <= every and a positive multiplier", ErrInvalidScenario)
+		}
+	}
+	if s.Lifecycle.IDs <= 0 {
+		s.Lifecycle.IDs = 100
+	}
+	if s.Lifecycle.MaxFiring < s.Lifecycle.MinFiring {
+		return s, fmt.Errorf("%w: max_firing is lower than min_firing", ErrInvalidScenario)
+	}
+	if len(s.Severities) == 0 {
+		s.Severities = []WeightedValue{{"critical", 1}, {"warning", 1}, {"info", 1}}
+	}
+	if len(s.Types) == 0 {
+		s.Types = []WeightedValue{{"cpu_high", 1}, {"memory_leak", 1}, {"disk_full", 1}, {"network_latency", 1}}
+	}
+	return s, nil
+}
+
+// rateAt returns the alerts per second after elapsed time into the scenario.
+func (s Scenario) rateAt(elapsed time.Duration) float64 {
+	rate := s.Rate
+	for _, burst := range s.Bursts {
+		if elapsed%burst.Every < burst.Length {
+			rate *= burst.Multiplier
+		}
+	}
+	return rate
+}
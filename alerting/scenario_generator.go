@@ -0,0 +1,260 @@
+package alerting
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/avilikof/go-shared-libs/alerts"
+)
+
+// ScenarioStats is a snapshot of a running scenario.
+type ScenarioStats struct {
+	Published uint64
+	Fired     uint64
+	Resolved  uint64
+	Resent    uint64
+	Errors    uint64
+	Elapsed   time.Duration
+}
+
+// Rate returns the average number of published alerts per second.
+func (s ScenarioStats) Rate() float64 {
+	if s.Elapsed <= 0 {
+		return 0
+	}
+	return float64(s.Published) / s.Elapsed.Seconds()
+}
+
+func (s ScenarioStats) String() string {
+	return fmt.Sprintf("published=%d fired=%d resolved=%d resent=%d errors=%d elapsed=%s rate=%.1f/s",
+		s.Published, s.Fired, s.Resolved, s.Resent, s.Errors, s.Elapsed.Round(time.Millisecond), s.Rate())
+}
+
+type scenarioAlert struct {
+	id        string
+	firing    bool
+	resolveAt time.Duration
+	severity  string
+	alertType string
+	labels    map[string]string
+}
+
+type transition int
+
+const (
+	transitionFired transition = iota
+	transitionResent
+	transitionResolved
+)
+
+// ScenarioGenerator publishes alerts according to a Scenario. Alerts are
+// scheduled on a virtual timeline derived from the scenario's rate and
+// bursts, so a given seed always produces the same sequence of alerts.
+type ScenarioGenerator struct {
+	stream   Stream
+	scenario Scenario
+
+	mu   sync.Mutex
+	rng  *rand.Rand
+	pool []*scenarioAlert
+
+	published atomic.Uint64
+	fired     atomic.Uint64
+	resolved  atomic.Uint64
+	resent    atomic.Uint64
+	errors    atomic.Uint64
+	elapsed   atomic.Int64
+}
+
+func NewScenarioGenerator(stream Stream, scenario Scenario) (*ScenarioGenerator, error) {
+	scenario, err := scenario.withDefaults()
+	if err != nil {
+		return nil, err
+	}
+
+	rng := rand.New(rand.NewSource(scenario.Seed))
+	pool := make([]*scenarioAlert, scenario.Lifecycle.IDs)
+	for i := range pool {
+		pool[i] = &scenarioAlert{id: fmt.Sprintf("%016x", rng.Uint64())}
+	}
+
+	return &ScenarioGenerator{
+		stream:   stream,
+		scenario: scenario,
+		rng:      rng,
+		pool:     pool,
+	}, nil
+}
+
+// Run publishes alerts until the scenario's duration has passed or ctx is
+// cancelled. A scenario without a duration runs until ctx is cancelled.
+func (g *ScenarioGenerator) Run(ctx context.Context) error {
+	start := time.Now()
+	var scheduled time.Duration
+
+	var report <-chan time.Time
+	if g.scenario.ReportInterval > 0 {
+		ticker := time.NewTicker(g.scenario.ReportInterval)
+		defer ticker.Stop()
+		report = ticker.C
+	}
+
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			g.printStats()
+			return ctx.Err()
+		case <-report:
+			g.printStats()
+		case <-timer.C:
+			if g.scenario.Duration > 0 && scheduled >= g.scenario.Duration {
+				g.printStats()
+				return nil
+			}
+			g.elapsed.Store(int64(time.Since(start)))
+			g.publish(scheduled)
+
+			// Falling behind schedule makes the timer fire at once, so the
+			// generator catches up instead of drifting below the target rate.
+			scheduled += time.Duration(float64(time.Second) / g.scenario.rateAt(scheduled))
+			timer.Reset(time.Until(start.Add(scheduled)))
+		}
+	}
+}
+
+// Stats returns the current statistics. It is safe to call while Run is
+// in progress.
+func (g *ScenarioGenerator) Stats() ScenarioStats {
+	return ScenarioStats{
+		Published: g.published.Load(),
+		Fired:     g.fired.Load(),
+		Resolved:  g.resolved.Load(),
+		Resent:    g.resent.Load(),
+		Errors:    g.errors.Load(),
+		Elapsed:   time.Duration(g.elapsed.Load()),
+	}
+}
+
+func (g *ScenarioGenerator) printStats() {
+	fmt.Printf("Scenario :: %s :: %s\n", g.scenario.Name, g.Stats())
+}
+
+func (g *ScenarioGenerator) publish(at time.Duration) {
+	alertBytes, kind, err := g.next(at)
+	if err == nil {
+		err = g.stream.Publish(g.scenario.Subject, alertBytes)
+	}
+	if err != nil {
+		g.errors.Add(1)
+		return
+	}
+
+	g.published.Add(1)
+	switch kind {
+	case transitionFired:
+		g.fired.Add(1)
+	case transitionResolved:
+		g.resolved.Add(1)
+	default:
+		g.resent.Add(1)
+	}
+}
+
+// next picks an alert from the pool and advances its lifecycle to the given
+// point on the scenario timeline.
+func (g *ScenarioGenerator) next(at time.Duration) ([]byte, transition, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	alert := g.pool[g.rng.Intn(len(g.pool))]
+	var kind transition
+	switch {
+	case !alert.firing:
+		alert.firing = true
+		alert.resolveAt = at + g.firingDuration()
+		alert.severity = g.pick(g.scenario.Severities)
+		alert.alertType = g.pick(g.scenario.Types)
+		alert.labels = g.pickLabels()
+		kind = transitionFired
+	case at >= alert.resolveAt:
+		alert.firing = false
+		kind = transitionResolved
+	default:
+		kind = transitionResent
+	}
+
+	alertBytes, err := g.encode(alert)
+	return alertBytes, kind, err
+}
+
+func (g *ScenarioGenerator) encode(alert *scenarioAlert) ([]byte, error) {
+	message := fmt.Sprintf("%s scenario alert", g.scenario.Name)
+	if g.scenario.Version == VersionV1.String() {
+		return alerts.NewAlert(alert.id, alert.alertType, message, time.Now(), alert.firing).Bytes(), nil
+	}
+
+	state := alerts.AlertStateActive
+	if !alert.firing {
+		state = alerts.AlertStateResolved
+	}
+	alertV2 := alerts.NewAlertV2(alert.id, g.scenario.Source, alert.severity, alert.alertType, message, alert.id, time.Now(), state)
+	for key, value := range alert.labels {
+		alertV2.AddLabel(key, value)
+	}
+	if g.scenario.Name != "" {
+		alertV2.AddAnnotation("scenario", g.scenario.Name)
+	}
+	return alertV2.MarshalJSON()
+}
+
+func (g *ScenarioGenerator) firingDuration() time.Duration {
+	lifecycle := g.scenario.Lifecycle
+	spread := lifecycle.MaxFiring - lifecycle.MinFiring
+	if spread <= 0 {
+		return lifecycle.MinFiring
+	}
+	return lifecycle.MinFiring + time.Duration(g.rng.Int63n(int64(spread)))
+}
+
+func (g *ScenarioGenerator) pickLabels() map[string]string {
+	// Sorted keys keep the random draws in a stable order.
+	keys := make([]string, 0, len(g.scenario.Labels))
+	for key := range g.scenario.Labels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	labels := make(map[string]string, len(keys))
+	for _, key := range keys {
+		if value := g.pick(g.scenario.Labels[key]); value != "" {
+			labels[key] = value
+		}
+	}
+	return labels
+}
+
+func (g *ScenarioGenerator) pick(values []WeightedValue) string {
+	var total float64
+	for _, v := range values {
+		total += v.Weight
+	}
+	if total <= 0 {
+		return ""
+	}
+	r := g.rng.Float64() * total
+	for _, v := range values {
+		r -= v.Weight
+		if r < 0 {
+			return v.Value
+		}
+	}
+	return values[len(values)-1].Value
+}
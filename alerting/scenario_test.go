@@ -0,0 +1,104 @@
+package alerting
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+const testScenario = `
+name: test
+seed: 7
+rate: 1000
+duration: 50ms
+bursts:
+  - every: 1s
+    length: 100ms
+    multiplier: 2
+lifecycle:
+  ids: 5
+  min_firing: 10ms
+  max_firing: 20ms
+labels:
+  env:
+    - {value: prod, weight: 3}
+    - {value: staging, weight: 1}
+  region:
+    - {value: eu-central, weight: 1}
+`
+
+func loadTestScenario(t *testing.T) Scenario {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "scenario.yaml")
+	if err := os.WriteFile(path, []byte(testScenario), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	scenario, err := LoadScenario(path)
+	if err != nil {
+		t.Fatalf("LoadScenario() error = %v", err)
+	}
+	return *scenario
+}
+
+func TestLoadScenario(t *testing.T) {
+	scenario := loadTestScenario(t)
+	if scenario.Duration != 50*time.Millisecond || scenario.Lifecycle.MaxFiring != 20*time.Millisecond {
+		t.Errorf("durations not decoded: %+v", scenario)
+	}
+	if got := scenario.rateAt(50 * time.Millisecond); got != 2000 {
+		t.Errorf("rateAt() during burst = %v; want 2000", got)
+	}
+	if got := scenario.rateAt(500 * time.Millisecond); got != 1000 {
+		t.Errorf("rateAt() outside burst = %v; want 1000", got)
+	}
+}
+
+func TestScenarioGenerator_Reproducible(t *testing.T) {
+	scenario := loadTestScenario(t)
+	sequence := func() []string {
+		g, err := NewScenarioGenerator(newMemStream(), scenario)
+		if err != nil {
+			t.Fatalf("NewScenarioGenerator() error = %v", err)
+		}
+		var out []string
+		for i := 0; i < 50; i++ {
+			g.next(time.Duration(i) * time.Millisecond)
+			for _, alert := range g.pool {
+				out = append(out, alert.id, alert.severity, alert.labels["env"], alert.resolveAt.String())
+			}
+		}
+		return out
+	}
+
+	if first, second := sequence(), sequence(); !reflect.DeepEqual(first, second) {
+		t.Error("expected the same seed to produce the same alert sequence")
+	}
+}
+
+func TestScenarioGenerator_Run(t *testing.T) {
+	stream := newMemStream()
+	g, err := NewScenarioGenerator(stream, loadTestScenario(t))
+	if err != nil {
+		t.Fatalf("NewScenarioGenerator() error = %v", err)
+	}
+	if err := g.Run(context.Background()); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	stats := g.Stats()
+	if stats.Published == 0 || stats.Published != uint64(len(stream.published["test.alert"])) {
+		t.Errorf("stats %v do not match %d published alerts", stats, len(stream.published["test.alert"]))
+	}
+	if stats.Fired+stats.Resolved+stats.Resent != stats.Published {
+		t.Errorf("transitions do not add up: %v", stats)
+	}
+}
+
+func TestNewScenarioGenerator_Invalid(t *testing.T) {
+	if _, err := NewScenarioGenerator(newMemStream(), Scenario{}); err == nil {
+		t.Error("expected an error for a scenario without a rate")
+	}
+}
@@ -1,17 +1,46 @@
 package alerting
 
-import "time"
+import (
+	"errors"
+	"time"
+)
+
+var (
+	// ErrNotFound is returned by Storage.Get for keys that are missing or expired.
+	ErrNotFound = errors.New("key not found")
+	// ErrClosed is returned by Storage and Stream operations after Close.
+	ErrClosed = errors.New("closed")
+)
 
 // Storage defines the interface for persisting and retrieving alert data.
 // Implementations should provide key-value storage with expiration support.
+// Get must return an error matching ErrNotFound (via errors.Is) for missing
+// keys, and every operation must return an error matching ErrClosed once the
+// implementation has been closed. The alertingtest package verifies this.
 type Storage interface {
 	Get(key string) ([]byte, error)
 	Set(key string, value []byte, expires time.Duration) error
 }
 
+// KeyLister is implemented by Storage implementations that can enumerate
+// their keys, e.g. for listing alerts.
+type KeyLister interface {
+	List() ([]string, error)
+}
+
+// KeyDeleter is implemented by Storage implementations that can delete keys,
+// e.g. for clearing the state of resolved alerts.
+type KeyDeleter interface {
+	Delete(key string) error
+}
+
 // Stream defines the interface for publish-subscribe messaging operations.
 // Implementations should support publishing alerts to topics and subscribing to receive them.
+// Publish must return an error matching ErrClosed once the implementation has been closed.
+// Subscribe returns at once with a handle to end the subscription. Its options
+// configure backpressure; a Stream returns an error matching
+// ErrInvalidSubscription for options it cannot honour.
 type Stream interface {
 	Publish(topic string, data []byte) error
-	Subscribe(topic string, channel chan []byte) error
+	Subscribe(topic string, channel chan []byte, opts ...SubscribeOption) (Subscription, error)
 }
@@ -0,0 +1,283 @@
+package alerting
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/avilikof/go-shared-libs/alerts"
+)
+
+// ResolveReasonStale is the reason carried by resolved events for alerts that
+// were not resent within their resend timeout.
+const ResolveReasonStale = "stale"
+
+// staleKeyPrefix prefixes the key holding the last-seen time of a firing
+// alert, so that it survives restarts.
+const staleKeyPrefix = "stale.alert."
+
+// StaleRule sets the resend timeout for alerts from Source and carrying all of
+// Labels. Empty fields match any alert; the first matching rule wins.
+type StaleRule struct {
+	Source  string            `json:"source,omitempty" yaml:"source"`
+	Labels  map[string]string `json:"labels,omitempty" yaml:"labels"`
+	Timeout time.Duration     `json:"timeout" yaml:"timeout"`
+}
+
+func (r StaleRule) matches(alert *alerts.AlertV2) bool {
+	if r.Source != "" && r.Source != alert.Source() {
+		return false
+	}
+	return matchLabels(alert.Labels(), r.Labels)
+}
+
+type seenAlert struct {
+	LastSeen time.Time       `json:"last_seen"`
+	Timeout  time.Duration   `json:"timeout"`
+	Alert    json.RawMessage `json:"alert"`
+	// V1 marks an alerts.Alert; other alerts are AlertV2.
+	V1 bool `json:"v1,omitempty"`
+}
+
+// StaleTracker remembers when each firing alert was last seen and resolves
+// alerts whose source stopped resending them within their resend timeout.
+// Last-seen times are stored as they are recorded, one key per alert; Sweep
+// requires the storage to implement KeyLister.
+type StaleTracker struct {
+	mu             sync.Mutex
+	storage        Storage
+	stream         Stream
+	escalator      *Escalator
+	defaultTimeout time.Duration
+	rules          []StaleRule
+	duplicates     time.Duration
+	now            func() time.Time
+}
+
+// NewStaleTracker creates a StaleTracker. Alerts not matched by any rule use
+// defaultTimeout; a zero timeout means the alert never goes stale.
+func NewStaleTracker(storage Storage, stream Stream, defaultTimeout time.Duration, rules ...StaleRule) *StaleTracker {
+	return &StaleTracker{
+		storage:        storage,
+		stream:         stream,
+		defaultTimeout: defaultTimeout,
+		rules:          rules,
+		now:            time.Now,
+	}
+}
+
+// Seen records that a firing alert was just received.
+func (t *StaleTracker) Seen(alert *alerts.AlertV2) error {
+	alertBytes, err := alert.MarshalJSON()
+	if err != nil {
+		return err
+	}
+	return t.record(alert.ID(), t.timeoutFor(alert), alertBytes, false)
+}
+
+// Touch records that a tracked alert was received again without being
+// processed, e.g. because the Processor's dedup cache dropped it as a
+// duplicate. Alerts that are not tracked stay untracked.
+func (t *StaleTracker) Touch(alertID string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	seen, err := t.load(alertID)
+	if err != nil || seen == nil {
+		return err
+	}
+	seen.LastSeen = t.now()
+	data, err := json.Marshal(seen)
+	if err != nil {
+		return err
+	}
+	if err := t.storage.Set(staleKeyPrefix+alertID, data, 0); err != nil {
+		return fmt.Errorf("failed to record %s as seen: %w", alertID, err)
+	}
+	return nil
+}
+
+// AllowDuplicates extends every resend timeout by window, the duplicate
+// window of a transport that drops identical resends before they reach the
+// Processor, such as JetStreamHandler, see its DuplicateWindow. Without it
+// an alert resent more often than its timeout goes stale while the resends
+// are being dropped.
+func (t *StaleTracker) AllowDuplicates(window time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.duplicates = window
+}
+
+// SeenV1 records that a firing v1 alert was just received. v1 alerts carry no
+// source or labels, so only rules matching any alert apply to them.
+func (t *StaleTracker) SeenV1(alert *alerts.Alert) error {
+	return t.record(alert.ID, t.timeoutForV1(), alert.Bytes(), true)
+}
+
+func (t *StaleTracker) record(alertID string, timeout time.Duration, alertBytes []byte, v1 bool) error {
+	if timeout <= 0 {
+		return t.Forget(alertID)
+	}
+	data, err := json.Marshal(seenAlert{
+		LastSeen: t.now(),
+		Timeout:  timeout,
+		Alert:    alertBytes,
+		V1:       v1,
+	})
+	if err != nil {
+		return err
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if err := t.storage.Set(staleKeyPrefix+alertID, data, 0); err != nil {
+		return fmt.Errorf("failed to record %s as seen: %w", alertID, err)
+	}
+	return nil
+}
+
+// Forget stops tracking an alert, e.g. because it was resolved by its source.
+func (t *StaleTracker) Forget(alertID string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.forget(alertID)
+}
+
+// Sweep resolves every alert whose resend timeout has passed.
+func (t *StaleTracker) Sweep() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	lister, ok := t.storage.(KeyLister)
+	if !ok {
+		return fmt.Errorf("%w: storage cannot list keys", errors.ErrUnsupported)
+	}
+	keys, err := lister.List()
+	if err != nil {
+		return fmt.Errorf("failed to list stale alert state: %w", err)
+	}
+
+	now := t.now()
+	var errs []error
+	for _, key := range keys {
+		alertID, ok := strings.CutPrefix(key, staleKeyPrefix)
+		if !ok {
+			continue
+		}
+		seen, err := t.load(alertID)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if seen == nil || now.Sub(seen.LastSeen) < seen.Timeout+t.duplicates {
+			continue
+		}
+		if err := t.resolve(alertID, *seen); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		errs = append(errs, t.forget(alertID))
+	}
+	return errors.Join(errs...)
+}
+
+// Run calls Sweep every interval until ctx is cancelled.
+func (t *StaleTracker) Run(ctx context.Context, interval time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+			if err := t.Sweep(); err != nil {
+				fmt.Printf("Stale alert sweep failed: %v\n", err)
+			}
+		}
+	}
+}
+
+func (t *StaleTracker) resolve(alertID string, seen seenAlert) error {
+	var alertBytes []byte
+	if seen.V1 {
+		alert, err := alerts.AlertFromBytes(seen.Alert)
+		if err != nil {
+			return fmt.Errorf("failed to decode stale alert %s: %w", alertID, err)
+		}
+		alert.Resolve(t.now())
+		alert.Firing = false
+		alertBytes = alert.Bytes()
+	} else {
+		alert, err := alerts.AlertV2FromBytes(seen.Alert)
+		if err != nil {
+			return fmt.Errorf("failed to decode stale alert %s: %w", alertID, err)
+		}
+		alert.Resolve()
+		alertBytes, err = alert.MarshalJSON()
+		if err != nil {
+			return err
+		}
+	}
+	if err := t.stream.Publish(StorageTopic, alertBytes); err != nil {
+		return err
+	}
+
+	resolveEvent := resolvedEventWithReason(alertID, ResolveReasonStale)
+	if err := t.stream.Publish(EvetTopic, resolveEvent.Bytes()); err != nil {
+		return err
+	}
+	fmt.Printf("Alert :: %s resolved as stale\n", alertID)
+
+	if t.escalator != nil {
+		return t.escalator.Stop(alertID)
+	}
+	return nil
+}
+
+func (t *StaleTracker) timeoutFor(alert *alerts.AlertV2) time.Duration {
+	for _, rule := range t.rules {
+		if rule.matches(alert) {
+			return rule.Timeout
+		}
+	}
+	return t.defaultTimeout
+}
+
+func (t *StaleTracker) timeoutForV1() time.Duration {
+	for _, rule := range t.rules {
+		if rule.Source == "" && len(rule.Labels) == 0 {
+			return rule.Timeout
+		}
+	}
+	return t.defaultTimeout
+}
+
+// load reads the last-seen time of an alert, nil if it is not tracked.
+func (t *StaleTracker) load(alertID string) (*seenAlert, error) {
+	data, err := t.storage.Get(staleKeyPrefix + alertID)
+	if errors.Is(err, ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load last-seen time of %s: %w", alertID, err)
+	}
+	var seen *seenAlert
+	if err := json.Unmarshal(data, &seen); err != nil {
+		return nil, fmt.Errorf("failed to decode last-seen time of %s: %w", alertID, err)
+	}
+	return seen, nil
+}
+
+// forget deletes the last-seen time of an alert, or overwrites it with null
+// on storages that cannot delete keys.
+func (t *StaleTracker) forget(alertID string) error {
+	key := staleKeyPrefix + alertID
+	if deleter, ok := t.storage.(KeyDeleter); ok {
+		return deleter.Delete(key)
+	}
+	return t.storage.Set(key, []byte("null"), 0)
+}
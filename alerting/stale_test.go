@@ -0,0 +1,139 @@
+package alerting
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/avilikof/go-shared-libs/alerts"
+	"github.com/avilikof/go-shared-libs/event"
+)
+
+func TestStaleTracker_ResolvesAfterTimeout(t *testing.T) {
+	storage := newMemStorage()
+	stream := newMemStream()
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tracker := NewStaleTracker(storage, stream, time.Hour, StaleRule{
+		Labels:  map[string]string{"env": "prod"},
+		Timeout: 5 * time.Minute,
+	})
+	tracker.now = func() time.Time { return now }
+
+	prod := alerts.NewAlertV2("prod-1", "test", "critical", "cpu_high", "cpu", "prod-1", now, alerts.AlertStateActive)
+	prod.AddLabel("env", "prod")
+	dev := alerts.NewAlertV2("dev-1", "test", "info", "cpu_high", "cpu", "dev-1", now, alerts.AlertStateActive)
+
+	for _, alert := range []*alerts.AlertV2{prod, dev} {
+		if err := tracker.Seen(alert); err != nil {
+			t.Fatalf("Seen() error = %v", err)
+		}
+	}
+
+	now = now.Add(10 * time.Minute)
+	if err := tracker.Sweep(); err != nil {
+		t.Fatalf("Sweep() error = %v", err)
+	}
+
+	resolved := stream.events(event.ActionResolved)
+	if len(resolved) != 1 {
+		t.Fatalf("expected 1 resolved event, got %d", len(resolved))
+	}
+	if resolved[0].Message["alert_id"] != "prod-1" || resolved[0].Message["reason"] != ResolveReasonStale {
+		t.Errorf("unexpected resolved event: %v", resolved[0].Message)
+	}
+
+	stored, err := alerts.AlertV2FromBytes(stream.published[StorageTopic][0])
+	if err != nil {
+		t.Fatalf("AlertV2FromBytes() error = %v", err)
+	}
+	if stored.IsFiring() {
+		t.Error("expected the stale alert to be stored as resolved")
+	}
+
+	// The dev alert is still tracked after a restart.
+	restarted := NewStaleTracker(storage, stream, time.Hour)
+	restarted.now = func() time.Time { return now.Add(time.Hour) }
+	if err := restarted.Sweep(); err != nil {
+		t.Fatalf("Sweep() error = %v", err)
+	}
+	if got := len(stream.events(event.ActionResolved)); got != 2 {
+		t.Errorf("expected the dev alert to go stale after restart, got %d resolved events", got)
+	}
+}
+
+func TestStaleTracker_AllowDuplicates(t *testing.T) {
+	stream := newMemStream()
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	tracker := NewStaleTracker(newMemStorage(), stream, 5*time.Minute)
+	tracker.now = func() time.Time { return now }
+	tracker.AllowDuplicates(2 * time.Minute)
+
+	if err := tracker.Seen(alerts.NewAlertV2("disk", "test", "critical", "disk_full", "disk", "disk", now, alerts.AlertStateActive)); err != nil {
+		t.Fatalf("Seen() error = %v", err)
+	}
+	for _, step := range []struct {
+		after time.Duration
+		want  int
+	}{
+		{after: 6 * time.Minute, want: 0},
+		{after: 8 * time.Minute, want: 1},
+	} {
+		tracker.now = func() time.Time { return now.Add(step.after) }
+		if err := tracker.Sweep(); err != nil {
+			t.Fatalf("Sweep() error = %v", err)
+		}
+		if got := len(stream.events(event.ActionResolved)); got != step.want {
+			t.Errorf("after %s: %d resolved events; want %d", step.after, got, step.want)
+		}
+	}
+}
+
+func TestStaleTracker_TracksV1AndStopsEscalations(t *testing.T) {
+	storage := newMemStorage()
+	stream := newMemStream()
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tracker := NewStaleTracker(storage, stream, 5*time.Minute)
+	tracker.now = func() time.Time { return now }
+	escalator := NewEscalator(storage, stream, time.Second, EscalationPolicy{
+		Name:  "oncall",
+		Steps: []EscalationStep{{Delay: time.Hour, Receivers: []string{"primary"}}},
+	})
+
+	input := make(chan *alerts.Alert, 1)
+	input <- alerts.NewAlert("v1", "disk", "disk full", now, true)
+	close(input)
+	NewProcessor(input, storage, stream, WithStaleTracker(tracker), WithEscalator(escalator)).Process()
+	if err := escalator.Start(newEscalationTestAlert()); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	if err := tracker.Seen(newEscalationTestAlert()); err != nil {
+		t.Fatalf("Seen() error = %v", err)
+	}
+
+	// Last-seen times are stored as they are recorded, so a tracker that
+	// never swept still hands them to its successor.
+	restarted := NewStaleTracker(storage, stream, 5*time.Minute)
+	restarted.escalator = escalator
+	restarted.now = func() time.Time { return now.Add(10 * time.Minute) }
+	if err := restarted.Sweep(); err != nil {
+		t.Fatalf("Sweep() error = %v", err)
+	}
+
+	if got := len(stream.events(event.ActionResolved)); got != 2 {
+		t.Fatalf("expected the v1 and v2 alerts to go stale, got %d resolved events", got)
+	}
+	var storedV1 *alerts.Alert
+	for _, data := range stream.published[StorageTopic] {
+		if alert, err := alerts.AlertFromBytes(data); err == nil && alert.ID == "v1" {
+			storedV1 = alert
+		}
+	}
+	if storedV1 == nil || storedV1.IsFiring() {
+		t.Errorf("expected the stale v1 alert to be stored as resolved, got %+v", storedV1)
+	}
+	if _, err := storage.Get(escalationKeyPrefix + "a1"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("escalation of the stale alert not stopped: %v", err)
+	}
+}
@@ -1,7 +1,13 @@
 package alerting
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"os"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	natsdriver "github.com/avilikof/go-shared-libs/nats"
 
@@ -34,17 +40,32 @@ func NewStreamHandler(url string) (*StreamHandler, error) {
 }
 
 // Subscribe sets up a subscription to receive messages from a specified topic.
-// Messages received from the topic are forwarded to the provided channel.
+// Messages received from the topic are buffered and forwarded to the provided
+// channel, see SubscribeOption. Core NATS cannot redeliver, so OverflowNak is
+// rejected with ErrInvalidSubscription.
 // Returns an error if the subscription setup fails.
-func (sh *StreamHandler) Subscribe(topic string, alertChan chan []byte) error {
+func (sh *StreamHandler) Subscribe(topic string, alertChan chan []byte, opts ...SubscribeOption) (Subscription, error) {
+	return sh.SubscribeMsg(topic, channelHandler(alertChan), opts...)
+}
+
+// SubscribeMsg is Subscribe calling handler with the messages and their
+// headers. Core NATS cannot redeliver, so handler errors are only logged.
+func (sh *StreamHandler) SubscribeMsg(topic string, handler MessageHandler, opts ...SubscribeOption) (Subscription, error) {
+	options := newSubscribeOptions(opts)
+	if options.overflow == OverflowNak {
+		return nil, fmt.Errorf("%w: %s overflow needs JetStream", ErrInvalidSubscription, options.overflow)
+	}
+	buffer := newSubscriptionBuffer(topic, handler, options)
+
 	pubSub := natsdriver.NewPubSub(sh.natsDriver)
-	err := pubSub.Subscribe(topic, func(msg *nats.Msg) {
-		alertChan <- msg.Data
+	sub, err := pubSub.Subscribe(topic, func(msg *nats.Msg) {
+		buffer.offer(bufferedMessage{msg: fromNATS(msg)})
 	})
 	if err != nil {
-		return err
+		buffer.close()
+		return nil, natsError(err)
 	}
-	return nil
+	return newNATSSubscription(sub, buffer, nil), nil
 }
 
 // Publish sends data to a specified topic through the message streaming system.
@@ -53,13 +74,136 @@ func (sh *StreamHandler) Publish(topic string, data []byte) error {
 	pubSub := natsdriver.NewPubSub(sh.natsDriver)
 	err := pubSub.Publish(topic, data)
 	if err != nil {
+		return natsError(err)
+	}
+	return nil
+}
+
+// PublishMsg publishes msg with its headers. Core NATS publishes without
+// waiting for the server, so ctx is only checked before publishing.
+func (sh *StreamHandler) PublishMsg(ctx context.Context, msg *Message) error {
+	if err := ctx.Err(); err != nil {
 		return err
 	}
+	pubSub := natsdriver.NewPubSub(sh.natsDriver)
+	if err := pubSub.PublishMsg(toNATS(msg)); err != nil {
+		return natsError(err)
+	}
 	return nil
 }
 
+// Conn returns the NATS connection, e.g. for request/reply.
+func (sh *StreamHandler) Conn() *nats.Conn {
+	return sh.natsDriver.Conn()
+}
+
 // Close terminates the connection to the NATS server and releases associated resources.
 // This method should be called when the StreamHandler is no longer needed.
 func (sh *StreamHandler) Close() {
 	sh.natsDriver.Close()
 }
+
+// toNATS converts msg to a NATS message, mapping its headers to NATS headers.
+func toNATS(msg *Message) *nats.Msg {
+	natsMsg := nats.NewMsg(msg.Subject)
+	natsMsg.Data = msg.Data
+	for key, value := range msg.Header {
+		// Assigned directly, since Header.Set would canonicalize the key.
+		natsMsg.Header[key] = []string{value}
+	}
+	return natsMsg
+}
+
+// fromNATS converts a received NATS message, keeping the first value of
+// every header.
+func fromNATS(natsMsg *nats.Msg) *Message {
+	msg := &Message{Subject: natsMsg.Subject, Data: natsMsg.Data}
+	if len(natsMsg.Header) > 0 {
+		msg.Header = make(Header, len(natsMsg.Header))
+		for key, values := range natsMsg.Header {
+			if len(values) > 0 {
+				msg.Header[key] = values[0]
+			}
+		}
+	}
+	return msg
+}
+
+// natsSubscription is the Subscription of StreamHandler and JetStreamHandler.
+type natsSubscription struct {
+	sub      *nats.Subscription
+	buffer   *subscriptionBuffer
+	draining atomic.Bool
+	release  func()
+	done     chan struct{}
+	once     sync.Once
+}
+
+// newNATSSubscription wraps sub. release, if not nil, is called when the
+// subscription ends, before Done is closed.
+func newNATSSubscription(sub *nats.Subscription, buffer *subscriptionBuffer, release func()) *natsSubscription {
+	s := &natsSubscription{sub: sub, buffer: buffer, release: release, done: make(chan struct{})}
+	closed := sub.StatusChanged(nats.SubscriptionClosed)
+	go func() {
+		// The subscription is closed by Unsubscribe, a completed Drain or
+		// the connection closing; Drain finishes itself once the buffer is
+		// flushed.
+		<-closed
+		if !s.draining.Load() {
+			s.finish()
+		}
+	}()
+	return s
+}
+
+func (s *natsSubscription) Unsubscribe() error {
+	defer s.finish()
+	if err := s.sub.Unsubscribe(); err != nil && !errors.Is(err, nats.ErrBadSubscription) {
+		return natsError(err)
+	}
+	return nil
+}
+
+func (s *natsSubscription) Drain(timeout time.Duration) error {
+	deadline := time.After(timeout)
+	closed := s.sub.StatusChanged(nats.SubscriptionClosed)
+	s.draining.Store(true)
+	if err := s.sub.Drain(); err != nil {
+		s.finish()
+		if errors.Is(err, nats.ErrBadSubscription) {
+			return nil
+		}
+		return natsError(err)
+	}
+
+	select {
+	case <-closed:
+	case <-deadline:
+		_ = s.Unsubscribe()
+		return fmt.Errorf("%w: %s", ErrDrainTimeout, s.sub.Subject)
+	}
+	if !s.buffer.waitEmpty(deadline) {
+		s.finish()
+		return fmt.Errorf("%w: %s", ErrDrainTimeout, s.sub.Subject)
+	}
+	s.finish()
+	return nil
+}
+
+func (s *natsSubscription) Done() <-chan struct{} {
+	return s.done
+}
+
+func (s *natsSubscription) Stats() SubscriptionStats {
+	return s.buffer.options.counters.Stats()
+}
+
+func (s *natsSubscription) finish() {
+	s.once.Do(func() {
+		s.buffer.close()
+		if s.release != nil {
+			s.release()
+		}
+		close(s.done)
+	})
+}
@@ -0,0 +1,463 @@
+package alerting
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	// ErrInvalidSubscription is returned by Subscribe for options the Stream
+	// cannot honour.
+	ErrInvalidSubscription = errors.New("invalid subscription")
+	// ErrDrainTimeout is returned by Subscription.Drain when the received
+	// messages could not be delivered in time.
+	ErrDrainTimeout = errors.New("drain timed out")
+)
+
+// Subscription is a handle on a subscription returned by Subscribe.
+type Subscription interface {
+	// Unsubscribe stops the subscription at once. Messages received but not
+	// yet handed to the channel are discarded; JetStream redelivers them.
+	Unsubscribe() error
+	// Drain stops receiving new messages and returns once the received ones
+	// have been handed to the channel. If that takes longer than timeout it
+	// unsubscribes and returns an error matching ErrDrainTimeout.
+	Drain(timeout time.Duration) error
+	// Done is closed once the subscription has ended, also when its Stream
+	// was closed.
+	Done() <-chan struct{}
+	Stats() SubscriptionStats
+}
+
+// OverflowPolicy decides what a subscription does with a message that
+// arrives while its buffer is full.
+type OverflowPolicy int
+
+const (
+	// OverflowBlock waits for room in the buffer. The transport stops
+	// delivering further messages to the subscription meanwhile.
+	OverflowBlock OverflowPolicy = iota
+	// OverflowDropOldest drops the oldest buffered message to make room.
+	OverflowDropOldest
+	// OverflowDropNewest drops the arriving message.
+	OverflowDropNewest
+	// OverflowNak hands the arriving message back to the server for
+	// redelivery a second later. Only JetStream subscriptions support it.
+	OverflowNak
+)
+
+func (p OverflowPolicy) String() string {
+	switch p {
+	case OverflowBlock:
+		return "block"
+	case OverflowDropOldest:
+		return "drop-oldest"
+	case OverflowDropNewest:
+		return "drop-newest"
+	case OverflowNak:
+		return "nak"
+	}
+	return fmt.Sprintf("OverflowPolicy(%d)", int(p))
+}
+
+// SubscriptionStats is a snapshot of a subscription's counters.
+type SubscriptionStats struct {
+	// Delivered counts messages handed to the subscriber's channel.
+	Delivered uint64
+	// Dropped counts messages discarded by a drop policy.
+	Dropped uint64
+	// Nacked counts messages handed back for redelivery by OverflowNak or a
+	// failed MessageHandler.
+	Nacked uint64
+	// Pending is the number of buffered messages not yet delivered.
+	Pending int
+}
+
+// SubscriptionCounters collects the counters of a subscription, see
+// WithCounters.
+type SubscriptionCounters struct {
+	delivered atomic.Uint64
+	dropped   atomic.Uint64
+	nacked    atomic.Uint64
+	pending   atomic.Int64
+}
+
+// Stats returns the current counters.
+func (c *SubscriptionCounters) Stats() SubscriptionStats {
+	return SubscriptionStats{
+		Delivered: c.delivered.Load(),
+		Dropped:   c.dropped.Load(),
+		Nacked:    c.nacked.Load(),
+		Pending:   int(c.pending.Load()),
+	}
+}
+
+// SlowConsumerFunc is called from the transport's delivery goroutine when a
+// subscription's buffer fills up, once each time it does. It must not block.
+type SlowConsumerFunc func(subject string, stats SubscriptionStats)
+
+// SubscribeOption configures how a subscription buffers messages for a
+// subscriber that cannot keep up. Streams that read at the subscriber's
+// pace, like RedisStream and KafkaStream, never overflow and ignore all
+// options but WithGroup.
+type SubscribeOption func(*subscribeOptions)
+
+type subscribeOptions struct {
+	bufferSize   int
+	overflow     OverflowPolicy
+	slowConsumer SlowConsumerFunc
+	counters     *SubscriptionCounters
+	group        string
+}
+
+func newSubscribeOptions(opts []SubscribeOption) subscribeOptions {
+	options := subscribeOptions{bufferSize: 64}
+	for _, opt := range opts {
+		opt(&options)
+	}
+	if options.counters == nil {
+		options.counters = &SubscriptionCounters{}
+	}
+	return options
+}
+
+// WithBufferSize sets how many messages a subscription buffers between the
+// transport and the subscriber's channel. Default 64.
+func WithBufferSize(size int) SubscribeOption {
+	return func(o *subscribeOptions) {
+		if size > 0 {
+			o.bufferSize = size
+		}
+	}
+}
+
+// WithOverflowPolicy sets what happens to messages arriving while the buffer
+// is full. Default OverflowBlock.
+func WithOverflowPolicy(policy OverflowPolicy) SubscribeOption {
+	return func(o *subscribeOptions) {
+		o.overflow = policy
+	}
+}
+
+// WithSlowConsumerHandler calls fn whenever the buffer fills up.
+func WithSlowConsumerHandler(fn SlowConsumerFunc) SubscribeOption {
+	return func(o *subscribeOptions) {
+		o.slowConsumer = fn
+	}
+}
+
+// WithCounters records the subscription's delivered, dropped, nacked and
+// pending messages in counters.
+func WithCounters(counters *SubscriptionCounters) SubscribeOption {
+	return func(o *subscribeOptions) {
+		o.counters = counters
+	}
+}
+
+// WithGroup makes the subscription share the topic's messages with the other
+// subscriptions of group, also those of other processes: each message is
+// delivered to one of them. Without it every subscription receives every
+// message. Durable streams keep the group's position, so it must be a valid
+// consumer group or durable name of the transport.
+func WithGroup(group string) SubscribeOption {
+	return func(o *subscribeOptions) {
+		o.group = group
+	}
+}
+
+// groupSlots names the consumer groups of durable streams for subscriptions
+// without WithGroup. Each active subscription of a topic takes the lowest
+// free slot, named base for the first and base-2, base-3, ... for the
+// others, so that every subscription receives every message. Slots are
+// released when the subscription ends, so a later subscription resumes
+// where it stopped, and replicas subscribing alike share their groups.
+type groupSlots struct {
+	mu   sync.Mutex
+	used map[string]map[int]bool
+}
+
+// acquire returns the group of a new subscription of topic and the func
+// that releases it.
+func (g *groupSlots) acquire(topic, base string) (string, func()) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.used == nil {
+		g.used = make(map[string]map[int]bool)
+	}
+	if g.used[topic] == nil {
+		g.used[topic] = make(map[int]bool)
+	}
+	slot := 1
+	for g.used[topic][slot] {
+		slot++
+	}
+	g.used[topic][slot] = true
+
+	group := base
+	if slot > 1 {
+		group = fmt.Sprintf("%s-%d", base, slot)
+	}
+	return group, func() {
+		g.mu.Lock()
+		defer g.mu.Unlock()
+		delete(g.used[topic], slot)
+	}
+}
+
+// group returns the consumer group of a new subscription of topic, the one
+// set by WithGroup or a free slot, and the func releasing it once the
+// subscription has ended.
+func (g *groupSlots) group(topic, base string, options subscribeOptions) (string, func()) {
+	if options.group != "" {
+		return options.group, func() {}
+	}
+	return g.acquire(topic, base)
+}
+
+// bufferedMessage is a message waiting in a subscriptionBuffer. done is
+// called once it has been delivered or dropped, e.g. to acknowledge it. nak
+// hands it back for redelivery, under OverflowNak or when the handler fails;
+// it is nil for transports that cannot redeliver.
+type bufferedMessage struct {
+	msg  *Message
+	done func()
+	nak  func()
+}
+
+// subscriptionBuffer sits between a transport callback and a subscriber's
+// handler so that a slow subscriber is handled by the overflow policy
+// instead of stalling the transport.
+type subscriptionBuffer struct {
+	subject string
+	options subscribeOptions
+	handler MessageHandler
+	ctx     context.Context
+	cancel  context.CancelFunc
+
+	mu       sync.Mutex
+	queue    []bufferedMessage
+	inFlight bool
+	full     bool
+	closed   bool
+	room     *sync.Cond
+	signal   chan struct{}
+	emptied  chan struct{}
+}
+
+func newSubscriptionBuffer(subject string, handler MessageHandler, options subscribeOptions) *subscriptionBuffer {
+	ctx, cancel := context.WithCancel(context.Background())
+	b := &subscriptionBuffer{
+		subject: subject,
+		options: options,
+		handler: handler,
+		ctx:     ctx,
+		cancel:  cancel,
+		signal:  make(chan struct{}, 1),
+		emptied: make(chan struct{}, 1),
+	}
+	b.room = sync.NewCond(&b.mu)
+	go b.run()
+	return b
+}
+
+// offer buffers a message, applying the overflow policy if the buffer is
+// full. Messages offered after close are discarded.
+func (b *subscriptionBuffer) offer(msg bufferedMessage) {
+	counters := b.options.counters
+
+	b.mu.Lock()
+	if len(b.queue) >= b.options.bufferSize && !b.closed {
+		b.overflowed()
+		switch b.options.overflow {
+		case OverflowDropNewest:
+			b.mu.Unlock()
+			counters.dropped.Add(1)
+			finish(msg)
+			return
+		case OverflowNak:
+			b.mu.Unlock()
+			counters.nacked.Add(1)
+			msg.nak()
+			return
+		case OverflowDropOldest:
+			oldest := b.queue[0]
+			b.queue = b.queue[1:]
+			counters.dropped.Add(1)
+			counters.pending.Add(-1)
+			finish(oldest)
+		default:
+			for len(b.queue) >= b.options.bufferSize && !b.closed {
+				b.room.Wait()
+			}
+		}
+	}
+	if b.closed {
+		b.mu.Unlock()
+		return
+	}
+	b.queue = append(b.queue, msg)
+	counters.pending.Add(1)
+	b.mu.Unlock()
+
+	notify(b.signal)
+}
+
+// overflowed reports the buffer as full to the slow-consumer handler, once
+// until it drains again. b.mu must be held.
+func (b *subscriptionBuffer) overflowed() {
+	if b.full {
+		return
+	}
+	b.full = true
+	if b.options.slowConsumer != nil {
+		b.options.slowConsumer(b.subject, b.options.counters.Stats())
+	}
+}
+
+// waitEmpty waits until every buffered message has been delivered and
+// reports whether it was before timeout fired.
+func (b *subscriptionBuffer) waitEmpty(timeout <-chan time.Time) bool {
+	for !b.empty() {
+		select {
+		case <-b.emptied:
+		case <-b.ctx.Done():
+			return false
+		case <-timeout:
+			return false
+		}
+	}
+	return true
+}
+
+func (b *subscriptionBuffer) empty() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.queue) == 0 && !b.inFlight
+}
+
+// close stops delivery and discards the buffered messages without settling
+// them, so that JetStream redelivers them.
+func (b *subscriptionBuffer) close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return
+	}
+	b.closed = true
+	b.options.counters.pending.Add(-int64(len(b.queue)))
+	b.queue = nil
+	b.room.Broadcast()
+	b.cancel()
+}
+
+func (b *subscriptionBuffer) run() {
+	counters := b.options.counters
+	for {
+		b.mu.Lock()
+		if len(b.queue) == 0 {
+			b.full = false
+			b.mu.Unlock()
+			select {
+			case <-b.signal:
+				continue
+			case <-b.ctx.Done():
+				return
+			}
+		}
+		msg := b.queue[0]
+		b.queue = b.queue[1:]
+		b.inFlight = true
+		b.room.Signal()
+		b.mu.Unlock()
+
+		err := b.handler(b.ctx, msg.msg)
+		counters.pending.Add(-1)
+		if err != nil && b.ctx.Err() != nil {
+			// Stopped by close; the message is left unsettled.
+			return
+		}
+		if err != nil {
+			fmt.Printf("Subscription :: %s :: %v\n", b.subject, err)
+		}
+		if err != nil && msg.nak != nil {
+			counters.nacked.Add(1)
+			msg.nak()
+		} else {
+			counters.delivered.Add(1)
+			finish(msg)
+		}
+
+		b.mu.Lock()
+		b.inFlight = false
+		b.mu.Unlock()
+		notify(b.emptied)
+	}
+}
+
+func finish(msg bufferedMessage) {
+	if msg.done != nil {
+		msg.done()
+	}
+}
+
+// notify signals ch without blocking.
+func notify(ch chan struct{}) {
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
+}
+
+// loopSubscription is the Subscription of a Stream whose goroutine reads at
+// the subscriber's pace. The goroutine runs while running reports true,
+// delivers with ctx and closes done when it exits.
+type loopSubscription struct {
+	ctx      context.Context
+	cancel   context.CancelFunc
+	draining atomic.Bool
+	done     chan struct{}
+	counters SubscriptionCounters
+}
+
+func newLoopSubscription(parent context.Context) *loopSubscription {
+	ctx, cancel := context.WithCancel(parent)
+	return &loopSubscription{ctx: ctx, cancel: cancel, done: make(chan struct{})}
+}
+
+// running reports whether the goroutine should read another batch.
+func (s *loopSubscription) running() bool {
+	return s.ctx.Err() == nil && !s.draining.Load()
+}
+
+func (s *loopSubscription) Unsubscribe() error {
+	s.cancel()
+	<-s.done
+	return nil
+}
+
+// Drain lets the goroutine deliver the batch it has read and waits for it to
+// exit.
+func (s *loopSubscription) Drain(timeout time.Duration) error {
+	s.draining.Store(true)
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-s.done:
+		return nil
+	case <-timer.C:
+		_ = s.Unsubscribe()
+		return ErrDrainTimeout
+	}
+}
+
+func (s *loopSubscription) Done() <-chan struct{} {
+	return s.done
+}
+
+func (s *loopSubscription) Stats() SubscriptionStats {
+	return s.counters.Stats()
+}
@@ -0,0 +1,221 @@
+package alerting
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// offerAll offers messages "0".."n-1" to buffer and returns the messages
+// that were finished, i.e. delivered or dropped, and nacked.
+func offerAll(t *testing.T, buffer *subscriptionBuffer, n int) (finished, nacked chan string) {
+	t.Helper()
+	finished = make(chan string, n)
+	nacked = make(chan string, n)
+	for i := 0; i < n; i++ {
+		data := fmt.Sprint(i)
+		buffer.offer(bufferedMessage{
+			msg:  &Message{Data: []byte(data)},
+			done: func() { finished <- data },
+			nak:  func() { nacked <- data },
+		})
+	}
+	return finished, nacked
+}
+
+func receive(t *testing.T, channel chan []byte) string {
+	t.Helper()
+	select {
+	case data := <-channel:
+		return string(data)
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for a message")
+		return ""
+	}
+}
+
+func TestSubscriptionBuffer_DropNewest(t *testing.T) {
+	channel := make(chan []byte)
+	counters := &SubscriptionCounters{}
+	var slow []SubscriptionStats
+	options := newSubscribeOptions([]SubscribeOption{
+		WithBufferSize(2),
+		WithOverflowPolicy(OverflowDropNewest),
+		WithCounters(counters),
+		WithSlowConsumerHandler(func(subject string, stats SubscriptionStats) {
+			slow = append(slow, stats)
+		}),
+	})
+	buffer := newSubscriptionBuffer("test.alert", channelHandler(channel), options)
+
+	// Wait for the first message to be taken off the buffer, so that the
+	// buffer holds 0 and 1 and drops 2 and 3.
+	buffer.offer(bufferedMessage{msg: &Message{Data: []byte("first")}})
+	waitFor(t, func() bool { return queued(buffer) == 0 })
+	finished, _ := offerAll(t, buffer, 4)
+
+	if got := counters.Stats(); got.Dropped != 2 || got.Pending != 3 {
+		t.Errorf("Stats() = %+v; want 2 dropped and 3 pending", got)
+	}
+	if len(slow) != 1 {
+		t.Errorf("slow consumer reported %d times; want once", len(slow))
+	}
+	for _, want := range []string{"2", "3"} {
+		if got := <-finished; got != want {
+			t.Errorf("dropped %s; want %s", got, want)
+		}
+	}
+	for _, want := range []string{"first", "0", "1"} {
+		if got := receive(t, channel); got != want {
+			t.Errorf("received %s; want %s", got, want)
+		}
+	}
+	waitFor(t, func() bool { return counters.Stats().Delivered == 3 })
+}
+
+func TestSubscriptionBuffer_DropOldest(t *testing.T) {
+	channel := make(chan []byte, 1)
+	counters := &SubscriptionCounters{}
+	buffer := newSubscriptionBuffer("test.alert", channelHandler(channel), newSubscribeOptions([]SubscribeOption{
+		WithBufferSize(2),
+		WithOverflowPolicy(OverflowDropOldest),
+		WithCounters(counters),
+	}))
+
+	buffer.offer(bufferedMessage{msg: &Message{Data: []byte("first")}})
+	waitFor(t, func() bool { return counters.Stats().Delivered == 1 })
+	buffer.offer(bufferedMessage{msg: &Message{Data: []byte("blocked")}})
+	waitFor(t, func() bool { return queued(buffer) == 0 })
+	offerAll(t, buffer, 4)
+
+	if got := counters.Stats(); got.Dropped != 2 {
+		t.Errorf("Stats() = %+v; want 2 dropped", got)
+	}
+	for _, want := range []string{"first", "blocked", "2", "3"} {
+		if got := receive(t, channel); got != want {
+			t.Errorf("received %s; want %s", got, want)
+		}
+	}
+}
+
+func TestSubscriptionBuffer_Nak(t *testing.T) {
+	channel := make(chan []byte)
+	counters := &SubscriptionCounters{}
+	buffer := newSubscriptionBuffer("test.alert", channelHandler(channel), newSubscribeOptions([]SubscribeOption{
+		WithBufferSize(1),
+		WithOverflowPolicy(OverflowNak),
+		WithCounters(counters),
+	}))
+
+	buffer.offer(bufferedMessage{msg: &Message{Data: []byte("in flight")}})
+	waitFor(t, func() bool { return queued(buffer) == 0 })
+	_, nacked := offerAll(t, buffer, 3)
+
+	if got := counters.Stats(); got.Nacked != 2 || got.Dropped != 0 {
+		t.Errorf("Stats() = %+v; want 2 nacked", got)
+	}
+	if got := <-nacked; got != "1" {
+		t.Errorf("nacked %s first; want 1", got)
+	}
+}
+
+func TestSubscriptionBuffer_Block(t *testing.T) {
+	channel := make(chan []byte)
+	buffer := newSubscriptionBuffer("test.alert", channelHandler(channel), newSubscribeOptions([]SubscribeOption{WithBufferSize(1)}))
+
+	offered := make(chan struct{})
+	go func() {
+		offerAll(t, buffer, 3)
+		close(offered)
+	}()
+	select {
+	case <-offered:
+		t.Fatal("offer returned with a full buffer; want it to block")
+	case <-time.After(50 * time.Millisecond):
+	}
+	for _, want := range []string{"0", "1", "2"} {
+		if got := receive(t, channel); got != want {
+			t.Errorf("received %s; want %s", got, want)
+		}
+	}
+	<-offered
+}
+
+func TestSubscriptionBuffer_WaitEmptyAndClose(t *testing.T) {
+	channel := make(chan []byte)
+	counters := &SubscriptionCounters{}
+	buffer := newSubscriptionBuffer("test.alert", channelHandler(channel), newSubscribeOptions([]SubscribeOption{WithCounters(counters)}))
+	finished, _ := offerAll(t, buffer, 2)
+
+	if buffer.waitEmpty(time.After(20 * time.Millisecond)) {
+		t.Fatal("waitEmpty() = true with undelivered messages")
+	}
+	go func() {
+		receive(t, channel)
+		receive(t, channel)
+	}()
+	if !buffer.waitEmpty(time.After(time.Second)) {
+		t.Fatal("waitEmpty() = false; want the buffer emptied by the receiver")
+	}
+	if len(finished) != 2 {
+		t.Errorf("%d messages finished; want 2", len(finished))
+	}
+
+	offerAll(t, buffer, 1)
+	buffer.close()
+	offerAll(t, buffer, 1)
+	if got := counters.Stats(); got.Delivered != 2 || got.Pending != 0 {
+		t.Errorf("Stats() after close = %+v; want 2 delivered and nothing pending", got)
+	}
+	if queued(buffer) != 0 {
+		t.Error("close() kept buffered messages")
+	}
+}
+
+func TestSubscriptionBuffer_NaksFailedHandler(t *testing.T) {
+	counters := &SubscriptionCounters{}
+	handler := func(_ context.Context, msg *Message) error {
+		if string(msg.Data) == "1" {
+			return errors.New("handler failed")
+		}
+		return nil
+	}
+	buffer := newSubscriptionBuffer("test.alert", handler, newSubscribeOptions([]SubscribeOption{WithCounters(counters)}))
+	defer buffer.close()
+	finished, nacked := offerAll(t, buffer, 3)
+
+	waitFor(t, func() bool { return len(finished)+len(nacked) == 3 })
+	if got := <-nacked; got != "1" {
+		t.Errorf("nacked %s; want the failed message 1", got)
+	}
+	if got := counters.Stats(); got.Delivered != 2 || got.Nacked != 1 {
+		t.Errorf("Stats() = %+v; want 2 delivered and 1 nacked", got)
+	}
+}
+
+func TestStreamHandler_RejectsNak(t *testing.T) {
+	var sh StreamHandler
+	_, err := sh.Subscribe("test.alert", make(chan []byte), WithOverflowPolicy(OverflowNak))
+	if !errors.Is(err, ErrInvalidSubscription) {
+		t.Fatalf("Subscribe() with OverflowNak error = %v; want ErrInvalidSubscription", err)
+	}
+}
+
+func queued(buffer *subscriptionBuffer) int {
+	buffer.mu.Lock()
+	defer buffer.mu.Unlock()
+	return len(buffer.queue)
+}
+
+func waitFor(t *testing.T, condition func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for condition")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
@@ -0,0 +1,292 @@
+package alerting
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/avilikof/go-shared-libs/event"
+)
+
+// TenantPrefix starts every key and subject of a tenant, which lives under
+// TenantPrefix + tenant ID + ".", e.g. "tenant.billing.alert.store".
+const TenantPrefix = "tenant."
+
+var (
+	ErrInvalidTenant = errors.New("invalid tenant")
+	// ErrTenantMismatch is returned when a tenant publishes an event that
+	// belongs to another tenant.
+	ErrTenantMismatch = errors.New("event belongs to another tenant")
+	// ErrQuotaExceeded is returned when a tenant exceeds its alert count or
+	// publish rate quota.
+	ErrQuotaExceeded = errors.New("tenant quota exceeded")
+)
+
+var tenantIDPattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// TenantQuota limits a tenant. Zero fields are unlimited.
+type TenantQuota struct {
+	// MaxAlerts is the number of alerts the tenant may have firing at once.
+	MaxAlerts int `json:"max_alerts,omitempty" yaml:"max_alerts"`
+	// PublishRate is the number of messages per second the tenant may
+	// publish on its input subjects, with bursts of up to PublishBurst
+	// messages. PublishBurst defaults to PublishRate rounded up. The
+	// Processor's own StorageTopic and EvetTopic publishes are not limited,
+	// so that a throttled tenant never keeps it from storing and reporting
+	// the alerts it accepted.
+	PublishRate  float64 `json:"publish_rate,omitempty" yaml:"publish_rate"`
+	PublishBurst int     `json:"publish_burst,omitempty" yaml:"publish_burst"`
+}
+
+// Tenant namespaces storage keys and stream subjects so that several teams
+// can share one cluster without seeing each other's alerts. Wrap the Storage
+// and Stream handed to a Processor with Storage and Stream; the Processor's
+// alert.store and alert.event subjects then become
+// tenant.<id>.alert.store and tenant.<id>.alert.event.
+//
+// The quota is shared by every Stream of the tenant. Firing alerts are
+// counted as they are published on StorageTopic, starting from zero when the
+// Tenant is created.
+type Tenant struct {
+	id     string
+	prefix string
+	quota  TenantQuota
+
+	mu       sync.Mutex
+	firing   map[string]bool
+	tokens   float64
+	refillAt time.Time
+	now      func() time.Time
+}
+
+func NewTenant(id string, quota TenantQuota) (*Tenant, error) {
+	if !tenantIDPattern.MatchString(id) {
+		return nil, fmt.Errorf("%w: %q must only contain letters, digits, '-' and '_'", ErrInvalidTenant, id)
+	}
+	if quota.MaxAlerts < 0 || quota.PublishRate < 0 || quota.PublishBurst < 0 {
+		return nil, fmt.Errorf("%w: %s: quotas must not be negative", ErrInvalidTenant, id)
+	}
+	if quota.PublishRate > 0 && quota.PublishBurst == 0 {
+		quota.PublishBurst = int(math.Ceil(quota.PublishRate))
+	}
+	return &Tenant{
+		id:     id,
+		prefix: TenantPrefix + id + ".",
+		quota:  quota,
+		firing: make(map[string]bool),
+		tokens: float64(quota.PublishBurst),
+		now:    time.Now,
+	}, nil
+}
+
+func (t *Tenant) ID() string { return t.id }
+
+// Subject returns the subject topic is published on for the tenant.
+func (t *Tenant) Subject(topic string) string {
+	return t.prefix + topic
+}
+
+// Storage returns a Storage that stores every key of the tenant in storage
+// under the tenant prefix.
+func (t *Tenant) Storage(storage Storage) *TenantStorage {
+	return &TenantStorage{tenant: t, storage: storage}
+}
+
+// Stream returns a Stream that publishes and subscribes to the tenant's
+// subjects only, stamps the tenant ID on published events and enforces the
+// tenant's quota.
+func (t *Tenant) Stream(stream Stream) *TenantStream {
+	return &TenantStream{tenant: t, stream: stream}
+}
+
+// allowPublish takes a token from the publish rate bucket.
+func (t *Tenant) allowPublish() error {
+	if t.quota.PublishRate == 0 {
+		return nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := t.now()
+	if !t.refillAt.IsZero() {
+		t.tokens += now.Sub(t.refillAt).Seconds() * t.quota.PublishRate
+		t.tokens = math.Min(t.tokens, float64(t.quota.PublishBurst))
+	}
+	t.refillAt = now
+	if t.tokens < 1 {
+		return fmt.Errorf("%w: %s: more than %g messages per second", ErrQuotaExceeded, t.id, t.quota.PublishRate)
+	}
+	t.tokens--
+	return nil
+}
+
+// storedAlert is the part of a V1 or V2 alert needed to count firing alerts.
+type storedAlert struct {
+	ID     string `json:"id"`
+	State  string `json:"state"`
+	Firing *bool  `json:"firing"`
+}
+
+func (a storedAlert) isFiring() bool {
+	if a.Firing != nil {
+		return *a.Firing
+	}
+	return a.State != "resolved"
+}
+
+// trackAlert checks that storing data keeps the tenant within MaxAlerts and
+// returns the function recording it once it has been published.
+func (t *Tenant) trackAlert(data []byte) (func(), error) {
+	var alert storedAlert
+	if err := json.Unmarshal(data, &alert); err != nil || alert.ID == "" {
+		return func() {}, nil
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !alert.isFiring() {
+		return func() {
+			t.mu.Lock()
+			delete(t.firing, alert.ID)
+			t.mu.Unlock()
+		}, nil
+	}
+	if t.quota.MaxAlerts > 0 && !t.firing[alert.ID] && len(t.firing) >= t.quota.MaxAlerts {
+		return nil, fmt.Errorf("%w: %s: more than %d firing alerts", ErrQuotaExceeded, t.id, t.quota.MaxAlerts)
+	}
+	return func() {
+		t.mu.Lock()
+		t.firing[alert.ID] = true
+		t.mu.Unlock()
+	}, nil
+}
+
+// TenantStorage is a Storage holding the keys of one tenant.
+type TenantStorage struct {
+	tenant  *Tenant
+	storage Storage
+}
+
+func (s *TenantStorage) Get(key string) ([]byte, error) {
+	return s.storage.Get(s.tenant.prefix + key)
+}
+
+func (s *TenantStorage) Set(key string, value []byte, expires time.Duration) error {
+	return s.storage.Set(s.tenant.prefix+key, value, expires)
+}
+
+// Delete removes key if the wrapped storage implements KeyDeleter.
+func (s *TenantStorage) Delete(key string) error {
+	deleter, ok := s.storage.(KeyDeleter)
+	if !ok {
+		return fmt.Errorf("%w: storage cannot delete keys", errors.ErrUnsupported)
+	}
+	return deleter.Delete(s.tenant.prefix + key)
+}
+
+// List returns the tenant's keys without the tenant prefix if the wrapped
+// storage implements KeyLister.
+func (s *TenantStorage) List() ([]string, error) {
+	lister, ok := s.storage.(KeyLister)
+	if !ok {
+		return nil, fmt.Errorf("%w: storage cannot list keys", errors.ErrUnsupported)
+	}
+	keys, err := lister.List()
+	if err != nil {
+		return nil, err
+	}
+	var tenantKeys []string
+	for _, key := range keys {
+		if tenantKey, ok := strings.CutPrefix(key, s.tenant.prefix); ok {
+			tenantKeys = append(tenantKeys, tenantKey)
+		}
+	}
+	return tenantKeys, nil
+}
+
+// TenantStream is a Stream publishing and subscribing to the subjects of one
+// tenant.
+type TenantStream struct {
+	tenant *Tenant
+	stream Stream
+}
+
+// Publish publishes data on the tenant's topic. Events published on
+// EvetTopic are stamped with the tenant ID; events stamped with another
+// tenant are rejected with ErrTenantMismatch.
+func (s *TenantStream) Publish(topic string, data []byte) error {
+	data, published, err := s.prepare(topic, data)
+	if err != nil {
+		return err
+	}
+	if err := s.stream.Publish(s.tenant.Subject(topic), data); err != nil {
+		return err
+	}
+	published()
+	return nil
+}
+
+// PublishMsg is Publish for a message with headers. The HeaderTenant header
+// is set to the tenant ID.
+func (s *TenantStream) PublishMsg(ctx context.Context, msg *Message) error {
+	data, published, err := s.prepare(msg.Subject, msg.Data)
+	if err != nil {
+		return err
+	}
+	header := msg.Header.Clone()
+	header[HeaderTenant] = s.tenant.id
+	tenantMsg := &Message{Subject: s.tenant.Subject(msg.Subject), Data: data, Header: header}
+	if err := PublishMsg(ctx, s.stream, tenantMsg); err != nil {
+		return err
+	}
+	published()
+	return nil
+}
+
+// prepare applies the tenant's quotas to a message about to be published on
+// topic and returns its data, stamped if it is an event. published must be
+// called once it has been published.
+func (s *TenantStream) prepare(topic string, data []byte) ([]byte, func(), error) {
+	published := func() {}
+	switch topic {
+	case EvetTopic:
+		ev, err := event.FromBytes(data)
+		if err != nil {
+			return nil, nil, err
+		}
+		if ev.Tenant != "" && ev.Tenant != s.tenant.id {
+			return nil, nil, fmt.Errorf("%w: %s published an event of %s", ErrTenantMismatch, s.tenant.id, ev.Tenant)
+		}
+		ev.Tenant = s.tenant.id
+		data = ev.Bytes()
+	case StorageTopic:
+		var err error
+		if published, err = s.tenant.trackAlert(data); err != nil {
+			return nil, nil, err
+		}
+	default:
+		if err := s.tenant.allowPublish(); err != nil {
+			return nil, nil, err
+		}
+	}
+	return data, published, nil
+}
+
+func (s *TenantStream) Subscribe(topic string, channel chan []byte, opts ...SubscribeOption) (Subscription, error) {
+	return s.stream.Subscribe(s.tenant.Subject(topic), channel, opts...)
+}
+
+// SubscribeMsg is Subscribe calling handler with the messages. Their subjects
+// are stripped of the tenant prefix.
+func (s *TenantStream) SubscribeMsg(topic string, handler MessageHandler, opts ...SubscribeOption) (Subscription, error) {
+	return SubscribeMsg(s.stream, s.tenant.Subject(topic), func(ctx context.Context, msg *Message) error {
+		msg.Subject = strings.TrimPrefix(msg.Subject, s.tenant.prefix)
+		return handler(ctx, msg)
+	}, opts...)
+}
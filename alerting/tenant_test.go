@@ -0,0 +1,144 @@
+package alerting
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/avilikof/go-shared-libs/alerts"
+	"github.com/avilikof/go-shared-libs/event"
+)
+
+func TestTenant_Isolation(t *testing.T) {
+	storage := newMemStorage()
+	stream := newMemStream()
+	billing, _ := NewTenant("billing", TenantQuota{})
+	search, _ := NewTenant("search", TenantQuota{})
+
+	p := NewProcessorV2(nil, billing.Storage(storage), billing.Stream(stream))
+	p.processAlertV2(alerts.NewAlertV2("disk", "node-exporter", "critical", "disk_full", "disk", "disk", time.Now(), alerts.AlertStateActive))
+
+	if got := len(stream.published["tenant.billing.alert.store"]); got != 1 {
+		t.Fatalf("expected the alert on the tenant's store subject, got %d", got)
+	}
+	if len(stream.published[StorageTopic]) != 0 || len(stream.published[EvetTopic]) != 0 {
+		t.Error("expected nothing on the global subjects")
+	}
+	events := stream.published["tenant.billing.alert.event"]
+	if len(events) != 1 {
+		t.Fatalf("expected 1 tenant event, got %d", len(events))
+	}
+	if ev, _ := event.FromBytes(events[0]); ev.Tenant != "billing" || ev.Action != event.ActionFiring {
+		t.Errorf("event = %+v; want a firing event of tenant billing", ev)
+	}
+
+	if err := billing.Storage(storage).Set("disk", []byte("billing"), 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := search.Storage(storage).Get("disk"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("search Get(disk) error = %v; want ErrNotFound", err)
+	}
+	if _, err := storage.Get("tenant.billing.disk"); err != nil {
+		t.Errorf("expected the key under the tenant prefix: %v", err)
+	}
+
+	foreign := event.NewEvent("alerting", event.TypeEvent, time.Now(), event.ActionFiring, nil)
+	foreign.Tenant = "billing"
+	if err := search.Stream(stream).Publish(EvetTopic, foreign.Bytes()); !errors.Is(err, ErrTenantMismatch) {
+		t.Errorf("Publish(event of billing) error = %v; want ErrTenantMismatch", err)
+	}
+	if _, err := search.Storage(struct{ Storage }{storage}).List(); !errors.Is(err, errors.ErrUnsupported) {
+		t.Errorf("List() error = %v; want errors.ErrUnsupported", err)
+	}
+}
+
+func TestTenant_AlertQuota(t *testing.T) {
+	tenant, err := NewTenant("billing", TenantQuota{MaxAlerts: 1})
+	if err != nil {
+		t.Fatalf("NewTenant() error = %v", err)
+	}
+	stream := tenant.Stream(newMemStream())
+	alert := func(id string, state alerts.AlertState) []byte {
+		data, _ := alerts.NewAlertV2(id, "test", "critical", "test", "test", id, time.Now(), state).MarshalJSON()
+		return data
+	}
+
+	if err := stream.Publish(StorageTopic, alert("a", alerts.AlertStateActive)); err != nil {
+		t.Fatalf("Publish(a) error = %v", err)
+	}
+	if err := stream.Publish(StorageTopic, alert("a", alerts.AlertStateActive)); err != nil {
+		t.Errorf("refreshing a firing alert error = %v; want nil", err)
+	}
+	if err := stream.Publish(StorageTopic, alert("b", alerts.AlertStateActive)); !errors.Is(err, ErrQuotaExceeded) {
+		t.Errorf("Publish(b) error = %v; want ErrQuotaExceeded", err)
+	}
+	if err := stream.Publish(StorageTopic, alert("a", alerts.AlertStateResolved)); err != nil {
+		t.Fatalf("resolving a error = %v", err)
+	}
+	if err := stream.Publish(StorageTopic, alert("b", alerts.AlertStateActive)); err != nil {
+		t.Errorf("Publish(b) after resolving a error = %v; want nil", err)
+	}
+}
+
+func TestTenant_PublishRate(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	tenant, _ := NewTenant("billing", TenantQuota{PublishRate: 2})
+	tenant.now = func() time.Time { return now }
+	stream := tenant.Stream(newMemStream())
+
+	for i := 0; i < 2; i++ {
+		if err := stream.Publish("test.alert", []byte("{}")); err != nil {
+			t.Fatalf("publish %d error = %v", i, err)
+		}
+	}
+	if err := stream.Publish("test.alert", []byte("{}")); !errors.Is(err, ErrQuotaExceeded) {
+		t.Errorf("publish beyond the burst error = %v; want ErrQuotaExceeded", err)
+	}
+
+	now = now.Add(500 * time.Millisecond)
+	if err := stream.Publish("test.alert", []byte("{}")); err != nil {
+		t.Errorf("publish after refill error = %v; want nil", err)
+	}
+}
+
+func TestTenant_PublishRateSparesProcessor(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	tenant, _ := NewTenant("billing", TenantQuota{PublishRate: 1})
+	tenant.now = func() time.Time { return now }
+	stream := newMemStream()
+	tenantStream := tenant.Stream(stream)
+
+	if err := tenantStream.Publish("test.alert", []byte("{}")); err != nil {
+		t.Fatalf("publish error = %v", err)
+	}
+	if err := tenantStream.Publish("test.alert", []byte("{}")); !errors.Is(err, ErrQuotaExceeded) {
+		t.Fatalf("publish beyond the burst error = %v; want ErrQuotaExceeded", err)
+	}
+
+	// The producers used up the tenant's rate, the Processor still stores
+	// and announces alerts without panicking.
+	input := make(chan *alerts.AlertV2, 3)
+	for _, id := range []string{"disk", "cpu", "mem"} {
+		input <- alerts.NewAlertV2(id, "node-exporter", "critical", "test", id, id, now, alerts.AlertStateActive)
+	}
+	close(input)
+	NewProcessorV2(input, tenant.Storage(newMemStorage()), tenantStream).ProcessV2()
+
+	if got := len(stream.published["tenant.billing.alert.store"]); got != 3 {
+		t.Errorf("expected 3 stored alerts, got %d", got)
+	}
+	if got := len(stream.published["tenant.billing.alert.event"]); got != 3 {
+		t.Errorf("expected 3 firing events, got %d", got)
+	}
+}
+
+func TestNewTenant_Invalid(t *testing.T) {
+	for _, id := range []string{"", "billing.eu", "team>", "a b"} {
+		if _, err := NewTenant(id, TenantQuota{}); !errors.Is(err, ErrInvalidTenant) {
+			t.Errorf("NewTenant(%q) error = %v; want ErrInvalidTenant", id, err)
+		}
+	}
+	if _, err := NewTenant("billing", TenantQuota{MaxAlerts: -1}); !errors.Is(err, ErrInvalidTenant) {
+		t.Errorf("negative quota error = %v; want ErrInvalidTenant", err)
+	}
+}
@@ -0,0 +1,213 @@
+package alerting
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrInvalidTimeInterval = errors.New("invalid time interval")
+
+// TimeRange is a time of day range in "HH:MM" notation. Start is inclusive,
+// End is exclusive and may be "24:00".
+type TimeRange struct {
+	Start string `json:"start" yaml:"start"`
+	End   string `json:"end" yaml:"end"`
+}
+
+// TimeInterval describes recurring points in time. Weekdays and DaysOfMonth
+// hold single values or inclusive ranges such as "monday:friday", "sunday",
+// "1:7" or "-1" (the last day of the month). All fields are evaluated in
+// Location, an IANA time zone name defaulting to UTC. A time is contained in
+// the interval when it matches every non-empty field.
+type TimeInterval struct {
+	Times       []TimeRange `json:"times,omitempty" yaml:"times"`
+	Weekdays    []string    `json:"weekdays,omitempty" yaml:"weekdays"`
+	DaysOfMonth []string    `json:"days_of_month,omitempty" yaml:"days_of_month"`
+	Location    string      `json:"location,omitempty" yaml:"location"`
+}
+
+type intRange struct {
+	start, end int
+}
+
+type compiledInterval struct {
+	times       []intRange
+	weekdays    []intRange
+	daysOfMonth []intRange
+	location    *time.Location
+}
+
+var weekdays = map[string]int{
+	"sunday":    int(time.Sunday),
+	"monday":    int(time.Monday),
+	"tuesday":   int(time.Tuesday),
+	"wednesday": int(time.Wednesday),
+	"thursday":  int(time.Thursday),
+	"friday":    int(time.Friday),
+	"saturday":  int(time.Saturday),
+}
+
+// Contains reports whether t falls within the interval.
+func (ti TimeInterval) Contains(t time.Time) (bool, error) {
+	compiled, err := ti.compile()
+	if err != nil {
+		return false, err
+	}
+	return compiled.contains(t), nil
+}
+
+func (ti TimeInterval) compile() (*compiledInterval, error) {
+	compiled := &compiledInterval{location: time.UTC}
+
+	if ti.Location != "" {
+		location, err := time.LoadLocation(ti.Location)
+		if err != nil {
+			return nil, fmt.Errorf("%w: location %q: %v", ErrInvalidTimeInterval, ti.Location, err)
+		}
+		compiled.location = location
+	}
+
+	for _, tr := range ti.Times {
+		start, err := parseClock(tr.Start)
+		if err != nil {
+			return nil, err
+		}
+		end, err := parseClock(tr.End)
+		if err != nil {
+			return nil, err
+		}
+		if start >= end {
+			return nil, fmt.Errorf("%w: time range %s-%s ends before it starts", ErrInvalidTimeInterval, tr.Start, tr.End)
+		}
+		// Stored inclusively, in minutes since midnight.
+		compiled.times = append(compiled.times, intRange{start, end - 1})
+	}
+
+	for _, weekday := range ti.Weekdays {
+		r, err := parseRange(weekday, func(s string) (int, error) {
+			day, ok := weekdays[strings.ToLower(strings.TrimSpace(s))]
+			if !ok {
+				return 0, fmt.Errorf("%w: unknown weekday %q", ErrInvalidTimeInterval, s)
+			}
+			return day, nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		if r.start > r.end {
+			return nil, fmt.Errorf("%w: weekday range %q ends before it starts", ErrInvalidTimeInterval, weekday)
+		}
+		compiled.weekdays = append(compiled.weekdays, r)
+	}
+
+	for _, day := range ti.DaysOfMonth {
+		r, err := parseRange(day, func(s string) (int, error) {
+			n, err := strconv.Atoi(strings.TrimSpace(s))
+			if err != nil || n == 0 || n < -31 || n > 31 {
+				return 0, fmt.Errorf("%w: day of month %q", ErrInvalidTimeInterval, s)
+			}
+			return n, nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		compiled.daysOfMonth = append(compiled.daysOfMonth, r)
+	}
+
+	return compiled, nil
+}
+
+func (ci *compiledInterval) contains(t time.Time) bool {
+	t = t.In(ci.location)
+
+	if len(ci.times) > 0 {
+		if !inAnyRange(ci.times, t.Hour()*60+t.Minute()) {
+			return false
+		}
+	}
+
+	if len(ci.weekdays) > 0 {
+		if !inAnyRange(ci.weekdays, int(t.Weekday())) {
+			return false
+		}
+	}
+
+	if len(ci.daysOfMonth) > 0 {
+		daysInMonth := time.Date(t.Year(), t.Month()+1, 0, 0, 0, 0, 0, ci.location).Day()
+		resolved := make([]intRange, 0, len(ci.daysOfMonth))
+		for _, r := range ci.daysOfMonth {
+			resolved = append(resolved, intRange{
+				start: absoluteDay(r.start, daysInMonth),
+				end:   absoluteDay(r.end, daysInMonth),
+			})
+		}
+		if !inAnyRange(resolved, t.Day()) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// inAnyRange reports whether value lies in one of the inclusive ranges.
+func inAnyRange(ranges []intRange, value int) bool {
+	for _, r := range ranges {
+		if value >= r.start && value <= r.end {
+			return true
+		}
+	}
+	return false
+}
+
+func absoluteDay(day, daysInMonth int) int {
+	if day < 0 {
+		return daysInMonth + day + 1
+	}
+	return day
+}
+
+// parseRange parses "a" or "a:b" using parse for both bounds.
+func parseRange(s string, parse func(string) (int, error)) (intRange, error) {
+	startStr, endStr, isRange := strings.Cut(s, ":")
+	start, err := parse(startStr)
+	if err != nil {
+		return intRange{}, err
+	}
+	if !isRange {
+		return intRange{start, start}, nil
+	}
+	end, err := parse(endStr)
+	if err != nil {
+		return intRange{}, err
+	}
+	// Ranges from a day counted from the start of the month to one counted
+	// from its end, such as "25:-1", can only be checked per month. The
+	// reverse, such as "-1:25", never matches.
+	if ((start > 0) == (end > 0) && start > end) || (start < 0 && end > 0) {
+		return intRange{}, fmt.Errorf("%w: range %q ends before it starts", ErrInvalidTimeInterval, s)
+	}
+	return intRange{start, end}, nil
+}
+
+// parseClock converts "HH:MM" into minutes since midnight.
+func parseClock(s string) (int, error) {
+	hourStr, minuteStr, ok := strings.Cut(s, ":")
+	if !ok {
+		return 0, fmt.Errorf("%w: time %q is not HH:MM", ErrInvalidTimeInterval, s)
+	}
+	hour, err := strconv.Atoi(hourStr)
+	if err != nil {
+		return 0, fmt.Errorf("%w: time %q is not HH:MM", ErrInvalidTimeInterval, s)
+	}
+	minute, err := strconv.Atoi(minuteStr)
+	if err != nil {
+		return 0, fmt.Errorf("%w: time %q is not HH:MM", ErrInvalidTimeInterval, s)
+	}
+	if hour < 0 || minute < 0 || minute > 59 || hour > 24 || (hour == 24 && minute != 0) {
+		return 0, fmt.Errorf("%w: time %q out of range", ErrInvalidTimeInterval, s)
+	}
+	return hour*60 + minute, nil
+}
@@ -1,6 +1,8 @@
 package alerts
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"time"
@@ -59,12 +61,42 @@ func NewAlertV2(id, source, severity, alertType, message, dedupKey string, recei
 		state:            state,
 	}
 }
+
+// AlertV2FromBytes decodes an AlertV2 from its JSON representation.
+func AlertV2FromBytes(data []byte) (*AlertV2, error) {
+	var alert AlertV2
+	err := json.Unmarshal(data, &alert)
+	if err != nil {
+		return nil, err
+	}
+	return &alert, nil
+}
+
+func (a *AlertV2) ID() string                     { return a.id }
+func (a *AlertV2) Source() string                 { return a.source }
+func (a *AlertV2) ReceivedAt() time.Time          { return a.receivedAt }
+func (a *AlertV2) Severity() string               { return a.severity }
+func (a *AlertV2) Type() string                   { return a.alertType }
+func (a *AlertV2) Message() string                { return a.message }
+func (a *AlertV2) State() AlertState              { return a.state }
 func (a *AlertV2) Labels() map[string]string      { return a.labels }
 func (a *AlertV2) Annotations() map[string]string { return a.annotations }
 func (a *AlertV2) DeduplicationKey() string       { return a.deduplicationKey }
 func (a *AlertV2) CorrelationID() *string         { return a.correlationID }
 func (a *AlertV2) Actions() []Action              { return a.actions }
 
+func (a *AlertV2) IsFiring() bool {
+	return a.state == AlertStateActive
+}
+
+func (a *AlertV2) Resolve() {
+	a.state = AlertStateResolved
+}
+
+func (a *AlertV2) Fire() {
+	a.state = AlertStateActive
+}
+
 // Controlled mutators
 func (a *AlertV2) SetSeverity(sev string) error {
 	switch sev {
@@ -80,6 +112,10 @@ func (a *AlertV2) AddLabel(key, value string) {
 	a.labels[key] = value
 }
 
+func (a *AlertV2) RemoveLabel(key string) {
+	delete(a.labels, key)
+}
+
 func (a *AlertV2) AddAnnotation(key, value string) {
 	a.annotations[key] = value
 }
@@ -92,6 +128,14 @@ func (a *AlertV2) AddAction(action Action) {
 	a.actions = append(a.actions, action)
 }
 
+// Hash returns the SHA-256 of the alert's JSON representation, so identical
+// resends of an alert have the same hash.
+func (a *AlertV2) Hash() string {
+	data, _ := a.MarshalJSON()
+	hash := sha256.Sum256(data)
+	return hex.EncodeToString(hash[:])
+}
+
 func (a *AlertV2) MarshalJSON() ([]byte, error) {
 	type alias AlertV2 // prevent infinite loop
 	return json.Marshal(&struct {
@@ -106,6 +150,7 @@ func (a *AlertV2) MarshalJSON() ([]byte, error) {
 		DeduplicationKey string            `json:"deduplication_key"`
 		CorrelationID    *string           `json:"correlation_id,omitempty"`
 		Actions          []Action          `json:"actions,omitempty"`
+		State            string            `json:"state"`
 	}{
 		ID:               a.id,
 		Source:           a.source,
@@ -118,5 +163,60 @@ func (a *AlertV2) MarshalJSON() ([]byte, error) {
 		DeduplicationKey: a.deduplicationKey,
 		CorrelationID:    a.correlationID,
 		Actions:          a.actions,
+		State:            a.state.String(),
 	})
 }
+
+func (a *AlertV2) UnmarshalJSON(data []byte) error {
+	var raw struct {
+		ID               string            `json:"id"`
+		Source           string            `json:"source"`
+		ReceivedAt       time.Time         `json:"received_at"`
+		Severity         string            `json:"severity"`
+		Type             string            `json:"type"`
+		Message          string            `json:"message"`
+		Labels           map[string]string `json:"labels,omitempty"`
+		Annotations      map[string]string `json:"annotations,omitempty"`
+		DeduplicationKey string            `json:"deduplication_key"`
+		CorrelationID    *string           `json:"correlation_id,omitempty"`
+		Actions          []Action          `json:"actions,omitempty"`
+		State            string            `json:"state"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	if raw.ID == "" {
+		return errors.New("alert id is required")
+	}
+
+	*a = AlertV2{
+		id:               raw.ID,
+		source:           raw.Source,
+		receivedAt:       raw.ReceivedAt,
+		severity:         raw.Severity,
+		alertType:        raw.Type,
+		message:          raw.Message,
+		labels:           raw.Labels,
+		annotations:      raw.Annotations,
+		deduplicationKey: raw.DeduplicationKey,
+		correlationID:    raw.CorrelationID,
+		actions:          raw.Actions,
+		state:            alertStateFromString(raw.State),
+	}
+	if a.labels == nil {
+		a.labels = make(map[string]string)
+	}
+	if a.annotations == nil {
+		a.annotations = make(map[string]string)
+	}
+	return nil
+}
+
+func alertStateFromString(s string) AlertState {
+	switch s {
+	case AlertStateResolved.String():
+		return AlertStateResolved
+	default:
+		return AlertStateActive
+	}
+}
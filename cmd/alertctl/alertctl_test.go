@@ -0,0 +1,171 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/avilikof/go-shared-libs/alerting"
+	"github.com/avilikof/go-shared-libs/alerting/alertingtest"
+	"github.com/avilikof/go-shared-libs/alerting/api"
+	"github.com/avilikof/go-shared-libs/alerts"
+	"github.com/avilikof/go-shared-libs/event"
+)
+
+func newTestApp(t *testing.T) (*app, *bytes.Buffer, *alertingtest.Stream) {
+	t.Helper()
+	storage := alertingtest.NewStorage(nil)
+	stream := alertingtest.NewStream()
+	stream.Persist(storage, 0)
+	t.Cleanup(stream.Close)
+
+	for _, id := range []string{"disk", "cpu"} {
+		alert := alerts.NewAlertV2(id, "node-exporter", "critical", id, id+" alert", id, time.Now(), alerts.AlertStateActive)
+		alert.AddLabel("env", "prod")
+		data, _ := alert.MarshalJSON()
+		if err := storage.Set(id, data, 0); err != nil {
+			t.Fatalf("Set() error = %v", err)
+		}
+	}
+
+	out := &bytes.Buffer{}
+	return &app{
+		out:     out,
+		service: api.NewService(storage, stream, ""),
+		stream:  stream,
+		dlq:     alertingtest.NewDeadLetterQueue(stream),
+	}, out, stream
+}
+
+func TestAlertCommands(t *testing.T) {
+	a, out, stream := newTestApp(t)
+	ctx := context.Background()
+
+	if err := runList(ctx, a, []string{"-label", "env=prod"}); err != nil {
+		t.Fatalf("list error = %v", err)
+	}
+	if got := out.String(); !strings.Contains(got, "cpu ") || !strings.Contains(got, "disk ") {
+		t.Errorf("list output = %q; want both alerts", got)
+	}
+
+	out.Reset()
+	if err := runAck(ctx, a, []string{"disk", "-by", "alice", "-comment", "on it"}); err != nil {
+		t.Fatalf("ack error = %v", err)
+	}
+	if got := out.String(); !strings.Contains(got, "by alice (on it)") {
+		t.Errorf("ack output = %q; want the acknowledgement", got)
+	}
+	alertingtest.ExpectEvent(t, stream, event.ActionAcknowledged, "disk")
+
+	out.Reset()
+	if err := runList(ctx, a, []string{"-acked=false"}); err != nil {
+		t.Fatalf("list error = %v", err)
+	}
+	if got := out.String(); strings.Contains(got, "disk ") || !strings.Contains(got, "cpu ") {
+		t.Errorf("list -acked=false output = %q; want only cpu", got)
+	}
+
+	if err := runSilence(ctx, a, []string{"cpu"}); err == nil {
+		t.Error("silence without -for succeeded; want an error")
+	}
+	if err := runResolve(ctx, a, []string{"cpu"}); err != nil {
+		t.Fatalf("resolve error = %v", err)
+	}
+	alertingtest.ExpectEvent(t, stream, event.ActionResolved, "cpu")
+
+	out.Reset()
+	if err := runShow(ctx, a, []string{"cpu"}); err != nil {
+		t.Fatalf("show error = %v", err)
+	}
+	if got := out.String(); !strings.Contains(got, "resolved") {
+		t.Errorf("show output = %q; want the resolved state", got)
+	}
+	if err := runShow(ctx, a, nil); err == nil {
+		t.Error("show without an ID succeeded; want a usage error")
+	}
+}
+
+func TestDLQCommands(t *testing.T) {
+	a, out, stream := newTestApp(t)
+	ctx := context.Background()
+	for _, data := range []string{"not json", "{"} {
+		letter := alerting.DeadLetter{Subject: "test.alert", Error: "decoding alert", Attempts: 1, Data: []byte(data)}
+		if err := a.dlq.Send(letter); err != nil {
+			t.Fatalf("Send() error = %v", err)
+		}
+	}
+
+	if err := runDLQ(ctx, a, []string{"list"}); err != nil {
+		t.Fatalf("dlq list error = %v", err)
+	}
+	if got := out.String(); !strings.Contains(got, "decoding alert") || strings.Count(got, "test.alert") != 2 {
+		t.Errorf("dlq list output = %q; want both dead letters", got)
+	}
+
+	out.Reset()
+	if err := runDLQ(ctx, a, []string{"show", "1"}); err != nil {
+		t.Fatalf("dlq show error = %v", err)
+	}
+	if got := out.String(); !strings.Contains(got, "not json") {
+		t.Errorf("dlq show output = %q; want the payload", got)
+	}
+
+	if err := runDLQ(ctx, a, []string{"redrive", "1"}); err != nil {
+		t.Fatalf("dlq redrive error = %v", err)
+	}
+	if got := stream.Messages("test.alert"); len(got) != 1 || string(got[0].Data) != "not json" {
+		t.Errorf("re-driven messages = %q; want the first payload", got)
+	}
+	if err := runDLQ(ctx, a, []string{"redrive", "1"}); !errors.Is(err, alerting.ErrNotFound) {
+		t.Errorf("second redrive error = %v; want ErrNotFound", err)
+	}
+
+	out.Reset()
+	if err := runDLQ(ctx, a, []string{"purge", "-all"}); err != nil {
+		t.Fatalf("dlq purge -all error = %v", err)
+	}
+	if got := out.String(); !strings.Contains(got, "1 dead letter(s) purged") {
+		t.Errorf("dlq purge output = %q; want one purged", got)
+	}
+	if letters, _ := a.dlq.List(0); len(letters) != 0 {
+		t.Errorf("List() after purge = %d dead letters; want 0", len(letters))
+	}
+}
+
+func TestEventFilter(t *testing.T) {
+	firing := event.NewEvent("alerting", event.TypeEvent, time.Now(), event.ActionFiring, map[string]any{"alert_id": "disk"})
+	logged := event.NewEvent("alerting", event.TypeLog, time.Now(), event.ActionError, map[string]any{"alert_id": "disk"})
+
+	tests := []struct {
+		name   string
+		filter eventFilter
+		event  event.Event
+		want   bool
+	}{
+		{name: "no filter", event: firing, want: true},
+		{name: "action", filter: eventFilter{actions: map[event.Action]bool{event.ActionResolved: true}}, event: firing},
+		{name: "alert", filter: eventFilter{alertID: "disk"}, event: firing, want: true},
+		{name: "other alert", filter: eventFilter{alertID: "cpu"}, event: firing},
+		{name: "logs hidden", event: logged},
+		{name: "logs shown", filter: eventFilter{logs: true}, event: logged, want: true},
+	}
+	for _, tt := range tests {
+		if got := tt.filter.matches(&tt.event); got != tt.want {
+			t.Errorf("%s: matches() = %v; want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestFormatEvent(t *testing.T) {
+	at := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	ev := event.NewEvent("alerting-api", event.TypeEvent, at, event.ActionResolved,
+		map[string]any{"alert_id": "disk", "reason": "manual", "by": "alice"})
+
+	want := "2024-05-01T12:00:00Z  resolved        disk  by=alice  reason=manual  [alerting-api]"
+	if got := formatEvent(&ev); got != want {
+		t.Errorf("formatEvent() = %q; want %q", got, want)
+	}
+}
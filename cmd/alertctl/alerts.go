@@ -0,0 +1,237 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/avilikof/go-shared-libs/alerting/api"
+)
+
+// labelsFlag collects repeated -label key=value flags.
+type labelsFlag map[string]string
+
+func (l labelsFlag) String() string {
+	pairs := make([]string, 0, len(l))
+	for key, value := range l {
+		pairs = append(pairs, key+"="+value)
+	}
+	return strings.Join(pairs, ",")
+}
+
+func (l labelsFlag) Set(s string) error {
+	key, value, ok := strings.Cut(s, "=")
+	if !ok || key == "" {
+		return fmt.Errorf("want key=value, got %q", s)
+	}
+	l[key] = value
+	return nil
+}
+
+// boolFlag is a tri-state flag: unset, true or false.
+type boolFlag struct{ value *bool }
+
+func (b *boolFlag) String() string {
+	if b.value == nil {
+		return ""
+	}
+	return fmt.Sprint(*b.value)
+}
+
+func (b *boolFlag) Set(s string) error {
+	value, err := parseBool(s)
+	if err != nil {
+		return err
+	}
+	b.value = &value
+	return nil
+}
+
+func parseBool(s string) (bool, error) {
+	switch strings.ToLower(s) {
+	case "true", "yes", "1":
+		return true, nil
+	case "false", "no", "0":
+		return false, nil
+	}
+	return false, fmt.Errorf("want true or false, got %q", s)
+}
+
+func runList(_ context.Context, a *app, args []string) error {
+	flags := flag.NewFlagSet("list", flag.ContinueOnError)
+	query := api.Query{Labels: labelsFlag{}}
+	var acknowledged, silenced boolFlag
+	flags.StringVar(&query.State, "state", "", "only list firing or resolved alerts")
+	flags.StringVar(&query.Version, "version", "", "only list v1 or v2 alerts")
+	flags.StringVar(&query.Source, "source", "", "only list alerts from this source")
+	flags.StringVar(&query.Severity, "severity", "", "only list alerts of this severity")
+	flags.Var(&acknowledged, "acked", "only list acknowledged (true) or unacknowledged (false) alerts")
+	flags.Var(&silenced, "silenced", "only list silenced (true) or unsilenced (false) alerts")
+	flags.Var(labelsFlag(query.Labels), "label", "only list alerts with this key=value label (repeatable)")
+	flags.IntVar(&query.Limit, "limit", 0, "list at most this many alerts")
+	flags.IntVar(&query.Offset, "offset", 0, "skip this many matching alerts")
+	asJSON := flags.Bool("json", false, "print JSON")
+	if _, err := parseFlags(flags, args, 0); err != nil {
+		return err
+	}
+	query.Acknowledged, query.Silenced = acknowledged.value, silenced.value
+
+	list, err := a.service.List(query)
+	if err != nil {
+		return err
+	}
+	if *asJSON {
+		return printJSON(a, list)
+	}
+
+	w := tabwriter.NewWriter(a.out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tVERSION\tSTATE\tSEVERITY\tSOURCE\tACKED\tSILENCED UNTIL")
+	for _, alert := range list.Alerts {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			alert.ID, alert.Version, state(&alert), dash(alert.Severity), dash(alert.Source),
+			acked(&alert), silencedUntil(&alert))
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	if shown := len(list.Alerts); shown < list.Total {
+		fmt.Fprintf(a.out, "\n%d of %d alerts shown\n", shown, list.Total)
+	}
+	return nil
+}
+
+func runShow(_ context.Context, a *app, args []string) error {
+	flags := flag.NewFlagSet("show", flag.ContinueOnError)
+	asJSON := flags.Bool("json", false, "print JSON")
+	rest, err := parseFlags(flags, args, 1)
+	if err != nil {
+		return err
+	}
+
+	alert, err := a.service.Get(rest[0])
+	if err != nil {
+		return err
+	}
+	if *asJSON {
+		return printJSON(a, alert)
+	}
+	printAlert(a, alert)
+	return nil
+}
+
+func runAck(_ context.Context, a *app, args []string) error {
+	return runAction(a, "ack", args, false, a.service.Ack)
+}
+
+func runUnack(_ context.Context, a *app, args []string) error {
+	return runAction(a, "unack", args, false, a.service.Unack)
+}
+
+func runResolve(_ context.Context, a *app, args []string) error {
+	return runAction(a, "resolve", args, false, a.service.Resolve)
+}
+
+func runSilence(_ context.Context, a *app, args []string) error {
+	return runAction(a, "silence", args, true, a.service.Silence)
+}
+
+func runAction(a *app, name string, args []string, needsDuration bool, fn func(string, api.ActionRequest) (*api.Alert, error)) error {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	var req api.ActionRequest
+	flags.StringVar(&req.By, "by", os.Getenv("USER"), "who performs the action")
+	flags.StringVar(&req.Comment, "comment", "", "comment recorded with the action")
+	if needsDuration {
+		flags.StringVar(&req.Duration, "for", "", "how long to silence the alert, e.g. 2h")
+	}
+	rest, err := parseFlags(flags, args, 1)
+	if err != nil {
+		return err
+	}
+
+	alert, err := fn(rest[0], req)
+	if err != nil {
+		return err
+	}
+	printAlert(a, alert)
+	return nil
+}
+
+func printAlert(a *app, alert *api.Alert) {
+	w := tabwriter.NewWriter(a.out, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "ID:\t%s\n", alert.ID)
+	fmt.Fprintf(w, "Version:\t%s\n", alert.Version)
+	fmt.Fprintf(w, "State:\t%s\n", state(alert))
+	if alert.Severity != "" {
+		fmt.Fprintf(w, "Severity:\t%s\n", alert.Severity)
+	}
+	if alert.Source != "" {
+		fmt.Fprintf(w, "Source:\t%s\n", alert.Source)
+	}
+	for _, key := range slices.Sorted(maps.Keys(alert.Labels)) {
+		fmt.Fprintf(w, "Label:\t%s=%s\n", key, alert.Labels[key])
+	}
+	if ack := alert.Acknowledgement; ack != nil {
+		fmt.Fprintf(w, "Acknowledged:\t%s by %s%s\n", ack.At.Format(time.RFC3339), dash(ack.By), comment(ack.Comment))
+	}
+	if silence := alert.Silence; silence != nil {
+		fmt.Fprintf(w, "Silenced until:\t%s by %s%s\n", silence.Until.Format(time.RFC3339), dash(silence.By), comment(silence.Comment))
+	}
+	_ = w.Flush()
+
+	var indented bytes.Buffer
+	if err := json.Indent(&indented, alert.Alert, "", "  "); err == nil {
+		fmt.Fprintf(a.out, "\n%s\n", indented.String())
+	}
+}
+
+func printJSON(a *app, v any) error {
+	encoder := json.NewEncoder(a.out)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
+
+func state(alert *api.Alert) string {
+	if alert.Firing {
+		return "firing"
+	}
+	return "resolved"
+}
+
+func acked(alert *api.Alert) string {
+	switch {
+	case alert.Acknowledgement == nil:
+		return "-"
+	case alert.Acknowledgement.By == "":
+		return "yes"
+	}
+	return alert.Acknowledgement.By
+}
+
+func silencedUntil(alert *api.Alert) string {
+	if alert.Silence == nil {
+		return "-"
+	}
+	return alert.Silence.Until.Format(time.RFC3339)
+}
+
+func comment(s string) string {
+	if s == "" {
+		return ""
+	}
+	return fmt.Sprintf(" (%s)", s)
+}
+
+func dash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
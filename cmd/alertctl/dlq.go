@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+const dlqUsage = `Usage: alertctl dlq <command> [flags] [args]
+
+Commands:
+  list                 list dead letters
+  show <id>            show one dead letter and its payload
+  redrive <id>         publish a dead letter on its original subject again (-all for every one)
+  purge <id>           delete a dead letter (-all for every one)
+`
+
+var dlqCommands = map[string]command{
+	"list":    runDLQList,
+	"show":    runDLQShow,
+	"redrive": runDLQRedrive,
+	"purge":   runDLQPurge,
+}
+
+func runDLQ(ctx context.Context, a *app, args []string) error {
+	if len(args) == 0 {
+		fmt.Fprint(a.out, dlqUsage)
+		return errUsage
+	}
+	run, ok := dlqCommands[args[0]]
+	if !ok {
+		fmt.Fprintf(a.out, "alertctl dlq: unknown command %q\n\n%s", args[0], dlqUsage)
+		return errUsage
+	}
+	if a.dlq == nil {
+		return errors.New("dlq needs a dead-letter queue")
+	}
+	return run(ctx, a, args[1:])
+}
+
+func runDLQList(_ context.Context, a *app, args []string) error {
+	flags := flag.NewFlagSet("dlq list", flag.ContinueOnError)
+	limit := flags.Int("limit", 0, "list at most this many dead letters")
+	asJSON := flags.Bool("json", false, "print JSON")
+	if _, err := parseFlags(flags, args, 0); err != nil {
+		return err
+	}
+
+	letters, err := a.dlq.List(*limit)
+	if err != nil {
+		return err
+	}
+	if *asJSON {
+		return printJSON(a, letters)
+	}
+
+	w := tabwriter.NewWriter(a.out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tSUBJECT\tATTEMPTS\tDEAD-LETTERED\tERROR")
+	for _, letter := range letters {
+		fmt.Fprintf(w, "%s\t%s\t%d\t%s\t%s\n", letter.ID, dash(letter.Subject), letter.Attempts,
+			ago(letter.Timestamp), firstLine(letter.Error))
+	}
+	return w.Flush()
+}
+
+func runDLQShow(_ context.Context, a *app, args []string) error {
+	flags := flag.NewFlagSet("dlq show", flag.ContinueOnError)
+	asJSON := flags.Bool("json", false, "print JSON")
+	rest, err := parseFlags(flags, args, 1)
+	if err != nil {
+		return err
+	}
+
+	letter, err := a.dlq.Get(rest[0])
+	if err != nil {
+		return err
+	}
+	if *asJSON {
+		return printJSON(a, letter)
+	}
+	w := tabwriter.NewWriter(a.out, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "ID:\t%s\n", letter.ID)
+	fmt.Fprintf(w, "Subject:\t%s\n", dash(letter.Subject))
+	fmt.Fprintf(w, "Attempts:\t%d\n", letter.Attempts)
+	fmt.Fprintf(w, "Dead-lettered:\t%s\n", letter.Timestamp.Format(time.RFC3339))
+	fmt.Fprintf(w, "Error:\t%s\n", letter.Error)
+	_ = w.Flush()
+	fmt.Fprintf(a.out, "\n%s\n", letter.Data)
+	return nil
+}
+
+func runDLQRedrive(_ context.Context, a *app, args []string) error {
+	return runDLQBulk(a, "redrive", "re-driven", args, a.dlq.Redrive, nil)
+}
+
+func runDLQPurge(_ context.Context, a *app, args []string) error {
+	return runDLQBulk(a, "purge", "purged", args, a.dlq.Purge, a.dlq.PurgeAll)
+}
+
+// runDLQBulk applies fn to the dead letter named in args, or to every dead
+// letter with -all, using fnAll if there is one.
+func runDLQBulk(a *app, name, done string, args []string, fn func(id string) error, fnAll func() error) error {
+	flags := flag.NewFlagSet("dlq "+name, flag.ContinueOnError)
+	all := flags.Bool("all", false, name+" every dead letter")
+	positional := 1
+	for _, arg := range args {
+		if arg == "-all" || arg == "--all" {
+			positional = 0
+		}
+	}
+	rest, err := parseFlags(flags, args, positional)
+	if err != nil {
+		return err
+	}
+
+	ids := rest
+	if *all {
+		letters, err := a.dlq.List(0)
+		if err != nil {
+			return err
+		}
+		ids = nil
+		for _, letter := range letters {
+			ids = append(ids, letter.ID)
+		}
+		if fnAll != nil {
+			if err := fnAll(); err != nil {
+				return err
+			}
+			fmt.Fprintf(a.out, "%d dead letter(s) %s\n", len(ids), done)
+			return nil
+		}
+	}
+	for _, id := range ids {
+		if err := fn(id); err != nil {
+			return err
+		}
+	}
+	fmt.Fprintf(a.out, "%d dead letter(s) %s\n", len(ids), done)
+	return nil
+}
+
+func firstLine(s string) string {
+	line, _, _ := strings.Cut(s, "\n")
+	return line
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+
+	"github.com/avilikof/go-shared-libs/alerting"
+)
+
+func runGenerate(ctx context.Context, a *app, args []string) error {
+	flags := flag.NewFlagSet("generate", flag.ContinueOnError)
+	version := flags.String("version", "v2", "alert version, v1 or v2")
+	count := flags.Int("count", 1, "number of alerts to publish")
+	interval := flags.Duration("interval", 0, "pause between alerts")
+	if _, err := parseFlags(flags, args, 0); err != nil {
+		return err
+	}
+
+	var alertVersion alerting.AlertVersion
+	switch *version {
+	case alerting.VersionV1.String():
+		alertVersion = alerting.VersionV1
+	case alerting.VersionV2.String():
+		alertVersion = alerting.VersionV2
+	default:
+		return fmt.Errorf("unknown alert version %q: want v1 or v2", *version)
+	}
+
+	generator := alerting.NewAlertGenerator(a.stream)
+	for i := 0; i < *count; i++ {
+		if ctx.Err() != nil {
+			break
+		}
+		if err := generator.Generate(alertVersion, *interval); err != nil {
+			return fmt.Errorf("published %d of %d alerts: %w", i, *count, err)
+		}
+	}
+	fmt.Fprintf(a.out, "published %d %s test alert(s)\n", *count, alertVersion)
+	return nil
+}
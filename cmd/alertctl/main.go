@@ -0,0 +1,144 @@
+// Command alertctl inspects and operates the alerting pipeline on NATS
+// JetStream: it lists and shows stored alerts, acknowledges, resolves and
+// silences them, tails the event stream, inspects and re-drives dead
+// letters, publishes test alerts and reports stream and consumer status.
+//
+//	alertctl [-nats URL] <command> [flags] [args]
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+
+	"github.com/nats-io/nats.go"
+
+	"github.com/avilikof/go-shared-libs/alerting"
+	"github.com/avilikof/go-shared-libs/alerting/api"
+)
+
+const usage = `Usage: alertctl [-nats URL] <command> [flags] [args]
+
+Commands:
+  list                 list stored alerts
+  show <id>            show one alert
+  ack <id>             acknowledge a firing alert
+  unack <id>           withdraw an acknowledgement
+  resolve <id>         resolve a firing alert
+  silence <id>         silence an alert (-for 1h)
+  tail                 follow the alert.event stream
+  dlq <command>        list, show, redrive or purge dead letters
+  generate             publish test alerts
+  status               show stream, consumer and bucket status
+
+Run "alertctl <command> -h" for the flags of a command.
+`
+
+var errUsage = errors.New("usage")
+
+// app holds what the commands operate on. js is nil when alertctl is not
+// connected to JetStream, e.g. in tests.
+type app struct {
+	out     io.Writer
+	service *api.Service
+	stream  alerting.Stream
+	dlq     alerting.DeadLetterQueue
+	js      nats.JetStreamContext
+}
+
+type command func(ctx context.Context, a *app, args []string) error
+
+var commands = map[string]command{
+	"list":     runList,
+	"show":     runShow,
+	"ack":      runAck,
+	"unack":    runUnack,
+	"resolve":  runResolve,
+	"silence":  runSilence,
+	"tail":     runTail,
+	"dlq":      runDLQ,
+	"generate": runGenerate,
+	"status":   runStatus,
+}
+
+func main() {
+	flags := flag.NewFlagSet("alertctl", flag.ExitOnError)
+	flags.Usage = func() { fmt.Fprint(os.Stderr, usage) }
+	natsURL := flags.String("nats", "", "NATS server URL (default $NATS_URL or nats://localhost:4222)")
+	_ = flags.Parse(os.Args[1:])
+
+	if flags.NArg() == 0 {
+		flags.Usage()
+		os.Exit(2)
+	}
+	run, ok := commands[flags.Arg(0)]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "alertctl: unknown command %q\n\n%s", flags.Arg(0), usage)
+		os.Exit(2)
+	}
+
+	if *natsURL != "" {
+		os.Setenv(alerting.NATS_URL_JS, *natsURL)
+	}
+	handler, err := alerting.NewJetStreamHandler()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "alertctl: %v\n", err)
+		os.Exit(1)
+	}
+	defer handler.Close()
+	dlq, err := alerting.NewJetStreamDeadLetterQueue(handler.JetStream(), 0)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "alertctl: %v\n", err)
+		handler.Close()
+		os.Exit(1)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	// Only the state of resolved alerts is cleared with them, so neither
+	// needs timeouts or policies.
+	stale := alerting.NewStaleTracker(handler.Storage(), handler, 0)
+	escalator := alerting.NewEscalator(handler.Storage(), handler, 0)
+	a := &app{
+		out:     os.Stdout,
+		service: api.NewService(handler.Storage(), handler, "", api.WithStaleTracker(stale), api.WithEscalator(escalator)),
+		stream:  handler,
+		dlq:     dlq,
+		js:      handler.JetStream(),
+	}
+	if err := run(ctx, a, flags.Args()[1:]); err != nil {
+		if !errors.Is(err, errUsage) && !errors.Is(err, flag.ErrHelp) {
+			fmt.Fprintf(os.Stderr, "alertctl %s: %v\n", flags.Arg(0), err)
+		}
+		handler.Close()
+		os.Exit(1)
+	}
+}
+
+// parseFlags parses args with flags, moving flags given after positional
+// arguments in front of them, and checks the number of positional arguments.
+func parseFlags(flags *flag.FlagSet, args []string, positional int) ([]string, error) {
+	flags.SetOutput(os.Stderr)
+	var rest []string
+	for {
+		if err := flags.Parse(args); err != nil {
+			return nil, err
+		}
+		if flags.NArg() == 0 {
+			break
+		}
+		rest = append(rest, flags.Arg(0))
+		args = flags.Args()[1:]
+	}
+	if len(rest) != positional {
+		fmt.Fprintf(flags.Output(), "alertctl %s: want %d argument(s), got %d\n", flags.Name(), positional, len(rest))
+		flags.Usage()
+		return nil, errUsage
+	}
+	return rest, nil
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/avilikof/go-shared-libs/alerting"
+)
+
+func runStatus(_ context.Context, a *app, args []string) error {
+	flags := flag.NewFlagSet("status", flag.ContinueOnError)
+	if _, err := parseFlags(flags, args, 0); err != nil {
+		return err
+	}
+	if a.js == nil {
+		return errors.New("status needs a JetStream connection")
+	}
+
+	var streams []string
+	for name := range a.js.StreamNames() {
+		streams = append(streams, name)
+	}
+	sort.Strings(streams)
+
+	w := tabwriter.NewWriter(a.out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "STREAM\tSUBJECTS\tMESSAGES\tBYTES\tFIRST SEQ\tLAST SEQ\tLAST MESSAGE\tCONSUMERS")
+	for _, name := range streams {
+		info, err := a.js.StreamInfo(name)
+		if err != nil {
+			fmt.Fprintf(w, "%s\terror: %v\n", name, err)
+			continue
+		}
+		fmt.Fprintf(w, "%s\t%v\t%d\t%d\t%d\t%d\t%s\t%d\n", name, info.Config.Subjects,
+			info.State.Msgs, info.State.Bytes, info.State.FirstSeq, info.State.LastSeq,
+			ago(info.State.LastTime), info.State.Consumers)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	fmt.Fprintln(a.out)
+	w = tabwriter.NewWriter(a.out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "CONSUMER\tSTREAM\tFILTER\tPENDING\tACK PENDING\tREDELIVERED\tLAST ACTIVE")
+	for _, stream := range streams {
+		for info := range a.js.Consumers(stream) {
+			lastActive := "-"
+			if info.Delivered.Last != nil {
+				lastActive = ago(*info.Delivered.Last)
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%d\t%d\t%s\n", info.Name, stream, dash(info.Config.FilterSubject),
+				info.NumPending, info.NumAckPending, info.NumRedelivered, lastActive)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	fmt.Fprintln(a.out)
+	kv, err := a.js.KeyValue(alerting.ALERT_BUCKET)
+	if err != nil {
+		return fmt.Errorf("failed to open bucket %s: %w", alerting.ALERT_BUCKET, err)
+	}
+	status, err := kv.Status()
+	if err != nil {
+		return fmt.Errorf("failed to read bucket %s status: %w", alerting.ALERT_BUCKET, err)
+	}
+	w = tabwriter.NewWriter(a.out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "BUCKET\tKEYS\tBYTES\tTTL")
+	fmt.Fprintf(w, "%s\t%d\t%d\t%s\n", status.Bucket(), status.Values(), status.Bytes(), status.TTL())
+	return w.Flush()
+}
+
+func ago(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return time.Since(t).Round(time.Second).String() + " ago"
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/nats-io/nats.go"
+
+	"github.com/avilikof/go-shared-libs/alerting"
+	"github.com/avilikof/go-shared-libs/event"
+)
+
+// eventFilter selects the events printed by tail. Empty fields match every
+// event.
+type eventFilter struct {
+	actions map[event.Action]bool
+	alertID string
+	service string
+	logs    bool
+}
+
+func (f eventFilter) matches(ev *event.Event) bool {
+	if len(f.actions) > 0 && !f.actions[ev.Action] {
+		return false
+	}
+	if f.alertID != "" && ev.Message["alert_id"] != f.alertID {
+		return false
+	}
+	if f.service != "" && ev.Service != f.service {
+		return false
+	}
+	return f.logs || ev.Type != event.TypeLog
+}
+
+func runTail(ctx context.Context, a *app, args []string) error {
+	flags := flag.NewFlagSet("tail", flag.ContinueOnError)
+	actions := flags.String("action", "", "only print these comma-separated actions, e.g. firing,resolved")
+	alertID := flags.String("alert", "", "only print events of this alert")
+	service := flags.String("service", "", "only print events published by this service")
+	logs := flags.Bool("logs", false, "also print log events")
+	since := flags.Duration("since", 0, "start with the events of this long ago instead of new events only")
+	all := flags.Bool("all", false, "start with every event retained by the stream")
+	if _, err := parseFlags(flags, args, 0); err != nil {
+		return err
+	}
+	if a.js == nil {
+		return errors.New("tail needs a JetStream connection")
+	}
+
+	filter := eventFilter{alertID: *alertID, service: *service, logs: *logs}
+	if *actions != "" {
+		filter.actions = make(map[event.Action]bool)
+		for _, action := range strings.Split(*actions, ",") {
+			filter.actions[event.Action(strings.TrimSpace(action))] = true
+		}
+	}
+
+	start := nats.DeliverNew()
+	switch {
+	case *all:
+		start = nats.DeliverAll()
+	case *since > 0:
+		start = nats.StartTime(time.Now().Add(-*since))
+	}
+
+	// An ordered consumer is ephemeral, so tailing never takes messages away
+	// from the durable consumers of the pipeline.
+	messages := make(chan *nats.Msg, 256)
+	sub, err := a.js.ChanSubscribe(alerting.EvetTopic, messages, nats.OrderedConsumer(), start)
+	if err != nil {
+		return fmt.Errorf("failed to subscribe to %s: %w", alerting.EvetTopic, err)
+	}
+	defer sub.Unsubscribe()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case msg := <-messages:
+			ev, err := event.FromBytes(msg.Data)
+			if err != nil {
+				fmt.Fprintf(a.out, "%s  undecodable event: %s\n", time.Now().Format(time.RFC3339), msg.Data)
+				continue
+			}
+			if filter.matches(ev) {
+				fmt.Fprintln(a.out, formatEvent(ev))
+			}
+		}
+	}
+}
+
+// formatEvent renders an event on one line: time, action, alert and the
+// remaining message fields in key order, except the alert of firing events.
+func formatEvent(ev *event.Event) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s  %-14s", ev.Timestamp.Format(time.RFC3339), ev.Action)
+	if alertID, ok := ev.Message["alert_id"]; ok {
+		fmt.Fprintf(&b, "  %v", alertID)
+	}
+	for _, key := range slices.Sorted(maps.Keys(ev.Message)) {
+		if key == "alert_id" || key == "alert" {
+			continue
+		}
+		fmt.Fprintf(&b, "  %s=%v", key, ev.Message[key])
+	}
+	if ev.Service != "" {
+		fmt.Fprintf(&b, "  [%s]", ev.Service)
+	}
+	return b.String()
+}
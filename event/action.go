@@ -12,6 +12,17 @@ const (
 	ActionFiring   Action = "firing"
 	ActionResolved Action = "resolved"
 	ActionAlert    Action = "alert"
+
+	ActionAcknowledged   Action = "acknowledged"
+	ActionUnacknowledged Action = "unacknowledged"
+	ActionEscalated      Action = "escalated"
+	ActionSilenced       Action = "silenced"
+
+	ActionWindowOpened Action = "window_opened"
+	ActionWindowClosed Action = "window_closed"
+
+	ActionLeaderElected Action = "leader_elected"
+	ActionLeaderLost    Action = "leader_lost"
 )
 
 // String returns the string representation of the Action
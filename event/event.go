@@ -12,6 +12,9 @@ type Event struct {
 	Timestamp time.Time
 	Action    Action
 	Message   map[string]any
+	// Tenant is the tenant the event belongs to; empty outside multi-tenant
+	// deployments.
+	Tenant string `json:",omitempty"`
 }
 
 // Action represents the type of action performed in an event
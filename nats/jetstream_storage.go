@@ -2,12 +2,15 @@ package natsdriver
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"time"
 
 	"github.com/nats-io/nats.go"
 )
 
+var ErrKeyNotFound = errors.New("key not found")
+
 type JetStreamStorage struct {
 	js nats.JetStreamContext
 	kv nats.KeyValue
@@ -47,7 +50,7 @@ func (jss *JetStreamStorage) Get(key string) ([]byte, error) {
 	entry, err := jss.kv.Get(key)
 	if err != nil {
 		if err == nats.ErrKeyNotFound {
-			return nil, fmt.Errorf("key not found: %s", key)
+			return nil, fmt.Errorf("%w: %s", ErrKeyNotFound, key)
 		}
 		return nil, fmt.Errorf("failed to get key %s: %w", key, err)
 	}
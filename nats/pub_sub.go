@@ -24,15 +24,26 @@ func (ps *PubSub) Publish(subject string, data []byte) error {
 	return nil
 }
 
+// PublishMsg publishes msg, including its headers.
+func (ps *PubSub) PublishMsg(msg *nats.Msg) error {
+	_err := ps.nc.conn.PublishMsg(msg)
+	if _err != nil {
+		log.Printf("Failed to publish to subject %s: %v", msg.Subject, _err)
+		return _err
+	}
+	return nil
+}
+
 func (ps *PubSub) Close() {
 	ps.nc.conn.Close()
 }
 
-func (ps *PubSub) Subscribe(subject string, callback func(msg *nats.Msg)) error {
-	_, _err := ps.nc.conn.Subscribe(subject, callback)
+// Subscribe calls callback for every message on subject until the returned
+// subscription is unsubscribed or drained. It does not block.
+func (ps *PubSub) Subscribe(subject string, callback func(msg *nats.Msg)) (*nats.Subscription, error) {
+	sub, _err := ps.nc.conn.Subscribe(subject, callback)
 	if _err != nil {
-		return _err
+		return nil, _err
 	}
-
-	select {}
+	return sub, nil
 }
@@ -0,0 +1,157 @@
+package natsdriver
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+// DefaultRequestTimeout bounds requests whose context has no deadline, and
+// the handling of every request by a responder.
+const DefaultRequestTimeout = 5 * time.Second
+
+// Error replies carry their code and message in these headers.
+const (
+	HeaderReplyError     = "Reply-Error"
+	HeaderReplyErrorCode = "Reply-Error-Code"
+
+	headerContentType = "Content-Type"
+)
+
+// Error codes of replies.
+const (
+	CodeBadRequest = "bad_request"
+	CodeInternal   = "internal"
+)
+
+var (
+	ErrRequestTimeout = errors.New("request timed out")
+	ErrNoResponders   = errors.New("no responders")
+)
+
+// ReplyError is an error reply. A RequestHandler returns one to choose the
+// code the requester sees; other errors are replied with CodeInternal.
+type ReplyError struct {
+	Code    string
+	Message string
+}
+
+func (e *ReplyError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Code, e.Message)
+}
+
+// Codec encodes and decodes request and reply payloads.
+type Codec interface {
+	ContentType() string
+	Marshal(v any) ([]byte, error)
+	Unmarshal(data []byte, v any) error
+}
+
+// JSONCodec encodes payloads as JSON.
+var JSONCodec Codec = jsonCodec{}
+
+type jsonCodec struct{}
+
+func (jsonCodec) ContentType() string                { return "application/json" }
+func (jsonCodec) Marshal(v any) ([]byte, error)      { return json.Marshal(v) }
+func (jsonCodec) Unmarshal(data []byte, v any) error { return json.Unmarshal(data, v) }
+
+// RequestHandler answers a decoded request.
+type RequestHandler[Req, Rep any] func(ctx context.Context, request Req) (Rep, error)
+
+// Conn returns the underlying connection, e.g. for Request and Respond.
+func (nc *NatsConnection) Conn() *nats.Conn {
+	return nc.conn
+}
+
+// Request sends request on subject and decodes the reply. It waits until
+// ctx is done, or DefaultRequestTimeout if ctx has no deadline. An error
+// reply is returned as a *ReplyError.
+func Request[Req, Rep any](ctx context.Context, conn *nats.Conn, codec Codec, subject string, request Req) (Rep, error) {
+	var reply Rep
+	data, err := codec.Marshal(request)
+	if err != nil {
+		return reply, fmt.Errorf("failed to encode request to %s: %w", subject, err)
+	}
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, DefaultRequestTimeout)
+		defer cancel()
+	}
+
+	msg := nats.NewMsg(subject)
+	msg.Data = data
+	msg.Header[headerContentType] = []string{codec.ContentType()}
+	response, err := conn.RequestMsgWithContext(ctx, msg)
+	switch {
+	case errors.Is(err, nats.ErrNoResponders):
+		return reply, fmt.Errorf("%w: %s", ErrNoResponders, subject)
+	case errors.Is(err, context.DeadlineExceeded) || errors.Is(err, nats.ErrTimeout):
+		return reply, fmt.Errorf("%w: %s", ErrRequestTimeout, subject)
+	case err != nil:
+		return reply, fmt.Errorf("failed to request %s: %w", subject, err)
+	}
+
+	if code := response.Header.Get(HeaderReplyErrorCode); code != "" {
+		return reply, &ReplyError{Code: code, Message: response.Header.Get(HeaderReplyError)}
+	}
+	if err := codec.Unmarshal(response.Data, &reply); err != nil {
+		return reply, fmt.Errorf("failed to decode reply from %s: %w", subject, err)
+	}
+	return reply, nil
+}
+
+// Respond answers requests on subject with handler until the returned
+// subscription is unsubscribed. Responders sharing a non-empty queue split
+// the requests between them. Undecodable requests are replied with
+// CodeBadRequest.
+func Respond[Req, Rep any](conn *nats.Conn, codec Codec, subject, queue string, handler RequestHandler[Req, Rep]) (*nats.Subscription, error) {
+	sub, err := conn.QueueSubscribe(subject, queue, func(msg *nats.Msg) {
+		ctx, cancel := context.WithTimeout(context.Background(), DefaultRequestTimeout)
+		defer cancel()
+
+		var request Req
+		if err := codec.Unmarshal(msg.Data, &request); err != nil {
+			replyError(msg, &ReplyError{Code: CodeBadRequest, Message: err.Error()})
+			return
+		}
+		reply, err := handler(ctx, request)
+		if err != nil {
+			replyError(msg, err)
+			return
+		}
+		data, err := codec.Marshal(reply)
+		if err != nil {
+			replyError(msg, err)
+			return
+		}
+
+		response := nats.NewMsg(msg.Reply)
+		response.Data = data
+		response.Header[headerContentType] = []string{codec.ContentType()}
+		if err := msg.RespondMsg(response); err != nil {
+			fmt.Printf("NATS :: failed to reply on %s: %v\n", subject, err)
+		}
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to respond on %s: %w", subject, err)
+	}
+	return sub, nil
+}
+
+func replyError(msg *nats.Msg, err error) {
+	var replyErr *ReplyError
+	if !errors.As(err, &replyErr) || replyErr.Code == "" {
+		replyErr = &ReplyError{Code: CodeInternal, Message: err.Error()}
+	}
+	response := nats.NewMsg(msg.Reply)
+	response.Header[HeaderReplyError] = []string{replyErr.Message}
+	response.Header[HeaderReplyErrorCode] = []string{replyErr.Code}
+	if err := msg.RespondMsg(response); err != nil {
+		fmt.Printf("NATS :: failed to reply on %s: %v\n", msg.Subject, err)
+	}
+}
@@ -2,6 +2,7 @@ package redisdriver
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"time"
 
@@ -37,13 +38,40 @@ func (d *Driver) Close() error {
 }
 
 func (d *Driver) Get(key string) ([]byte, error) {
-	return d.client.Get(context.Background(), key).Bytes()
+	value, err := d.client.Get(context.Background(), key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, ErrKeyNotFound
+	}
+	return value, err
 }
 
 func (d *Driver) Set(key string, value []byte, expiration time.Duration) error {
 	return d.client.Set(context.Background(), key, value, expiration).Err()
 }
 
+func (d *Driver) Delete(key string) error {
+	return d.client.Del(context.Background(), key).Err()
+}
+
+// Eval runs a Lua script atomically on the server and returns its reply.
+func (d *Driver) Eval(script string, keys []string, args ...any) (any, error) {
+	return d.client.Eval(context.Background(), script, keys, args...).Result()
+}
+
+// Keys returns the keys matching a glob pattern. Unlike GetAll it uses SCAN,
+// so it does not block the server on large databases.
+func (d *Driver) Keys(pattern string) ([]string, error) {
+	var keys []string
+	iter := d.client.Scan(context.Background(), 0, pattern, 100).Iterator()
+	for iter.Next(context.Background()) {
+		keys = append(keys, iter.Val())
+	}
+	if err := iter.Err(); err != nil {
+		return nil, fmt.Errorf("failed to scan keys %s: %w", pattern, err)
+	}
+	return keys, nil
+}
+
 func (d *Driver) GetAll() ([]string, error) {
 	keys, err := d.client.Keys(context.Background(), "*").Result()
 	if err != nil {
@@ -0,0 +1,123 @@
+package redisdriver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	redis "github.com/go-redis/redis/v8"
+)
+
+// StreamMessage is an entry read from a Redis stream.
+type StreamMessage struct {
+	ID     string
+	Values map[string]string
+}
+
+// StreamAdd appends values to a stream. A positive maxLen trims the stream
+// to approximately that many entries.
+func (d *Driver) StreamAdd(stream string, maxLen int64, values map[string]any) (string, error) {
+	args := &redis.XAddArgs{
+		Stream: stream,
+		Values: values,
+	}
+	if maxLen > 0 {
+		args.MaxLen = maxLen
+		args.Approx = true
+	}
+	id, err := d.client.XAdd(context.Background(), args).Result()
+	if err != nil {
+		return "", fmt.Errorf("failed to add to stream %s: %w", stream, err)
+	}
+	return id, nil
+}
+
+// StreamCreateGroup creates a consumer group reading stream from start,
+// creating the stream if needed. An existing group is not an error.
+func (d *Driver) StreamCreateGroup(stream, group, start string) error {
+	err := d.client.XGroupCreateMkStream(context.Background(), stream, group, start).Err()
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return fmt.Errorf("failed to create group %s on %s: %w", group, stream, err)
+	}
+	return nil
+}
+
+// StreamReadGroup reads up to count new entries for consumer, blocking for
+// at most block. It returns no messages and no error when block elapses.
+func (d *Driver) StreamReadGroup(ctx context.Context, stream, group, consumer string, count int64, block time.Duration) ([]StreamMessage, error) {
+	streams, err := d.client.XReadGroup(ctx, &redis.XReadGroupArgs{
+		Group:    group,
+		Consumer: consumer,
+		Streams:  []string{stream, ">"},
+		Count:    count,
+		Block:    block,
+	}).Result()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read group %s on %s: %w", group, stream, err)
+	}
+
+	var messages []StreamMessage
+	for _, s := range streams {
+		messages = append(messages, toStreamMessages(s.Messages)...)
+	}
+	return messages, nil
+}
+
+// StreamAck acknowledges entries so they leave the group's pending list.
+func (d *Driver) StreamAck(stream, group string, ids ...string) error {
+	if err := d.client.XAck(context.Background(), stream, group, ids...).Err(); err != nil {
+		return fmt.Errorf("failed to ack %v on %s: %w", ids, stream, err)
+	}
+	return nil
+}
+
+// StreamAutoClaim transfers pending entries idle for at least minIdle to
+// consumer, starting at start. It returns the claimed entries and the cursor
+// for the next call, which is "0-0" once the pending list is exhausted.
+//
+// The reply is parsed by hand because Redis 7 added a third element that the
+// typed XAutoClaim of go-redis v8 rejects.
+func (d *Driver) StreamAutoClaim(ctx context.Context, stream, group, consumer string, minIdle time.Duration, start string, count int64) ([]StreamMessage, string, error) {
+	reply, err := d.client.Do(ctx, "XAUTOCLAIM", stream, group, consumer, minIdle.Milliseconds(), start, "COUNT", count).Slice()
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to claim pending entries on %s: %w", stream, err)
+	}
+	if len(reply) < 2 {
+		return nil, "", fmt.Errorf("failed to claim pending entries on %s: unexpected reply %v", stream, reply)
+	}
+	next, _ := reply[0].(string)
+	entries, _ := reply[1].([]any)
+
+	messages := make([]StreamMessage, 0, len(entries))
+	for _, entry := range entries {
+		fields, ok := entry.([]any)
+		if !ok || len(fields) != 2 {
+			continue
+		}
+		id, _ := fields[0].(string)
+		pairs, _ := fields[1].([]any)
+		values := make(map[string]string, len(pairs)/2)
+		for i := 0; i+1 < len(pairs); i += 2 {
+			values[fmt.Sprint(pairs[i])] = fmt.Sprint(pairs[i+1])
+		}
+		messages = append(messages, StreamMessage{ID: id, Values: values})
+	}
+	return messages, next, nil
+}
+
+func toStreamMessages(messages []redis.XMessage) []StreamMessage {
+	result := make([]StreamMessage, 0, len(messages))
+	for _, msg := range messages {
+		values := make(map[string]string, len(msg.Values))
+		for key, value := range msg.Values {
+			values[key] = fmt.Sprint(value)
+		}
+		result = append(result, StreamMessage{ID: msg.ID, Values: values})
+	}
+	return result
+}